@@ -0,0 +1,172 @@
+// Команда importer загружает файл урлов в CSV или NDJSON в сервис сокращения ссылок
+// и ждет завершения задачи импорта, печатая прогресс и отчет об ошибках по строкам.
+//
+// Использование:
+//
+//	importer -a http://localhost:8080 -token <jwt> -f links.csv
+//
+// Формат определяется по расширению файла (.csv, .ndjson, .jsonl) или задается флагом -format.
+// Без токена сервис создаст нового пользователя, токен которого будет напечатан.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	address := flag.String("a", "http://localhost:8080", "server base address")
+	filename := flag.String("f", "", "file to import")
+	format := flag.String("format", "", "file format: csv or ndjson, by default detected from the file extension")
+	token := flag.String("token", os.Getenv("IMPORT_TOKEN"), "user token, defaults to IMPORT_TOKEN")
+	pollInterval := flag.Duration("poll", 2*time.Second, "job progress polling interval")
+	flag.Parse()
+
+	if *filename == "" {
+		return errors.New("file is required, use -f")
+	}
+	if *format == "" {
+		*format = formatByExtension(*filename)
+	}
+	if *format != models.ImportFormatCSV && *format != models.ImportFormatNDJSON {
+		return fmt.Errorf("unknown format %q, use -format csv or -format ndjson", *format)
+	}
+
+	baseURL, err := url.Parse(*address)
+	if err != nil {
+		return fmt.Errorf("invalid server address: %w", err)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		jar.SetCookies(baseURL, []*http.Cookie{{Name: "token", Value: *token}})
+	}
+	client := &http.Client{Jar: jar}
+
+	job, location, err := upload(client, baseURL, *filename, *format)
+	if err != nil {
+		return err
+	}
+	if *token == "" {
+		for _, cookie := range jar.Cookies(baseURL) {
+			if cookie.Name == "token" {
+				fmt.Printf("Links are imported for a new user, token: %s\n", cookie.Value)
+			}
+		}
+	}
+	fmt.Printf("Import job %d started\n", job.ID)
+
+	for job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning {
+		time.Sleep(*pollInterval)
+
+		job, err = poll(client, location)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: processed %d, imported %d, failed %d\n", job.Status, job.Processed, job.Succeeded, job.Failed)
+	}
+
+	for _, lineErr := range job.Errors {
+		fmt.Printf("line %d: %s\n", lineErr.Line, lineErr.Error)
+	}
+	if job.ErrorsTruncated {
+		fmt.Printf("... only first %d of %d line errors are reported\n", len(job.Errors), job.Failed)
+	}
+
+	if job.Status == models.JobStatusFailed {
+		return fmt.Errorf("import job %d failed: %s", job.ID, job.Error)
+	}
+	return nil
+}
+
+// formatByExtension - определяет формат файла импорта по расширению.
+func formatByExtension(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return models.ImportFormatCSV
+	case ".ndjson", ".jsonl":
+		return models.ImportFormatNDJSON
+	}
+	return ""
+}
+
+// upload - отправляет файл потоком и возвращает созданную задачу и адрес ее прогресса.
+func upload(client *http.Client, baseURL *url.URL, filename string, format string) (*models.Job, *url.URL, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	importURL := baseURL.JoinPath("/api/user/imports")
+	importURL.RawQuery = url.Values{"format": {format}}.Encode()
+
+	resp, err := client.Post(importURL.String(), "application/octet-stream", file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, nil, fmt.Errorf("import request failed: %s", readError(resp))
+	}
+
+	var job models.Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, nil, err
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &job, location, nil
+}
+
+// poll - запрашивает прогресс задачи импорта.
+func poll(client *http.Client, location *url.URL) (*models.Job, error) {
+	resp, err := client.Get(location.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("job progress request failed: %s", readError(resp))
+	}
+
+	var job models.Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// readError - возвращает статус и текст ответа с ошибкой.
+func readError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return strings.TrimSpace(resp.Status + " " + string(body))
+}
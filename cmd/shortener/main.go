@@ -19,6 +19,8 @@ import (
 	"github.com/nu-kotov/URLcompressor/internal/app/logger"
 	"github.com/nu-kotov/URLcompressor/internal/app/proto"
 	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"github.com/nu-kotov/URLcompressor/internal/app/urlpolicy"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc"
 )
@@ -66,6 +68,16 @@ func run() error {
 	}
 
 	service := service.NewURLService(*config, store)
+	if config.DomainPolicyFile != "" {
+		policy, err := urlpolicy.Load(config.DomainPolicyFile)
+		if err != nil {
+			return fmt.Errorf("error loading domain policy: %w", err)
+		}
+		service.Policy = policy
+		if config.DomainPolicyReloadInterval > 0 {
+			service.WatchPolicy(config.DomainPolicyReloadInterval)
+		}
+	}
 	HTTPHandler := handler.NewHandler(*config, service, store, trustedSubnet)
 	router := handler.NewRouter(*HTTPHandler)
 
@@ -119,10 +131,6 @@ func run() error {
 
 	logger.Log.Info("shutdown signal received...")
 
-	if err := service.Storage.Close(); err != nil {
-		return fmt.Errorf("error closing store: %w", err)
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -136,5 +144,17 @@ func run() error {
 	}
 	close(idleConnsClosed)
 
+	// фоновые задачи сервиса останавливаются, а очередь удаления дорабатывается после остановки серверов,
+	// чтобы не поступали новые переходы и сообщения, и до закрытия хранилища.
+	if err := service.Shutdown(ctx); err != nil {
+		logger.Log.Info("service wasn't stopped gracefully, the rest is left in storage", zap.Error(err))
+	} else {
+		logger.Log.Info("service stopped, clicks flushed and deletion queue drained")
+	}
+
+	if err := service.Storage.Close(); err != nil {
+		return fmt.Errorf("error closing store: %w", err)
+	}
+
 	return nil
 }
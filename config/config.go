@@ -6,8 +6,47 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"time"
 )
 
+// Значения по умолчанию для агрегации переходов и сроков хранения аналитики.
+const (
+	defaultClicksRollupInterval  = 10 * time.Minute
+	defaultClicksRawRetention    = 90 * 24 * time.Hour
+	defaultClicksHourlyRetention = 365 * 24 * time.Hour
+)
+
+// Значения по умолчанию для проверки доступности адресов назначения.
+const (
+	defaultHealthCheckInterval     = 10 * time.Minute
+	defaultHealthRecheckAfter      = 24 * time.Hour
+	defaultHealthCheckConcurrency  = 8
+	defaultHealthCheckHostInterval = time.Second
+	defaultHealthCheckTimeout      = 10 * time.Second
+)
+
+// Значения по умолчанию для корзины удаленных урлов.
+const (
+	defaultTrashRetention     = 30 * 24 * time.Hour
+	defaultTrashPurgeInterval = time.Hour
+)
+
+// Значения по умолчанию для обработчика очереди удаления урлов.
+const (
+	defaultDeletionFlushInterval = 10 * time.Second
+	defaultDeletionBatchSize     = 1000
+	defaultDeletionConcurrency   = 1
+	defaultDeletionMaxAttempts   = 5
+	defaultDeletionRetryBackoff  = time.Second
+)
+
+// defaultImportMaxBytes - максимальный размер файла импорта урлов по умолчанию.
+const defaultImportMaxBytes = 32 << 20
+
+// defaultDomainPolicyReloadInterval - период проверки изменений файла политики доменов по умолчанию.
+const defaultDomainPolicyReloadInterval = 5 * time.Second
+
 // Config - структура конфигурации проекта.
 type Config struct {
 	RunAddr            string
@@ -18,6 +57,48 @@ type Config struct {
 	ConfigFileName     string
 	TrustedSubnet      string
 	GRPCServerAddress  string
+	IPHashSalt         string
+	// ClicksRollupInterval - период агрегации переходов, 0 - агрегация выключена.
+	ClicksRollupInterval time.Duration
+	// ClicksRawRetention, ClicksHourlyRetention, ClicksDailyRetention - сроки хранения
+	// сырых событий перехода, часовых и дневных агрегатов, 0 - хранить бессрочно.
+	ClicksRawRetention    time.Duration
+	ClicksHourlyRetention time.Duration
+	ClicksDailyRetention  time.Duration
+	// HealthCheckInterval - период проверки адресов назначения, 0 - проверка выключена.
+	HealthCheckInterval time.Duration
+	// HealthRecheckAfter - через сколько перепроверять адрес назначения.
+	HealthRecheckAfter time.Duration
+	// HealthCheckConcurrency - количество одновременных проверок.
+	HealthCheckConcurrency int
+	// HealthCheckHostInterval - минимальный интервал между запросами проверки к одному хосту.
+	HealthCheckHostInterval time.Duration
+	// HealthCheckTimeout - таймаут запроса проверки.
+	HealthCheckTimeout time.Duration
+	// HealthWebhookURL - вебхук для уведомлений владельцев о сломанных ссылках, пустой - без уведомлений.
+	HealthWebhookURL string
+	// DomainPolicyFile - файл со списками разрешенных и запрещенных доменов адресов назначения, пустой - без ограничений.
+	DomainPolicyFile string
+	// DomainPolicyReloadInterval - период проверки изменений файла политики доменов, 0 - без перечитывания.
+	DomainPolicyReloadInterval time.Duration
+	// TrashRetention - сколько удаленные урлы хранятся в корзине до безвозвратного удаления, 0 - хранить бессрочно.
+	TrashRetention time.Duration
+	// TrashPurgeInterval - период очистки корзины от урлов с истекшим сроком хранения.
+	TrashPurgeInterval time.Duration
+	// DeletionFlushInterval - период разбора очереди удаления урлов.
+	DeletionFlushInterval time.Duration
+	// DeletionBatchSize - максимальное количество сообщений очереди удаления, обрабатываемых за раз.
+	DeletionBatchSize int
+	// DeletionConcurrency - количество одновременных обработчиков очереди удаления.
+	DeletionConcurrency int
+	// DeletionMaxAttempts - количество попыток обработки сообщения очереди удаления,
+	// после которых оно переносится в очередь недоставленных.
+	DeletionMaxAttempts int
+	// DeletionRetryBackoff - задержка перед первым повтором сообщения очереди удаления,
+	// каждая следующая задержка вдвое больше предыдущей.
+	DeletionRetryBackoff time.Duration
+	// ImportMaxBytes - максимальный размер файла импорта урлов в байтах, 0 - без ограничения.
+	ImportMaxBytes int
 }
 
 // FileConfig - структура конфигурации проекта из файла json.
@@ -30,6 +111,33 @@ type JSONFileConfig struct {
 	ConfigFileName     string `json:"config_file_name"`
 	TrustedSubnet      string `json:"trusted_subnet"`
 	GRPCServerAddress  string `json:"jrpc_server_address"`
+	IPHashSalt         string `json:"ip_hash_salt"`
+	// Длительности задаются строкой в формате time.ParseDuration, например "720h".
+	ClicksRollupInterval  string `json:"clicks_rollup_interval"`
+	ClicksRawRetention    string `json:"clicks_raw_retention"`
+	ClicksHourlyRetention string `json:"clicks_hourly_retention"`
+	ClicksDailyRetention  string `json:"clicks_daily_retention"`
+
+	HealthCheckInterval     string `json:"health_check_interval"`
+	HealthRecheckAfter      string `json:"health_recheck_after"`
+	HealthCheckConcurrency  int    `json:"health_check_concurrency"`
+	HealthCheckHostInterval string `json:"health_check_host_interval"`
+	HealthCheckTimeout      string `json:"health_check_timeout"`
+	HealthWebhookURL        string `json:"health_webhook_url"`
+
+	DomainPolicyFile           string `json:"domain_policy_file"`
+	DomainPolicyReloadInterval string `json:"domain_policy_reload_interval"`
+
+	TrashRetention     string `json:"trash_retention"`
+	TrashPurgeInterval string `json:"trash_purge_interval"`
+
+	DeletionFlushInterval string `json:"deletion_flush_interval"`
+	DeletionBatchSize     int    `json:"deletion_batch_size"`
+	DeletionConcurrency   int    `json:"deletion_concurrency"`
+	DeletionMaxAttempts   int    `json:"deletion_max_attempts"`
+	DeletionRetryBackoff  string `json:"deletion_retry_backoff"`
+
+	ImportMaxBytes int `json:"import_max_bytes"`
 }
 
 // NewConfig - конструктор конфигурации проекта.
@@ -45,6 +153,27 @@ func NewConfig() (*Config, error) {
 	flag.BoolVar(&config.EnableHTTPS, "s", false, "Enable HTTPS connection")
 	flag.StringVar(&config.TrustedSubnet, "t", "", "Trusted subnet in CIDR format")
 	flag.StringVar(&config.GRPCServerAddress, "j", "localhost:50051", "jrpc server address")
+	flag.StringVar(&config.IPHashSalt, "ip-hash-salt", "", "Salt for hashing visitors IP in click analytics")
+	flag.DurationVar(&config.ClicksRollupInterval, "clicks-rollup-interval", defaultClicksRollupInterval, "Interval of clicks rollup job, 0 disables it")
+	flag.DurationVar(&config.ClicksRawRetention, "clicks-raw-retention", defaultClicksRawRetention, "Retention of raw click events, 0 keeps them forever")
+	flag.DurationVar(&config.ClicksHourlyRetention, "clicks-hourly-retention", defaultClicksHourlyRetention, "Retention of hourly click rollups, 0 keeps them forever")
+	flag.DurationVar(&config.ClicksDailyRetention, "clicks-daily-retention", 0, "Retention of daily click rollups, 0 keeps them forever")
+	flag.DurationVar(&config.HealthCheckInterval, "health-check-interval", defaultHealthCheckInterval, "Interval of destination health checks, 0 disables them")
+	flag.DurationVar(&config.HealthRecheckAfter, "health-recheck-after", defaultHealthRecheckAfter, "How often each destination is rechecked")
+	flag.IntVar(&config.HealthCheckConcurrency, "health-check-concurrency", defaultHealthCheckConcurrency, "Number of concurrent destination health checks")
+	flag.DurationVar(&config.HealthCheckHostInterval, "health-check-host-interval", defaultHealthCheckHostInterval, "Minimal interval between health check requests to one host")
+	flag.DurationVar(&config.HealthCheckTimeout, "health-check-timeout", defaultHealthCheckTimeout, "Timeout of destination health check request")
+	flag.StringVar(&config.HealthWebhookURL, "health-webhook-url", "", "Webhook for broken destination notifications")
+	flag.StringVar(&config.DomainPolicyFile, "domain-policy-file", "", "File with allowed and denied destination domains")
+	flag.DurationVar(&config.DomainPolicyReloadInterval, "domain-policy-reload-interval", defaultDomainPolicyReloadInterval, "Interval of domain policy file change checks, 0 disables reload")
+	flag.DurationVar(&config.TrashRetention, "trash-retention", defaultTrashRetention, "Retention of deleted URLs in trash before purge, 0 keeps them forever")
+	flag.DurationVar(&config.TrashPurgeInterval, "trash-purge-interval", defaultTrashPurgeInterval, "Interval of trash purge job")
+	flag.DurationVar(&config.DeletionFlushInterval, "deletion-flush-interval", defaultDeletionFlushInterval, "Interval of flushing queued URL deletions")
+	flag.IntVar(&config.DeletionBatchSize, "deletion-batch-size", defaultDeletionBatchSize, "Max number of queued URL deletions processed at once")
+	flag.IntVar(&config.DeletionConcurrency, "deletion-concurrency", defaultDeletionConcurrency, "Number of concurrent URL deletion workers")
+	flag.IntVar(&config.DeletionMaxAttempts, "deletion-max-attempts", defaultDeletionMaxAttempts, "Attempts of URL deletion before it is moved to dead letters")
+	flag.DurationVar(&config.DeletionRetryBackoff, "deletion-retry-backoff", defaultDeletionRetryBackoff, "Delay before the first URL deletion retry, doubled on each next one")
+	flag.IntVar(&config.ImportMaxBytes, "import-max-bytes", defaultImportMaxBytes, "Max size of URLs import file in bytes, 0 disables the limit")
 
 	if envConfigFileName := os.Getenv("CONFIG"); envConfigFileName != "" {
 		config.ConfigFileName = envConfigFileName
@@ -71,6 +200,62 @@ func NewConfig() (*Config, error) {
 	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
 		config.TrustedSubnet = envTrustedSubnet
 	}
+	if envIPHashSalt := os.Getenv("IP_HASH_SALT"); envIPHashSalt != "" {
+		config.IPHashSalt = envIPHashSalt
+	}
+
+	durationEnvs := map[string]*time.Duration{
+		"CLICKS_ROLLUP_INTERVAL":  &config.ClicksRollupInterval,
+		"CLICKS_RAW_RETENTION":    &config.ClicksRawRetention,
+		"CLICKS_HOURLY_RETENTION": &config.ClicksHourlyRetention,
+		"CLICKS_DAILY_RETENTION":  &config.ClicksDailyRetention,
+
+		"HEALTH_CHECK_INTERVAL":      &config.HealthCheckInterval,
+		"HEALTH_RECHECK_AFTER":       &config.HealthRecheckAfter,
+		"HEALTH_CHECK_HOST_INTERVAL": &config.HealthCheckHostInterval,
+		"HEALTH_CHECK_TIMEOUT":       &config.HealthCheckTimeout,
+
+		"DOMAIN_POLICY_RELOAD_INTERVAL": &config.DomainPolicyReloadInterval,
+
+		"TRASH_RETENTION":      &config.TrashRetention,
+		"TRASH_PURGE_INTERVAL": &config.TrashPurgeInterval,
+
+		"DELETION_FLUSH_INTERVAL": &config.DeletionFlushInterval,
+		"DELETION_RETRY_BACKOFF":  &config.DeletionRetryBackoff,
+	}
+	for name, value := range durationEnvs {
+		if env := os.Getenv(name); env != "" {
+			d, err := time.ParseDuration(env)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s error: %w", name, err)
+			}
+			*value = d
+		}
+	}
+	intEnvs := map[string]*int{
+		"HEALTH_CHECK_CONCURRENCY": &config.HealthCheckConcurrency,
+
+		"DELETION_BATCH_SIZE":   &config.DeletionBatchSize,
+		"DELETION_CONCURRENCY":  &config.DeletionConcurrency,
+		"DELETION_MAX_ATTEMPTS": &config.DeletionMaxAttempts,
+
+		"IMPORT_MAX_BYTES": &config.ImportMaxBytes,
+	}
+	for name, value := range intEnvs {
+		if env := os.Getenv(name); env != "" {
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s error: %w", name, err)
+			}
+			*value = n
+		}
+	}
+	if envHealthWebhookURL := os.Getenv("HEALTH_WEBHOOK_URL"); envHealthWebhookURL != "" {
+		config.HealthWebhookURL = envHealthWebhookURL
+	}
+	if envDomainPolicyFile := os.Getenv("DOMAIN_POLICY_FILE"); envDomainPolicyFile != "" {
+		config.DomainPolicyFile = envDomainPolicyFile
+	}
 
 	flag.Parse()
 
@@ -110,6 +295,62 @@ func NewConfig() (*Config, error) {
 		if config.TrustedSubnet == "" {
 			config.TrustedSubnet = jsonConfig.TrustedSubnet
 		}
+		if config.IPHashSalt == "" {
+			config.IPHashSalt = jsonConfig.IPHashSalt
+		}
+
+		durationJSONs := []struct {
+			value        *time.Duration
+			defaultValue time.Duration
+			jsonValue    string
+		}{
+			{&config.ClicksRollupInterval, defaultClicksRollupInterval, jsonConfig.ClicksRollupInterval},
+			{&config.ClicksRawRetention, defaultClicksRawRetention, jsonConfig.ClicksRawRetention},
+			{&config.ClicksHourlyRetention, defaultClicksHourlyRetention, jsonConfig.ClicksHourlyRetention},
+			{&config.ClicksDailyRetention, 0, jsonConfig.ClicksDailyRetention},
+			{&config.HealthCheckInterval, defaultHealthCheckInterval, jsonConfig.HealthCheckInterval},
+			{&config.HealthRecheckAfter, defaultHealthRecheckAfter, jsonConfig.HealthRecheckAfter},
+			{&config.HealthCheckHostInterval, defaultHealthCheckHostInterval, jsonConfig.HealthCheckHostInterval},
+			{&config.HealthCheckTimeout, defaultHealthCheckTimeout, jsonConfig.HealthCheckTimeout},
+			{&config.DomainPolicyReloadInterval, defaultDomainPolicyReloadInterval, jsonConfig.DomainPolicyReloadInterval},
+			{&config.TrashRetention, defaultTrashRetention, jsonConfig.TrashRetention},
+			{&config.TrashPurgeInterval, defaultTrashPurgeInterval, jsonConfig.TrashPurgeInterval},
+			{&config.DeletionFlushInterval, defaultDeletionFlushInterval, jsonConfig.DeletionFlushInterval},
+			{&config.DeletionRetryBackoff, defaultDeletionRetryBackoff, jsonConfig.DeletionRetryBackoff},
+		}
+		for _, d := range durationJSONs {
+			if *d.value != d.defaultValue || d.jsonValue == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(d.jsonValue)
+			if err != nil {
+				return nil, fmt.Errorf("parsing config json duration error: %w", err)
+			}
+			*d.value = parsed
+		}
+
+		intJSONs := []struct {
+			value        *int
+			defaultValue int
+			jsonValue    int
+		}{
+			{&config.HealthCheckConcurrency, defaultHealthCheckConcurrency, jsonConfig.HealthCheckConcurrency},
+			{&config.DeletionBatchSize, defaultDeletionBatchSize, jsonConfig.DeletionBatchSize},
+			{&config.DeletionConcurrency, defaultDeletionConcurrency, jsonConfig.DeletionConcurrency},
+			{&config.DeletionMaxAttempts, defaultDeletionMaxAttempts, jsonConfig.DeletionMaxAttempts},
+			{&config.ImportMaxBytes, defaultImportMaxBytes, jsonConfig.ImportMaxBytes},
+		}
+		for _, n := range intJSONs {
+			if *n.value == n.defaultValue && n.jsonValue != 0 {
+				*n.value = n.jsonValue
+			}
+		}
+		if config.HealthWebhookURL == "" {
+			config.HealthWebhookURL = jsonConfig.HealthWebhookURL
+		}
+		if config.DomainPolicyFile == "" {
+			config.DomainPolicyFile = jsonConfig.DomainPolicyFile
+		}
 		config.EnableHTTPS = jsonConfig.EnableHTTPS
 	}
 
@@ -1,22 +1,66 @@
 package handler
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"html/template"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/nu-kotov/URLcompressor/config"
 	"github.com/nu-kotov/URLcompressor/internal/app/api/service"
+	"github.com/nu-kotov/URLcompressor/internal/app/api/utils"
 	"github.com/nu-kotov/URLcompressor/internal/app/auth"
+	"github.com/nu-kotov/URLcompressor/internal/app/botdetect"
 	"github.com/nu-kotov/URLcompressor/internal/app/logger"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/qrcode"
 	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"github.com/nu-kotov/URLcompressor/internal/app/urlpolicy"
 	"go.uber.org/zap"
 )
 
+const (
+	// variantCookiePrefix - префикс имени куки с закрепленным вариантом назначения короткого урла.
+	variantCookiePrefix = "variant_"
+	// variantCookieMaxAge - время жизни куки с закрепленным вариантом, в секундах.
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+	// clicksExportCSV и clicksExportNDJSON - форматы выгрузки событий перехода.
+	clicksExportCSV    = "csv"
+	clicksExportNDJSON = "ndjson"
+)
+
+// takedownPage - страница ответа 451 по заблокированному модератором урлу.
+var takedownPage = template.Must(template.New("takedown").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Ссылка заблокирована</title></head>
+<body>
+<h1>Ссылка заблокирована</h1>
+<p>Короткая ссылка {{.ShortURL}} заблокирована модератором сервиса по жалобе и больше не ведет на исходный адрес.</p>
+<p>Причина: {{.Reason}}</p>
+<p>Дата блокировки: {{.At.Format "2006-01-02"}}</p>
+</body>
+</html>
+`))
+
+// clicksCSVHeader - заголовок выгрузки событий перехода в CSV.
+var clicksCSVHeader = []string{
+	"id", "short_url", "clicked_at", "variant_id", "referrer", "referrer_host",
+	"user_agent", "ua_family", "ip_hash", "country", "is_bot",
+}
+
 // Handler - структура http хендлера для сокращения ссылок.
 type Handler struct {
 	Config        config.Config
@@ -37,22 +81,32 @@ func NewHandler(config config.Config, service service.Service, storage storage.S
 	return &hnd
 }
 
-// GetStats возвращает количество пользователей и урлов в сервисе.
-func (hnd *Handler) GetStats(res http.ResponseWriter, req *http.Request) {
+// checkTrustedSubnet - проверяет, что запрос пришел из доверенной подсети по заголовку X-Real-IP,
+// иначе отвечает 403. Возвращает false, если запрос отклонен.
+func (hnd *Handler) checkTrustedSubnet(res http.ResponseWriter, req *http.Request) bool {
 	if hnd.trustedSubnet == nil {
 		http.Error(res, "trustedSubnet is nil", http.StatusForbidden)
-		return
+		return false
 	}
 
 	headerIPStr := req.Header.Get("X-Real-IP")
 	if headerIPStr == "" {
 		res.WriteHeader(http.StatusForbidden)
-		return
+		return false
 	}
 
 	ip := net.ParseIP(headerIPStr)
 	if ip == nil || !hnd.trustedSubnet.Contains(ip) {
 		http.Error(res, "Not trusted IP", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// GetStats возвращает количество пользователей и урлов в сервисе.
+func (hnd *Handler) GetStats(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
 		return
 	}
 
@@ -80,17 +134,115 @@ func (hnd *Handler) GetStats(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// DeleteUserURLs помещает список ID урлов ["IhqFu4fdBD9w", "50ZT5FOYE6y"] в канал для удаления.
+// userURLsRequest - разбирает параметры поиска и пагинации урлов пользователя из запроса.
+func userURLsRequest(req *http.Request) (models.UserURLsRequest, error) {
+	query := req.URL.Query()
+	urlsReq := models.UserURLsRequest{
+		Query:       query.Get("q"),
+		Tags:        query["tag"],
+		Domain:      query.Get("domain"),
+		CreatedFrom: query.Get("created_from"),
+		CreatedTo:   query.Get("created_to"),
+		State:       query.Get("state"),
+		Sort:        query.Get("sort"),
+		Cursor:      query.Get("cursor"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		urlsReq.Limit, err = strconv.Atoi(limit)
+		if err != nil || urlsReq.Limit <= 0 {
+			return urlsReq, errors.New("limit must be a positive integer")
+		}
+	}
+	return urlsReq, nil
+}
+
+// GetTrashURLs возвращает пользователю страницу его удаленных урлов с моментом их безвозвратного удаления.
+// Поддерживает те же параметры поиска и пагинации, что и GetUserURLs.
+func (hnd *Handler) GetTrashURLs(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	urlsReq, err := userURLsRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := hnd.service.GetTrashURLs(req.Context(), userID, urlsReq)
+	if errors.Is(err, service.ErrInvalidURLsFilter) {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && len(page.URLs) == 0) {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		logger.Log.Info("Failed to get trash urls", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if page.NextCursor != "" {
+		res.Header().Set("Link", userURLsPageLink(req, page.NextCursor, "next"))
+	}
+	writeJSON(res, http.StatusOK, page.URLs)
+}
+
+// RestoreUserURLs восстанавливает из корзины удаленные урлы пользователя, переданные списком коротких урлов.
+func (hnd *Handler) RestoreUserURLs(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var urls []string
+	if err := json.NewDecoder(req.Body).Decode(&urls); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := hnd.service.RestoreUserURLs(req.Context(), userID, urls)
+	if err != nil {
+		logger.Log.Info("Failed to restore urls", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, resp)
+}
+
+// DeleteUserURLs помещает список ID урлов ["IhqFu4fdBD9w", "50ZT5FOYE6y"] в канал для удаления
+// и отдает задачу удаления, результат которой доступен по адресу из Location.
 func (hnd *Handler) DeleteUserURLs(res http.ResponseWriter, req *http.Request) {
 	token, err := req.Cookie("token")
 
 	if err != nil {
 		res.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
 	userID, err := auth.GetUserID(token.Value)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	body, err := io.ReadAll(req.Body)
@@ -104,31 +256,62 @@ func (hnd *Handler) DeleteUserURLs(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	res.WriteHeader(http.StatusAccepted)
+	job, err := hnd.service.SendURLsToDeletion(req.Context(), urls, userID)
+	if err != nil {
+		logger.Log.Info("Failed to start urls deletion", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	go hnd.service.SendURLsToDeletion(urls, userID)
+	res.Header().Set("Location", "/api/user/jobs/"+strconv.FormatInt(job.ID, 10))
+	writeJSON(res, http.StatusAccepted, job)
 }
 
 // GetUserURLs возвращает список сокращенных и полных урлов пользователя.
+// Параметры поиска: q - подстрока полного урла или названия, tag (можно несколько), domain,
+// created_from и created_to, state - active или deleted, sort - created_at, title или original_url, с "-" по убыванию.
 func (hnd *Handler) GetUserURLs(res http.ResponseWriter, req *http.Request) {
 
 	token, err := req.Cookie("token")
 
 	if err != nil {
 		res.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
 	userID, err := auth.GetUserID(token.Value)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	res.Header().Set("Content-Type", "application/json")
-	if data, err := hnd.service.GetUserURLs(req.Context(), userID); data != nil {
+	urlsReq, err := userURLsRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
-		}
+	page, err := hnd.service.GetUserURLs(req.Context(), userID, urlsReq)
+	switch {
+	case errors.Is(err, service.ErrInvalidURLsFilter):
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		res.WriteHeader(http.StatusNoContent)
+		return
+	case err != nil:
+		logger.Log.Info("Failed to get user urls", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data := page.URLs
+	if page.NextCursor != "" {
+		res.Header().Set("Link", userURLsPageLink(req, page.NextCursor, "next"))
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if data != nil {
 
 		resp, err := json.Marshal(data)
 		if err != nil {
@@ -145,6 +328,305 @@ func (hnd *Handler) GetUserURLs(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// userURLsPageLink - значение заголовка Link со ссылкой на страницу урлов пользователя по курсору.
+func userURLsPageLink(req *http.Request, cursor string, rel string) string {
+	query := req.URL.Query()
+	query.Set("cursor", cursor)
+	link := url.URL{Path: req.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", link.String(), rel)
+}
+
+// UpdateURLMetadata меняет название, описание и теги урла пользователя.
+func (hnd *Handler) UpdateURLMetadata(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var updateReq models.UpdateURLMetadataRequest
+	if err := json.NewDecoder(req.Body).Decode(&updateReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := hnd.service.UpdateURLMetadata(req.Context(), userID, mux.Vars(req)["id"], updateReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidMetadata):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrURLNotOwned):
+			http.Error(res, err.Error(), http.StatusForbidden)
+		case errors.Is(err, service.ErrURLDeleted):
+			res.WriteHeader(http.StatusGone)
+		default:
+			logger.Log.Info("Failed to update url metadata", zap.Error(err))
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(res, http.StatusOK, updated)
+}
+
+// GetURLStats возвращает владельцу статистику переходов по короткому урлу.
+// Параметры: from, to (RFC3339 или 2006-01-02), tz (IANA), bucket (hour, day, week),
+// include_bots - учитывать ли переходы ботов (по умолчанию нет).
+func (hnd *Handler) GetURLStats(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statsReq, err := urlStatsRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := hnd.service.GetURLStats(req.Context(), userID, mux.Vars(req)["id"], statsReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidStatsParams):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrURLNotOwned):
+			http.Error(res, err.Error(), http.StatusForbidden)
+		default:
+			logger.Log.Info("Failed to get url stats", zap.Error(err))
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	respJSON, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(respJSON)
+}
+
+// urlStatsRequest - собирает параметры статистики переходов из query-параметров запроса.
+func urlStatsRequest(req *http.Request) (models.URLStatsRequest, error) {
+	query := req.URL.Query()
+	statsReq := models.URLStatsRequest{
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		Timezone: query.Get("tz"),
+		Bucket:   query.Get("bucket"),
+	}
+
+	if includeBots := query.Get("include_bots"); includeBots != "" {
+		var err error
+		statsReq.IncludeBots, err = strconv.ParseBool(includeBots)
+		if err != nil {
+			return statsReq, errors.New("invalid include_bots")
+		}
+	}
+
+	return statsReq, nil
+}
+
+// ExportClicks потоково выгружает владельцу события перехода по короткому урлу в CSV или NDJSON.
+// Параметры: from, to (RFC3339 или 2006-01-02), tz (IANA). Без периода выгружаются все события.
+func (hnd *Handler) ExportClicks(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(req)
+	query := req.URL.Query()
+	exportReq := models.ClicksExportRequest{
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+		Timezone: query.Get("tz"),
+	}
+
+	var (
+		started    bool
+		csvWriter  *csv.Writer
+		ndjsonEnc  *json.Encoder
+		format     = vars["format"]
+		flusher, _ = res.(http.Flusher)
+	)
+
+	writePage := func(page []models.ClickEvent) error {
+		if !started {
+			started = true
+			switch format {
+			case clicksExportCSV:
+				res.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				res.Header().Set("Content-Disposition", `attachment; filename="`+vars["id"]+`_clicks.csv"`)
+				res.WriteHeader(http.StatusOK)
+				csvWriter = csv.NewWriter(res)
+				if err := csvWriter.Write(clicksCSVHeader); err != nil {
+					return err
+				}
+			case clicksExportNDJSON:
+				res.Header().Set("Content-Type", "application/x-ndjson")
+				res.WriteHeader(http.StatusOK)
+				ndjsonEnc = json.NewEncoder(res)
+			}
+		}
+
+		for _, c := range page {
+			var err error
+			if csvWriter != nil {
+				err = csvWriter.Write(clickCSVRecord(c))
+			} else {
+				err = ndjsonEnc.Encode(c)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	err = hnd.service.ExportClicks(req.Context(), userID, vars["id"], exportReq, writePage)
+	if err == nil {
+		return
+	}
+	if started {
+		logger.Log.Info("Clicks export interrupted", zap.Error(err))
+		return
+	}
+
+	switch {
+	case errors.Is(err, service.ErrInvalidStatsParams):
+		http.Error(res, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(res, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrURLNotOwned):
+		http.Error(res, err.Error(), http.StatusForbidden)
+	default:
+		logger.Log.Info("Failed to export clicks", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// clickCSVRecord - строка выгрузки события перехода в CSV в порядке clicksCSVHeader.
+func clickCSVRecord(c models.ClickEvent) []string {
+	return []string{
+		strconv.FormatInt(c.ID, 10),
+		c.ShortURL,
+		c.ClickedAt.UTC().Format(time.RFC3339Nano),
+		c.VariantID,
+		c.Referrer,
+		c.ReferrerHost,
+		c.UserAgent,
+		c.UAFamily,
+		c.IPHash,
+		c.Country,
+		strconv.FormatBool(c.IsBot),
+	}
+}
+
+// GetQRCode возвращает QR-код короткого урла в PNG или SVG.
+// Формат задается параметром format или заголовком Accept, по умолчанию PNG.
+// Параметры: size (пиксели), margin (модули), ecc (L, M, Q, H), fg и bg (цвет в hex).
+func (hnd *Handler) GetQRCode(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	opts := qrcode.Options{
+		Format:     query.Get("format"),
+		Level:      query.Get("ecc"),
+		Foreground: query.Get("fg"),
+		Background: query.Get("bg"),
+	}
+
+	if opts.Format == "" {
+		opts.Format = negotiateQRFormat(req.Header.Get("Accept"))
+	}
+
+	if size := query.Get("size"); size != "" {
+		var err error
+		opts.Size, err = strconv.Atoi(size)
+		if err != nil {
+			http.Error(res, "invalid size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if margin := query.Get("margin"); margin != "" {
+		m, err := strconv.Atoi(margin)
+		if err != nil {
+			http.Error(res, "invalid margin", http.StatusBadRequest)
+			return
+		}
+		opts.Margin = &m
+	}
+
+	img, err := hnd.service.GetQRCode(req.Context(), mux.Vars(req)["id"], opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, qrcode.ErrInvalidOptions):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrURLTakenDown):
+			http.Error(res, err.Error(), http.StatusUnavailableForLegalReasons)
+		case errors.Is(err, service.ErrURLDeleted), errors.Is(err, service.ErrURLExpired):
+			res.WriteHeader(http.StatusGone)
+		default:
+			logger.Log.Info("Failed to get qr code", zap.Error(err))
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	res.Header().Set("Content-Type", img.ContentType)
+	res.Header().Set("Cache-Control", "public, max-age=86400")
+	res.Header().Add("Vary", "Accept")
+	res.WriteHeader(http.StatusOK)
+	res.Write(img.Data)
+}
+
+// negotiateQRFormat - выбирает формат QR-кода по заголовку Accept: SVG, только если клиент не принимает PNG.
+func negotiateQRFormat(accept string) string {
+	if strings.Contains(accept, "image/svg+xml") && !strings.Contains(accept, "image/png") {
+		return qrcode.FormatSVG
+	}
+	return qrcode.FormatPNG
+}
+
 // GetShortURLsBatch сохраняет батч коротких урлов и возвращает его в качестве ответа.
 func (hnd *Handler) GetShortURLsBatch(res http.ResponseWriter, req *http.Request) {
 	if req.Method == http.MethodPost {
@@ -174,6 +656,9 @@ func (hnd *Handler) GetShortURLsBatch(res http.ResponseWriter, req *http.Request
 
 		response, err := hnd.service.GetShortURLsBatch(req.Context(), jsonBody, userID)
 		if err != nil {
+			if writeDestinationRejected(res, err) {
+				return
+			}
 			logger.Log.Info(err.Error())
 			http.Error(res, "Get short urls batch error", http.StatusInternalServerError)
 			return
@@ -192,6 +677,31 @@ func (hnd *Handler) GetShortURLsBatch(res http.ResponseWriter, req *http.Request
 	}
 }
 
+// writeDestinationRejected - отвечает 403 с причиной, если адрес назначения отклонен политикой доменов.
+// Возвращает false, если ошибка другая.
+func writeDestinationRejected(res http.ResponseWriter, err error) bool {
+	var rejection *urlpolicy.RejectionError
+	if !errors.As(err, &rejection) {
+		return false
+	}
+
+	respJSON, err := json.Marshal(models.DestinationRejectedResponse{
+		Error:  rejection.Error(),
+		Host:   rejection.Host,
+		Reason: rejection.Reason,
+		Rule:   rejection.Rule,
+	})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusForbidden)
+	res.Write(respJSON)
+	return true
+}
+
 // GetShortURL сохраняет сокращенный URL и возвращает его в качестве ответа.
 func (hnd *Handler) GetShortURL(res http.ResponseWriter, req *http.Request) {
 
@@ -230,6 +740,13 @@ func (hnd *Handler) GetShortURL(res http.ResponseWriter, req *http.Request) {
 				res.Write(respJSON)
 				return
 			}
+			if errors.Is(err, service.ErrInvalidVariants) || errors.Is(err, service.ErrInvalidRedirectOptions) || errors.Is(err, service.ErrInvalidMetadata) {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if writeDestinationRejected(res, err) {
+				return
+			}
 			logger.Log.Info(err.Error())
 			http.Error(res, "Inserting to db error", http.StatusInternalServerError)
 			return
@@ -280,6 +797,9 @@ func (hnd *Handler) CompressURL(res http.ResponseWriter, req *http.Request) {
 				io.WriteString(res, string(hnd.Config.BaseURL+"/"+shortID))
 				return
 			}
+			if writeDestinationRejected(res, err) {
+				return
+			}
 			logger.Log.Info(err.Error())
 			http.Error(res, "Inserting to db error", http.StatusInternalServerError)
 			return
@@ -295,27 +815,66 @@ func (hnd *Handler) CompressURL(res http.ResponseWriter, req *http.Request) {
 }
 
 // RedirectByShortURLID редиректит по ID короткого урла на страницу по оригинальному урлу.
+// Для урлов с вариантами назначения выбранный вариант закрепляется за посетителем в куке.
+// HEAD-запросы обрабатываются так же, как GET, но переход учитывается как переход бота.
 func (hnd *Handler) RedirectByShortURLID(res http.ResponseWriter, req *http.Request) {
 
-	if req.Method == http.MethodGet {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
 
 		params := mux.Vars(req)
 		shortURLID := params["id"]
 
-		originalURL, err := hnd.service.SelectOriginalURLByShortURL(req.Context(), shortURLID)
+		variantCookieName := variantCookiePrefix + shortURLID
+		var stickyVariantID string
+		if cookie, err := req.Cookie(variantCookieName); err == nil {
+			stickyVariantID = cookie.Value
+		}
+
+		target, err := hnd.service.GetRedirectTarget(req.Context(), shortURLID, stickyVariantID, req.URL.Query())
 		if err != nil {
+			var takedown *service.TakedownError
+			if errors.As(err, &takedown) {
+				res.Header().Set("Content-Type", "text/html; charset=utf-8")
+				res.WriteHeader(http.StatusUnavailableForLegalReasons)
+				if req.Method == http.MethodGet {
+					takedownPage.Execute(res, struct {
+						ShortURL string
+						*service.TakedownError
+					}{hnd.Config.BaseURL + "/" + shortURLID, takedown})
+				}
+				return
+			}
+			if errors.Is(err, service.ErrURLDeleted) || errors.Is(err, service.ErrURLExpired) {
+				res.WriteHeader(http.StatusGone)
+				return
+			}
 			logger.Log.Info(err.Error())
 			http.Error(res, "URLs select error", http.StatusInternalServerError)
 			return
 		}
 
-		if originalURL == "deleted" {
-			res.WriteHeader(http.StatusGone)
-			return
+		if target.VariantID != "" {
+			http.SetCookie(res, &http.Cookie{
+				Name:     variantCookieName,
+				Value:    target.VariantID,
+				Path:     "/" + shortURLID,
+				MaxAge:   variantCookieMaxAge,
+				HttpOnly: true,
+			})
 		}
 
-		res.Header().Set("Location", originalURL)
+		res.Header().Set("Location", target.OriginalURL)
 		res.WriteHeader(http.StatusTemporaryRedirect)
+
+		hnd.service.RecordClick(models.ClickEvent{
+			ShortURL:  shortURLID,
+			VariantID: target.VariantID,
+			ClickedAt: time.Now().UTC(),
+			Referrer:  req.Referer(),
+			UserAgent: req.UserAgent(),
+			Country:   models.UnknownCountry,
+			IsBot:     botdetect.IsBot(req),
+		}, utils.ClientIP(req))
 	} else {
 		res.WriteHeader(http.StatusBadRequest)
 	}
@@ -334,3 +893,1229 @@ func (hnd *Handler) PingDB(res http.ResponseWriter, req *http.Request) {
 		res.WriteHeader(http.StatusBadRequest)
 	}
 }
+
+// ReportURL принимает жалобу на короткий урл.
+func (hnd *Handler) ReportURL(res http.ResponseWriter, req *http.Request) {
+	var reportReq models.AbuseReportRequest
+	if err := json.NewDecoder(req.Body).Decode(&reportReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := hnd.service.ReportURL(req.Context(), mux.Vars(req)["id"], reportReq, utils.ClientIP(req))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAbuseReport):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, err.Error(), http.StatusNotFound)
+		default:
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, models.AbuseReportResponse{ID: report.ID, Status: report.Status})
+}
+
+// GetAbuseReports возвращает модератору из доверенной подсети страницу очереди жалоб.
+// Параметры запроса: status, url - короткий урл, after - идентификатор последней жалобы предыдущей страницы, limit.
+func (hnd *Handler) GetAbuseReports(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
+		return
+	}
+
+	query := req.URL.Query()
+	filter := models.AbuseReportsFilter{Status: query.Get("status"), ShortURL: query.Get("url")}
+
+	var err error
+	if after := query.Get("after"); after != "" {
+		if filter.AfterID, err = strconv.ParseInt(after, 10, 64); err != nil {
+			http.Error(res, "Invalid after param", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			http.Error(res, "Invalid limit param", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reports, err := hnd.service.GetAbuseReports(req.Context(), filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidModeration) {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Info("Failed to get abuse reports", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if reports == nil {
+		reports = []models.AbuseReport{}
+	}
+
+	writeJSON(res, http.StatusOK, reports)
+}
+
+// GetDeletionDeadLetters возвращает администратору из доверенной подсети страницу сообщений очереди удаления,
+// исчерпавших попытки обработки. Параметры запроса: after - идентификатор последнего сообщения
+// предыдущей страницы, limit.
+func (hnd *Handler) GetDeletionDeadLetters(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
+		return
+	}
+
+	query := req.URL.Query()
+
+	var afterID int64
+	var limit int
+	var err error
+	if after := query.Get("after"); after != "" {
+		if afterID, err = strconv.ParseInt(after, 10, 64); err != nil {
+			http.Error(res, "Invalid after param", http.StatusBadRequest)
+			return
+		}
+	}
+	if limitParam := query.Get("limit"); limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil {
+			http.Error(res, "Invalid limit param", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deadLetters, err := hnd.service.GetDeletionDeadLetters(req.Context(), afterID, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDeadLettersFilter) {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Info("Failed to get deletion dead letters", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deadLetters == nil {
+		deadLetters = []models.DeletionDeadLetter{}
+	}
+
+	writeJSON(res, http.StatusOK, deadLetters)
+}
+
+// ModerateAbuseReport выполняет действие модератора из доверенной подсети по жалобе.
+func (hnd *Handler) ModerateAbuseReport(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
+		return
+	}
+
+	reportID, err := strconv.ParseInt(mux.Vars(req)["rid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid report id", http.StatusBadRequest)
+		return
+	}
+
+	var moderationReq models.ModerationRequest
+	if err := json.NewDecoder(req.Body).Decode(&moderationReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := hnd.service.ModerateAbuseReport(req.Context(), reportID, moderationReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidModeration):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrAbuseReportResolved):
+			http.Error(res, err.Error(), http.StatusConflict)
+		default:
+			logger.Log.Info("Failed to moderate abuse report", zap.Error(err))
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(res, http.StatusOK, report)
+}
+
+// TakedownURL блокирует короткий урл по запросу модератора из доверенной подсети.
+func (hnd *Handler) TakedownURL(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
+		return
+	}
+
+	var takedownReq models.TakedownRequest
+	if err := json.NewDecoder(req.Body).Decode(&takedownReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hnd.writeModerationResult(res, hnd.service.TakedownURL(req.Context(), mux.Vars(req)["id"], takedownReq.Reason))
+}
+
+// RestoreURL снимает блокировку короткого урла по запросу модератора из доверенной подсети.
+func (hnd *Handler) RestoreURL(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
+		return
+	}
+
+	hnd.writeModerationResult(res, hnd.service.RestoreURL(req.Context(), mux.Vars(req)["id"]))
+}
+
+// writeModerationResult - отвечает на блокировку или разблокировку урла.
+func (hnd *Handler) writeModerationResult(res http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		res.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, service.ErrInvalidModeration):
+		http.Error(res, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(res, err.Error(), http.StatusNotFound)
+	default:
+		logger.Log.Info("Failed to update url takedown", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ExportUserData потоково выгружает пользователю все его урлы, включая удаленные, с метаданными и сводкой переходов.
+// Параметр format: zip (по умолчанию) - архив с links.ndjson и manifest.json, ndjson - только урлы.
+func (hnd *Handler) ExportUserData(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = models.UserExportZIP
+	}
+	if format != models.UserExportZIP && format != models.UserExportNDJSON {
+		http.Error(res, "Unknown export format, use format=zip or format=ndjson", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		started   bool
+		zipWriter *zip.Writer
+		linksEnc  *json.Encoder
+		links     int
+	)
+
+	start := func() error {
+		started = true
+		if format == models.UserExportNDJSON {
+			res.Header().Set("Content-Type", "application/x-ndjson")
+			res.Header().Set("Content-Disposition", `attachment; filename="export.ndjson"`)
+			res.WriteHeader(http.StatusOK)
+			linksEnc = json.NewEncoder(res)
+			return nil
+		}
+
+		res.Header().Set("Content-Type", "application/zip")
+		res.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+		res.WriteHeader(http.StatusOK)
+		zipWriter = zip.NewWriter(res)
+		linksFile, err := zipWriter.Create("links.ndjson")
+		if err != nil {
+			return err
+		}
+		linksEnc = json.NewEncoder(linksFile)
+		return nil
+	}
+
+	err = hnd.service.ExportUserData(req.Context(), userID, func(link models.UserExportLink) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		links++
+		return linksEnc.Encode(link)
+	})
+	if err != nil && !started {
+		logger.Log.Info("Failed to export user data", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil && zipWriter != nil {
+		err = writeExportManifest(zipWriter, models.UserExportManifest{UserID: userID, ExportedAt: time.Now().UTC(), Links: links})
+	}
+	if err != nil {
+		logger.Log.Info("User data export interrupted", zap.Error(err))
+	}
+}
+
+// writeExportManifest - дописывает в архив выгрузки manifest.json и закрывает архив.
+func writeExportManifest(zipWriter *zip.Writer, manifest models.UserExportManifest) error {
+	manifestFile, err := zipWriter.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(manifestFile).Encode(manifest); err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
+
+// ImportURLs принимает файл импорта урлов пользователя в CSV или NDJSON и запускает задачу импорта.
+// Формат берется из параметра format, а если он не задан - из Content-Type.
+// Тело сохраняется во временный файл, в ответ отдается задача, прогресс которой доступен по адресу из Location.
+// Тело больше Config.ImportMaxBytes отклоняется с кодом 413.
+func (hnd *Handler) ImportURLs(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := importFormat(req)
+	if format == "" {
+		http.Error(res, "Unknown import format, use format=csv or format=ndjson", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	file, err := os.CreateTemp("", "urls-import-*")
+	if err != nil {
+		logger.Log.Info("Failed to create import file", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body := req.Body
+	if hnd.Config.ImportMaxBytes > 0 {
+		body = http.MaxBytesReader(res, req.Body, int64(hnd.Config.ImportMaxBytes))
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(res, fmt.Sprintf("Import file is larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := hnd.service.StartURLsImport(req.Context(), userID, format, file.Name())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidImport) {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Info("Failed to start urls import", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Location", "/api/user/imports/"+strconv.FormatInt(job.ID, 10))
+	writeJSON(res, http.StatusAccepted, job)
+}
+
+// importFormat - возвращает формат файла импорта из параметра format или из Content-Type запроса.
+func importFormat(req *http.Request) string {
+	switch format := req.URL.Query().Get("format"); format {
+	case models.ImportFormatCSV, models.ImportFormatNDJSON:
+		return format
+	case "":
+	default:
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return models.ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return models.ImportFormatNDJSON
+	}
+	return ""
+}
+
+// GetJob возвращает пользователю состояние и результат его фоновой задачи любого вида.
+func (hnd *Handler) GetJob(res http.ResponseWriter, req *http.Request) {
+	hnd.writeUserJob(res, req, "")
+}
+
+// GetImportJob возвращает пользователю прогресс и отчет об ошибках задачи импорта.
+func (hnd *Handler) GetImportJob(res http.ResponseWriter, req *http.Request) {
+	hnd.writeUserJob(res, req, models.JobKindImport)
+}
+
+// EraseUser запускает безвозвратное удаление всех урлов, переходов и истории пользователя.
+// В ответ отдается задача удаления, итог которой доступен по адресу из Location.
+func (hnd *Handler) EraseUser(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := hnd.service.StartUserErasure(req.Context(), userID)
+	if errors.Is(err, service.ErrLastWorkspaceOwner) {
+		http.Error(res, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Log.Info("Failed to start user erasure", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Location", "/api/user/erasures/"+strconv.FormatInt(job.ID, 10))
+	writeJSON(res, http.StatusAccepted, job)
+}
+
+// GetErasureJob возвращает пользователю состояние и итог задачи удаления его данных.
+func (hnd *Handler) GetErasureJob(res http.ResponseWriter, req *http.Request) {
+	hnd.writeUserJob(res, req, models.JobKindErasure)
+}
+
+// CreateURLTransfer создает предложение передать урлы пользователя другому пользователю.
+// В ответе отдается токен, который владелец передает получателю.
+func (hnd *Handler) CreateURLTransfer(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var transferReq models.URLTransferRequest
+	if err := json.NewDecoder(req.Body).Decode(&transferReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := hnd.service.CreateURLTransfer(req.Context(), userID, transferReq)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTransfer):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrURLNotOwned):
+			http.Error(res, err.Error(), http.StatusForbidden)
+		case errors.Is(err, service.ErrURLDeleted):
+			res.WriteHeader(http.StatusGone)
+		default:
+			logger.Log.Info("Failed to create url transfer", zap.Error(err))
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, transfer)
+}
+
+// AcceptURLTransfer принимает предложение передачи по токену, урлы переходят к текущему пользователю.
+func (hnd *Handler) AcceptURLTransfer(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var acceptReq models.URLTransferAcceptRequest
+	if err := json.NewDecoder(req.Body).Decode(&acceptReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := hnd.service.AcceptURLTransfer(req.Context(), userID, acceptReq.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTransfer):
+			http.Error(res, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(res, "Transfer not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrTransferClosed):
+			http.Error(res, err.Error(), http.StatusConflict)
+		default:
+			logger.Log.Info("Failed to accept url transfer", zap.Error(err))
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(res, http.StatusOK, transfer)
+}
+
+// CancelURLTransfer отменяет ожидающее предложение передачи пользователя.
+func (hnd *Handler) CancelURLTransfer(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transferID, err := strconv.ParseInt(mux.Vars(req)["tid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid transfer id", http.StatusBadRequest)
+		return
+	}
+
+	err = hnd.service.CancelURLTransfer(req.Context(), userID, transferID)
+	switch {
+	case err == nil:
+		res.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(res, "Transfer not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrTransferClosed):
+		http.Error(res, err.Error(), http.StatusConflict)
+	default:
+		logger.Log.Info("Failed to cancel url transfer", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetURLOwnershipAudit отдает запросу из доверенной подсети журнал смены владельцев короткого урла.
+func (hnd *Handler) GetURLOwnershipAudit(res http.ResponseWriter, req *http.Request) {
+	if !hnd.checkTrustedSubnet(res, req) {
+		return
+	}
+
+	audit, err := hnd.service.GetURLOwnershipAudit(req.Context(), mux.Vars(req)["id"])
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(res, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.Info("Failed to get url ownership audit", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, audit)
+}
+
+// CreateWorkspace создает рабочее пространство, пользователь становится его владельцем.
+func (hnd *Handler) CreateWorkspace(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var workspaceReq models.WorkspaceRequest
+	if err := json.NewDecoder(req.Body).Decode(&workspaceReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := hnd.service.CreateWorkspace(req.Context(), userID, workspaceReq)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to create workspace")
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, workspace)
+}
+
+// GetUserWorkspaces возвращает рабочие пространства пользователя с его ролью в каждом.
+func (hnd *Handler) GetUserWorkspaces(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaces, err := hnd.service.GetUserWorkspaces(req.Context(), userID)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to get workspaces")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, workspaces)
+}
+
+// GetWorkspaceMembers возвращает участнику список участников рабочего пространства.
+func (hnd *Handler) GetWorkspaceMembers(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	members, err := hnd.service.GetWorkspaceMembers(req.Context(), userID, workspaceID)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to get workspace members")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, members)
+}
+
+// UpdateWorkspaceMember меняет роль участника рабочего пространства по запросу владельца.
+func (hnd *Handler) UpdateWorkspaceMember(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	var memberReq models.WorkspaceMemberRequest
+	if err := json.NewDecoder(req.Body).Decode(&memberReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	member, err := hnd.service.UpdateWorkspaceMember(req.Context(), userID, workspaceID, mux.Vars(req)["uid"], memberReq)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to update workspace member")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, member)
+}
+
+// RemoveWorkspaceMember исключает участника из рабочего пространства, участник может исключить и себя.
+func (hnd *Handler) RemoveWorkspaceMember(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	err = hnd.service.RemoveWorkspaceMember(req.Context(), userID, workspaceID, mux.Vars(req)["uid"])
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to remove workspace member")
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// CreateWorkspaceInvite создает приглашение в рабочее пространство, токен которого владелец передает приглашенному.
+func (hnd *Handler) CreateWorkspaceInvite(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	var inviteReq models.WorkspaceInviteRequest
+	if err := json.NewDecoder(req.Body).Decode(&inviteReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	invite, err := hnd.service.CreateWorkspaceInvite(req.Context(), userID, workspaceID, inviteReq)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to create workspace invite")
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, invite)
+}
+
+// AcceptWorkspaceInvite принимает приглашение в рабочее пространство по токену.
+func (hnd *Handler) AcceptWorkspaceInvite(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var acceptReq models.WorkspaceInviteAcceptRequest
+	if err := json.NewDecoder(req.Body).Decode(&acceptReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	member, err := hnd.service.AcceptWorkspaceInvite(req.Context(), userID, acceptReq.Token)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to accept workspace invite")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, member)
+}
+
+// CreateWorkspaceURL сохраняет сокращенный урл в рабочем пространстве, тело запроса как у GetShortURL.
+func (hnd *Handler) CreateWorkspaceURL(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, "Invalid body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := hnd.service.CreateWorkspaceURL(req.Context(), userID, workspaceID, body)
+	if errors.Is(err, storage.ErrConflict) {
+		http.Error(res, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidVariants) || errors.Is(err, service.ErrInvalidRedirectOptions) || errors.Is(err, service.ErrInvalidMetadata) {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if !writeDestinationRejected(res, err) {
+			writeWorkspaceError(res, err, "Failed to create workspace url")
+		}
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, resp)
+}
+
+// GetWorkspaceURLs возвращает участнику страницу урлов рабочего пространства.
+// Поддерживает те же параметры поиска и пагинации, что и GetUserURLs.
+func (hnd *Handler) GetWorkspaceURLs(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	urlsReq, err := userURLsRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := hnd.service.GetWorkspaceURLs(req.Context(), userID, workspaceID, urlsReq)
+	if errors.Is(err, service.ErrInvalidURLsFilter) {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to get workspace urls")
+		return
+	}
+	if len(page.URLs) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if page.NextCursor != "" {
+		res.Header().Set("Link", userURLsPageLink(req, page.NextCursor, "next"))
+	}
+	writeJSON(res, http.StatusOK, page.URLs)
+}
+
+// DeleteWorkspaceURLs ставит в очередь удаления урлы рабочего пространства из списка ID
+// и отдает задачу удаления, результат которой доступен по адресу из Location.
+func (hnd *Handler) DeleteWorkspaceURLs(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, err := strconv.ParseInt(mux.Vars(req)["wid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid workspace id", http.StatusBadRequest)
+		return
+	}
+
+	var urls []string
+	if err := json.NewDecoder(req.Body).Decode(&urls); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := hnd.service.SendWorkspaceURLsToDeletion(req.Context(), userID, workspaceID, urls)
+	if err != nil {
+		writeWorkspaceError(res, err, "Failed to start workspace urls deletion")
+		return
+	}
+
+	res.Header().Set("Location", "/api/user/jobs/"+strconv.FormatInt(job.ID, 10))
+	writeJSON(res, http.StatusAccepted, job)
+}
+
+// writeWorkspaceError - отвечает на ошибку запроса к рабочему пространству, остальные ошибки логирует с msg.
+func writeWorkspaceError(res http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWorkspace):
+		http.Error(res, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(res, "Workspace not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		http.Error(res, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrLastWorkspaceOwner) || errors.Is(err, service.ErrInviteClosed):
+		http.Error(res, err.Error(), http.StatusConflict)
+	default:
+		logger.Log.Info(msg, zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// CreateCollection создает коллекцию урлов пользователя.
+func (hnd *Handler) CreateCollection(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var collectionReq models.CollectionRequest
+	if err := json.NewDecoder(req.Body).Decode(&collectionReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collection, err := hnd.service.CreateCollection(req.Context(), userID, collectionReq)
+	if err != nil {
+		writeCollectionError(res, err, "Failed to create collection")
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, collection)
+}
+
+// GetUserCollections возвращает коллекции урлов пользователя.
+func (hnd *Handler) GetUserCollections(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collections, err := hnd.service.GetUserCollections(req.Context(), userID)
+	if err != nil {
+		writeCollectionError(res, err, "Failed to get collections")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, collections)
+}
+
+// GetCollection возвращает коллекцию урлов пользователя.
+func (hnd *Handler) GetCollection(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(req)["cid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := hnd.service.GetCollection(req.Context(), userID, collectionID)
+	if err != nil {
+		writeCollectionError(res, err, "Failed to get collection")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, collection)
+}
+
+// RenameCollection переименовывает коллекцию урлов пользователя.
+func (hnd *Handler) RenameCollection(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(req)["cid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	var collectionReq models.CollectionRequest
+	if err := json.NewDecoder(req.Body).Decode(&collectionReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collection, err := hnd.service.RenameCollection(req.Context(), userID, collectionID, collectionReq)
+	if err != nil {
+		writeCollectionError(res, err, "Failed to rename collection")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, collection)
+}
+
+// DeleteCollection удаляет коллекцию пользователя, ее урлы остаются вне коллекций.
+func (hnd *Handler) DeleteCollection(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(req)["cid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	if err := hnd.service.DeleteCollection(req.Context(), userID, collectionID); err != nil {
+		writeCollectionError(res, err, "Failed to delete collection")
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// AddURLsToCollection переносит урлы пользователя в коллекцию, в том числе из другой коллекции.
+func (hnd *Handler) AddURLsToCollection(res http.ResponseWriter, req *http.Request) {
+	hnd.moveCollectionURLs(res, req, hnd.service.AddURLsToCollection)
+}
+
+// RemoveURLsFromCollection исключает урлы пользователя из коллекции.
+func (hnd *Handler) RemoveURLsFromCollection(res http.ResponseWriter, req *http.Request) {
+	hnd.moveCollectionURLs(res, req, hnd.service.RemoveURLsFromCollection)
+}
+
+// moveCollectionURLs - разбирает запрос переноса урлов коллекции и выполняет перенос функцией move.
+func (hnd *Handler) moveCollectionURLs(res http.ResponseWriter, req *http.Request,
+	move func(context.Context, string, int64, models.CollectionURLsRequest) error) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(req)["cid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	var urlsReq models.CollectionURLsRequest
+	if err := json.NewDecoder(req.Body).Decode(&urlsReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := move(req.Context(), userID, collectionID, urlsReq); err != nil {
+		writeCollectionError(res, err, "Failed to move collection urls")
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// GetCollectionURLs возвращает страницу урлов коллекции пользователя.
+// Поддерживает те же параметры поиска и пагинации, что и GetUserURLs.
+func (hnd *Handler) GetCollectionURLs(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(req)["cid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	urlsReq, err := userURLsRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := hnd.service.GetCollectionURLs(req.Context(), userID, collectionID, urlsReq)
+	if err != nil {
+		writeCollectionError(res, err, "Failed to get collection urls")
+		return
+	}
+	if len(page.URLs) == 0 {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if page.NextCursor != "" {
+		res.Header().Set("Link", userURLsPageLink(req, page.NextCursor, "next"))
+	}
+	writeJSON(res, http.StatusOK, page.URLs)
+}
+
+// GetCollectionStats возвращает суммарную статистику переходов по урлам коллекции пользователя.
+// Параметры те же, что у GetURLStats.
+func (hnd *Handler) GetCollectionStats(res http.ResponseWriter, req *http.Request) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(req)["cid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	statsReq, err := urlStatsRequest(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := hnd.service.GetCollectionStats(req.Context(), userID, collectionID, statsReq)
+	if err != nil {
+		writeCollectionError(res, err, "Failed to get collection stats")
+		return
+	}
+
+	writeJSON(res, http.StatusOK, stats)
+}
+
+// writeCollectionError - отвечает на ошибку запроса к коллекции, остальные ошибки логирует с msg.
+func writeCollectionError(res http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCollection), errors.Is(err, service.ErrInvalidURLsFilter),
+		errors.Is(err, service.ErrInvalidStatsParams):
+		http.Error(res, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(res, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrURLNotOwned):
+		http.Error(res, err.Error(), http.StatusForbidden)
+	case errors.Is(err, storage.ErrConflict):
+		http.Error(res, "Collection name is taken", http.StatusConflict)
+	default:
+		logger.Log.Info(msg, zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// writeUserJob - отдает пользователю его фоновую задачу вида kind, задачи другого вида не отличаются от несуществующих.
+// Пустой kind разрешает задачи любого вида.
+func (hnd *Handler) writeUserJob(res http.ResponseWriter, req *http.Request, kind string) {
+	token, err := req.Cookie("token")
+	if err != nil {
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := auth.GetUserID(token.Value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobID, err := strconv.ParseInt(mux.Vars(req)["jid"], 10, 64)
+	if err != nil {
+		http.Error(res, "Invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := hnd.service.GetJob(req.Context(), userID, jobID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && kind != "" && job.Kind != kind) {
+		http.Error(res, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.Info("Failed to get job", zap.Error(err))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, job)
+}
+
+// writeJSON - отвечает кодом status с телом value в JSON.
+func writeJSON(res http.ResponseWriter, status int, value any) {
+	respJSON, err := json.Marshal(value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(respJSON)
+}
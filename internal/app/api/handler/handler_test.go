@@ -1,26 +1,44 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/gorilla/mux"
 
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/nu-kotov/URLcompressor/config"
 	"github.com/nu-kotov/URLcompressor/internal/app/api/service"
 	"github.com/nu-kotov/URLcompressor/internal/app/api/utils"
+	"github.com/nu-kotov/URLcompressor/internal/app/auth"
 	"github.com/nu-kotov/URLcompressor/internal/app/middleware"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
 	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"github.com/nu-kotov/URLcompressor/internal/app/urlpolicy"
 	"github.com/nu-kotov/URLcompressor/mocks"
 	"github.com/sqids/sqids-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCompressURLWithPGMock(t *testing.T) {
@@ -29,6 +47,8 @@ func TestCompressURLWithPGMock(t *testing.T) {
 	config, err := config.NewConfig()
 	assert.NoError(t, err, "error config init")
 
+	// при старте сервис ищет фоновые задачи, брошенные прошлым запуском.
+	storage.EXPECT().SelectStaleJobs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
 	service := service.NewURLService(*config, storage)
 	HTTPHandler := NewHandler(*config, service, storage, nil)
 
@@ -436,3 +456,2219 @@ func TestRedirectByShortURLID(t *testing.T) {
 		})
 	}
 }
+
+func TestRedirectByShortURLIDWithVariants(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	variants := []models.URLVariant{
+		{ID: "a", OriginalURL: "https://a.example.com", Weight: 1},
+		{ID: "b", OriginalURL: "https://b.example.com", Weight: 3},
+	}
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com", Variants: variants})
+	assert.NoError(t, err, "marshal request error")
+
+	createRec := httptest.NewRecorder()
+	router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL)
+
+	redirectRec := httptest.NewRecorder()
+	router.ServeHTTP(redirectRec, httptest.NewRequest(http.MethodGet, shortID, nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, redirectRec.Code, "Response statusCode didn't match expected")
+
+	var variantCookie *http.Cookie
+	for _, cookie := range redirectRec.Result().Cookies() {
+		if cookie.Name == variantCookiePrefix+strings.TrimPrefix(shortID, "/") {
+			variantCookie = cookie
+		}
+	}
+	assert.NotNil(t, variantCookie, "Variant cookie not set")
+
+	location := redirectRec.Header().Get("Location")
+	assert.Contains(t, []string{"https://a.example.com", "https://b.example.com"}, location)
+
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodGet, shortID, nil)
+		req.AddCookie(variantCookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, location, rec.Header().Get("Location"), "Sticky variant didn't match")
+	}
+
+	badBody, err := json.Marshal(models.ShortenURLRequest{
+		URL:      "https://example.org",
+		Variants: []models.URLVariant{{OriginalURL: "https://a.example.org", Weight: 0}},
+	})
+	assert.NoError(t, err, "marshal request error")
+
+	badRec := httptest.NewRecorder()
+	router.ServeHTTP(badRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(badBody))))
+	assert.Equal(t, http.StatusBadRequest, badRec.Code, "Response statusCode didn't match expected")
+}
+
+func TestRedirectByShortURLIDWithRedirectOptions(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	tests := []struct {
+		name     string
+		url      string
+		options  models.RedirectOptions
+		query    string
+		location string
+	}{
+		{
+			name:     "Query params dropped by default",
+			url:      "https://example.com/drop?a=1",
+			options:  models.RedirectOptions{UTM: map[string]string{"utm_source": "short"}},
+			query:    "?a=2&ref=x",
+			location: "https://example.com/drop?a=1&utm_source=short",
+		},
+		{
+			name:     "Merge keeps destination params",
+			url:      "https://example.com/merge?a=1",
+			options:  models.RedirectOptions{QueryPolicy: models.QueryPolicyMerge},
+			query:    "?a=2&ref=x",
+			location: "https://example.com/merge?a=1&ref=x",
+		},
+		{
+			name:     "Override replaces destination params",
+			url:      "https://example.com/override?a=1#top",
+			options:  models.RedirectOptions{QueryPolicy: models.QueryPolicyOverride, UTM: map[string]string{"utm_campaign": "link-{short_id}"}},
+			query:    "?a=2&ref=a%20b",
+			location: "https://example.com/override?a=2&ref=a+b&utm_campaign=link-{id}#top",
+		},
+		{
+			name:     "Destination query with semicolons kept as is",
+			url:      "https://example.com/semi?a=1;b=2&c=%7e",
+			options:  models.RedirectOptions{QueryPolicy: models.QueryPolicyMerge, UTM: map[string]string{"utm_source": "short"}},
+			query:    "?ref=x",
+			location: "https://example.com/semi?a=1;b=2&c=%7e&ref=x&utm_source=short",
+		},
+		{
+			name:     "Valueless flag kept and overridden keys removed",
+			url:      "https://example.com/flag?flag&a=1&utm_source=old",
+			options:  models.RedirectOptions{QueryPolicy: models.QueryPolicyOverride, UTM: map[string]string{"utm_source": "short"}},
+			query:    "?a=2",
+			location: "https://example.com/flag?flag&a=2&utm_source=short",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			reqBody, err := json.Marshal(models.ShortenURLRequest{URL: test.url, RedirectOptions: &options})
+			assert.NoError(t, err, "marshal request error")
+
+			createRec := httptest.NewRecorder()
+			router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+			assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+			var created models.ShortenURLResponse
+			assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+			shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+			redirectRec := httptest.NewRecorder()
+			router.ServeHTTP(redirectRec, httptest.NewRequest(http.MethodGet, "/"+shortID+test.query, nil))
+			assert.Equal(t, http.StatusTemporaryRedirect, redirectRec.Code, "Response statusCode didn't match expected")
+			assert.Equal(t, strings.ReplaceAll(test.location, "{id}", shortID), redirectRec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestExportClicks(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com/export"})
+	assert.NoError(t, err, "marshal request error")
+
+	createRec := httptest.NewRecorder()
+	router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range createRec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	assert.NotNil(t, token, "Token cookie not set")
+
+	clickedAt := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	clicks := []models.ClickEvent{
+		{ShortURL: shortID, ClickedAt: clickedAt, Referrer: "https://ref.example.com/a,b", ReferrerHost: "ref.example.com"},
+		{ShortURL: shortID, ClickedAt: clickedAt.Add(time.Hour), UserAgent: "Googlebot", IsBot: true},
+		{ShortURL: shortID, ClickedAt: clickedAt.AddDate(0, 0, 2)},
+		{ShortURL: "other", ClickedAt: clickedAt},
+	}
+	assert.NoError(t, store.InsertClicks(context.Background(), clicks))
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		lines  int
+	}{
+		{name: "CSV export of all clicks", path: "/clicks.csv", status: http.StatusOK, lines: 4},
+		{name: "CSV export filtered by date", path: "/clicks.csv?from=2026-01-10&to=2026-01-10", status: http.StatusOK, lines: 3},
+		{name: "NDJSON export", path: "/clicks.ndjson", status: http.StatusOK, lines: 3},
+		{name: "Invalid period", path: "/clicks.ndjson?from=2026-01-12&to=2026-01-10", status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+shortID+test.path, nil)
+			req.AddCookie(token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.status, rec.Code, "Response statusCode didn't match expected")
+			if test.status != http.StatusOK {
+				return
+			}
+
+			lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+			assert.Len(t, lines, test.lines)
+			if strings.HasSuffix(test.path, ".ndjson") {
+				var click models.ClickEvent
+				assert.NoError(t, json.Unmarshal([]byte(lines[0]), &click))
+				assert.Equal(t, shortID, click.ShortURL)
+			}
+		})
+	}
+
+	foreignRec := httptest.NewRecorder()
+	router.ServeHTTP(foreignRec, httptest.NewRequest(http.MethodGet, "/api/user/urls/"+shortID+"/clicks.csv", nil))
+	assert.Equal(t, http.StatusForbidden, foreignRec.Code, "Response statusCode didn't match expected")
+}
+
+func TestGetQRCode(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com/qr"})
+	assert.NoError(t, err, "marshal request error")
+
+	createRec := httptest.NewRecorder()
+	router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		status      int
+		contentType string
+	}{
+		{name: "PNG by default", path: "/" + shortID + "/qr", status: http.StatusOK, contentType: "image/png"},
+		{name: "SVG by format param", path: "/" + shortID + "/qr?format=svg&size=512&margin=0&ecc=H&fg=333", status: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "SVG by Accept header", path: "/" + shortID + "/qr", accept: "image/svg+xml", status: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "Invalid size", path: "/" + shortID + "/qr?size=big", status: http.StatusBadRequest},
+		{name: "Invalid color", path: "/" + shortID + "/qr?bg=white", status: http.StatusBadRequest},
+		{name: "Unknown short url", path: "/unknown/qr", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, test.status, rec.Code, "Response statusCode didn't match expected")
+			if test.contentType != "" {
+				assert.Equal(t, test.contentType, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestDomainPolicy(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	policyPath := filepath.Join(t.TempDir(), "policy.txt")
+	assert.NoError(t, os.WriteFile(policyPath, []byte("deny *.phish.io\n"), 0o644))
+	policy, err := urlpolicy.Load(policyPath)
+	assert.NoError(t, err, "policy loading error")
+
+	service := service.NewURLService(config, store)
+	service.Policy = policy
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "Allowed text", path: "/", body: "https://example.com/ok", status: http.StatusCreated},
+		{name: "Denied text", path: "/", body: "https://login.phish.io/", status: http.StatusForbidden},
+		{name: "Denied json", path: "/api/shorten", body: `{"url":"https://login.phish.io/"}`, status: http.StatusForbidden},
+		{name: "Denied variant", path: "/api/shorten", body: `{"url":"https://example.com/a","variants":[{"id":"a","url":"https://example.com/a","weight":1},{"id":"b","url":"https://x.phish.io","weight":1}]}`, status: http.StatusForbidden},
+		{name: "Denied batch", path: "/api/shorten/batch", body: `[{"correlation_id":"1","original_url":"https://x.phish.io"}]`, status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body)))
+
+			assert.Equal(t, test.status, rec.Code, "Response statusCode didn't match expected")
+			if test.status != http.StatusForbidden {
+				return
+			}
+			var rejected models.DestinationRejectedResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rejected))
+			assert.Equal(t, urlpolicy.ReasonDenied, rejected.Reason)
+			assert.Equal(t, "*.phish.io", rejected.Rule)
+		})
+	}
+}
+
+func TestAbuseModeration(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	_, trustedSubnet, err := net.ParseCIDR("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, trustedSubnet)
+	router := NewRouter(*HTTPHandler)
+
+	serve := func(method string, path string, body string, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	createRec := serve(http.MethodPost, "/", "https://example.com/phish", "")
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+	shortID := strings.TrimPrefix(createRec.Body.String(), config.BaseURL+"/")
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/"+shortID+"/report", `{"reason":"boring"}`, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/unknown/report", `{"reason":"spam"}`, "").Code)
+
+	reportRec := serve(http.MethodPost, "/"+shortID+"/report", `{"reason":"phishing","comment":"fake bank login"}`, "")
+	assert.Equal(t, http.StatusCreated, reportRec.Code, "Response statusCode didn't match expected")
+	var reported models.AbuseReportResponse
+	assert.NoError(t, json.Unmarshal(reportRec.Body.Bytes(), &reported))
+	assert.Equal(t, models.AbuseReportOpen, reported.Status)
+
+	duplicateRec := serve(http.MethodPost, "/"+shortID+"/report", `{"reason":"spam"}`, "")
+	assert.Equal(t, http.StatusCreated, duplicateRec.Code, "Response statusCode didn't match expected")
+	var duplicate models.AbuseReportResponse
+	assert.NoError(t, json.Unmarshal(duplicateRec.Body.Bytes(), &duplicate))
+	assert.Equal(t, reported.ID, duplicate.ID)
+
+	otherRec := serve(http.MethodPost, "/"+shortID+"/report", `{"reason":"spam"}`, "203.0.113.5")
+	assert.Equal(t, http.StatusCreated, otherRec.Code, "Response statusCode didn't match expected")
+	var other models.AbuseReportResponse
+	assert.NoError(t, json.Unmarshal(otherRec.Body.Bytes(), &other))
+	assert.NotEqual(t, reported.ID, other.ID)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/api/internal/reports", "", "192.168.1.1").Code)
+
+	listRec := serve(http.MethodGet, "/api/internal/reports?status=open", "", "10.1.2.3")
+	assert.Equal(t, http.StatusOK, listRec.Code, "Response statusCode didn't match expected")
+	var reports []models.AbuseReport
+	assert.NoError(t, json.Unmarshal(listRec.Body.Bytes(), &reports))
+	assert.Len(t, reports, 2)
+	assert.Equal(t, reported.ID, reports[0].ID)
+
+	reportPath := "/api/internal/reports/" + strconv.FormatInt(reported.ID, 10)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, reportPath, `{"action":"takedown","note":"phishing page"}`, "10.1.2.3").Code)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, reportPath, `{"action":"dismiss"}`, "10.1.2.3").Code)
+	otherPath := "/api/internal/reports/" + strconv.FormatInt(other.ID, 10)
+	assert.Equal(t, http.StatusConflict, serve(http.MethodPost, otherPath, `{"action":"dismiss"}`, "10.1.2.3").Code)
+
+	takenDownRec := serve(http.MethodGet, "/"+shortID, "", "")
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, takenDownRec.Code, "Response statusCode didn't match expected")
+	assert.Contains(t, takenDownRec.Body.String(), "phishing page")
+	assert.Empty(t, takenDownRec.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/internal/urls/"+shortID+"/takedown", "", "10.1.2.3").Code)
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodGet, "/"+shortID, "", "").Code)
+
+	t.Run("Concurrent decisions", func(t *testing.T) {
+		createRec := serve(http.MethodPost, "/", "https://example.com/race", "")
+		assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+		raceID := strings.TrimPrefix(createRec.Body.String(), config.BaseURL+"/")
+
+		reportRec := serve(http.MethodPost, "/"+raceID+"/report", `{"reason":"spam"}`, "")
+		assert.Equal(t, http.StatusCreated, reportRec.Code, "Response statusCode didn't match expected")
+		var report models.AbuseReportResponse
+		assert.NoError(t, json.Unmarshal(reportRec.Body.Bytes(), &report))
+
+		path := "/api/internal/reports/" + strconv.FormatInt(report.ID, 10)
+		actions := []string{`{"action":"dismiss"}`, `{"action":"takedown"}`}
+		codes := make([]int, len(actions))
+		var wg sync.WaitGroup
+		for i, action := range actions {
+			wg.Add(1)
+			go func(i int, action string) {
+				defer wg.Done()
+				codes[i] = serve(http.MethodPost, path, action, "10.1.2.3").Code
+			}(i, action)
+		}
+		wg.Wait()
+		assert.ElementsMatch(t, []int{http.StatusOK, http.StatusConflict}, codes)
+
+		redirectCode := serve(http.MethodGet, "/"+raceID, "", "").Code
+		if codes[1] == http.StatusOK {
+			assert.Equal(t, http.StatusUnavailableForLegalReasons, redirectCode, "Response statusCode didn't match expected")
+		} else {
+			assert.Equal(t, http.StatusTemporaryRedirect, redirectCode, "Response statusCode didn't match expected")
+		}
+	})
+}
+
+func TestURLMetadata(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	invalidRec := httptest.NewRecorder()
+	router.ServeHTTP(invalidRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com/bad","tags":["a,b"]}`)))
+	assert.Equal(t, http.StatusBadRequest, invalidRec.Code, "Response statusCode didn't match expected")
+
+	createRec := httptest.NewRecorder()
+	router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten",
+		strings.NewReader(`{"url":"https://example.com/docs","title":" Docs ","tags":["Go","go","  Go   Modules "]}`)))
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range createRec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	assert.NotNil(t, token, "Token cookie not set")
+
+	getUserURLs := func() []models.GetUserURLsResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+
+		var urls []models.GetUserURLsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &urls))
+		return urls
+	}
+
+	urls := getUserURLs()
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "Docs", urls[0].Title)
+	assert.Equal(t, []string{"go", "go modules"}, urls[0].Tags)
+
+	tests := []struct {
+		name   string
+		body   string
+		token  bool
+		status int
+	}{
+		{name: "Foreign user", body: `{"title":"x"}`, status: http.StatusForbidden},
+		{name: "Too long title", body: `{"title":"` + strings.Repeat("x", 201) + `"}`, token: true, status: http.StatusBadRequest},
+		{name: "Partial update", body: `{"description":"Go documentation","tags":["reference"]}`, token: true, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+shortID, strings.NewReader(test.body))
+			if test.token {
+				req.AddCookie(token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, test.status, rec.Code, "Response statusCode didn't match expected")
+		})
+	}
+
+	urls = getUserURLs()
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "Docs", urls[0].Title)
+	assert.Equal(t, "Go documentation", urls[0].Description)
+	assert.Equal(t, []string{"reference"}, urls[0].Tags)
+}
+
+func TestUserURLsPagination(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	var token *http.Cookie
+	for _, title := range []string{"c", "a", "b"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten",
+			strings.NewReader(`{"url":"https://example.com/`+title+`","title":"`+title+`"}`))
+		if token != nil {
+			req.AddCookie(token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == "token" {
+				token = cookie
+			}
+		}
+	}
+	assert.NotNil(t, token, "Token cookie not set")
+
+	getPage := func(target string) (int, []string, string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil, ""
+		}
+
+		var urls []models.GetUserURLsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &urls))
+		titles := make([]string, 0, len(urls))
+		for _, u := range urls {
+			titles = append(titles, u.Title)
+		}
+		return rec.Code, titles, rec.Header().Get("Link")
+	}
+
+	status, titles, link := getPage("/api/user/urls?sort=title&limit=2")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"a", "b"}, titles)
+	assert.True(t, strings.HasSuffix(link, `>; rel="next"`), "Link header didn't match expected")
+
+	next := strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+	assert.True(t, strings.HasPrefix(next, "/api/user/urls?"))
+	status, titles, link = getPage(next)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"c"}, titles)
+	assert.Empty(t, link)
+
+	cursor, err := url.Parse(next)
+	assert.NoError(t, err)
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "Zero limit", target: "/api/user/urls?limit=0"},
+		{name: "Too large limit", target: "/api/user/urls?limit=100000"},
+		{name: "Malformed cursor", target: "/api/user/urls?cursor=%21%21"},
+		{name: "Cursor for another sort", target: "/api/user/urls?sort=-title&cursor=" + cursor.Query().Get("cursor")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, _, _ := getPage(test.target)
+			assert.Equal(t, http.StatusBadRequest, status, "Response statusCode didn't match expected")
+		})
+	}
+}
+
+type failingURLsStorage struct {
+	storage.Storage
+}
+
+func (s *failingURLsStorage) SelectURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	return nil, errors.New("database is unavailable")
+}
+
+func TestUserURLsStorageFailure(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	mapStore, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+	store := &failingURLsStorage{Storage: mapStore}
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/outage")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "storage outage looked like an empty list")
+}
+
+func TestURLsImport(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	csvBody := "url,alias,tags,expires_at\n" +
+		"https://example.com/a,promo,Go|docs,\n" +
+		"https://example.com/b,promo,,\n" +
+		"not a url,,,\n" +
+		"https://example.com/c,bad-alias,,\n" +
+		"https://example.com/d,old_promo,,2020-01-01\n" +
+		"https://example.com/e,,,\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/imports", strings.NewReader(csvBody))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code, "Response statusCode didn't match expected")
+
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	assert.NotNil(t, token, "Token cookie not set")
+
+	getJob := func(location string) models.Job {
+		req := httptest.NewRequest(http.MethodGet, location, nil)
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+
+		var job models.Job
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		return job
+	}
+
+	location := rec.Header().Get("Location")
+	var job models.Job
+	assert.Eventually(t, func() bool {
+		job = getJob(location)
+		return job.Status == models.JobStatusDone
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 6, job.Processed)
+	assert.Equal(t, 3, job.Succeeded)
+	assert.Equal(t, 3, job.Failed)
+	lines := make([]int, 0, len(job.Errors))
+	for _, lineErr := range job.Errors {
+		lines = append(lines, lineErr.Line)
+	}
+	assert.ElementsMatch(t, []int{3, 4, 5}, lines)
+
+	redirect := func(shortID string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+shortID, nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusTemporaryRedirect, redirect("promo"))
+	assert.Equal(t, http.StatusGone, redirect("old_promo"))
+
+	data, err := store.SelectURLData(context.Background(), "promo")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", data.OriginalURL)
+	assert.Equal(t, []string{"go", "docs"}, data.Tags)
+
+	ndjsonReq := httptest.NewRequest(http.MethodPost, "/api/user/imports?format=ndjson",
+		strings.NewReader("{\"url\":\"https://example.com/f\",\"alias\":\"promo\"}\n\n{\"url\":\"https://example.com/g\",\"alias\":\"spring\"}\n{bad json\n"))
+	ndjsonReq.AddCookie(token)
+	ndjsonRec := httptest.NewRecorder()
+	router.ServeHTTP(ndjsonRec, ndjsonReq)
+	assert.Equal(t, http.StatusAccepted, ndjsonRec.Code, "Response statusCode didn't match expected")
+
+	assert.Eventually(t, func() bool {
+		job = getJob(ndjsonRec.Header().Get("Location"))
+		return job.Status == models.JobStatusDone
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, job.Succeeded)
+	if assert.Len(t, job.Errors, 2) {
+		assert.Equal(t, 4, job.Errors[0].Line)
+		assert.Equal(t, models.JobLineError{Line: 1, Error: `alias "promo" is already taken`}, job.Errors[1])
+	}
+
+	// слишком длинная строка NDJSON пропускается с ошибкой, следующие строки импортируются.
+	longLine := `{"url":"https://example.com/` + strings.Repeat("x", 100<<10) + `"}`
+	longReq := httptest.NewRequest(http.MethodPost, "/api/user/imports?format=ndjson",
+		strings.NewReader(longLine+"\n{\"url\":\"https://example.com/h\",\"alias\":\"after_long\"}\n"))
+	longReq.AddCookie(token)
+	longRec := httptest.NewRecorder()
+	router.ServeHTTP(longRec, longReq)
+	assert.Equal(t, http.StatusAccepted, longRec.Code, "Response statusCode didn't match expected")
+
+	assert.Eventually(t, func() bool {
+		job = getJob(longRec.Header().Get("Location"))
+		return job.Status == models.JobStatusDone
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, job.Succeeded)
+	if assert.Len(t, job.Errors, 1) {
+		assert.Equal(t, 1, job.Errors[0].Line)
+		assert.Contains(t, job.Errors[0].Error, "longer than")
+	}
+
+	limited := config
+	limited.ImportMaxBytes = 16
+	limitedRouter := NewRouter(*NewHandler(limited, service, store, nil))
+	tooLargeReq := httptest.NewRequest(http.MethodPost, "/api/user/imports?format=csv", strings.NewReader(csvBody))
+	tooLargeReq.AddCookie(token)
+	tooLargeRec := httptest.NewRecorder()
+	limitedRouter.ServeHTTP(tooLargeRec, tooLargeReq)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, tooLargeRec.Code, "Response statusCode didn't match expected")
+
+	foreignReq := httptest.NewRequest(http.MethodGet, location, nil)
+	foreignRec := httptest.NewRecorder()
+	router.ServeHTTP(foreignRec, foreignReq)
+	assert.Equal(t, http.StatusNotFound, foreignRec.Code, "Response statusCode didn't match expected")
+
+	unknownRec := httptest.NewRecorder()
+	router.ServeHTTP(unknownRec, httptest.NewRequest(http.MethodPost, "/api/user/imports", strings.NewReader("x")))
+	assert.Equal(t, http.StatusUnsupportedMediaType, unknownRec.Code, "Response statusCode didn't match expected")
+}
+
+func TestStaleImportJobsFailOnStart(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	ctx := context.Background()
+	updatedAt := time.Now().UTC().Add(-time.Hour)
+	stale := &models.Job{UserID: "u1", Kind: models.JobKindImport, Status: models.JobStatusRunning, CreatedAt: updatedAt, UpdatedAt: updatedAt}
+	fresh := &models.Job{UserID: "u1", Kind: models.JobKindImport, Status: models.JobStatusRunning, CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+	assert.NoError(t, store.InsertJob(ctx, stale))
+	assert.NoError(t, store.InsertJob(ctx, fresh))
+
+	service := service.NewURLService(config, store)
+	defer service.Shutdown(ctx)
+
+	assert.Eventually(t, func() bool {
+		job, err := store.SelectJob(ctx, stale.ID)
+		return err == nil && job.Status == models.JobStatusFailed && job.FinishedAt != nil
+	}, 5*time.Second, 10*time.Millisecond, "stale import job wasn't failed")
+
+	job, err := store.SelectJob(ctx, fresh.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStatusRunning, job.Status, "running import job was failed")
+}
+
+func TestStaleErasureJobsResumeOnStart(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	ctx := context.Background()
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "erased", OriginalURL: "https://example.com/erased", UserID: "u1"}))
+	updatedAt := time.Now().UTC().Add(-time.Hour)
+	stale := &models.Job{UserID: "u1", Kind: models.JobKindErasure, Status: models.JobStatusRunning, CreatedAt: updatedAt, UpdatedAt: updatedAt}
+	assert.NoError(t, store.InsertJob(ctx, stale))
+
+	service := service.NewURLService(config, store)
+
+	var job *models.Job
+	assert.Eventually(t, func() bool {
+		job, err = store.SelectJob(ctx, stale.ID)
+		return err == nil && job.FinishedAt != nil
+	}, 5*time.Second, 10*time.Millisecond, "stale erasure job wasn't resumed")
+	assert.Equal(t, models.JobStatusDone, job.Status)
+
+	_, err = store.SelectURLData(ctx, "erased")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NoError(t, service.Shutdown(ctx))
+}
+
+type failingErasureStorage struct {
+	storage.Storage
+}
+
+func (s *failingErasureStorage) EraseUserData(ctx context.Context, userID string, keepJobID int64) (*models.UserErasure, error) {
+	return nil, errors.New("storage file rewrite failed")
+}
+
+func TestFailedErasureIsRetried(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	mapStore, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+	store := &failingErasureStorage{Storage: mapStore}
+
+	ctx := context.Background()
+	service := service.NewURLService(config, store)
+	started, err := service.StartUserErasure(ctx, "u1")
+	require.NoError(t, err)
+
+	var job *models.Job
+	assert.Eventually(t, func() bool {
+		job, err = store.SelectJob(ctx, started.ID)
+		return err == nil && job.Error != ""
+	}, time.Second, 10*time.Millisecond, "erasure failure wasn't saved")
+	// незавершенную задачу подберет resumeStaleErasures.
+	assert.Nil(t, job.FinishedAt, "failed erasure was finished")
+	assert.Equal(t, models.JobStatusRunning, job.Status)
+	assert.NoError(t, service.Shutdown(ctx))
+}
+
+func TestUserDataExport(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com/portable"})
+	assert.NoError(t, err, "marshal request error")
+
+	createRec := httptest.NewRecorder()
+	router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range createRec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	userID, err := auth.GetUserID(token.Value)
+	require.NoError(t, err)
+	assert.NoError(t, store.InsertURLsData(context.Background(), &models.URLsData{
+		UUID:        uuid.NewString(),
+		ShortURL:    "deletedlink",
+		OriginalURL: "https://example.com/deleted",
+		UserID:      userID,
+		DeletedFlag: true,
+		CreatedAt:   time.Now(),
+	}))
+
+	clickedAt := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.InsertClicks(context.Background(), []models.ClickEvent{
+		{ShortURL: shortID, ClickedAt: clickedAt},
+		{ShortURL: shortID, ClickedAt: clickedAt.AddDate(0, 0, 1), IsBot: true},
+	}))
+
+	export := func(t *testing.T, query string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/export"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	readLinks := func(t *testing.T, r io.Reader) map[string]models.UserExportLink {
+		links := make(map[string]models.UserExportLink)
+		decoder := json.NewDecoder(r)
+		for decoder.More() {
+			var link models.UserExportLink
+			require.NoError(t, decoder.Decode(&link))
+			links[link.ShortURL] = link
+		}
+		return links
+	}
+
+	t.Run("NDJSON export", func(t *testing.T) {
+		rec := export(t, "?format=ndjson", token)
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+
+		links := readLinks(t, rec.Body)
+		require.Len(t, links, 2)
+		link := links[created.Result]
+		assert.Equal(t, "https://example.com/portable", link.OriginalURL)
+		assert.Equal(t, int64(2), link.Clicks.TotalClicks)
+		assert.Equal(t, int64(1), link.Clicks.BotClicks)
+		assert.Len(t, link.Clicks.Daily, 2)
+		assert.True(t, links[config.BaseURL+"/deletedlink"].Deleted)
+	})
+
+	t.Run("ZIP export", func(t *testing.T) {
+		rec := export(t, "", token)
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+		assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		require.NoError(t, err)
+
+		files := make(map[string]*zip.File)
+		for _, file := range archive.File {
+			files[file.Name] = file
+		}
+		require.Contains(t, files, "links.ndjson")
+		require.Contains(t, files, "manifest.json")
+
+		linksFile, err := files["links.ndjson"].Open()
+		require.NoError(t, err)
+		defer linksFile.Close()
+		assert.Len(t, readLinks(t, linksFile), 2)
+
+		manifestFile, err := files["manifest.json"].Open()
+		require.NoError(t, err)
+		defer manifestFile.Close()
+		var manifest models.UserExportManifest
+		require.NoError(t, json.NewDecoder(manifestFile).Decode(&manifest))
+		assert.Equal(t, userID, manifest.UserID)
+		assert.Equal(t, 2, manifest.Links)
+	})
+
+	t.Run("Foreign user", func(t *testing.T) {
+		rec := export(t, "?format=ndjson", nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+		assert.Empty(t, strings.TrimSpace(rec.Body.String()))
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		rec := export(t, "?format=tar", token)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "Response statusCode didn't match expected")
+	})
+}
+
+func TestUserErasure(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com/forget-me"})
+	assert.NoError(t, err, "marshal request error")
+
+	createRec := httptest.NewRecorder()
+	router.ServeHTTP(createRec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, createRec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(createRec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range createRec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	assert.NoError(t, store.InsertClicks(context.Background(), []models.ClickEvent{{ShortURL: shortID, ClickedAt: time.Now()}}))
+
+	// урл, переданный другому пользователю, остается у него, но без истории передачи.
+	userID, err := auth.GetUserID(token.Value)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	assert.NoError(t, store.InsertURLsData(context.Background(), &models.URLsData{ShortURL: "handedover", OriginalURL: "https://example.com/handed-over", UserID: userID}))
+	transfer := &models.URLTransfer{TokenHash: "transfer-hash", FromUserID: userID, ShortURLs: []string{"handedover"},
+		Status: models.URLTransferPending, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, store.InsertURLTransfer(context.Background(), transfer))
+	_, err = store.AcceptURLTransfer(context.Background(), transfer.ID, "receiver", now)
+	assert.NoError(t, err)
+
+	eraseReq := httptest.NewRequest(http.MethodDelete, "/api/user", nil)
+	eraseReq.AddCookie(token)
+	eraseRec := httptest.NewRecorder()
+	router.ServeHTTP(eraseRec, eraseReq)
+	assert.Equal(t, http.StatusAccepted, eraseRec.Code, "Response statusCode didn't match expected")
+
+	location := eraseRec.Header().Get("Location")
+	var job models.Job
+	assert.Eventually(t, func() bool {
+		req := httptest.NewRequest(http.MethodGet, location, nil)
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			return false
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		return job.Status == models.JobStatusDone
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, models.JobKindErasure, job.Kind)
+	assert.Equal(t, &models.UserErasure{Links: 1, Clicks: 1}, job.Erasure)
+	assert.NotNil(t, job.FinishedAt)
+
+	_, err = store.SelectURLData(context.Background(), shortID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	handedOver, err := store.SelectURLData(context.Background(), "handedover")
+	assert.NoError(t, err)
+	assert.Equal(t, "receiver", handedOver.UserID)
+	audit, err := store.SelectURLOwnershipAudit(context.Background(), "handedover")
+	assert.NoError(t, err)
+	assert.Empty(t, audit, "erased user's transfer history was kept")
+
+	redirectRec := httptest.NewRecorder()
+	router.ServeHTTP(redirectRec, httptest.NewRequest(http.MethodGet, "/"+shortID, nil))
+	assert.NotEqual(t, http.StatusTemporaryRedirect, redirectRec.Code)
+
+	importJobReq := httptest.NewRequest(http.MethodGet, strings.Replace(location, "erasures", "imports", 1), nil)
+	importJobReq.AddCookie(token)
+	importJobRec := httptest.NewRecorder()
+	router.ServeHTTP(importJobRec, importJobReq)
+	assert.Equal(t, http.StatusNotFound, importJobRec.Code, "Response statusCode didn't match expected")
+
+	foreignRec := httptest.NewRecorder()
+	router.ServeHTTP(foreignRec, httptest.NewRequest(http.MethodGet, location, nil))
+	assert.Equal(t, http.StatusNotFound, foreignRec.Code, "Response statusCode didn't match expected")
+}
+
+func TestTrashRestore(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.TrashRetention = 24 * time.Hour
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	var token *http.Cookie
+	var shortIDs []string
+	for _, originalURL := range []string{"https://example.com/trash/1", "https://example.com/trash/2"} {
+		reqBody, err := json.Marshal(models.ShortenURLRequest{URL: originalURL})
+		assert.NoError(t, err, "marshal request error")
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody)))
+		if token != nil {
+			req.AddCookie(token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+		var created models.ShortenURLResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		shortIDs = append(shortIDs, strings.TrimPrefix(created.Result, config.BaseURL+"/"))
+
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == "token" {
+				token = cookie
+			}
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	userID, err := auth.GetUserID(token.Value)
+	require.NoError(t, err)
+	_, err = store.DeleteURLs(context.Background(), []models.URLForDeleteMsg{
+		{ShortURL: shortIDs[0], UserID: userID},
+		{ShortURL: shortIDs[1], UserID: userID},
+	})
+	assert.NoError(t, err)
+
+	getTrash := func(t *testing.T) []models.GetUserURLsResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/trash", nil)
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusNoContent {
+			return nil
+		}
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+
+		var urls []models.GetUserURLsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &urls))
+		return urls
+	}
+
+	restore := func(t *testing.T, cookie *http.Cookie, shortURLs []string) []string {
+		body, err := json.Marshal(shortURLs)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(string(body)))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, "Response statusCode didn't match expected")
+
+		var resp models.RestoreURLsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp.Restored
+	}
+
+	trash := getTrash(t)
+	require.Len(t, trash, 2)
+	for _, item := range trash {
+		assert.True(t, item.Deleted)
+		require.NotNil(t, item.DeletedAt)
+		require.NotNil(t, item.PurgeAt)
+		assert.Equal(t, item.DeletedAt.Add(config.TrashRetention), *item.PurgeAt)
+	}
+
+	assert.Empty(t, restore(t, nil, []string{shortIDs[0]}), "foreign user restored a link")
+	assert.Equal(t, []string{shortIDs[0]}, restore(t, token, []string{shortIDs[0], "unknown"}))
+	assert.Empty(t, restore(t, token, []string{shortIDs[0]}), "active link restored twice")
+
+	redirectRec := httptest.NewRecorder()
+	router.ServeHTTP(redirectRec, httptest.NewRequest(http.MethodGet, "/"+shortIDs[0], nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, redirectRec.Code, "Response statusCode didn't match expected")
+
+	trash = getTrash(t)
+	require.Len(t, trash, 1)
+	assert.Equal(t, shortIDs[1], trash[0].ShortURL)
+
+	purged, err := store.PurgeDeletedURLs(context.Background(), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.Empty(t, getTrash(t))
+
+	_, err = store.SelectURLData(context.Background(), shortIDs[1])
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = store.SelectURLData(context.Background(), shortIDs[0])
+	assert.NoError(t, err)
+}
+
+func TestDeletionJobs(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.DeletionFlushInterval = 10 * time.Millisecond
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com/deletion"})
+	assert.NoError(t, err, "marshal request error")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	deleteURLs := func(t *testing.T, shortURLs []string) (models.Job, string) {
+		body, err := json.Marshal(shortURLs)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(string(body)))
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusAccepted, rec.Code, "Response statusCode didn't match expected")
+
+		var job models.Job
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		return job, rec.Header().Get("Location")
+	}
+
+	getJob := func(cookie *http.Cookie, location string) (models.Job, int) {
+		req := httptest.NewRequest(http.MethodGet, location, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		var job models.Job
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		}
+		return job, rec.Code
+	}
+
+	job, location := deleteURLs(t, []string{shortID, shortID, "unknown"})
+	assert.Equal(t, fmt.Sprintf("/api/user/jobs/%d", job.ID), location)
+	assert.Equal(t, models.JobKindDeletion, job.Kind)
+	require.Len(t, job.URLs, 2, "duplicate url wasn't dropped")
+
+	assert.Eventually(t, func() bool {
+		job, _ = getJob(token, location)
+		return job.Status != models.JobStatusPending && job.Status != models.JobStatusRunning
+	}, 5*time.Second, 10*time.Millisecond, "deletion job didn't finish")
+
+	assert.Equal(t, models.JobStatusDone, job.Status)
+	assert.Equal(t, 2, job.Processed)
+	assert.Equal(t, 1, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, []models.JobURLResult{
+		{ShortURL: shortID, Status: models.JobURLDeleted},
+		{ShortURL: "unknown", Status: models.JobURLNotFound},
+	}, job.URLs)
+
+	redirectRec := httptest.NewRecorder()
+	router.ServeHTTP(redirectRec, httptest.NewRequest(http.MethodGet, "/"+shortID, nil))
+	assert.Equal(t, http.StatusGone, redirectRec.Code, "Response statusCode didn't match expected")
+
+	_, code := getJob(nil, location)
+	assert.Equal(t, http.StatusNotFound, code, "foreign user got the job")
+
+	empty, _ := deleteURLs(t, nil)
+	assert.Equal(t, models.JobStatusDone, empty.Status)
+	assert.Empty(t, empty.URLs)
+}
+
+func TestDeletionQueueDrainOnShutdown(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.DeletionFlushInterval = time.Hour
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	reqBody, err := json.Marshal(models.ShortenURLRequest{URL: "https://example.com/shutdown"})
+	assert.NoError(t, err, "marshal request error")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody))))
+	assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+	var created models.ShortenURLResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	shortID := strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["`+shortID+`"]`))
+	req.AddCookie(token)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code, "Response statusCode didn't match expected")
+
+	var job models.Job
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	assert.Equal(t, models.JobStatusPending, job.Status)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, service.Shutdown(ctx))
+
+	finished, err := store.SelectJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStatusDone, finished.Status)
+	assert.Equal(t, []models.JobURLResult{{ShortURL: shortID, Status: models.JobURLDeleted}}, finished.URLs)
+
+	data, err := store.SelectURLData(context.Background(), shortID)
+	assert.NoError(t, err)
+	assert.True(t, data.DeletedFlag)
+}
+
+// flakyClicksStorage - хранилище, в котором первые failures записей переходов падают.
+type flakyClicksStorage struct {
+	storage.Storage
+	failures atomic.Int32
+}
+
+func (s *flakyClicksStorage) InsertClicks(ctx context.Context, clicks []models.ClickEvent) error {
+	if s.failures.Add(-1) >= 0 {
+		return errors.New("clicks storage unavailable")
+	}
+	return s.Storage.InsertClicks(ctx, clicks)
+}
+
+func TestClicksRetryAndFlushOnShutdown(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	mapStore, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+	store := &flakyClicksStorage{Storage: mapStore}
+	store.failures.Store(1)
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/clicks")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	shortID := strings.TrimPrefix(rec.Body.String(), config.BaseURL+"/")
+
+	redirect := func() {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+shortID, nil))
+		assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	}
+	countClicks := func() int {
+		clicks, err := store.SelectClicksPage(context.Background(), models.ClicksPageFilter{
+			ShortURL: shortID,
+			To:       time.Now().Add(time.Hour),
+			Limit:    100,
+		})
+		assert.NoError(t, err)
+		return len(clicks)
+	}
+
+	// батч, который не удалось записать, не теряется и записывается повторно.
+	redirect()
+	redirect()
+	assert.Eventually(t, func() bool { return countClicks() == 2 }, 5*time.Second, 10*time.Millisecond, "failed clicks batch was lost")
+
+	// оставшиеся в буфере переходы записываются при остановке сервиса.
+	redirect()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, service.Shutdown(ctx))
+	assert.Equal(t, 3, countClicks(), "buffered clicks weren't flushed on shutdown")
+}
+
+// flakyDeletionJobsStorage - хранилище, в котором можно уронить постановку урлов в очередь удаления
+// и сохранение задач удаления.
+type flakyDeletionJobsStorage struct {
+	storage.Storage
+	failEnqueue atomic.Bool
+	failModify  atomic.Bool
+}
+
+func (s *flakyDeletionJobsStorage) EnqueueURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	if s.failEnqueue.Load() {
+		return errors.New("queue unavailable")
+	}
+	return s.Storage.EnqueueURLsDeletion(ctx, msgs)
+}
+
+func (s *flakyDeletionJobsStorage) ModifyJob(ctx context.Context, id int64, modify func(job *models.Job)) (*models.Job, error) {
+	if s.failModify.Load() {
+		return nil, errors.New("jobs unavailable")
+	}
+	return s.Storage.ModifyJob(ctx, id, modify)
+}
+
+func TestDeletionJobConsistency(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.DeletionFlushInterval = time.Hour
+	mapStore, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+	store := &flakyDeletionJobsStorage{Storage: mapStore}
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/consistency")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	shortID := strings.TrimPrefix(rec.Body.String(), config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	deleteURL := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["`+shortID+`"]`))
+		req.AddCookie(token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	ctx := context.Background()
+
+	// задача, урлы которой не попали в очередь, не остается висеть в ожидании.
+	store.failEnqueue.Store(true)
+	assert.Equal(t, http.StatusInternalServerError, deleteURL().Code)
+	job, err := store.SelectJob(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.NotNil(t, job.FinishedAt)
+	assert.Equal(t, models.JobURLFailed, job.URLs[0].Status)
+
+	// сообщения не подтверждаются, пока их результаты не сохранены в задаче.
+	store.failEnqueue.Store(false)
+	store.failModify.Store(true)
+	rec = deleteURL()
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), job))
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.NoError(t, service.Shutdown(shutdownCtx))
+
+	stats, err := store.SelectDeletionQueueStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Ready+stats.Delayed, "message was acked without saving its job")
+
+	job, err = store.SelectJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStatusPending, job.Status)
+}
+
+// outageDeleteStorage - хранилище, которое во время сбоя не отвечает на проверку связи и не записывает удаления.
+type outageDeleteStorage struct {
+	storage.Storage
+	outage  atomic.Bool
+	deletes atomic.Int32
+}
+
+func (s *outageDeleteStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error) {
+	if s.outage.Load() {
+		s.deletes.Add(1)
+		return nil, errors.New("connection refused")
+	}
+	return s.Storage.DeleteURLs(ctx, data)
+}
+
+func (s *outageDeleteStorage) Ping() error {
+	if s.outage.Load() {
+		return errors.New("connection refused")
+	}
+	return s.Storage.Ping()
+}
+
+func TestDeletionOutageIsNotDeadLettered(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.DeletionFlushInterval = 5 * time.Millisecond
+	config.DeletionMaxAttempts = 2
+	config.DeletionRetryBackoff = time.Millisecond
+	mapStore, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+	store := &outageDeleteStorage{Storage: mapStore}
+	store.outage.Store(true)
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/outage")))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	shortID := strings.TrimPrefix(rec.Body.String(), config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["`+shortID+`"]`))
+	req.AddCookie(token)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	var job models.Job
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+
+	// попыток во время сбоя больше, чем DeletionMaxAttempts, но сообщение остается в очереди.
+	assert.Eventually(t, func() bool { return store.deletes.Load() > 5 }, 5*time.Second, 5*time.Millisecond)
+	stats, err := store.SelectDeletionQueueStats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), stats.DeadLetters, "message dead-lettered during storage outage")
+
+	store.outage.Store(false)
+	assert.Eventually(t, func() bool {
+		loaded, err := store.SelectJob(context.Background(), job.ID)
+		return err == nil && loaded.Status == models.JobStatusDone
+	}, 5*time.Second, 5*time.Millisecond, "deletion wasn't finished after outage")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, service.Shutdown(ctx))
+}
+
+// poisonDeleteStorage - хранилище, в котором запись удалений падает на батчах с урлом poison.
+type poisonDeleteStorage struct {
+	storage.Storage
+	poison string
+}
+
+func (s *poisonDeleteStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error) {
+	for _, msg := range data {
+		if msg.ShortURL == s.poison {
+			return nil, errors.New("poisoned")
+		}
+	}
+	return s.Storage.DeleteURLs(ctx, data)
+}
+
+func TestDeletionRetryAndDeadLetters(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.DeletionFlushInterval = 5 * time.Millisecond
+	config.DeletionMaxAttempts = 3
+	config.DeletionRetryBackoff = time.Millisecond
+	config.DeletionConcurrency = 2
+	mapStore, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+	store := &poisonDeleteStorage{Storage: mapStore, poison: "poison"}
+
+	_, trustedSubnet, err := net.ParseCIDR("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, trustedSubnet)
+	router := NewRouter(*HTTPHandler)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/poison")))
+	assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+	shortID := strings.TrimPrefix(rec.Body.String(), config.BaseURL+"/")
+
+	var token *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			token = cookie
+		}
+	}
+	require.NotNil(t, token, "Token cookie not set")
+
+	deadLettered, err := strconv.ParseInt(expvar.Get("deletions_dead_lettered").String(), 10, 64)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["`+shortID+`","poison"]`))
+	req.AddCookie(token)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code, "Response statusCode didn't match expected")
+
+	var job models.Job
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+
+	assert.Eventually(t, func() bool {
+		loaded, err := store.SelectJob(context.Background(), job.ID)
+		if err != nil || loaded.FinishedAt == nil {
+			return false
+		}
+		job = *loaded
+		return true
+	}, 5*time.Second, 5*time.Millisecond, "deletion job didn't finish")
+
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Equal(t, 1, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, []models.JobURLResult{
+		{ShortURL: shortID, Status: models.JobURLDeleted},
+		{ShortURL: "poison", Status: models.JobURLFailed, Error: "poisoned"},
+	}, job.URLs)
+
+	// результаты сохраняются в задаче до переноса сообщения в очередь недоставленных.
+	assert.Eventually(t, func() bool {
+		stats, err := store.SelectDeletionQueueStats(context.Background())
+		return err == nil && stats.DeadLetters == 1
+	}, 5*time.Second, 5*time.Millisecond, "message wasn't moved to dead letters")
+
+	serveDeadLetters := func(query string, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/internal/deletions/dead-letters"+query, nil)
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, serveDeadLetters("", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serveDeadLetters("?limit=100000", "10.0.0.1").Code)
+
+	deadLettersRec := serveDeadLetters("", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, deadLettersRec.Code, "Response statusCode didn't match expected")
+
+	var deadLetters []models.DeletionDeadLetter
+	assert.NoError(t, json.Unmarshal(deadLettersRec.Body.Bytes(), &deadLetters))
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "poison", deadLetters[0].ShortURL)
+	assert.Equal(t, job.ID, deadLetters[0].JobID)
+	assert.Equal(t, config.DeletionMaxAttempts, deadLetters[0].Attempts)
+	assert.Equal(t, "poisoned", deadLetters[0].Error)
+
+	after := serveDeadLetters(fmt.Sprintf("?after=%d", deadLetters[0].ID), "10.0.0.1")
+	assert.Equal(t, "[]", strings.TrimSpace(after.Body.String()))
+
+	assert.Equal(t, fmt.Sprint(deadLettered+1), expvar.Get("deletions_dead_lettered").String())
+
+	stats, err := store.SelectDeletionQueueStats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &models.DeletionQueueStats{DeadLetters: 1}, stats)
+}
+
+func TestURLTransfer(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	_, trustedSubnet, err := net.ParseCIDR("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, trustedSubnet)
+	router := NewRouter(*HTTPHandler)
+
+	shorten := func(cookie *http.Cookie, originalURL string) (string, *http.Cookie) {
+		reqBody, err := json.Marshal(models.ShortenURLRequest{URL: originalURL})
+		assert.NoError(t, err, "marshal request error")
+
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(reqBody)))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+		var created models.ShortenURLResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "token" {
+				cookie = c
+			}
+		}
+		return strings.TrimPrefix(created.Result, config.BaseURL+"/"), cookie
+	}
+
+	first, owner := shorten(nil, "https://example.com/transfer-1")
+	require.NotNil(t, owner, "Token cookie not set")
+	second, _ := shorten(owner, "https://example.com/transfer-2")
+	_, recipient := shorten(nil, "https://example.com/transfer-recipient")
+	require.NotNil(t, recipient, "Token cookie not set")
+
+	send := func(cookie *http.Cookie, method string, target string, body any) *httptest.ResponseRecorder {
+		var reqBody []byte
+		if body != nil {
+			reqBody, err = json.Marshal(body)
+			assert.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, target, strings.NewReader(string(reqBody)))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	createTransfer := func(urls []string) models.URLTransfer {
+		rec := send(owner, http.MethodPost, "/api/user/transfers", models.URLTransferRequest{URLs: urls})
+		assert.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+		var transfer models.URLTransfer
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &transfer))
+		return transfer
+	}
+
+	t.Run("invalid offers are rejected", func(t *testing.T) {
+		rec := send(owner, http.MethodPost, "/api/user/transfers", models.URLTransferRequest{})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = send(owner, http.MethodPost, "/api/user/transfers", models.URLTransferRequest{URLs: []string{"unknown"}})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = send(recipient, http.MethodPost, "/api/user/transfers", models.URLTransferRequest{URLs: []string{first}})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("cancelled offer can't be accepted", func(t *testing.T) {
+		transfer := createTransfer([]string{second})
+		assert.NotEmpty(t, transfer.Token)
+		assert.Equal(t, models.URLTransferPending, transfer.Status)
+
+		rec := send(recipient, http.MethodDelete, fmt.Sprintf("/api/user/transfers/%d", transfer.ID), nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "recipient cancelled owner's transfer")
+
+		rec = send(owner, http.MethodDelete, fmt.Sprintf("/api/user/transfers/%d", transfer.ID), nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = send(recipient, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: transfer.Token})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("accepted offer moves ownership", func(t *testing.T) {
+		transfer := createTransfer([]string{first, second, first})
+		assert.Equal(t, []string{first, second}, transfer.ShortURLs)
+
+		rec := send(recipient, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: "wrong"})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = send(owner, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: transfer.Token})
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "owner accepted own transfer")
+
+		rec = send(recipient, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: transfer.Token})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var accepted models.URLTransfer
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &accepted))
+		assert.Equal(t, models.URLTransferAccepted, accepted.Status)
+		assert.Empty(t, accepted.Token, "token leaked after creation")
+		assert.NotNil(t, accepted.AcceptedAt)
+
+		recipientID, err := auth.GetUserID(recipient.Value)
+		assert.NoError(t, err)
+		for _, shortURL := range []string{first, second} {
+			data, err := store.SelectURLData(context.Background(), shortURL)
+			assert.NoError(t, err)
+			assert.Equal(t, recipientID, data.UserID, "ownership didn't move")
+		}
+
+		rec = send(recipient, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: transfer.Token})
+		assert.Equal(t, http.StatusConflict, rec.Code, "transfer accepted twice")
+
+		rec = send(owner, http.MethodDelete, fmt.Sprintf("/api/user/transfers/%d", transfer.ID), nil)
+		assert.Equal(t, http.StatusConflict, rec.Code, "accepted transfer cancelled")
+
+		req := httptest.NewRequest(http.MethodGet, "/api/internal/urls/"+first+"/ownership", nil)
+		req.Header.Set("X-Real-IP", "10.1.2.3")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var audit []models.URLOwnershipAudit
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &audit))
+		require.Len(t, audit, 1)
+		assert.Equal(t, transfer.ID, audit[0].TransferID)
+		assert.Equal(t, transfer.FromUserID, audit[0].FromUserID)
+		assert.Equal(t, recipientID, audit[0].ToUserID)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/internal/urls/"+first+"/ownership", nil)
+		req.Header.Set("X-Real-IP", "192.168.1.1")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("stale offer is not applied partially", func(t *testing.T) {
+		third, _ := shorten(owner, "https://example.com/transfer-3")
+		transfer := createTransfer([]string{third})
+
+		// урл ушел к получателю по другому предложению.
+		other := createTransfer([]string{third})
+		rec := send(recipient, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: other.Token})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		_, stranger := shorten(nil, "https://example.com/transfer-stranger")
+		rec = send(stranger, http.MethodPost, "/api/user/transfers/accept", models.URLTransferAcceptRequest{Token: transfer.Token})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		audit, err := store.SelectURLOwnershipAudit(context.Background(), third)
+		assert.NoError(t, err)
+		assert.Len(t, audit, 1)
+	})
+}
+
+func TestURLStats(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	retained := config
+	retained.ClicksRawRetention = time.Hour
+	retained.ClicksHourlyRetention = 24 * time.Hour
+	retainedRouter := NewRouter(*NewHandler(retained, service.NewURLService(retained, store), store, nil))
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	shorten := func(originalURL string) (string, *http.Cookie) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(originalURL)))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "token" {
+				return strings.TrimPrefix(rec.Body.String(), config.BaseURL+"/"), c
+			}
+		}
+		t.Fatal("Token cookie not set")
+		return "", nil
+	}
+	getStats := func(cookie *http.Cookie, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	shortID, owner := shorten("https://example.com/stats")
+	_, stranger := shorten("https://example.com/stranger")
+
+	day := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.InsertClicks(context.Background(), []models.ClickEvent{
+		{ShortURL: shortID, ClickedAt: day, IPHash: "a", ReferrerHost: "news.example"},
+		{ShortURL: shortID, ClickedAt: day.Add(time.Hour), IPHash: "b"},
+		{ShortURL: shortID, ClickedAt: day.AddDate(0, 0, 1), IPHash: "a"},
+	}))
+	base := "/api/user/urls/" + shortID + "/stats"
+
+	t.Run("owner gets stats", func(t *testing.T) {
+		rec := getStats(owner, base+"?from=2026-10-18&to=2026-10-19&bucket=day")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var stats models.URLStatsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		assert.Equal(t, config.BaseURL+"/"+shortID, stats.ShortURL)
+		assert.Equal(t, int64(3), stats.TotalClicks)
+		assert.Equal(t, int64(2), stats.UniqueVisitors)
+		assert.Equal(t, []models.StatsBucket{
+			{Start: day.Truncate(24 * time.Hour), Clicks: 2},
+			{Start: day.Truncate(24*time.Hour).AddDate(0, 0, 1), Clicks: 1},
+		}, stats.TimeSeries)
+	})
+
+	t.Run("foreign and missing links", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, getStats(stranger, base).Code, "stranger saw link stats")
+		assert.Equal(t, http.StatusNotFound, getStats(owner, "/api/user/urls/missing/stats").Code)
+		assert.Equal(t, http.StatusForbidden, getStats(nil, base).Code, "new session saw link stats")
+	})
+
+	t.Run("bad params", func(t *testing.T) {
+		for _, query := range []string{"?bucket=year", "?tz=Mars/Base", "?from=yesterday", "?from=2026-10-19&to=2026-10-18", "?include_bots=maybe"} {
+			assert.Equal(t, http.StatusBadRequest, getStats(owner, base+query).Code, query)
+		}
+	})
+
+	t.Run("hourly stats past hourly retention", func(t *testing.T) {
+		from := time.Now().UTC().AddDate(0, 0, -10).Format(time.DateOnly)
+		for bucket, code := range map[string]int{"hour": http.StatusBadRequest, "day": http.StatusOK} {
+			req := httptest.NewRequest(http.MethodGet, base+"?from="+from+"&bucket="+bucket, nil)
+			req.AddCookie(owner)
+			rec := httptest.NewRecorder()
+			retainedRouter.ServeHTTP(rec, req)
+			assert.Equal(t, code, rec.Code, bucket)
+		}
+	})
+}
+
+func TestWorkspaces(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	config.DeletionFlushInterval = 10 * time.Millisecond
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	send := func(cookie *http.Cookie, method string, target string, body any) *httptest.ResponseRecorder {
+		var reqBody []byte
+		if body != nil {
+			reqBody, err = json.Marshal(body)
+			assert.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, target, strings.NewReader(string(reqBody)))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	newUser := func() *http.Cookie {
+		rec := send(nil, http.MethodGet, "/api/workspaces", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "token" {
+				return c
+			}
+		}
+		t.Fatal("Token cookie not set")
+		return nil
+	}
+
+	owner, editor, viewer, stranger := newUser(), newUser(), newUser(), newUser()
+	editorID, err := auth.GetUserID(editor.Value)
+	assert.NoError(t, err)
+
+	rec := send(owner, http.MethodPost, "/api/workspaces", models.WorkspaceRequest{Name: " "})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = send(owner, http.MethodPost, "/api/workspaces", models.WorkspaceRequest{Name: "Marketing"})
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var workspace models.Workspace
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &workspace))
+	assert.Equal(t, "Marketing", workspace.Name)
+	base := fmt.Sprintf("/api/workspaces/%d", workspace.ID)
+
+	join := func(cookie *http.Cookie, role string) string {
+		rec := send(owner, http.MethodPost, base+"/invites", models.WorkspaceInviteRequest{Role: role})
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var invite models.WorkspaceInvite
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &invite))
+		assert.NotEmpty(t, invite.Token)
+
+		rec = send(cookie, http.MethodPost, "/api/workspaces/invites/accept", models.WorkspaceInviteAcceptRequest{Token: invite.Token})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		return invite.Token
+	}
+
+	editorToken := join(editor, models.WorkspaceRoleEditor)
+	join(viewer, models.WorkspaceRoleViewer)
+
+	t.Run("invites and members", func(t *testing.T) {
+		rec := send(owner, http.MethodPost, base+"/invites", models.WorkspaceInviteRequest{Role: "admin"})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = send(editor, http.MethodPost, base+"/invites", models.WorkspaceInviteRequest{Role: models.WorkspaceRoleViewer})
+		assert.Equal(t, http.StatusForbidden, rec.Code, "editor created an invite")
+
+		rec = send(stranger, http.MethodPost, "/api/workspaces/invites/accept", models.WorkspaceInviteAcceptRequest{Token: editorToken})
+		assert.Equal(t, http.StatusConflict, rec.Code, "invite accepted twice")
+
+		rec = send(stranger, http.MethodGet, base+"/members", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "stranger saw the workspace")
+
+		rec = send(viewer, http.MethodGet, base+"/members", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var members []models.WorkspaceMember
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &members))
+		assert.Len(t, members, 3)
+
+		rec = send(editor, http.MethodGet, "/api/workspaces", nil)
+		var workspaces []models.Workspace
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &workspaces))
+		require.Len(t, workspaces, 1)
+		assert.Equal(t, models.WorkspaceRoleEditor, workspaces[0].Role)
+	})
+
+	t.Run("last owner is kept", func(t *testing.T) {
+		ownerID, err := auth.GetUserID(owner.Value)
+		assert.NoError(t, err)
+
+		rec := send(owner, http.MethodPut, base+"/members/"+ownerID, models.WorkspaceMemberRequest{Role: models.WorkspaceRoleEditor})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		rec = send(owner, http.MethodDelete, base+"/members/"+ownerID, nil)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		rec = send(owner, http.MethodDelete, "/api/user", nil)
+		assert.Equal(t, http.StatusConflict, rec.Code, "last owner erased their account")
+		_, err = store.EraseUserData(context.Background(), ownerID, 0)
+		assert.ErrorIs(t, err, storage.ErrConflict, "last owner erased their account")
+
+		rec = send(editor, http.MethodPut, base+"/members/"+editorID, models.WorkspaceMemberRequest{Role: models.WorkspaceRoleOwner})
+		assert.Equal(t, http.StatusForbidden, rec.Code, "editor promoted themselves")
+	})
+
+	var shortID string
+	t.Run("links follow roles", func(t *testing.T) {
+		rec := send(viewer, http.MethodGet, base+"/urls", nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code, "empty workspace wasn't listed")
+
+		rec = send(viewer, http.MethodPost, base+"/urls", models.ShortenURLRequest{URL: "https://example.com/workspace-viewer"})
+		assert.Equal(t, http.StatusForbidden, rec.Code, "viewer created a link")
+
+		rec = send(editor, http.MethodPost, base+"/urls", models.ShortenURLRequest{URL: "https://example.com/workspace"})
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var created models.ShortenURLResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		shortID = strings.TrimPrefix(created.Result, config.BaseURL+"/")
+
+		rec = send(viewer, http.MethodGet, base+"/urls", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var urls []models.GetUserURLsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &urls))
+		require.Len(t, urls, 1)
+		assert.Equal(t, shortID, urls[0].ShortURL)
+
+		rec = send(stranger, http.MethodGet, base+"/urls", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = send(editor, http.MethodGet, "/api/user/urls", nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code, "workspace link listed as personal")
+
+		rec = send(viewer, http.MethodDelete, base+"/urls", []string{shortID})
+		assert.Equal(t, http.StatusForbidden, rec.Code, "viewer deleted a link")
+
+		title := "Campaign"
+		rec = send(owner, http.MethodPatch, "/api/user/urls/"+shortID, models.UpdateURLMetadataRequest{Title: &title})
+		assert.Equal(t, http.StatusOK, rec.Code, "owner couldn't edit editor's link")
+
+		rec = send(viewer, http.MethodPatch, "/api/user/urls/"+shortID, models.UpdateURLMetadataRequest{Title: &title})
+		assert.Equal(t, http.StatusForbidden, rec.Code, "viewer edited a link")
+
+		rec = send(viewer, http.MethodGet, "/api/user/urls/"+shortID+"/stats", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = send(stranger, http.MethodGet, "/api/user/urls/"+shortID+"/stats", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "stranger saw workspace link stats")
+	})
+
+	t.Run("owner deletes editor's link", func(t *testing.T) {
+		rec := send(owner, http.MethodDelete, base+"/urls", []string{shortID})
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		location := rec.Header().Get("Location")
+
+		var job models.Job
+		assert.Eventually(t, func() bool {
+			rec := send(owner, http.MethodGet, location, nil)
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+			return job.Status != models.JobStatusPending && job.Status != models.JobStatusRunning
+		}, 5*time.Second, 10*time.Millisecond, "deletion job didn't finish")
+		assert.Equal(t, []models.JobURLResult{{ShortURL: shortID, Status: models.JobURLDeleted}}, job.URLs)
+
+		data, err := store.SelectURLData(context.Background(), shortID)
+		assert.NoError(t, err)
+		assert.True(t, data.DeletedFlag)
+	})
+
+	t.Run("member leaves", func(t *testing.T) {
+		rec := send(editor, http.MethodDelete, base+"/members/"+editorID, nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = send(editor, http.MethodGet, base+"/urls", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = send(editor, http.MethodGet, "/api/user/urls/"+shortID+"/stats", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "creator kept access after leaving")
+	})
+}
+
+func TestCollections(t *testing.T) {
+	var config config.Config
+	config.BaseURL = "http://localhost:8080"
+	store, err := storage.NewStorage(config)
+	assert.NoError(t, err, "storage initializing error")
+
+	service := service.NewURLService(config, store)
+	HTTPHandler := NewHandler(config, service, store, nil)
+	router := NewRouter(*HTTPHandler)
+
+	send := func(cookie *http.Cookie, method string, target string, body any) *httptest.ResponseRecorder {
+		var reqBody []byte
+		if body != nil {
+			reqBody, err = json.Marshal(body)
+			assert.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, target, strings.NewReader(string(reqBody)))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	shorten := func(cookie *http.Cookie, originalURL string) (string, *http.Cookie) {
+		rec := send(cookie, http.MethodPost, "/api/shorten", models.ShortenURLRequest{URL: originalURL})
+		require.Equal(t, http.StatusCreated, rec.Code, "Response statusCode didn't match expected")
+
+		var created models.ShortenURLResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "token" {
+				cookie = c
+			}
+		}
+		return strings.TrimPrefix(created.Result, config.BaseURL+"/"), cookie
+	}
+
+	createCollection := func(cookie *http.Cookie, name string) models.Collection {
+		rec := send(cookie, http.MethodPost, "/api/user/collections", models.CollectionRequest{Name: name})
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		var collection models.Collection
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &collection))
+		return collection
+	}
+
+	listURLs := func(cookie *http.Cookie, collectionID int64) []string {
+		rec := send(cookie, http.MethodGet, fmt.Sprintf("/api/user/collections/%d/urls", collectionID), nil)
+		if rec.Code == http.StatusNoContent {
+			return nil
+		}
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var urls []models.GetUserURLsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &urls))
+		var shortURLs []string
+		for _, u := range urls {
+			assert.Equal(t, collectionID, u.CollectionID)
+			shortURLs = append(shortURLs, u.ShortURL)
+		}
+		return shortURLs
+	}
+
+	first, owner := shorten(nil, "https://example.com/collection-1")
+	require.NotNil(t, owner, "Token cookie not set")
+	second, _ := shorten(owner, "https://example.com/collection-2")
+	foreign, stranger := shorten(nil, "https://example.com/collection-foreign")
+
+	rec := send(owner, http.MethodPost, "/api/user/collections", models.CollectionRequest{Name: " "})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	blog := createCollection(owner, "Blog")
+	news := createCollection(owner, "News")
+	rec = send(owner, http.MethodPost, "/api/user/collections", models.CollectionRequest{Name: "Blog"})
+	assert.Equal(t, http.StatusConflict, rec.Code, "duplicate name accepted")
+	createCollection(stranger, "Blog")
+
+	blogURLs := fmt.Sprintf("/api/user/collections/%d/urls", blog.ID)
+	newsURLs := fmt.Sprintf("/api/user/collections/%d/urls", news.ID)
+
+	t.Run("collections are private", func(t *testing.T) {
+		rec := send(owner, http.MethodGet, "/api/user/collections", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var collections []models.Collection
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &collections))
+		require.Len(t, collections, 2)
+		assert.Equal(t, "Blog", collections[0].Name)
+
+		rec = send(stranger, http.MethodGet, fmt.Sprintf("/api/user/collections/%d", blog.ID), nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "stranger saw the collection")
+
+		rec = send(stranger, http.MethodPost, blogURLs, models.CollectionURLsRequest{URLs: []string{foreign}})
+		assert.Equal(t, http.StatusNotFound, rec.Code, "stranger filled the collection")
+
+		rec = send(owner, http.MethodPost, blogURLs, models.CollectionURLsRequest{URLs: []string{foreign}})
+		assert.Equal(t, http.StatusForbidden, rec.Code, "foreign url added")
+
+		rec = send(owner, http.MethodPost, blogURLs, models.CollectionURLsRequest{})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("urls move between collections", func(t *testing.T) {
+		rec := send(owner, http.MethodPost, blogURLs, models.CollectionURLsRequest{URLs: []string{first, second}})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.ElementsMatch(t, []string{first, second}, listURLs(owner, blog.ID))
+		assert.Empty(t, listURLs(owner, news.ID))
+
+		rec = send(owner, http.MethodPost, newsURLs, models.CollectionURLsRequest{URLs: []string{second}})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, []string{first}, listURLs(owner, blog.ID))
+		assert.Equal(t, []string{second}, listURLs(owner, news.ID))
+
+		// урл из другой коллекции не исключается.
+		rec = send(owner, http.MethodDelete, blogURLs, models.CollectionURLsRequest{URLs: []string{second}})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, []string{second}, listURLs(owner, news.ID))
+	})
+
+	t.Run("stats sum collection urls", func(t *testing.T) {
+		rec := send(owner, http.MethodPost, blogURLs, models.CollectionURLsRequest{URLs: []string{first}})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		now := time.Now()
+		assert.NoError(t, store.InsertClicks(context.Background(), []models.ClickEvent{
+			{ShortURL: first, ClickedAt: now},
+			{ShortURL: first, ClickedAt: now},
+			{ShortURL: first, ClickedAt: now, IsBot: true},
+			{ShortURL: second, ClickedAt: now},
+		}))
+
+		rec = send(owner, http.MethodGet, fmt.Sprintf("/api/user/collections/%d/stats", blog.ID), nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var stats models.CollectionStatsResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		assert.Equal(t, int64(2), stats.TotalClicks)
+		assert.Equal(t, int64(1), stats.BotClicks)
+		assert.Equal(t, []models.StatsCount{{Name: config.BaseURL + "/" + first, Clicks: 2}}, stats.URLs)
+
+		var seriesClicks int64
+		for _, b := range stats.TimeSeries {
+			seriesClicks += b.Clicks
+		}
+		assert.Equal(t, int64(2), seriesClicks)
+
+		rec = send(owner, http.MethodGet, fmt.Sprintf("/api/user/collections/%d/stats?bucket=year", blog.ID), nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("rename and delete", func(t *testing.T) {
+		rec := send(owner, http.MethodPut, fmt.Sprintf("/api/user/collections/%d", news.ID), models.CollectionRequest{Name: "Blog"})
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		rec = send(owner, http.MethodPut, fmt.Sprintf("/api/user/collections/%d", news.ID), models.CollectionRequest{Name: "Press"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var renamed models.Collection
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &renamed))
+		assert.Equal(t, "Press", renamed.Name)
+		assert.Equal(t, news.CreatedAt.Unix(), renamed.CreatedAt.Unix())
+
+		rec = send(owner, http.MethodDelete, fmt.Sprintf("/api/user/collections/%d", news.ID), nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = send(owner, http.MethodGet, fmt.Sprintf("/api/user/collections/%d", news.ID), nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		data, err := store.SelectURLData(context.Background(), second)
+		assert.NoError(t, err)
+		assert.Zero(t, data.CollectionID, "url kept deleted collection")
+	})
+}
@@ -19,10 +19,51 @@ func NewRouter(handler Handler) *mux.Router {
 	router.HandleFunc(`/`, middlewareStack(handler.CompressURL))
 	router.HandleFunc(`/api/shorten`, middlewareStack(handler.GetShortURL))
 	router.HandleFunc(`/{id:\w+}`, middlewareStack(handler.RedirectByShortURLID))
+	router.HandleFunc(`/{id:\w+}/qr`, middlewareStack(handler.GetQRCode)).Methods("GET")
 	router.HandleFunc(`/api/shorten/batch`, middlewareStack(handler.GetShortURLsBatch))
 	router.HandleFunc(`/api/user/urls`, middlewareStack(handler.GetUserURLs)).Methods("GET")
 	router.HandleFunc(`/api/user/urls`, middlewareStack(handler.DeleteUserURLs)).Methods("DELETE")
-	router.HandleFunc(`/api/internal/stats`, middlewareStack(handler.DeleteUserURLs)).Methods("GET")
+	router.HandleFunc(`/api/user/urls/restore`, middlewareStack(handler.RestoreUserURLs)).Methods("POST")
+	router.HandleFunc(`/api/user/urls/{id:\w+}`, middlewareStack(handler.UpdateURLMetadata)).Methods("PATCH")
+	router.HandleFunc(`/api/user/trash`, middlewareStack(handler.GetTrashURLs)).Methods("GET")
+	router.HandleFunc(`/api/user/urls/{id:\w+}/stats`, middlewareStack(handler.GetURLStats)).Methods("GET")
+	router.HandleFunc(`/api/user/urls/{id:\w+}/clicks.{format:csv|ndjson}`, middlewareStack(handler.ExportClicks)).Methods("GET")
+	router.HandleFunc(`/api/user/export`, middlewareStack(handler.ExportUserData)).Methods("GET")
+	router.HandleFunc(`/api/user/jobs/{jid:[0-9]+}`, middlewareStack(handler.GetJob)).Methods("GET")
+	router.HandleFunc(`/api/user/imports`, middlewareStack(handler.ImportURLs)).Methods("POST")
+	router.HandleFunc(`/api/user/imports/{jid:[0-9]+}`, middlewareStack(handler.GetImportJob)).Methods("GET")
+	router.HandleFunc(`/api/user`, middlewareStack(handler.EraseUser)).Methods("DELETE")
+	router.HandleFunc(`/api/user/erasures/{jid:[0-9]+}`, middlewareStack(handler.GetErasureJob)).Methods("GET")
+	router.HandleFunc(`/api/user/transfers`, middlewareStack(handler.CreateURLTransfer)).Methods("POST")
+	router.HandleFunc(`/api/user/transfers/accept`, middlewareStack(handler.AcceptURLTransfer)).Methods("POST")
+	router.HandleFunc(`/api/user/transfers/{tid:[0-9]+}`, middlewareStack(handler.CancelURLTransfer)).Methods("DELETE")
+	router.HandleFunc(`/api/user/collections`, middlewareStack(handler.CreateCollection)).Methods("POST")
+	router.HandleFunc(`/api/user/collections`, middlewareStack(handler.GetUserCollections)).Methods("GET")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}`, middlewareStack(handler.GetCollection)).Methods("GET")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}`, middlewareStack(handler.RenameCollection)).Methods("PUT")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}`, middlewareStack(handler.DeleteCollection)).Methods("DELETE")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}/urls`, middlewareStack(handler.GetCollectionURLs)).Methods("GET")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}/urls`, middlewareStack(handler.AddURLsToCollection)).Methods("POST")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}/urls`, middlewareStack(handler.RemoveURLsFromCollection)).Methods("DELETE")
+	router.HandleFunc(`/api/user/collections/{cid:[0-9]+}/stats`, middlewareStack(handler.GetCollectionStats)).Methods("GET")
+	router.HandleFunc(`/api/workspaces`, middlewareStack(handler.CreateWorkspace)).Methods("POST")
+	router.HandleFunc(`/api/workspaces`, middlewareStack(handler.GetUserWorkspaces)).Methods("GET")
+	router.HandleFunc(`/api/workspaces/invites/accept`, middlewareStack(handler.AcceptWorkspaceInvite)).Methods("POST")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/members`, middlewareStack(handler.GetWorkspaceMembers)).Methods("GET")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/members/{uid}`, middlewareStack(handler.UpdateWorkspaceMember)).Methods("PUT")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/members/{uid}`, middlewareStack(handler.RemoveWorkspaceMember)).Methods("DELETE")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/invites`, middlewareStack(handler.CreateWorkspaceInvite)).Methods("POST")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/urls`, middlewareStack(handler.CreateWorkspaceURL)).Methods("POST")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/urls`, middlewareStack(handler.GetWorkspaceURLs)).Methods("GET")
+	router.HandleFunc(`/api/workspaces/{wid:[0-9]+}/urls`, middlewareStack(handler.DeleteWorkspaceURLs)).Methods("DELETE")
+	router.HandleFunc(`/{id:\w+}/report`, middlewareStack(handler.ReportURL)).Methods("POST")
+	router.HandleFunc(`/api/internal/stats`, middlewareStack(handler.GetStats)).Methods("GET")
+	router.HandleFunc(`/api/internal/reports`, middlewareStack(handler.GetAbuseReports)).Methods("GET")
+	router.HandleFunc(`/api/internal/reports/{rid:[0-9]+}`, middlewareStack(handler.ModerateAbuseReport)).Methods("POST")
+	router.HandleFunc(`/api/internal/deletions/dead-letters`, middlewareStack(handler.GetDeletionDeadLetters)).Methods("GET")
+	router.HandleFunc(`/api/internal/urls/{id:\w+}/ownership`, middlewareStack(handler.GetURLOwnershipAudit)).Methods("GET")
+	router.HandleFunc(`/api/internal/urls/{id:\w+}/takedown`, middlewareStack(handler.TakedownURL)).Methods("PUT")
+	router.HandleFunc(`/api/internal/urls/{id:\w+}/takedown`, middlewareStack(handler.RestoreURL)).Methods("DELETE")
 
 	return router
 }
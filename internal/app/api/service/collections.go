@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidCollection - ошибка валидации коллекции урлов или списка урлов для переноса.
+var ErrInvalidCollection = errors.New("invalid collection request")
+
+const (
+	// maxCollectionNameLength - максимальная длина названия коллекции в символах.
+	maxCollectionNameLength = 100
+	// maxCollectionMoveURLs - максимальное количество урлов в одном запросе переноса.
+	maxCollectionMoveURLs = 1000
+)
+
+// CreateCollection создает коллекцию урлов пользователя.
+// Названия коллекций одного пользователя не повторяются, для занятого названия возвращается storage.ErrConflict.
+func (srv *URLService) CreateCollection(ctx context.Context, userID string, req models.CollectionRequest) (*models.Collection, error) {
+	name, err := collectionName(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	collection := &models.Collection{UserID: userID, Name: name, CreatedAt: now, UpdatedAt: now}
+	if err := srv.Storage.InsertCollection(ctx, collection); err != nil {
+		if !errors.Is(err, storage.ErrConflict) {
+			logger.Log.Info("Failed to save collection", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// GetUserCollections возвращает коллекции пользователя в порядке названий.
+func (srv *URLService) GetUserCollections(ctx context.Context, userID string) ([]models.Collection, error) {
+	collections, err := srv.Storage.SelectUserCollections(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if collections == nil {
+		collections = []models.Collection{}
+	}
+	return collections, nil
+}
+
+// GetCollection возвращает коллекцию пользователя, чужие коллекции считаются несуществующими.
+func (srv *URLService) GetCollection(ctx context.Context, userID string, id int64) (*models.Collection, error) {
+	collection, err := srv.Storage.SelectCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if collection.UserID != userID {
+		return nil, storage.ErrNotFound
+	}
+	return collection, nil
+}
+
+// RenameCollection переименовывает коллекцию пользователя.
+func (srv *URLService) RenameCollection(ctx context.Context, userID string, id int64, req models.CollectionRequest) (*models.Collection, error) {
+	name, err := collectionName(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := srv.GetCollection(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	collection := &models.Collection{ID: id, Name: name, UpdatedAt: time.Now().UTC()}
+	if err := srv.Storage.UpdateCollection(ctx, collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// DeleteCollection удаляет коллекцию пользователя, ее урлы остаются у пользователя вне коллекций.
+func (srv *URLService) DeleteCollection(ctx context.Context, userID string, id int64) error {
+	if _, err := srv.GetCollection(ctx, userID, id); err != nil {
+		return err
+	}
+	return srv.Storage.DeleteCollection(ctx, id)
+}
+
+// AddURLsToCollection переносит личные урлы пользователя в коллекцию, в том числе из другой коллекции.
+func (srv *URLService) AddURLsToCollection(ctx context.Context, userID string, id int64, req models.CollectionURLsRequest) error {
+	if _, err := srv.GetCollection(ctx, userID, id); err != nil {
+		return err
+	}
+
+	shortURLs, err := srv.ownCollectionURLs(ctx, userID, req)
+	if err != nil {
+		return err
+	}
+	return srv.Storage.MoveURLsToCollection(ctx, userID, shortURLs, storage.AnyCollection, id)
+}
+
+// RemoveURLsFromCollection исключает урлы пользователя из коллекции, урлы из других коллекций не меняются.
+func (srv *URLService) RemoveURLsFromCollection(ctx context.Context, userID string, id int64, req models.CollectionURLsRequest) error {
+	if _, err := srv.GetCollection(ctx, userID, id); err != nil {
+		return err
+	}
+
+	shortURLs, err := srv.ownCollectionURLs(ctx, userID, req)
+	if err != nil {
+		return err
+	}
+	return srv.Storage.MoveURLsToCollection(ctx, userID, shortURLs, id, 0)
+}
+
+// GetCollectionURLs возвращает страницу урлов коллекции пользователя.
+// Параметры поиска и пагинации те же, что у GetUserURLs.
+func (srv *URLService) GetCollectionURLs(ctx context.Context, userID string, id int64, req models.UserURLsRequest) (*models.UserURLsResponse, error) {
+	if _, err := srv.GetCollection(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	filter, err := parseUserURLsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	filter.UserID = userID
+	filter.CollectionID = id
+
+	page, err := srv.selectURLsPage(ctx, filter)
+	if errors.Is(err, storage.ErrNotFound) {
+		return &models.UserURLsResponse{}, nil
+	}
+	return page, err
+}
+
+// GetCollectionStats возвращает суммарную статистику переходов по всем урлам коллекции, включая удаленные.
+// Параметры периода те же, что у GetURLStats. Уникальные посетители по коллекции не считаются,
+// потому что оценки по отдельным урлам нельзя сложить.
+func (srv *URLService) GetCollectionStats(ctx context.Context, userID string, id int64, req models.URLStatsRequest) (*models.CollectionStatsResponse, error) {
+	filter, err := parseStatsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	filter.Rollup, err = srv.statsRollup(*filter)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := srv.GetCollection(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := srv.Storage.SelectCollectionClickStats(ctx, collection.ID, *filter)
+	if err != nil {
+		logger.Log.Info("Failed to get collection click stats", zap.Error(err))
+		return nil, fmt.Errorf("click stats selection error: %w", err)
+	}
+
+	resp.CollectionID = collection.ID
+	resp.Name = collection.Name
+	resp.From = filter.From.In(filter.Location)
+	resp.To = filter.To.In(filter.Location)
+	resp.Timezone = filter.Location.String()
+	resp.Bucket = filter.Bucket
+	resp.IncludeBots = filter.IncludeBots
+	if resp.URLs == nil {
+		resp.URLs = []models.StatsCount{}
+	}
+	for i := range resp.URLs {
+		resp.URLs[i].Name = srv.Config.BaseURL + "/" + resp.URLs[i].Name
+	}
+	resp.TimeSeries = fillStatsGaps(resp.TimeSeries, *filter)
+
+	return resp, nil
+}
+
+// collectionName - проверяет и нормализует название коллекции из запроса.
+func collectionName(req models.CollectionRequest) (string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxCollectionNameLength {
+		return "", ErrInvalidCollection
+	}
+	return name, nil
+}
+
+// ownCollectionURLs - проверяет, что урлы из запроса существуют и являются личными урлами пользователя,
+// и возвращает их без повторов.
+func (srv *URLService) ownCollectionURLs(ctx context.Context, userID string, req models.CollectionURLsRequest) ([]string, error) {
+	var shortURLs []string
+	seen := make(map[string]bool, len(req.URLs))
+	for _, shortURL := range req.URLs {
+		if shortURL == "" {
+			return nil, ErrInvalidCollection
+		}
+		if seen[shortURL] {
+			continue
+		}
+		seen[shortURL] = true
+		shortURLs = append(shortURLs, shortURL)
+	}
+	if len(shortURLs) == 0 || len(shortURLs) > maxCollectionMoveURLs {
+		return nil, ErrInvalidCollection
+	}
+
+	for _, shortURL := range shortURLs {
+		data, err := srv.Storage.SelectURLData(ctx, shortURL)
+		if err != nil {
+			return nil, err
+		}
+		if data.UserID != userID || data.WorkspaceID != 0 {
+			return nil, ErrURLNotOwned
+		}
+	}
+	return shortURLs, nil
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidDeadLettersFilter - ошибка неверных параметров страницы недоставленных сообщений удаления.
+var ErrInvalidDeadLettersFilter = errors.New("invalid dead letters filter")
+
+// Значения по умолчанию для обработчиков очереди удаления, если они не заданы в конфигурации.
+const (
+	deletionFlushInterval = 10 * time.Second
+	deletionBatchSize     = 1000
+	deletionMaxAttempts   = 5
+	deletionRetryBackoff  = time.Second
+)
+
+const (
+	// deletionMaxRetryBackoff - максимальная задержка перед повтором сообщения очереди удаления.
+	deletionMaxRetryBackoff = 10 * time.Minute
+	// deletionLease - время, на которое сообщения очереди удаления занимаются обработчиком. Сообщения,
+	// не подтвержденные за это время, например из-за падения экземпляра сервиса, снова забираются в обработку.
+	deletionLease = time.Minute
+	// deadLettersDefaultLimit и deadLettersMaxLimit - размер страницы недоставленных сообщений по умолчанию и максимальный.
+	deadLettersDefaultLimit = 50
+	deadLettersMaxLimit     = 500
+)
+
+// Метрики очереди удаления, публикуются через expvar на /debug/vars.
+// Размеры очереди обновляются обработчиками после каждого разбора очереди.
+var (
+	deletionQueueReady       = expvar.NewInt("deletion_queue_ready")
+	deletionQueueDelayed     = expvar.NewInt("deletion_queue_delayed")
+	deletionQueueDeadLetters = expvar.NewInt("deletion_queue_dead_letters")
+	deletionsProcessed       = expvar.NewInt("deletions_processed")
+	deletionsRetried         = expvar.NewInt("deletions_retried")
+	deletionsDeadLettered    = expvar.NewInt("deletions_dead_lettered")
+)
+
+// SendURLsToDeletion создает задачу удаления урлов пользователя и ставит урлы с id пользователя и задачи
+// в очередь удаления хранилища. Повторы в списке урлов отбрасываются.
+func (srv *URLService) SendURLsToDeletion(ctx context.Context, urls []string, userID string) (*models.Job, error) {
+	return srv.sendURLsToDeletion(ctx, urls, userID, 0)
+}
+
+// sendURLsToDeletion - создает задачу удаления урлов пользователя, с ненулевым workspaceID - урлов рабочего пространства,
+// и ставит урлы в очередь удаления. Если урлы не удалось поставить в очередь, задача завершается с ошибкой.
+func (srv *URLService) sendURLsToDeletion(ctx context.Context, urls []string, userID string, workspaceID int64) (*models.Job, error) {
+	now := time.Now().UTC()
+	job := &models.Job{
+		UserID:    userID,
+		Kind:      models.JobKindDeletion,
+		Status:    models.JobStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	seen := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		job.URLs = append(job.URLs, models.JobURLResult{ShortURL: url, Status: models.JobURLPending})
+	}
+	if len(job.URLs) == 0 {
+		job.Status = models.JobStatusDone
+		job.FinishedAt = &now
+	}
+
+	if err := srv.Storage.InsertJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if len(job.URLs) == 0 {
+		return job, nil
+	}
+
+	msgs := make([]models.URLForDeleteMsg, len(job.URLs))
+	for i, result := range job.URLs {
+		msgs[i] = models.URLForDeleteMsg{ShortURL: result.ShortURL, UserID: userID, WorkspaceID: workspaceID, JobID: job.ID}
+	}
+	if err := srv.Storage.EnqueueURLsDeletion(ctx, msgs); err != nil {
+		failedAt := time.Now().UTC()
+		job.Status = models.JobStatusFailed
+		job.Error = "urls could not be queued for deletion"
+		job.Processed, job.Failed = len(job.URLs), len(job.URLs)
+		for i := range job.URLs {
+			job.URLs[i].Status = models.JobURLFailed
+			job.URLs[i].Error = err.Error()
+		}
+		job.UpdatedAt = failedAt
+		job.FinishedAt = &failedAt
+		if err := srv.Storage.UpdateJob(context.WithoutCancel(ctx), job); err != nil {
+			logger.Log.Info("Failed to save deletion job", zap.Int64("job_id", job.ID), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// GetDeletionDeadLetters возвращает страницу недоставленных сообщений очереди удаления
+// с идентификаторами больше afterID.
+func (srv *URLService) GetDeletionDeadLetters(ctx context.Context, afterID int64, limit int) ([]models.DeletionDeadLetter, error) {
+	if limit == 0 {
+		limit = deadLettersDefaultLimit
+	}
+	if limit < 0 || limit > deadLettersMaxLimit || afterID < 0 {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidDeadLettersFilter, deadLettersMaxLimit)
+	}
+
+	return srv.Storage.SelectDeletionDeadLetters(ctx, afterID, limit)
+}
+
+// startDeletionWorkers запускает Config.DeletionConcurrency обработчиков очереди удаления.
+func (srv *URLService) startDeletionWorkers() {
+	concurrency := srv.Config.DeletionConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	srv.stopDeletions = stop
+	srv.deletionsDone = make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			srv.processDeletions(ctx)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(srv.deletionsDone)
+	}()
+}
+
+// Shutdown останавливает фоновые задачи сервиса и дожидается их завершения, в том числе записи
+// оставшихся событий перехода, затем останавливает обработчики очереди удаления и дорабатывает очередь до конца,
+// пока не истечет ctx. Недоработанные сообщения остаются в хранилище до следующего запуска.
+// Вызывается до закрытия хранилища.
+func (srv *URLService) Shutdown(ctx context.Context) error {
+	srv.stopBackground()
+	srv.stopDeletions()
+
+	backgroundDone := make(chan struct{})
+	go func() {
+		srv.backgroundWG.Wait()
+		close(backgroundDone)
+	}()
+
+	for _, done := range []<-chan struct{}{backgroundDone, srv.deletionsDone} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err := srv.drainDeletions(ctx)
+	srv.updateDeletionMetrics(context.WithoutCancel(ctx))
+	return err
+}
+
+// processDeletions периодически разбирает очередь удаления урлов до отмены ctx.
+func (srv *URLService) processDeletions(ctx context.Context) {
+	interval := srv.Config.DeletionFlushInterval
+	if interval <= 0 {
+		interval = deletionFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			if err := srv.drainDeletions(ctx); err != nil && ctx.Err() == nil {
+				logger.Log.Info("Failed to process deletion queue", zap.Error(err))
+			}
+			srv.updateDeletionMetrics(ctx)
+		}
+	}
+}
+
+// drainDeletions забирает сообщения из очереди удаления батчами, пока очередь не опустеет или не отменится ctx,
+// помечает их урлы удаленными и сохраняет результаты в задачах удаления. Начатый батч дорабатывается
+// и после отмены ctx. Если батч не удалось записать, его сообщения обрабатываются по одному, чтобы
+// отделить сообщения, на которых падает запись: они повторяются с экспоненциальной задержкой, а исчерпав
+// попытки, переносятся в очередь недоставленных и отмечаются в задачах как неудачные.
+// Если при этом недоступно само хранилище, попытка сообщениям не засчитывается, чтобы сбой хранилища
+// не переносил исправные сообщения в очередь недоставленных.
+func (srv *URLService) drainDeletions(ctx context.Context) error {
+	batchSize := srv.Config.DeletionBatchSize
+	if batchSize <= 0 {
+		batchSize = deletionBatchSize
+	}
+
+	for ctx.Err() == nil {
+		batchCtx := context.WithoutCancel(ctx)
+
+		batch, err := srv.Storage.ClaimURLsDeletion(batchCtx, batchSize, deletionLease)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		deleted, batchErr := srv.Storage.DeleteURLs(batchCtx, batch)
+		processed, failed := batch, []models.URLForDeleteMsg(nil)
+		if batchErr != nil {
+			logger.Log.Info("Failed to delete urls", zap.Int("count", len(batch)), zap.Error(batchErr))
+			processed, deleted, failed = srv.deleteURLsOneByOne(batchCtx, batch, batchErr)
+			if len(failed) != 0 && srv.Storage.Ping() != nil {
+				for i := range failed {
+					failed[i].Attempts--
+				}
+			}
+		}
+
+		if err := srv.finishDeletions(batchCtx, processed, deleted, failed); err != nil {
+			return err
+		}
+		if batchErr != nil {
+			return batchErr
+		}
+	}
+
+	return ctx.Err()
+}
+
+// deleteURLsOneByOne помечает удаленными урлы сообщений по одному. Возвращает обработанные сообщения,
+// сообщения с удаленными урлами и сообщения, которые не удалось записать, с ошибкой записи.
+func (srv *URLService) deleteURLsOneByOne(ctx context.Context, batch []models.URLForDeleteMsg, batchErr error) (processed, deleted, failed []models.URLForDeleteMsg) {
+	if len(batch) == 1 {
+		batch[0].Error = batchErr.Error()
+		return nil, nil, batch
+	}
+
+	for _, msg := range batch {
+		msgDeleted, err := srv.Storage.DeleteURLs(ctx, []models.URLForDeleteMsg{msg})
+		if err != nil {
+			msg.Error = err.Error()
+			failed = append(failed, msg)
+			continue
+		}
+		processed = append(processed, msg)
+		deleted = append(deleted, msgDeleted...)
+	}
+	return processed, deleted, failed
+}
+
+// finishDeletions сохраняет результаты обработанных сообщений и подтверждает их, откладывает повтор
+// неудачных сообщений, а исчерпавшие попытки переносит в очередь недоставленных.
+// Сообщения задач, результаты которых не удалось сохранить, не подтверждаются и не переносятся:
+// они остаются занятыми до истечения deletionLease и затем обрабатываются заново.
+func (srv *URLService) finishDeletions(ctx context.Context, processed, deleted, failed []models.URLForDeleteMsg) error {
+	maxAttempts := srv.Config.DeletionMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = deletionMaxAttempts
+	}
+
+	var deadLetters []models.URLForDeleteMsg
+	retries := make(map[int][]models.URLForDeleteMsg)
+	for _, msg := range failed {
+		if msg.Attempts >= maxAttempts {
+			deadLetters = append(deadLetters, msg)
+		} else {
+			retries[msg.Attempts] = append(retries[msg.Attempts], msg)
+		}
+	}
+
+	unsaved := srv.saveDeletionResults(ctx, processed, deleted, deadLetters)
+	processed = withoutJobs(processed, unsaved)
+	deadLetters = withoutJobs(deadLetters, unsaved)
+
+	if len(processed) != 0 {
+		ids := make([]int64, len(processed))
+		for i, msg := range processed {
+			ids[i] = msg.ID
+		}
+		if err := srv.Storage.AckURLsDeletion(ctx, ids); err != nil {
+			return err
+		}
+		deletionsProcessed.Add(int64(len(processed)))
+	}
+
+	for attempts, msgs := range retries {
+		retryAt := time.Now().Add(srv.deletionRetryDelay(attempts))
+		if err := srv.Storage.RetryURLsDeletion(ctx, msgs, retryAt); err != nil {
+			return err
+		}
+		deletionsRetried.Add(int64(len(msgs)))
+	}
+
+	if len(deadLetters) != 0 {
+		if err := srv.Storage.DeadLetterURLsDeletion(ctx, deadLetters); err != nil {
+			return err
+		}
+		deletionsDeadLettered.Add(int64(len(deadLetters)))
+		logger.Log.Info("Deletions moved to dead letters", zap.Int("count", len(deadLetters)))
+	}
+
+	return nil
+}
+
+// deletionRetryDelay возвращает задержку перед повтором сообщения, обработанного attempts раз:
+// базовая задержка удваивается с каждой попыткой, но не превышает deletionMaxRetryBackoff.
+func (srv *URLService) deletionRetryDelay(attempts int) time.Duration {
+	delay := srv.Config.DeletionRetryBackoff
+	if delay <= 0 {
+		delay = deletionRetryBackoff
+	}
+
+	for i := 1; i < attempts && delay < deletionMaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, deletionMaxRetryBackoff)
+}
+
+// updateDeletionMetrics обновляет метрики размеров очереди удаления.
+func (srv *URLService) updateDeletionMetrics(ctx context.Context) {
+	stats, err := srv.Storage.SelectDeletionQueueStats(ctx)
+	if err != nil {
+		logger.Log.Info("Failed to get deletion queue stats", zap.Error(err))
+		return
+	}
+
+	deletionQueueReady.Set(stats.Ready)
+	deletionQueueDelayed.Set(stats.Delayed)
+	deletionQueueDeadLetters.Set(stats.DeadLetters)
+}
+
+// saveDeletionResults - сохраняет в задачах удаления результаты по урлам: для обработанных сообщений - удален
+// или не найден, для недоставленных - неудачу с ошибкой последней попытки.
+// Задача завершается, когда обработаны все ее урлы. Возвращает задачи, которые не удалось сохранить.
+func (srv *URLService) saveDeletionResults(ctx context.Context, processed, deleted, deadLetters []models.URLForDeleteMsg) map[int64]bool {
+	isDeleted := make(map[int64]bool, len(deleted))
+	for _, msg := range deleted {
+		isDeleted[msg.ID] = true
+	}
+
+	results := make(map[int64]map[string]models.JobURLResult)
+	addResult := func(msg models.URLForDeleteMsg, result models.JobURLResult) {
+		if msg.JobID == 0 {
+			return
+		}
+		if results[msg.JobID] == nil {
+			results[msg.JobID] = make(map[string]models.JobURLResult)
+		}
+		results[msg.JobID][msg.ShortURL] = result
+	}
+
+	for _, msg := range processed {
+		result := models.JobURLResult{ShortURL: msg.ShortURL, Status: models.JobURLNotFound}
+		if isDeleted[msg.ID] {
+			result.Status = models.JobURLDeleted
+		}
+		addResult(msg, result)
+	}
+	for _, msg := range deadLetters {
+		addResult(msg, models.JobURLResult{ShortURL: msg.ShortURL, Status: models.JobURLFailed, Error: msg.Error})
+	}
+
+	unsaved := make(map[int64]bool)
+	for jobID, jobResults := range results {
+		_, err := srv.Storage.ModifyJob(ctx, jobID, func(job *models.Job) {
+			applyDeletionResults(job, jobResults)
+		})
+		// задачу могли удалить вместе с данными пользователя, сообщения по ней сохранять некуда.
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logger.Log.Info("Failed to save deletion job", zap.Int64("job_id", jobID), zap.Error(err))
+			unsaved[jobID] = true
+		}
+	}
+	return unsaved
+}
+
+// withoutJobs - возвращает сообщения, не относящиеся к задачам jobs.
+func withoutJobs(msgs []models.URLForDeleteMsg, jobs map[int64]bool) []models.URLForDeleteMsg {
+	if len(jobs) == 0 {
+		return msgs
+	}
+
+	kept := make([]models.URLForDeleteMsg, 0, len(msgs))
+	for _, msg := range msgs {
+		if !jobs[msg.JobID] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// applyDeletionResults - переносит результаты по урлам в задачу удаления и пересчитывает ее прогресс и статус.
+func applyDeletionResults(job *models.Job, results map[string]models.JobURLResult) {
+	job.Processed, job.Succeeded, job.Failed = 0, 0, 0
+	failed := false
+	for i := range job.URLs {
+		if result, ok := results[job.URLs[i].ShortURL]; ok && job.URLs[i].Status == models.JobURLPending {
+			job.URLs[i] = result
+		}
+
+		switch job.URLs[i].Status {
+		case models.JobURLPending:
+			continue
+		case models.JobURLDeleted:
+			job.Succeeded++
+		case models.JobURLFailed:
+			failed = true
+			job.Failed++
+		default:
+			job.Failed++
+		}
+		job.Processed++
+	}
+
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	if job.Processed < len(job.URLs) {
+		job.Status = models.JobStatusRunning
+		return
+	}
+
+	job.Status = models.JobStatusDone
+	if failed {
+		job.Status = models.JobStatusFailed
+		job.Error = "some urls could not be deleted"
+	}
+	job.FinishedAt = &now
+}
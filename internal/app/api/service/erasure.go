@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// StartUserErasure создает задачу безвозвратного удаления всех данных пользователя и запускает ее в фоне.
+// Сама задача остается в хранилище записью о выполненном удалении.
+// Последний владелец рабочего пространства должен сначала передать владение или выйти из него,
+// иначе возвращается ErrLastWorkspaceOwner.
+func (srv *URLService) StartUserErasure(ctx context.Context, userID string) (*models.Job, error) {
+	if err := srv.checkNotLastWorkspaceOwner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := &models.Job{
+		UserID:    userID,
+		Kind:      models.JobKindErasure,
+		Status:    models.JobStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := srv.Storage.InsertJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	srv.startUserErasure(*job)
+
+	return job, nil
+}
+
+// startUserErasure - запускает задачу удаления данных пользователя в фоне, Shutdown дожидается ее завершения.
+func (srv *URLService) startUserErasure(job models.Job) {
+	srv.goBackground(func(ctx context.Context) {
+		srv.runUserErasure(ctx, &job)
+	})
+}
+
+// runUserErasure - удаляет данные пользователя и сохраняет итог удаления в задаче.
+// Начатое удаление не прерывается отменой ctx.
+func (srv *URLService) runUserErasure(ctx context.Context, job *models.Job) {
+	ctx = context.WithoutCancel(ctx)
+
+	job.Status = models.JobStatusRunning
+	job.UpdatedAt = time.Now().UTC()
+	if err := srv.Storage.UpdateJob(ctx, job); err != nil {
+		logger.Log.Info("Failed to save erasure job", zap.Int64("job_id", job.ID), zap.Error(err))
+	}
+
+	erasure, err := srv.Storage.EraseUserData(ctx, job.UserID, job.ID)
+	if errors.Is(err, storage.ErrConflict) {
+		err = ErrLastWorkspaceOwner
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case errors.Is(err, ErrLastWorkspaceOwner):
+		logger.Log.Info("User data erasure refused", zap.Int64("job_id", job.ID), zap.String("user_id", job.UserID), zap.Error(err))
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	case err != nil:
+		// данные могли остаться в хранилище, поэтому задача не завершается
+		// и перезапускается resumeStaleErasures.
+		logger.Log.Info("User data erasure failed, will be retried", zap.Int64("job_id", job.ID), zap.String("user_id", job.UserID), zap.Error(err))
+		job.Error = err.Error()
+		job.UpdatedAt = now
+		if err := srv.Storage.UpdateJob(ctx, job); err != nil {
+			logger.Log.Info("Failed to save erasure job", zap.Int64("job_id", job.ID), zap.Error(err))
+		}
+		return
+	default:
+		job.Status = models.JobStatusDone
+		logger.Log.Info("User data erased",
+			zap.Int64("job_id", job.ID),
+			zap.String("user_id", job.UserID),
+			zap.Int64("links", erasure.Links),
+			zap.Int64("clicks", erasure.Clicks),
+			zap.Int64("jobs", erasure.Jobs),
+		)
+		job.Erasure = erasure
+		job.Processed = int(erasure.Links)
+		job.Succeeded = int(erasure.Links)
+		job.Error = ""
+	}
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+
+	if err := srv.Storage.UpdateJob(ctx, job); err != nil {
+		logger.Log.Info("Failed to save erasure job", zap.Int64("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// checkNotLastWorkspaceOwner - возвращает ErrLastWorkspaceOwner, если пользователь последний владелец
+// какого-либо рабочего пространства. Хранилище повторяет проверку атомарно при удалении данных.
+func (srv *URLService) checkNotLastWorkspaceOwner(ctx context.Context, userID string) error {
+	workspaces, err := srv.Storage.SelectUserWorkspaces(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, workspace := range workspaces {
+		if workspace.Role != models.WorkspaceRoleOwner {
+			continue
+		}
+		members, err := srv.Storage.SelectWorkspaceMembers(ctx, workspace.ID)
+		if err != nil {
+			return err
+		}
+		owners := 0
+		for _, member := range members {
+			if member.Role == models.WorkspaceRoleOwner {
+				owners++
+			}
+		}
+		if owners <= 1 {
+			return ErrLastWorkspaceOwner
+		}
+	}
+	return nil
+}
+
+// resumeStaleErasures - перезапускает брошенные задачи удаления данных пользователя.
+// Удаление данных можно повторять, поэтому задача запускается заново целиком.
+func (srv *URLService) resumeStaleErasures(ctx context.Context) {
+	jobs, err := srv.Storage.SelectStaleJobs(ctx, models.JobKindErasure, time.Now().Add(-jobStaleAfter))
+	if err != nil {
+		logger.Log.Info("Failed to select stale erasure jobs", zap.Error(err))
+		return
+	}
+
+	for _, stale := range jobs {
+		claimed := false
+		job, err := srv.Storage.ModifyJob(ctx, stale.ID, func(job *models.Job) {
+			// задача могла обновиться после выборки, значит ее еще выполняют.
+			if job.FinishedAt != nil || job.UpdatedAt.After(stale.UpdatedAt) {
+				return
+			}
+			claimed = true
+			job.UpdatedAt = time.Now().UTC()
+		})
+		if err != nil {
+			logger.Log.Info("Failed to claim stale erasure job", zap.Int64("job_id", stale.ID), zap.Error(err))
+			continue
+		}
+		if claimed {
+			logger.Log.Info("Resuming user data erasure", zap.Int64("job_id", job.ID), zap.String("user_id", job.UserID))
+			srv.startUserErasure(*job)
+		}
+	}
+}
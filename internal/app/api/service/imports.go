@@ -0,0 +1,516 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nu-kotov/URLcompressor/internal/app/api/utils"
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidImport - ошибка валидации запроса импорта урлов.
+var ErrInvalidImport = errors.New("invalid import")
+
+const (
+	// importChunkSize - количество строк файла импорта, вставляемых в хранилище одним батчем.
+	importChunkSize = 1000
+	// importMaxLineErrors - максимальное количество ошибок по строкам в отчете задачи импорта.
+	importMaxLineErrors = 10000
+	// importMaxLineSize - максимальная длина строки файла импорта в NDJSON, более длинные строки пропускаются с ошибкой.
+	importMaxLineSize = 64 << 10
+	// csvTagsSeparator - разделитель тегов в колонке tags файла CSV.
+	csvTagsSeparator = "|"
+	// jobStaleAfter - время без обновлений, после которого незавершенная фоновая задача считается брошенной
+	// остановившимся экземпляром сервиса. Задачи импорта обновляются после каждого батча,
+	// задачи удаления данных - при запуске.
+	jobStaleAfter = 10 * time.Minute
+)
+
+// aliasPattern - допустимый короткий урл, заданный пользователем.
+var aliasPattern = regexp.MustCompile(`^\w{3,64}$`)
+
+// reservedAliases - короткие урлы, совпадающие с путями сервиса.
+var reservedAliases = map[string]bool{
+	"api":  true,
+	"ping": true,
+}
+
+// StartURLsImport создает задачу импорта урлов пользователя из файла path в формате format
+// и запускает ее в фоне. Файл удаляется по завершении задачи. При остановке сервиса импорт прерывается
+// после текущего батча, и задача завершается с ошибкой.
+func (srv *URLService) StartURLsImport(ctx context.Context, userID string, format string, path string) (*models.Job, error) {
+	if format != models.ImportFormatCSV && format != models.ImportFormatNDJSON {
+		os.Remove(path)
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidImport, format)
+	}
+
+	now := time.Now().UTC()
+	job := &models.Job{
+		UserID:    userID,
+		Kind:      models.JobKindImport,
+		Status:    models.JobStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := srv.Storage.InsertJob(ctx, job); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	importJob := *job
+	srv.goBackground(func(ctx context.Context) {
+		srv.runURLsImport(ctx, &importJob, format, path)
+	})
+
+	return job, nil
+}
+
+// GetJob возвращает фоновую задачу пользователя, чужие задачи не отличаются от несуществующих.
+func (srv *URLService) GetJob(ctx context.Context, userID string, id int64) (*models.Job, error) {
+	job, err := srv.Storage.SelectJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, storage.ErrNotFound
+	}
+	return job, nil
+}
+
+// runURLsImport - читает файл импорта, вставляет урлы в хранилище батчами и сохраняет прогресс задачи после каждого батча,
+// пока не отменен ctx. Итог задачи сохраняется и после отмены ctx.
+func (srv *URLService) runURLsImport(ctx context.Context, job *models.Job, format string, path string) {
+	defer os.Remove(path)
+
+	err := srv.importURLs(ctx, job, format, path)
+	ctx = context.WithoutCancel(ctx)
+
+	now := time.Now().UTC()
+	job.Status = models.JobStatusDone
+	if err != nil {
+		logger.Log.Info("URLs import failed", zap.Int64("job_id", job.ID), zap.Error(err))
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	}
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+
+	if err := srv.Storage.UpdateJob(ctx, job); err != nil {
+		logger.Log.Info("Failed to save import job", zap.Int64("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// importURLs - обрабатывает файл импорта, ошибки строк попадают в отчет задачи,
+// возвращаемая ошибка прерывает импорт. Отмена ctx прерывает импорт перед очередным батчем,
+// начатый батч записывается до конца.
+func (srv *URLService) importURLs(ctx context.Context, job *models.Job, format string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	storeCtx := context.WithoutCancel(ctx)
+
+	job.Status = models.JobStatusRunning
+	job.UpdatedAt = time.Now().UTC()
+	if err := srv.Storage.UpdateJob(storeCtx, job); err != nil {
+		return err
+	}
+
+	var reader importReader
+	if format == models.ImportFormatCSV {
+		reader, err = newCSVImportReader(file)
+		if err != nil {
+			return err
+		}
+	} else {
+		reader = newNDJSONImportReader(file)
+	}
+
+	chunk := make([]importLine, 0, importChunkSize)
+	for {
+		line, record, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var lineErr *importLineError
+		if errors.As(err, &lineErr) {
+			job.Processed++
+			addJobLineError(job, line, lineErr.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := srv.importRecordData(record, job.UserID)
+		if err != nil {
+			job.Processed++
+			addJobLineError(job, line, err.Error())
+			continue
+		}
+
+		chunk = append(chunk, importLine{line: line, data: data, alias: record.Alias != ""})
+		if len(chunk) == importChunkSize {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("import interrupted: %w", err)
+			}
+			if err := srv.flushImportChunk(storeCtx, job, chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	return srv.flushImportChunk(storeCtx, job, chunk)
+}
+
+// importLine - проверенная строка файла импорта, ожидающая вставки.
+type importLine struct {
+	line  int
+	data  models.URLsData
+	alias bool
+}
+
+// importRecordData - проверяет строку файла импорта и переводит ее в данные урла.
+func (srv *URLService) importRecordData(record models.ImportRecord, userID string) (models.URLsData, error) {
+	originalURL := strings.TrimSpace(record.URL)
+	parsed, err := url.Parse(originalURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.URLsData{}, fmt.Errorf("invalid url %q", record.URL)
+	}
+
+	if err := srv.Policy.Check(originalURL); err != nil {
+		return models.URLsData{}, err
+	}
+
+	shortID := strings.TrimSpace(record.Alias)
+	if shortID != "" {
+		if !aliasPattern.MatchString(shortID) || reservedAliases[strings.ToLower(shortID)] {
+			return models.URLsData{}, fmt.Errorf("invalid alias %q", record.Alias)
+		}
+	} else {
+		shortID, err = utils.HashOriginalURL([]byte(originalURL))
+		if err != nil {
+			return models.URLsData{}, err
+		}
+	}
+
+	metadata, err := normalizeURLMetadata("", "", record.Tags)
+	if err != nil {
+		return models.URLsData{}, err
+	}
+
+	data := models.URLsData{
+		UUID:        uuid.New().String(),
+		ShortURL:    shortID,
+		OriginalURL: originalURL,
+		UserID:      userID,
+		Tags:        metadata.Tags,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if record.ExpiresAt != "" {
+		expiresAt, dateOnly, err := parseStatsTime(strings.TrimSpace(record.ExpiresAt), time.UTC)
+		if err != nil {
+			return models.URLsData{}, fmt.Errorf("invalid expires_at %q", record.ExpiresAt)
+		}
+		if dateOnly {
+			expiresAt = expiresAt.AddDate(0, 0, 1)
+		}
+		data.ExpiresAt = &expiresAt
+	}
+
+	return data, nil
+}
+
+// flushImportChunk - вставляет батч строк импорта, пропуская короткие урлы, которые уже заняты,
+// и сохраняет счетчики прогресса задачи. Отчет об ошибках строк копится в job и сохраняется
+// один раз по завершении задачи, чтобы не переписывать его после каждого батча.
+func (srv *URLService) flushImportChunk(ctx context.Context, job *models.Job, chunk []importLine) error {
+	if len(chunk) != 0 {
+		shortURLs := make([]string, 0, len(chunk))
+		for _, l := range chunk {
+			shortURLs = append(shortURLs, l.data.ShortURL)
+		}
+
+		existing, err := srv.Storage.SelectExistingShortURLs(ctx, shortURLs)
+		if err != nil {
+			return err
+		}
+		taken := make(map[string]bool, len(existing))
+		for _, shortURL := range existing {
+			taken[shortURL] = true
+		}
+
+		batch := make([]models.URLsData, 0, len(chunk))
+		lines := make([]importLine, 0, len(chunk))
+		for _, l := range chunk {
+			if taken[l.data.ShortURL] {
+				addJobLineError(job, l.line, importConflictMessage(l))
+				continue
+			}
+			taken[l.data.ShortURL] = true
+			batch = append(batch, l.data)
+			lines = append(lines, l)
+		}
+
+		err = srv.Storage.InsertURLsDataBatch(ctx, batch)
+		if errors.Is(err, storage.ErrConflict) {
+			// Короткий урл заняли после проверки, вставляем по одному, чтобы найти строку с конфликтом.
+			for _, l := range lines {
+				err := srv.Storage.InsertURLsData(ctx, &l.data)
+				if errors.Is(err, storage.ErrConflict) {
+					addJobLineError(job, l.line, importConflictMessage(l))
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				job.Succeeded++
+			}
+		} else if err != nil {
+			return err
+		} else {
+			job.Succeeded += len(batch)
+		}
+
+		job.Processed += len(chunk)
+	}
+
+	job.UpdatedAt = time.Now().UTC()
+	progress := *job
+	progress.Errors = nil
+	return srv.Storage.UpdateJob(ctx, &progress)
+}
+
+// failStaleImports - завершает с ошибкой брошенные задачи импорта: файл импорта не переживает
+// остановку сервиса, поэтому такие задачи нельзя продолжить.
+func (srv *URLService) failStaleImports(ctx context.Context) {
+	jobs, err := srv.Storage.SelectStaleJobs(ctx, models.JobKindImport, time.Now().Add(-jobStaleAfter))
+	if err != nil {
+		logger.Log.Info("Failed to select stale import jobs", zap.Error(err))
+		return
+	}
+
+	for _, stale := range jobs {
+		_, err := srv.Storage.ModifyJob(ctx, stale.ID, func(job *models.Job) {
+			// задача могла обновиться после выборки, значит ее еще выполняют.
+			if job.FinishedAt != nil || job.UpdatedAt.After(stale.UpdatedAt) {
+				return
+			}
+			now := time.Now().UTC()
+			job.Status = models.JobStatusFailed
+			job.Error = "import was interrupted by a service restart, upload the file again"
+			job.UpdatedAt = now
+			job.FinishedAt = &now
+		})
+		if err != nil {
+			logger.Log.Info("Failed to fail stale import job", zap.Int64("job_id", stale.ID), zap.Error(err))
+		}
+	}
+}
+
+// recoverJobs - при старте сервиса и затем каждые jobStaleAfter до отмены ctx разбирает фоновые задачи,
+// брошенные остановившимися экземплярами сервиса.
+func (srv *URLService) recoverJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobStaleAfter)
+	defer ticker.Stop()
+
+	for {
+		srv.failStaleImports(ctx)
+		srv.resumeStaleErasures(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// importConflictMessage - текст ошибки строки импорта, короткий урл которой уже занят.
+func importConflictMessage(l importLine) string {
+	if l.alias {
+		return fmt.Sprintf("alias %q is already taken", l.data.ShortURL)
+	}
+	return fmt.Sprintf("url is already shortened as %q", l.data.ShortURL)
+}
+
+// addJobLineError - учитывает ошибку строки в задаче, отчет об ошибках ограничен importMaxLineErrors.
+func addJobLineError(job *models.Job, line int, message string) {
+	job.Failed++
+	if len(job.Errors) >= importMaxLineErrors {
+		job.ErrorsTruncated = true
+		return
+	}
+	job.Errors = append(job.Errors, models.JobLineError{Line: line, Error: message})
+}
+
+// importLineError - ошибка разбора строки файла импорта, после которой чтение продолжается.
+type importLineError struct {
+	err error
+}
+
+// Error - текст ошибки разбора строки файла импорта.
+func (e *importLineError) Error() string {
+	return e.err.Error()
+}
+
+// importReader - читатель строк файла импорта.
+// next возвращает номер строки и запись, io.EOF в конце файла и *importLineError для строки, которую не удалось разобрать.
+type importReader interface {
+	next() (int, models.ImportRecord, error)
+}
+
+// csvImportReader - читатель файла импорта в CSV с заголовком, колонка url обязательна,
+// колонки alias, tags и expires_at - нет, прочие колонки пропускаются.
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVImportReader - читает заголовок файла импорта в CSV.
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("csv file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("csv header error: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("csv header must contain url column")
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+// next - читает очередную строку CSV.
+func (c *csvImportReader) next() (int, models.ImportRecord, error) {
+	row, err := c.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, models.ImportRecord{}, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, models.ImportRecord{}, &importLineError{err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, models.ImportRecord{}, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	record := models.ImportRecord{URL: field("url"), Alias: field("alias"), ExpiresAt: field("expires_at")}
+	for _, tag := range strings.Split(field("tags"), csvTagsSeparator) {
+		if strings.TrimSpace(tag) != "" {
+			record.Tags = append(record.Tags, tag)
+		}
+	}
+
+	return line, record, nil
+}
+
+// ndjsonImportReader - читатель файла импорта в NDJSON, пустые строки пропускаются.
+// Строка длиннее importMaxLineSize не накапливается в памяти, а пропускается с ошибкой строки.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+	// skipping - отбрасывается продолжение слишком длинной строки.
+	skipping bool
+	// tooLong - последняя прочитанная строка была слишком длинной.
+	tooLong bool
+}
+
+// newNDJSONImportReader - конструктор читателя файла импорта в NDJSON.
+func newNDJSONImportReader(r io.Reader) *ndjsonImportReader {
+	n := &ndjsonImportReader{scanner: bufio.NewScanner(r)}
+	n.scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), importMaxLineSize)
+	n.scanner.Split(n.splitLines)
+	return n
+}
+
+// splitLines - делит ввод на строки, как bufio.ScanLines, но вместо строки длиннее importMaxLineSize
+// возвращает пустую строку и отмечает ее в tooLong.
+func (n *ndjsonImportReader) splitLines(data []byte, atEOF bool) (int, []byte, error) {
+	i := bytes.IndexByte(data, '\n')
+	switch {
+	case i >= 0 && n.skipping:
+		n.skipping, n.tooLong = false, true
+		return i + 1, []byte{}, nil
+	case i >= 0:
+		return i + 1, data[:i], nil
+	case len(data) >= importMaxLineSize:
+		n.skipping = true
+		return len(data), nil, nil
+	case atEOF && n.skipping:
+		n.skipping, n.tooLong = false, true
+		return len(data), []byte{}, nil
+	case atEOF && len(data) > 0:
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// next - читает очередную непустую строку NDJSON.
+func (n *ndjsonImportReader) next() (int, models.ImportRecord, error) {
+	for {
+		if !n.scanner.Scan() {
+			if err := n.scanner.Err(); err != nil {
+				return 0, models.ImportRecord{}, err
+			}
+			return 0, models.ImportRecord{}, io.EOF
+		}
+		n.line++
+
+		if n.tooLong {
+			n.tooLong = false
+			return n.line, models.ImportRecord{}, &importLineError{err: fmt.Errorf("line is longer than %d bytes", importMaxLineSize)}
+		}
+
+		data := bytes.TrimSpace(n.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var record models.ImportRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return n.line, record, &importLineError{err: err}
+		}
+		return n.line, record, nil
+	}
+}
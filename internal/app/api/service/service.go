@@ -2,57 +2,270 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/nu-kotov/URLcompressor/config"
 	"github.com/nu-kotov/URLcompressor/internal/app/api/utils"
+	"github.com/nu-kotov/URLcompressor/internal/app/healthcheck"
 	"github.com/nu-kotov/URLcompressor/internal/app/logger"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/qrcode"
 	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"github.com/nu-kotov/URLcompressor/internal/app/urlpolicy"
 	"go.uber.org/zap"
 )
 
 // Service - интерфейс для работы с URL.
 type Service interface {
 	CompressURL(context.Context, []byte, string) (string, error)
-	GetUserURLs(context.Context, string) ([]models.GetUserURLsResponse, error)
+	GetUserURLs(context.Context, string, models.UserURLsRequest) (*models.UserURLsResponse, error)
 	GetShortURLsBatch(context.Context, []models.GetShortURLsBatchRequest, string) ([]models.GetShortURLsBatchResponse, error)
 	GetShortURLSrv(context.Context, []byte, string) (*models.ShortenURLResponse, error)
-	SendURLsToDeletion([]string, string)
+	SendURLsToDeletion(context.Context, []string, string) (*models.Job, error)
+	GetTrashURLs(context.Context, string, models.UserURLsRequest) (*models.UserURLsResponse, error)
+	RestoreUserURLs(context.Context, string, []string) (*models.RestoreURLsResponse, error)
 	SelectOriginalURLByShortURL(context.Context, string) (string, error)
+	GetRedirectTarget(context.Context, string, string, url.Values) (*models.RedirectTarget, error)
+	RecordClick(models.ClickEvent, string)
+	GetURLStats(context.Context, string, string, models.URLStatsRequest) (*models.URLStatsResponse, error)
+	ExportClicks(context.Context, string, string, models.ClicksExportRequest, func([]models.ClickEvent) error) error
+	ExportUserData(context.Context, string, func(models.UserExportLink) error) error
+	GetQRCode(context.Context, string, qrcode.Options) (*qrcode.Image, error)
+	UpdateURLMetadata(context.Context, string, string, models.UpdateURLMetadataRequest) (*models.GetUserURLsResponse, error)
+	ReportURL(context.Context, string, models.AbuseReportRequest, string) (*models.AbuseReport, error)
+	GetDeletionDeadLetters(context.Context, int64, int) ([]models.DeletionDeadLetter, error)
+	GetAbuseReports(context.Context, models.AbuseReportsFilter) ([]models.AbuseReport, error)
+	ModerateAbuseReport(context.Context, int64, models.ModerationRequest) (*models.AbuseReport, error)
+	TakedownURL(context.Context, string, string) error
+	RestoreURL(context.Context, string) error
+	StartURLsImport(context.Context, string, string, string) (*models.Job, error)
+	StartUserErasure(context.Context, string) (*models.Job, error)
+	CreateURLTransfer(context.Context, string, models.URLTransferRequest) (*models.URLTransfer, error)
+	AcceptURLTransfer(context.Context, string, string) (*models.URLTransfer, error)
+	CancelURLTransfer(context.Context, string, int64) error
+	GetURLOwnershipAudit(context.Context, string) ([]models.URLOwnershipAudit, error)
+	CreateWorkspace(context.Context, string, models.WorkspaceRequest) (*models.Workspace, error)
+	GetUserWorkspaces(context.Context, string) ([]models.Workspace, error)
+	GetWorkspaceMembers(context.Context, string, int64) ([]models.WorkspaceMember, error)
+	UpdateWorkspaceMember(context.Context, string, int64, string, models.WorkspaceMemberRequest) (*models.WorkspaceMember, error)
+	RemoveWorkspaceMember(context.Context, string, int64, string) error
+	CreateWorkspaceInvite(context.Context, string, int64, models.WorkspaceInviteRequest) (*models.WorkspaceInvite, error)
+	AcceptWorkspaceInvite(context.Context, string, string) (*models.WorkspaceMember, error)
+	CreateWorkspaceURL(context.Context, string, int64, []byte) (*models.ShortenURLResponse, error)
+	GetWorkspaceURLs(context.Context, string, int64, models.UserURLsRequest) (*models.UserURLsResponse, error)
+	SendWorkspaceURLsToDeletion(context.Context, string, int64, []string) (*models.Job, error)
+	CreateCollection(context.Context, string, models.CollectionRequest) (*models.Collection, error)
+	GetUserCollections(context.Context, string) ([]models.Collection, error)
+	GetCollection(context.Context, string, int64) (*models.Collection, error)
+	RenameCollection(context.Context, string, int64, models.CollectionRequest) (*models.Collection, error)
+	DeleteCollection(context.Context, string, int64) error
+	AddURLsToCollection(context.Context, string, int64, models.CollectionURLsRequest) error
+	RemoveURLsFromCollection(context.Context, string, int64, models.CollectionURLsRequest) error
+	GetCollectionURLs(context.Context, string, int64, models.UserURLsRequest) (*models.UserURLsResponse, error)
+	GetCollectionStats(context.Context, string, int64, models.URLStatsRequest) (*models.CollectionStatsResponse, error)
+	GetJob(context.Context, string, int64) (*models.Job, error)
 	GetStats(context.Context) (*models.GetStatsResponse, error)
 	PingDB() error
 }
 
+// ErrInvalidVariants - ошибка валидации вариантов назначения короткого урла.
+var ErrInvalidVariants = errors.New("invalid url variants")
+
+// ErrInvalidRedirectOptions - ошибка валидации настроек редиректа короткого урла.
+var ErrInvalidRedirectOptions = errors.New("invalid redirect options")
+
+// ErrInvalidStatsParams - ошибка валидации параметров запроса статистики.
+var ErrInvalidStatsParams = errors.New("invalid stats params")
+
+// ErrURLNotOwned - ошибка при обращении к урлу другого пользователя.
+var ErrURLNotOwned = errors.New("url is owned by another user")
+
+// ErrInvalidURLsFilter - ошибка валидации параметров поиска урлов пользователя.
+var ErrInvalidURLsFilter = errors.New("invalid urls filter")
+
+// ErrInvalidMetadata - ошибка валидации названия, описания или тегов короткого урла.
+var ErrInvalidMetadata = errors.New("invalid url metadata")
+
+// ErrURLDeleted - ошибка при обращении к удаленному урлу.
+var ErrURLDeleted = errors.New("url is deleted")
+
+// ErrURLExpired - ошибка при обращении к урлу с истекшим сроком действия.
+var ErrURLExpired = errors.New("url is expired")
+
+// ErrURLTakenDown - ошибка при обращении к урлу, заблокированному модератором.
+var ErrURLTakenDown = errors.New("url is taken down")
+
+// ErrInvalidAbuseReport - ошибка валидации жалобы на короткий урл.
+var ErrInvalidAbuseReport = errors.New("invalid abuse report")
+
+// ErrInvalidModeration - ошибка валидации запроса модератора.
+var ErrInvalidModeration = errors.New("invalid moderation request")
+
+// ErrAbuseReportResolved - ошибка при повторном решении по жалобе.
+var ErrAbuseReportResolved = errors.New("abuse report is already resolved")
+
+// TakedownError - ошибка при обращении к заблокированному урлу с причиной блокировки,
+// errors.Is(err, ErrURLTakenDown) для нее истинно.
+type TakedownError struct {
+	Reason string
+	At     time.Time
+}
+
+// Error - текст ошибки обращения к заблокированному урлу.
+func (e *TakedownError) Error() string {
+	return ErrURLTakenDown.Error() + ": " + e.Reason
+}
+
+// Is - сопоставляет ошибку с ErrURLTakenDown.
+func (e *TakedownError) Is(target error) bool {
+	return target == ErrURLTakenDown
+}
+
+// tagPattern - допустимые символы тега: буквы, цифры, пробел, точка, дефис и подчеркивание.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N} ._-]+$`)
+
+// abuseReasons - допустимые причины жалоб на короткие урлы.
+var abuseReasons = map[string]bool{
+	models.AbuseReasonPhishing:  true,
+	models.AbuseReasonMalware:   true,
+	models.AbuseReasonSpam:      true,
+	models.AbuseReasonIllegal:   true,
+	models.AbuseReasonCopyright: true,
+	models.AbuseReasonOther:     true,
+}
+
+const (
+	// clicksBufferSize - размер буфера канала событий перехода.
+	clicksBufferSize = 4096
+	// clicksBatchSize - максимальный размер батча событий перехода при записи в хранилище.
+	clicksBatchSize = 500
+	// clicksFlushInterval - период записи накопленных событий перехода в хранилище.
+	clicksFlushInterval = time.Second
+	// statsDefaultPeriod - период статистики переходов по умолчанию.
+	statsDefaultPeriod = 7 * 24 * time.Hour
+	// statsMaxBuckets - максимальное количество интервалов во временном ряду статистики.
+	statsMaxBuckets = 5000
+	// statsTopLimit - количество значений в топах источников и браузеров.
+	statsTopLimit = 10
+	// statsRawMaxPeriod - максимальный период статистики, который считается только по сырым событиям перехода,
+	// для более длинных периодов используются агрегаты.
+	statsRawMaxPeriod = 31 * 24 * time.Hour
+	// clicksExportPageSize - количество событий перехода, читаемых из хранилища за один запрос при выгрузке.
+	clicksExportPageSize = 1000
+	// userExportPageSize - количество урлов, читаемых из хранилища за один запрос при выгрузке данных пользователя.
+	userExportPageSize = 500
+	// titleMaxLength и descriptionMaxLength - максимальные длины названия и описания урла в символах.
+	titleMaxLength       = 200
+	descriptionMaxLength = 1000
+	// tagMaxLength и tagsMaxCount - максимальные длина тега в символах и количество тегов урла.
+	tagMaxLength = 50
+	tagsMaxCount = 20
+	// abuseCommentMaxLength - максимальная длина комментария к жалобе в символах.
+	abuseCommentMaxLength = 2000
+	// abuseReportsDefaultLimit и abuseReportsMaxLimit - размер страницы жалоб по умолчанию и максимальный.
+	abuseReportsDefaultLimit = 50
+	abuseReportsMaxLimit     = 500
+	// userURLsDefaultLimit и userURLsMaxLimit - размер страницы урлов пользователя по умолчанию и максимальный.
+	userURLsDefaultLimit = 100
+	userURLsMaxLimit     = 1000
+)
+
 // URLService - структура сервиса для сокращения ссылок.
 type URLService struct {
-	Config         config.Config
-	Storage        storage.Storage
-	URLsDeletionCh chan models.URLForDeleteMsg
+	Config   config.Config
+	Storage  storage.Storage
+	ClicksCh chan models.ClickEvent
+	// Policy - политика доменов адресов назначения, nil - без ограничений.
+	Policy *urlpolicy.Policy
+	// stopDeletions останавливает обработчики очереди удаления, deletionsDone закрывается после их остановки.
+	stopDeletions context.CancelFunc
+	deletionsDone chan struct{}
+	// backgroundCtx отменяется в Shutdown и останавливает фоновые задачи сервиса,
+	// backgroundWG ожидает их завершения.
+	backgroundCtx  context.Context
+	stopBackground context.CancelFunc
+	backgroundWG   sync.WaitGroup
 }
 
+// clicksDropped - количество событий перехода, отброшенных из-за переполнения буфера, публикуется через expvar.
+var clicksDropped = expvar.NewInt("clicks_dropped")
+
 // NewURLService - конструктор сервиса для сокращения ссылок.
 func NewURLService(config config.Config, storage storage.Storage) *URLService {
 	var srv URLService
 
 	srv.Config = config
 	srv.Storage = storage
-	srv.URLsDeletionCh = make(chan models.URLForDeleteMsg, 1024)
+	srv.ClicksCh = make(chan models.ClickEvent, clicksBufferSize)
+	srv.backgroundCtx, srv.stopBackground = context.WithCancel(context.Background())
+
+	srv.startDeletionWorkers()
+	srv.goBackground(srv.flushClicks)
+	srv.goBackground(srv.rollupClicks)
+	srv.goBackground(srv.purgeTrash)
+	srv.goBackground(srv.recoverJobs)
+
+	if config.HealthCheckInterval > 0 {
+		var notifier healthcheck.Notifier
+		if config.HealthWebhookURL != "" {
+			notifier = healthcheck.NewWebhookNotifier(config.HealthWebhookURL, config.BaseURL, config.HealthCheckTimeout)
+		}
+
+		checker := healthcheck.NewChecker(storage, healthcheck.Options{
+			Interval:     config.HealthCheckInterval,
+			RecheckAfter: config.HealthRecheckAfter,
+			Concurrency:  config.HealthCheckConcurrency,
+			HostInterval: config.HealthCheckHostInterval,
+			Timeout:      config.HealthCheckTimeout,
+		}, notifier)
 
-	go srv.flushMessages()
+		srv.goBackground(checker.Run)
+	}
 
 	return &srv
 }
 
+// goBackground запускает фоновую задачу сервиса, которая останавливается и дожидается в Shutdown.
+func (srv *URLService) goBackground(run func(ctx context.Context)) {
+	srv.backgroundWG.Add(1)
+	go func() {
+		defer srv.backgroundWG.Done()
+		run(srv.backgroundCtx)
+	}()
+}
+
+// WatchPolicy перечитывает файл политики доменов Policy каждые interval до остановки сервиса в Shutdown.
+func (srv *URLService) WatchPolicy(interval time.Duration) {
+	policy := srv.Policy
+	srv.goBackground(func(ctx context.Context) {
+		policy.Watch(ctx, interval)
+	})
+}
+
 // GetShortURLsBatch сохраняет батч коротких урлов и возвращает его в качестве ответа.
 func (srv *URLService) GetShortURLsBatch(ctx context.Context, shortURLsBatch []models.GetShortURLsBatchRequest, userID string) ([]models.GetShortURLsBatchResponse, error) {
 	var resp []models.GetShortURLsBatchResponse
 	var rowsBatch []models.URLsData
 	for _, row := range shortURLsBatch {
 
+		if err := srv.Policy.Check(row.OriginalURL); err != nil {
+			logger.Log.Info(err.Error())
+			return nil, err
+		}
+
 		shortID, err := utils.HashOriginalURL([]byte(row.OriginalURL))
 		if err != nil {
 			logger.Log.Info(err.Error())
@@ -75,6 +288,7 @@ func (srv *URLService) GetShortURLsBatch(ctx context.Context, shortURLsBatch []m
 			OriginalURL:   strBody,
 			CorrelationID: row.CorrelationID,
 			UserID:        userID,
+			CreatedAt:     time.Now().UTC(),
 		}
 		rowsBatch = append(rowsBatch, event)
 	}
@@ -88,57 +302,496 @@ func (srv *URLService) GetShortURLsBatch(ctx context.Context, shortURLsBatch []m
 	return resp, nil
 }
 
-// SendURLsToDeletion отправляет урл + id пользователя в канал для пометки урла удаленным.
-func (srv *URLService) SendURLsToDeletion(urls []string, userID string) {
-	for _, url := range urls {
-		srv.URLsDeletionCh <- models.URLForDeleteMsg{
-			ShortURL: url,
-			UserID:   userID,
+// RecordClick отправляет событие перехода в канал для асинхронной записи в хранилище.
+// IP посетителя сохраняется только в виде соленого хеша.
+// Если канал переполнен, событие отбрасывается, чтобы не замедлять редирект, и учитывается в метрике clicks_dropped.
+func (srv *URLService) RecordClick(click models.ClickEvent, clientIP string) {
+	click.IPHash = utils.HashIP(clientIP, srv.Config.IPHashSalt)
+	click.ReferrerHost = utils.ReferrerHost(click.Referrer)
+	click.UAFamily = utils.UserAgentFamily(click.UserAgent)
+
+	select {
+	case srv.ClicksCh <- click:
+	default:
+		clicksDropped.Add(1)
+	}
+}
+
+// flushClicks слушает события в канале ClicksCh и записывает их в хранилище батчами до отмены ctx,
+// после отмены дописывает оставшиеся в канале события. Батч, который не удалось записать, остается в буфере
+// и повторяется по таймеру; события сверх clicksBufferSize в буфере отбрасываются, начиная с самых старых.
+func (srv *URLService) flushClicks(ctx context.Context) {
+	ticker := time.NewTicker(clicksFlushInterval)
+	defer ticker.Stop()
+
+	var clicks []models.ClickEvent
+	failed := false
+
+	flush := func() {
+		if len(clicks) == 0 {
+			return
+		}
+
+		err := srv.Storage.InsertClicks(context.WithoutCancel(ctx), clicks)
+		if err != nil {
+			logger.Log.Info("Failed to insert clicks, batch is kept for retry", zap.Int("count", len(clicks)), zap.Error(err))
+			if dropped := len(clicks) - clicksBufferSize; dropped > 0 {
+				clicksDropped.Add(int64(dropped))
+				clicks = append(clicks[:0], clicks[dropped:]...)
+			}
+			failed = true
+			return
+		}
+
+		clicks = nil
+		failed = false
+	}
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			for {
+				select {
+				case click := <-srv.ClicksCh:
+					clicks = append(clicks, click)
+				default:
+					flush()
+					return
+				}
+			}
+
+		case click := <-srv.ClicksCh:
+			clicks = append(clicks, click)
+			// после неудачной записи батч повторяется только по таймеру, чтобы не нагружать хранилище.
+			if len(clicks) >= clicksBatchSize && !failed {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
 		}
 	}
 }
 
-// flushMessages слушает сообщения в канале URLsDeletionCh, помечает, что урлы из сообщений удалены.
-func (srv *URLService) flushMessages() {
-	ticker := time.NewTicker(10 * time.Second)
+// rollupClicks периодически агрегирует события перехода и удаляет устаревшую аналитику по настройкам хранения
+// до отмены ctx.
+func (srv *URLService) rollupClicks(ctx context.Context) {
+	if srv.Config.ClicksRollupInterval <= 0 {
+		return
+	}
 
-	var URLsForDelete []models.URLForDeleteMsg
+	ticker := time.NewTicker(srv.Config.ClicksRollupInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 
-		case msg := <-srv.URLsDeletionCh:
-			URLsForDelete = append(URLsForDelete, msg)
+		case <-ctx.Done():
+			return
 
 		case <-ticker.C:
-			if len(URLsForDelete) == 0 {
-				continue
+			err := srv.Storage.RollupClicks(ctx, models.ClicksRollupPolicy{
+				Now:             time.Now(),
+				RawRetention:    srv.Config.ClicksRawRetention,
+				HourlyRetention: srv.Config.ClicksHourlyRetention,
+				DailyRetention:  srv.Config.ClicksDailyRetention,
+			})
+			if err != nil && ctx.Err() == nil {
+				logger.Log.Info("Failed to rollup clicks", zap.Error(err))
 			}
+		}
+	}
+}
 
-			err := srv.Storage.DeleteURLs(context.Background(), URLsForDelete)
-			if err != nil {
-				logger.Log.Info(err.Error())
-				continue
-			}
+// statsRollup выбирает гранулярность агрегатов для статистики за период фильтра.
+// Короткие периоды, по которым еще хранятся сырые события, считаются без агрегатов.
+// Дневные агрегаты используются, когда часовые уже удалены, и считаются по дням UTC.
+// Почасовая статистика за период, часовые агрегаты которого уже удалены, не считается:
+// по дневным агрегатам она вернула бы нули.
+func (srv *URLService) statsRollup(filter models.ClickStatsFilter) (string, error) {
+	now := time.Now()
+
+	rawAvailable := srv.Config.ClicksRawRetention <= 0 || !filter.From.Before(now.Add(-srv.Config.ClicksRawRetention))
+	if rawAvailable && filter.To.Sub(filter.From) <= statsRawMaxPeriod {
+		return "", nil
+	}
+
+	hourlyAvailable := srv.Config.ClicksHourlyRetention <= 0 || !filter.From.Before(now.Add(-srv.Config.ClicksHourlyRetention))
+	if hourlyAvailable {
+		return models.StatsBucketHour, nil
+	}
+	if filter.Bucket == models.StatsBucketHour {
+		return "", fmt.Errorf("%w: hourly stats are kept for %s, use bucket=day", ErrInvalidStatsParams, srv.Config.ClicksHourlyRetention)
+	}
+	return models.StatsBucketDay, nil
+}
+
+// GetURLStats возвращает статистику переходов по короткому урлу его владельцу,
+// по урлу рабочего пространства - участникам пространства.
+// Уникальные посетители оцениваются по дневным скетчам HyperLogLog за дни по UTC, пересекающиеся с периодом.
+// Для длинных периодов статистика считается по агрегатам с точностью до часа или дня.
+func (srv *URLService) GetURLStats(ctx context.Context, userID string, shortURLID string, req models.URLStatsRequest) (*models.URLStatsResponse, error) {
+	filter, err := parseStatsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	filter.ShortURL = shortURLID
+	filter.Rollup, err = srv.statsRollup(*filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := srv.checkURLOwner(ctx, userID, shortURLID, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+
+	stats, err := srv.Storage.SelectClickStats(ctx, *filter)
+	if err != nil {
+		logger.Log.Info("Failed to get click stats", zap.Error(err))
+		return nil, fmt.Errorf("click stats selection error: %w", err)
+	}
+
+	stats.ShortURL = srv.Config.BaseURL + "/" + shortURLID
+	stats.From = filter.From.In(filter.Location)
+	stats.To = filter.To.In(filter.Location)
+	stats.Timezone = filter.Location.String()
+	stats.Bucket = filter.Bucket
+	stats.IncludeBots = filter.IncludeBots
+	stats.TimeSeries = fillStatsGaps(stats.TimeSeries, *filter)
+
+	return stats, nil
+}
+
+// ExportClicks выгружает владельцу или участникам рабочего пространства урла события перехода по короткому урлу
+// страницами в порядке их записи.
+// Функция writePage вызывается хотя бы один раз после проверки параметров и владельца, даже если событий нет,
+// поэтому до первого вызова ошибку можно вернуть клиенту кодом ответа.
+func (srv *URLService) ExportClicks(ctx context.Context, userID string, shortURLID string, req models.ClicksExportRequest, writePage func([]models.ClickEvent) error) error {
+	filter, err := parseClicksExportRequest(req)
+	if err != nil {
+		return err
+	}
+	filter.ShortURL = shortURLID
+
+	if _, err := srv.checkURLOwner(ctx, userID, shortURLID, models.WorkspaceRoleViewer); err != nil {
+		return err
+	}
+
+	for {
+		page, err := srv.Storage.SelectClicksPage(ctx, *filter)
+		if err != nil {
+			logger.Log.Info("Failed to select clicks page", zap.Error(err))
+			return fmt.Errorf("clicks page selection error: %w", err)
+		}
+
+		if err := writePage(page); err != nil {
+			return err
+		}
+
+		if len(page) < filter.Limit {
+			return nil
+		}
+		filter.AfterID = page[len(page)-1].ID
+	}
+}
+
+// checkURLOwner проверяет, что короткий урл существует и доступен пользователю, и возвращает данные урла.
+// Личный урл доступен его владельцу, урл рабочего пространства - участникам пространства с ролью не ниже minRole,
+// в том числе после ухода из пространства создавшего урл пользователя.
+func (srv *URLService) checkURLOwner(ctx context.Context, userID string, shortURLID string, minRole string) (*models.URLsData, error) {
+	data, err := srv.Storage.SelectURLData(ctx, shortURLID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.WorkspaceID == 0 {
+		if data.UserID != userID {
+			return nil, ErrURLNotOwned
+		}
+		return data, nil
+	}
+
+	err = srv.checkWorkspaceRole(ctx, userID, data.WorkspaceID, minRole)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, ErrWorkspaceForbidden) {
+		return nil, ErrURLNotOwned
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseStatsRequest разбирает и проверяет параметры запроса статистики.
+// Дата без времени в параметре To означает конец этого дня.
+func parseStatsRequest(req models.URLStatsRequest) (*models.ClickStatsFilter, error) {
+	filter := models.ClickStatsFilter{Location: time.UTC, Bucket: req.Bucket, TopLimit: statsTopLimit, IncludeBots: req.IncludeBots}
+
+	if req.Timezone != "" {
+		loc, err := time.LoadLocation(req.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidStatsParams, req.Timezone)
+		}
+		filter.Location = loc
+	}
+
+	switch filter.Bucket {
+	case "":
+		filter.Bucket = models.StatsBucketDay
+	case models.StatsBucketHour, models.StatsBucketDay, models.StatsBucketWeek:
+	default:
+		return nil, fmt.Errorf("%w: unknown bucket %q", ErrInvalidStatsParams, req.Bucket)
+	}
+
+	filter.To = time.Now()
+	if req.To != "" {
+		to, dateOnly, err := parseStatsTime(req.To, filter.Location)
+		if err != nil {
+			return nil, err
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+
+	filter.From = filter.To.Add(-statsDefaultPeriod)
+	if req.From != "" {
+		from, _, err := parseStatsTime(req.From, filter.Location)
+		if err != nil {
+			return nil, err
+		}
+		filter.From = from
+	}
+
+	if !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsParams)
+	}
+
+	bucketsCount := 0
+	for start := storage.TruncateToBucket(filter.From, filter.Bucket, filter.Location); start.Before(filter.To); start = storage.NextBucket(start, filter.Bucket) {
+		bucketsCount++
+		if bucketsCount > statsMaxBuckets {
+			return nil, fmt.Errorf("%w: too many buckets, use larger bucket or shorter period", ErrInvalidStatsParams)
+		}
+	}
+
+	return &filter, nil
+}
 
-			URLsForDelete = nil
+// parseClicksExportRequest разбирает и проверяет параметры выгрузки событий перехода.
+// Без границ периода выгружаются все события до текущего момента.
+func parseClicksExportRequest(req models.ClicksExportRequest) (*models.ClicksPageFilter, error) {
+	filter := models.ClicksPageFilter{From: time.Unix(0, 0).UTC(), To: time.Now(), Limit: clicksExportPageSize}
+
+	loc := time.UTC
+	if req.Timezone != "" {
+		l, err := time.LoadLocation(req.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidStatsParams, req.Timezone)
+		}
+		loc = l
+	}
+
+	if req.To != "" {
+		to, dateOnly, err := parseStatsTime(req.To, loc)
+		if err != nil {
+			return nil, err
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
 		}
+		filter.To = to
+	}
+
+	if req.From != "" {
+		from, _, err := parseStatsTime(req.From, loc)
+		if err != nil {
+			return nil, err
+		}
+		filter.From = from
+	}
+
+	if !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsParams)
+	}
+
+	return &filter, nil
+}
+
+// parseStatsTime разбирает время в RFC3339 или дату 2006-01-02 в часовом поясе loc.
+func parseStatsTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%w: invalid time %q", ErrInvalidStatsParams, value)
+}
+
+// fillStatsGaps дополняет временной ряд нулевыми интервалами, в которых не было переходов.
+func fillStatsGaps(series []models.StatsBucket, filter models.ClickStatsFilter) []models.StatsBucket {
+	clicks := make(map[int64]int64, len(series))
+	for _, b := range series {
+		clicks[b.Start.Unix()] = b.Clicks
+	}
+
+	filled := []models.StatsBucket{}
+	for start := storage.TruncateToBucket(filter.From, filter.Bucket, filter.Location); start.Before(filter.To); start = storage.NextBucket(start, filter.Bucket) {
+		filled = append(filled, models.StatsBucket{Start: start, Clicks: clicks[start.Unix()]})
+	}
+
+	return filled
+}
+
+// GetUserURLs получает страницу урлов пользователя, подходящих под параметры поиска.
+func (srv *URLService) GetUserURLs(ctx context.Context, userID string, req models.UserURLsRequest) (*models.UserURLsResponse, error) {
+	filter, err := parseUserURLsRequest(req)
+	if err != nil {
+		return nil, err
 	}
+	filter.UserID = userID
+
+	return srv.selectURLsPage(ctx, filter)
 }
 
-// GetUserURLs получает неудаленные урлы по id пользователя.
-func (srv *URLService) GetUserURLs(ctx context.Context, userID string) ([]models.GetUserURLsResponse, error) {
-	data, err := srv.Storage.SelectURLs(ctx, userID)
+// selectURLsPage - выбирает страницу урлов по фильтру и кодирует курсор следующей страницы.
+func (srv *URLService) selectURLsPage(ctx context.Context, filter *models.UserURLsFilter) (*models.UserURLsResponse, error) {
+	page, err := srv.Storage.SelectURLs(ctx, *filter)
 	if err != nil {
 		logger.Log.Info(err.Error())
 		return nil, fmt.Errorf("user urls selection error: %w", err)
 	}
 
-	return data, nil
+	resp := &models.UserURLsResponse{URLs: page.URLs}
+	if page.Next != nil {
+		page.Next.Sort = userURLsSort(filter)
+		resp.NextCursor, err = encodeUserURLsCursor(page.Next)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// userURLsSort - сортировка фильтра в виде параметра sort.
+func userURLsSort(filter *models.UserURLsFilter) string {
+	if filter.SortDesc {
+		return "-" + filter.SortBy
+	}
+	return filter.SortBy
+}
+
+// encodeUserURLsCursor - кодирует курсор страницы урлов пользователя в непрозрачную строку.
+func encodeUserURLsCursor(cursor *models.UserURLsCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeUserURLsCursor - разбирает курсор страницы урлов пользователя.
+func decodeUserURLsCursor(value string) (*models.UserURLsCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor models.UserURLsCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ShortURL == "" {
+		return nil, errors.New("empty cursor position")
+	}
+	return &cursor, nil
+}
+
+// parseUserURLsRequest - проверяет параметры поиска урлов пользователя и переводит их в фильтр хранилища.
+func parseUserURLsRequest(req models.UserURLsRequest) (*models.UserURLsFilter, error) {
+	filter := models.UserURLsFilter{
+		Query:  strings.TrimSpace(req.Query),
+		Domain: strings.TrimSuffix(strings.ToLower(strings.TrimSpace(req.Domain)), "."),
+		State:  req.State,
+		SortBy: models.URLSortCreatedAt,
+	}
+
+	for _, tag := range req.Tags {
+		filter.Tags = append(filter.Tags, strings.ToLower(strings.Join(strings.Fields(tag), " ")))
+	}
+
+	switch filter.State {
+	case "", models.URLStateActive, models.URLStateDeleted:
+	default:
+		return nil, fmt.Errorf("%w: unknown state %q", ErrInvalidURLsFilter, req.State)
+	}
+
+	if req.Sort == "" {
+		filter.SortDesc = true
+	} else {
+		filter.SortBy = strings.TrimPrefix(req.Sort, "-")
+		filter.SortDesc = strings.HasPrefix(req.Sort, "-")
+		switch filter.SortBy {
+		case models.URLSortCreatedAt, models.URLSortTitle, models.URLSortOriginalURL:
+		default:
+			return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidURLsFilter, req.Sort)
+		}
+	}
+
+	if req.CreatedFrom != "" {
+		from, _, err := parseStatsTime(req.CreatedFrom, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid created_from %q", ErrInvalidURLsFilter, req.CreatedFrom)
+		}
+		filter.CreatedFrom = from
+	}
+	if req.CreatedTo != "" {
+		to, dateOnly, err := parseStatsTime(req.CreatedTo, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid created_to %q", ErrInvalidURLsFilter, req.CreatedTo)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.CreatedTo = to
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && !filter.CreatedFrom.Before(filter.CreatedTo) {
+		return nil, fmt.Errorf("%w: created_from must be before created_to", ErrInvalidURLsFilter)
+	}
+
+	switch {
+	case req.Limit < 0 || req.Limit > userURLsMaxLimit:
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidURLsFilter, userURLsMaxLimit)
+	case req.Limit == 0:
+		filter.Limit = userURLsDefaultLimit
+	default:
+		filter.Limit = req.Limit
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeUserURLsCursor(req.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidURLsFilter)
+		}
+		if cursor.Sort != userURLsSort(&filter) {
+			return nil, fmt.Errorf("%w: cursor was issued for sort %q", ErrInvalidURLsFilter, cursor.Sort)
+		}
+		filter.After = cursor
+	}
+
+	return &filter, nil
 }
 
 // GetShortURLSrv сохраняет сокращенный URL и возвращает его в качестве ответа.
 func (srv *URLService) GetShortURLSrv(ctx context.Context, body []byte, userID string) (*models.ShortenURLResponse, error) {
+	return srv.shortenURL(ctx, body, userID, 0)
+}
+
+// shortenURL - сохраняет сокращенный урл пользователя, с ненулевым workspaceID - в рабочем пространстве.
+func (srv *URLService) shortenURL(ctx context.Context, body []byte, userID string, workspaceID int64) (*models.ShortenURLResponse, error) {
 
 	var jsonBody models.ShortenURLRequest
 
@@ -153,9 +806,42 @@ func (srv *URLService) GetShortURLSrv(ctx context.Context, body []byte, userID s
 		return nil, fmt.Errorf("short ID creating error: %w", err)
 	}
 
+	variants, err := prepareVariants(jsonBody.Variants)
+	if err != nil {
+		logger.Log.Info(err.Error())
+		return nil, err
+	}
+
+	if err := srv.checkDestinations(jsonBody.URL, variants); err != nil {
+		logger.Log.Info(err.Error())
+		return nil, err
+	}
+
+	metadata, err := normalizeURLMetadata(jsonBody.Title, jsonBody.Description, jsonBody.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRedirectOptions(jsonBody.RedirectOptions); err != nil {
+		logger.Log.Info(err.Error())
+		return nil, err
+	}
+
 	resp := models.ShortenURLResponse{Result: srv.Config.BaseURL + "/" + shortID}
 
-	event := models.URLsData{UserID: userID, UUID: uuid.New().String(), ShortURL: shortID, OriginalURL: jsonBody.URL}
+	event := models.URLsData{
+		UserID:          userID,
+		WorkspaceID:     workspaceID,
+		UUID:            uuid.New().String(),
+		ShortURL:        shortID,
+		OriginalURL:     jsonBody.URL,
+		Variants:        variants,
+		RedirectOptions: jsonBody.RedirectOptions,
+		Title:           metadata.Title,
+		Description:     metadata.Description,
+		Tags:            metadata.Tags,
+		CreatedAt:       time.Now().UTC(),
+	}
 
 	err = srv.Storage.InsertURLsData(ctx, &event)
 	if err != nil {
@@ -169,6 +855,11 @@ func (srv *URLService) GetShortURLSrv(ctx context.Context, body []byte, userID s
 // CompressURL сохраняет сокращенный URL и возвращает его в качестве ответа.
 func (srv *URLService) CompressURL(ctx context.Context, originalURL []byte, userID string) (string, error) {
 
+	if err := srv.Policy.Check(string(originalURL)); err != nil {
+		logger.Log.Info(err.Error())
+		return "", err
+	}
+
 	shortID, err := utils.HashOriginalURL(originalURL)
 	if err != nil {
 		logger.Log.Info(err.Error())
@@ -176,7 +867,7 @@ func (srv *URLService) CompressURL(ctx context.Context, originalURL []byte, user
 	}
 
 	strBody := string(originalURL)
-	event := models.URLsData{UUID: uuid.New().String(), ShortURL: shortID, OriginalURL: strBody, UserID: userID}
+	event := models.URLsData{UUID: uuid.New().String(), ShortURL: shortID, OriginalURL: strBody, UserID: userID, CreatedAt: time.Now().UTC()}
 
 	err = srv.Storage.InsertURLsData(ctx, &event)
 	if err != nil {
@@ -190,13 +881,536 @@ func (srv *URLService) CompressURL(ctx context.Context, originalURL []byte, user
 // SelectOriginalURLByShortURL возвращает оригинальный урл по сокращенному.
 func (srv *URLService) SelectOriginalURLByShortURL(ctx context.Context, shortURLID string) (string, error) {
 
-	originalURL, err := srv.Storage.SelectOriginalURLByShortURL(ctx, shortURLID)
+	data, err := srv.Storage.SelectURLData(ctx, shortURLID)
 	if err != nil {
 		logger.Log.Info(err.Error())
 		return "", err
 	}
+	if data.Takedown != nil {
+		return "", &TakedownError{Reason: data.Takedown.Reason, At: data.Takedown.At}
+	}
+	if data.DeletedFlag {
+		return "", ErrURLDeleted
+	}
+	if urlExpired(data) {
+		return "", ErrURLExpired
+	}
+
+	return data.OriginalURL, nil
+}
+
+// urlExpired - проверяет, истек ли срок действия урла.
+func urlExpired(data *models.URLsData) bool {
+	return data.ExpiresAt != nil && !time.Now().Before(*data.ExpiresAt)
+}
+
+// GetRedirectTarget выбирает назначение редиректа по короткому урлу.
+// Если у урла есть варианты, то сохраняется ранее показанный вариант stickyVariantID,
+// иначе вариант выбирается случайно с учетом весов.
+// К урлу назначения применяются настройки проброса query-параметров и UTM-метки урла.
+func (srv *URLService) GetRedirectTarget(ctx context.Context, shortURLID string, stickyVariantID string, query url.Values) (*models.RedirectTarget, error) {
+
+	data, err := srv.Storage.SelectURLData(ctx, shortURLID)
+	if err != nil {
+		logger.Log.Info(err.Error())
+		return nil, err
+	}
+
+	if data.Takedown != nil {
+		return nil, &TakedownError{Reason: data.Takedown.Reason, At: data.Takedown.At}
+	}
+	if data.DeletedFlag {
+		return nil, ErrURLDeleted
+	}
+	if urlExpired(data) {
+		return nil, ErrURLExpired
+	}
+
+	target := models.RedirectTarget{OriginalURL: data.OriginalURL}
+
+	if len(data.Variants) != 0 {
+		variant := pickVariant(data.Variants, stickyVariantID)
+		target = models.RedirectTarget{OriginalURL: variant.OriginalURL, VariantID: variant.ID}
+
+		// показ учитывается в рамках запроса, чтобы сервер дожидался его записи при остановке,
+		// ошибка записи не мешает редиректу.
+		if err := srv.Storage.IncrementVariantServed(ctx, shortURLID, variant.ID); err != nil {
+			logger.Log.Info("Failed to record served variant", zap.Error(err))
+		}
+	}
+
+	target.OriginalURL, err = buildRedirectURL(target.OriginalURL, query, data.RedirectOptions, shortURLID, target.VariantID)
+	if err != nil {
+		logger.Log.Info(err.Error())
+		return nil, err
+	}
+
+	return &target, nil
+}
+
+// ExportUserData выгружает пользователю все его урлы, включая удаленные, с метаданными и сводкой переходов.
+// Урлы читаются из хранилища страницами и передаются в writeLink по одному в порядке коротких урлов.
+func (srv *URLService) ExportUserData(ctx context.Context, userID string, writeLink func(models.UserExportLink) error) error {
+	var after string
+	for {
+		page, err := srv.Storage.SelectUserURLsData(ctx, userID, after, userExportPageSize)
+		if err != nil {
+			logger.Log.Info("Failed to select user urls for export", zap.Error(err))
+			return fmt.Errorf("user urls selection error: %w", err)
+		}
+
+		for i := range page {
+			link, err := srv.userExportLink(ctx, &page[i])
+			if err != nil {
+				return err
+			}
+			if err := writeLink(*link); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < userExportPageSize {
+			return nil
+		}
+		after = page[len(page)-1].ShortURL
+	}
+}
+
+// userExportLink - собирает урл для выгрузки данных пользователя вместе со сводкой переходов за все время.
+func (srv *URLService) userExportLink(ctx context.Context, data *models.URLsData) (*models.UserExportLink, error) {
+	filter := models.ClickStatsFilter{
+		ShortURL:    data.ShortURL,
+		From:        time.Unix(0, 0).UTC(),
+		To:          time.Now().UTC(),
+		Location:    time.UTC,
+		Bucket:      models.StatsBucketDay,
+		IncludeBots: true,
+	}
+	// сводка считается по дням, поэтому гранулярность выбирается без ошибки.
+	filter.Rollup, _ = srv.statsRollup(filter)
+
+	stats, err := srv.Storage.SelectClickStats(ctx, filter)
+	if err != nil {
+		logger.Log.Info("Failed to get click stats for export", zap.Error(err))
+		return nil, fmt.Errorf("click stats selection error: %w", err)
+	}
+
+	return &models.UserExportLink{
+		ShortURL:        srv.Config.BaseURL + "/" + data.ShortURL,
+		OriginalURL:     data.OriginalURL,
+		Title:           data.Title,
+		Description:     data.Description,
+		Tags:            data.Tags,
+		Variants:        data.Variants,
+		RedirectOptions: data.RedirectOptions,
+		CreatedAt:       data.CreatedAt,
+		ExpiresAt:       data.ExpiresAt,
+		Deleted:         data.DeletedFlag,
+		DeletedAt:       data.DeletedAt,
+		Takedown:        data.Takedown,
+		Clicks: models.UserExportClicks{
+			TotalClicks:    stats.TotalClicks,
+			BotClicks:      stats.BotClicks,
+			UniqueVisitors: stats.UniqueVisitors,
+			Daily:          stats.TimeSeries,
+			Referrers:      stats.TopReferrers,
+			UserAgents:     stats.UserAgents,
+			Variants:       stats.Variants,
+		},
+	}, nil
+}
+
+// GetQRCode рисует QR-код с полным адресом короткого урла.
+func (srv *URLService) GetQRCode(ctx context.Context, shortURLID string, opts qrcode.Options) (*qrcode.Image, error) {
+	data, err := srv.Storage.SelectURLData(ctx, shortURLID)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Takedown != nil {
+		return nil, &TakedownError{Reason: data.Takedown.Reason, At: data.Takedown.At}
+	}
+	if data.DeletedFlag {
+		return nil, ErrURLDeleted
+	}
+	if urlExpired(data) {
+		return nil, ErrURLExpired
+	}
+
+	img, err := qrcode.Render(srv.Config.BaseURL+"/"+shortURLID, opts)
+	if err != nil {
+		if !errors.Is(err, qrcode.ErrInvalidOptions) {
+			logger.Log.Info("Failed to render qr code", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// UpdateURLMetadata меняет название, описание и теги урла пользователя или урла рабочего пространства,
+// где у пользователя роль не ниже редактора. Незаданные поля запроса не меняются.
+func (srv *URLService) UpdateURLMetadata(ctx context.Context, userID string, shortURLID string, req models.UpdateURLMetadataRequest) (*models.GetUserURLsResponse, error) {
+	data, err := srv.checkURLOwner(ctx, userID, shortURLID, models.WorkspaceRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	if data.DeletedFlag {
+		return nil, ErrURLDeleted
+	}
+
+	title, description, tags := data.Title, data.Description, data.Tags
+	if req.Title != nil {
+		title = *req.Title
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if req.Tags != nil {
+		tags = *req.Tags
+	}
+
+	metadata, err := normalizeURLMetadata(title, description, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := srv.Storage.UpdateURLMetadata(ctx, shortURLID, metadata); err != nil {
+		logger.Log.Info("Failed to update url metadata", zap.Error(err))
+		return nil, err
+	}
+
+	return &models.GetUserURLsResponse{
+		ShortURL:    srv.Config.BaseURL + "/" + shortURLID,
+		OriginalURL: data.OriginalURL,
+		Title:       metadata.Title,
+		Description: metadata.Description,
+		Tags:        metadata.Tags,
+		CreatedAt:   data.CreatedAt,
+		Health:      data.Health,
+	}, nil
+}
+
+// normalizeURLMetadata - проверяет название, описание и теги урла. Теги приводятся к нижнему регистру,
+// повторы убираются с сохранением порядка.
+func normalizeURLMetadata(title string, description string, tags []string) (models.URLMetadata, error) {
+	metadata := models.URLMetadata{Title: strings.TrimSpace(title), Description: strings.TrimSpace(description)}
+
+	if utf8.RuneCountInString(metadata.Title) > titleMaxLength {
+		return metadata, fmt.Errorf("%w: title is longer than %d characters", ErrInvalidMetadata, titleMaxLength)
+	}
+	if utf8.RuneCountInString(metadata.Description) > descriptionMaxLength {
+		return metadata, fmt.Errorf("%w: description is longer than %d characters", ErrInvalidMetadata, descriptionMaxLength)
+	}
+
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || utf8.RuneCountInString(tag) > tagMaxLength || !tagPattern.MatchString(tag) {
+			return metadata, fmt.Errorf("%w: invalid tag %q", ErrInvalidMetadata, tag)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		metadata.Tags = append(metadata.Tags, tag)
+	}
+	if len(metadata.Tags) > tagsMaxCount {
+		return metadata, fmt.Errorf("%w: more than %d tags", ErrInvalidMetadata, tagsMaxCount)
+	}
+
+	return metadata, nil
+}
+
+// ReportURL сохраняет жалобу на короткий урл. IP автора сохраняется только в виде соленого хеша.
+// Повторная жалоба с того же IP на урл, по которому она еще не решена, не сохраняется - возвращается уже открытая.
+func (srv *URLService) ReportURL(ctx context.Context, shortURLID string, req models.AbuseReportRequest, clientIP string) (*models.AbuseReport, error) {
+	if !abuseReasons[req.Reason] {
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidAbuseReport, req.Reason)
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(comment) > abuseCommentMaxLength {
+		return nil, fmt.Errorf("%w: comment is longer than %d characters", ErrInvalidAbuseReport, abuseCommentMaxLength)
+	}
+
+	if _, err := srv.Storage.SelectURLData(ctx, shortURLID); err != nil {
+		return nil, err
+	}
+
+	report := models.AbuseReport{
+		ShortURL:       shortURLID,
+		Reason:         req.Reason,
+		Comment:        comment,
+		ReporterIPHash: utils.HashIP(clientIP, srv.Config.IPHashSalt),
+		Status:         models.AbuseReportOpen,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := srv.Storage.InsertAbuseReport(ctx, &report); err != nil {
+		logger.Log.Info("Failed to save abuse report", zap.Error(err))
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// GetAbuseReports возвращает страницу очереди жалоб для модератора.
+func (srv *URLService) GetAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error) {
+	switch filter.Status {
+	case "", models.AbuseReportOpen, models.AbuseReportDismissed, models.AbuseReportActioned:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidModeration, filter.Status)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = abuseReportsDefaultLimit
+	}
+	if filter.Limit < 0 || filter.Limit > abuseReportsMaxLimit || filter.AfterID < 0 {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidModeration, abuseReportsMaxLimit)
+	}
+
+	return srv.Storage.SelectAbuseReports(ctx, filter)
+}
+
+// ModerateAbuseReport выполняет действие модератора по открытой жалобе: отклоняет ее
+// или блокирует урл, закрывая вместе с ней все открытые жалобы на этот урл.
+func (srv *URLService) ModerateAbuseReport(ctx context.Context, reportID int64, req models.ModerationRequest) (*models.AbuseReport, error) {
+	if req.Action != models.ModerationDismiss && req.Action != models.ModerationTakedown {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidModeration, req.Action)
+	}
+
+	report, err := srv.Storage.SelectAbuseReport(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status != models.AbuseReportOpen {
+		return nil, ErrAbuseReportResolved
+	}
+
+	now := time.Now().UTC()
+	resolution := models.AbuseReportResolution{
+		ReportID:   reportID,
+		Status:     models.AbuseReportDismissed,
+		Note:       req.Note,
+		ResolvedAt: now,
+	}
+	if req.Action == models.ModerationTakedown {
+		resolution.Status = models.AbuseReportActioned
+	}
+
+	// жалоба закрывается до блокировки урла: из параллельных решений по ней
+	// урл блокирует только то, которое успело перевести ее из открытых.
+	if err := srv.Storage.ResolveAbuseReports(ctx, resolution); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			return nil, ErrAbuseReportResolved
+		}
+		logger.Log.Info("Failed to resolve abuse report", zap.Error(err))
+		return nil, err
+	}
+
+	if req.Action == models.ModerationTakedown {
+		reason := report.Reason
+		if req.Note != "" {
+			reason = req.Note
+		}
+		if err := srv.Storage.UpdateURLTakedown(ctx, report.ShortURL, &models.URLTakedown{Reason: reason, At: now}); err != nil {
+			return nil, err
+		}
+		err := srv.Storage.ResolveAbuseReports(ctx, models.AbuseReportResolution{
+			ShortURL:   report.ShortURL,
+			Status:     models.AbuseReportActioned,
+			Note:       req.Note,
+			ResolvedAt: now,
+		})
+		if err != nil {
+			logger.Log.Info("Failed to resolve abuse reports", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	return srv.Storage.SelectAbuseReport(ctx, reportID)
+}
+
+// TakedownURL блокирует короткий урл модератором без жалобы, открытые жалобы на него закрываются.
+func (srv *URLService) TakedownURL(ctx context.Context, shortURLID string, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("%w: takedown reason is required", ErrInvalidModeration)
+	}
+
+	now := time.Now().UTC()
+	if err := srv.Storage.UpdateURLTakedown(ctx, shortURLID, &models.URLTakedown{Reason: reason, At: now}); err != nil {
+		return err
+	}
+
+	return srv.Storage.ResolveAbuseReports(ctx, models.AbuseReportResolution{
+		ShortURL:   shortURLID,
+		Status:     models.AbuseReportActioned,
+		Note:       reason,
+		ResolvedAt: now,
+	})
+}
+
+// RestoreURL снимает блокировку короткого урла модератором.
+func (srv *URLService) RestoreURL(ctx context.Context, shortURLID string) error {
+	return srv.Storage.UpdateURLTakedown(ctx, shortURLID, nil)
+}
+
+// checkDestinations - проверяет политикой доменов основной адрес назначения и адреса вариантов.
+func (srv *URLService) checkDestinations(originalURL string, variants []models.URLVariant) error {
+	if err := srv.Policy.Check(originalURL); err != nil {
+		return err
+	}
+	for _, v := range variants {
+		if err := srv.Policy.Check(v.OriginalURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRedirectOptions проверяет политику проброса query-параметров и UTM-метки.
+func validateRedirectOptions(opts *models.RedirectOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	switch opts.QueryPolicy {
+	case models.QueryPolicyDrop, models.QueryPolicyMerge, models.QueryPolicyOverride:
+	default:
+		return fmt.Errorf("%w: unknown query policy %q", ErrInvalidRedirectOptions, opts.QueryPolicy)
+	}
+
+	for key := range opts.UTM {
+		if !strings.HasPrefix(key, "utm_") {
+			return fmt.Errorf("%w: %q is not utm parameter", ErrInvalidRedirectOptions, key)
+		}
+	}
+
+	return nil
+}
+
+// buildRedirectURL формирует урл назначения: пробрасывает query-параметры входящего запроса
+// согласно политике и проставляет UTM-метки, заменяя в них шаблоны {short_id} и {variant_id}.
+// Исходная строка запроса назначения сохраняется как есть, из неё убираются только
+// переопределяемые ключи, а новые пары дописываются в конец.
+func buildRedirectURL(destination string, query url.Values, opts *models.RedirectOptions, shortURLID string, variantID string) (string, error) {
+	if opts == nil || (opts.QueryPolicy == models.QueryPolicyDrop && len(opts.UTM) == 0) {
+		return destination, nil
+	}
+
+	parsedURL, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("destination url parsing error: %w", err)
+	}
+
+	pairs := splitRawQuery(parsedURL.RawQuery)
+	existing := make(map[string]struct{}, len(pairs))
+	for _, pair := range pairs {
+		existing[rawQueryKey(pair)] = struct{}{}
+	}
+
+	added := url.Values{}
+	for key, values := range query {
+		switch opts.QueryPolicy {
+		case models.QueryPolicyMerge:
+			if _, exist := existing[key]; !exist {
+				added[key] = values
+			}
+		case models.QueryPolicyOverride:
+			added[key] = values
+		}
+	}
+
+	replacer := strings.NewReplacer("{short_id}", shortURLID, "{variant_id}", variantID)
+	for key, value := range opts.UTM {
+		added.Set(key, replacer.Replace(value))
+	}
+
+	kept := make([]string, 0, len(pairs)+1)
+	for _, pair := range pairs {
+		if _, overridden := added[rawQueryKey(pair)]; !overridden {
+			kept = append(kept, pair)
+		}
+	}
+	if len(added) != 0 {
+		kept = append(kept, added.Encode())
+	}
+
+	parsedURL.RawQuery = strings.Join(kept, "&")
+
+	return parsedURL.String(), nil
+}
+
+// splitRawQuery разбивает строку запроса на пары без их разбора и перекодирования.
+func splitRawQuery(rawQuery string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// rawQueryKey возвращает раскодированный ключ пары строки запроса,
+// а если ключ не раскодируется - ключ как есть.
+func rawQueryKey(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+// prepareVariants проверяет варианты назначения и проставляет им идентификаторы.
+func prepareVariants(variants []models.URLVariant) ([]models.URLVariant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+
+	prepared := make([]models.URLVariant, len(variants))
+	ids := make(map[string]struct{}, len(variants))
+
+	for i, v := range variants {
+		if v.OriginalURL == "" {
+			return nil, fmt.Errorf("%w: variant %d has empty url", ErrInvalidVariants, i)
+		}
+		if v.Weight <= 0 {
+			return nil, fmt.Errorf("%w: variant %d has non-positive weight", ErrInvalidVariants, i)
+		}
+		if v.ID == "" {
+			v.ID = strconv.Itoa(i + 1)
+		}
+		if _, exist := ids[v.ID]; exist {
+			return nil, fmt.Errorf("%w: duplicate variant id %q", ErrInvalidVariants, v.ID)
+		}
+		ids[v.ID] = struct{}{}
+
+		v.Served = 0
+		prepared[i] = v
+	}
+
+	return prepared, nil
+}
+
+// pickVariant возвращает закрепленный за посетителем вариант или выбирает новый по весам.
+func pickVariant(variants []models.URLVariant, stickyVariantID string) models.URLVariant {
+	totalWeight := 0
+	for _, v := range variants {
+		if v.ID == stickyVariantID {
+			return v
+		}
+		totalWeight += v.Weight
+	}
+
+	n := rand.Intn(totalWeight)
+	for _, v := range variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
 
-	return originalURL, nil
+	return variants[len(variants)-1]
 }
 
 // PingDB пингует бд.
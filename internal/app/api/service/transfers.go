@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidTransfer - ошибка валидации предложения передачи урлов.
+var ErrInvalidTransfer = errors.New("invalid url transfer")
+
+// ErrTransferClosed - ошибка при обращении к принятому, отмененному или истекшему предложению передачи,
+// а также к предложению, урлы которого с момента создания удалены или сменили владельца.
+var ErrTransferClosed = errors.New("url transfer is closed")
+
+const (
+	// maxTransferURLs - максимальное количество урлов в одном предложении передачи.
+	maxTransferURLs = 1000
+	// urlTransferTTL - срок, в течение которого получатель может принять предложение передачи.
+	urlTransferTTL = 7 * 24 * time.Hour
+)
+
+// CreateURLTransfer создает предложение передать урлы пользователя другому пользователю.
+// Передавать можно только свои неудаленные урлы вне рабочих пространств.
+// Токен для получателя возвращается только в ответе, в хранилище сохраняется его хеш.
+func (srv *URLService) CreateURLTransfer(ctx context.Context, userID string, req models.URLTransferRequest) (*models.URLTransfer, error) {
+	var shortURLs []string
+	seen := make(map[string]bool, len(req.URLs))
+	for _, shortURL := range req.URLs {
+		if shortURL == "" {
+			return nil, ErrInvalidTransfer
+		}
+		if seen[shortURL] {
+			continue
+		}
+		seen[shortURL] = true
+		shortURLs = append(shortURLs, shortURL)
+	}
+	if len(shortURLs) == 0 || len(shortURLs) > maxTransferURLs {
+		return nil, ErrInvalidTransfer
+	}
+
+	for _, shortURL := range shortURLs {
+		data, err := srv.Storage.SelectURLData(ctx, shortURL)
+		if err != nil {
+			return nil, err
+		}
+		if data.UserID != userID || data.WorkspaceID != 0 {
+			return nil, ErrURLNotOwned
+		}
+		if data.DeletedFlag {
+			return nil, ErrURLDeleted
+		}
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	transfer := &models.URLTransfer{
+		Token:      token,
+		TokenHash:  hashSecretToken(token),
+		FromUserID: userID,
+		ShortURLs:  shortURLs,
+		Status:     models.URLTransferPending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(urlTransferTTL),
+	}
+	if err := srv.Storage.InsertURLTransfer(ctx, transfer); err != nil {
+		logger.Log.Info("Failed to save url transfer", zap.Error(err))
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// AcceptURLTransfer принимает предложение передачи по токену: урлы предложения переходят к userID.
+func (srv *URLService) AcceptURLTransfer(ctx context.Context, userID string, token string) (*models.URLTransfer, error) {
+	if token == "" {
+		return nil, ErrInvalidTransfer
+	}
+
+	transfer, err := srv.Storage.SelectURLTransferByTokenHash(ctx, hashSecretToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if transfer.FromUserID == userID {
+		return nil, ErrInvalidTransfer
+	}
+
+	transfer, err = srv.Storage.AcceptURLTransfer(ctx, transfer.ID, userID, time.Now().UTC())
+	if errors.Is(err, storage.ErrConflict) {
+		return nil, ErrTransferClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info("URLs transferred",
+		zap.Int64("transfer_id", transfer.ID),
+		zap.String("from_user_id", transfer.FromUserID),
+		zap.String("to_user_id", transfer.ToUserID),
+		zap.Int("urls", len(transfer.ShortURLs)),
+	)
+	return transfer, nil
+}
+
+// CancelURLTransfer отменяет ожидающее предложение передачи пользователя.
+// Чужие предложения считаются несуществующими.
+func (srv *URLService) CancelURLTransfer(ctx context.Context, userID string, id int64) error {
+	transfer, err := srv.Storage.SelectURLTransfer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if transfer.FromUserID != userID {
+		return storage.ErrNotFound
+	}
+
+	err = srv.Storage.CancelURLTransfer(ctx, id, time.Now().UTC())
+	if errors.Is(err, storage.ErrConflict) {
+		return ErrTransferClosed
+	}
+	return err
+}
+
+// GetURLOwnershipAudit возвращает журнал смены владельцев урла.
+func (srv *URLService) GetURLOwnershipAudit(ctx context.Context, shortURL string) ([]models.URLOwnershipAudit, error) {
+	if _, err := srv.Storage.SelectURLData(ctx, shortURL); err != nil {
+		return nil, err
+	}
+
+	audit, err := srv.Storage.SelectURLOwnershipAudit(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	if audit == nil {
+		audit = []models.URLOwnershipAudit{}
+	}
+	return audit, nil
+}
+
+// newSecretToken - генерирует случайный токен для предложений передачи и приглашений.
+func newSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashSecretToken - вычисляет хеш случайного токена для хранения и поиска.
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"go.uber.org/zap"
+)
+
+// GetTrashURLs возвращает страницу удаленных урлов пользователя с моментом их безвозвратного удаления.
+// Параметры поиска и пагинации те же, что у GetUserURLs, состояние всегда deleted.
+func (srv *URLService) GetTrashURLs(ctx context.Context, userID string, req models.UserURLsRequest) (*models.UserURLsResponse, error) {
+	req.State = models.URLStateDeleted
+
+	resp, err := srv.GetUserURLs(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if srv.Config.TrashRetention > 0 {
+		for i := range resp.URLs {
+			if deletedAt := resp.URLs[i].DeletedAt; deletedAt != nil {
+				purgeAt := deletedAt.Add(srv.Config.TrashRetention)
+				resp.URLs[i].PurgeAt = &purgeAt
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// RestoreUserURLs восстанавливает из корзины удаленные урлы пользователя.
+// Неудаленные, несуществующие и чужие урлы пропускаются.
+func (srv *URLService) RestoreUserURLs(ctx context.Context, userID string, shortURLs []string) (*models.RestoreURLsResponse, error) {
+	resp := &models.RestoreURLsResponse{Restored: []string{}}
+	if len(shortURLs) == 0 {
+		return resp, nil
+	}
+
+	restored, err := srv.Storage.RestoreURLs(ctx, userID, shortURLs)
+	if err != nil {
+		return nil, err
+	}
+	resp.Restored = append(resp.Restored, restored...)
+
+	return resp, nil
+}
+
+// purgeTrash периодически безвозвратно удаляет урлы, пролежавшие в корзине дольше срока хранения, до отмены ctx.
+func (srv *URLService) purgeTrash(ctx context.Context) {
+	if srv.Config.TrashRetention <= 0 || srv.Config.TrashPurgeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(srv.Config.TrashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			purged, err := srv.Storage.PurgeDeletedURLs(ctx, time.Now().Add(-srv.Config.TrashRetention))
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Log.Info("Failed to purge trash", zap.Error(err))
+				}
+				continue
+			}
+			if purged > 0 {
+				logger.Log.Info("Trash purged", zap.Int64("urls", purged))
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidWorkspace - ошибка валидации рабочего пространства, роли участника или приглашения.
+var ErrInvalidWorkspace = errors.New("invalid workspace request")
+
+// ErrWorkspaceForbidden - ошибка при действии, на которое у роли участника рабочего пространства нет прав.
+var ErrWorkspaceForbidden = errors.New("insufficient workspace role")
+
+// ErrLastWorkspaceOwner - ошибка при исключении или понижении последнего владельца рабочего пространства.
+var ErrLastWorkspaceOwner = errors.New("workspace must keep an owner")
+
+// ErrInviteClosed - ошибка при принятии использованного или истекшего приглашения,
+// а также приглашения в пространство, где пользователь уже состоит.
+var ErrInviteClosed = errors.New("workspace invite is closed")
+
+const (
+	// maxWorkspaceNameLength - максимальная длина названия рабочего пространства в символах.
+	maxWorkspaceNameLength = 100
+	// workspaceInviteTTL - срок, в течение которого можно принять приглашение в рабочее пространство.
+	workspaceInviteTTL = 7 * 24 * time.Hour
+)
+
+// workspaceRoleRanks - права ролей участников рабочего пространства по возрастанию.
+var workspaceRoleRanks = map[string]int{
+	models.WorkspaceRoleViewer: 1,
+	models.WorkspaceRoleEditor: 2,
+	models.WorkspaceRoleOwner:  3,
+}
+
+// CreateWorkspace создает рабочее пространство, создатель становится его владельцем.
+func (srv *URLService) CreateWorkspace(ctx context.Context, userID string, req models.WorkspaceRequest) (*models.Workspace, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxWorkspaceNameLength {
+		return nil, ErrInvalidWorkspace
+	}
+
+	workspace := &models.Workspace{Name: name, CreatedBy: userID, CreatedAt: time.Now().UTC()}
+	if err := srv.Storage.InsertWorkspace(ctx, workspace); err != nil {
+		logger.Log.Info("Failed to save workspace", zap.Error(err))
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// GetUserWorkspaces возвращает рабочие пространства пользователя с его ролью в каждом.
+func (srv *URLService) GetUserWorkspaces(ctx context.Context, userID string) ([]models.Workspace, error) {
+	workspaces, err := srv.Storage.SelectUserWorkspaces(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if workspaces == nil {
+		workspaces = []models.Workspace{}
+	}
+	return workspaces, nil
+}
+
+// GetWorkspaceMembers возвращает участнику список участников рабочего пространства.
+func (srv *URLService) GetWorkspaceMembers(ctx context.Context, userID string, workspaceID int64) ([]models.WorkspaceMember, error) {
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+	return srv.Storage.SelectWorkspaceMembers(ctx, workspaceID)
+}
+
+// UpdateWorkspaceMember меняет роль участника рабочего пространства по запросу владельца.
+func (srv *URLService) UpdateWorkspaceMember(ctx context.Context, userID string, workspaceID int64, memberID string, req models.WorkspaceMemberRequest) (*models.WorkspaceMember, error) {
+	if _, ok := workspaceRoleRanks[req.Role]; !ok {
+		return nil, ErrInvalidWorkspace
+	}
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+
+	member, err := srv.Storage.UpdateWorkspaceMemberRole(ctx, workspaceID, memberID, req.Role)
+	if errors.Is(err, storage.ErrConflict) {
+		return nil, ErrLastWorkspaceOwner
+	}
+	return member, err
+}
+
+// RemoveWorkspaceMember исключает участника из рабочего пространства по запросу владельца,
+// любой участник может выйти из пространства сам.
+func (srv *URLService) RemoveWorkspaceMember(ctx context.Context, userID string, workspaceID int64, memberID string) error {
+	minRole := models.WorkspaceRoleOwner
+	if memberID == userID {
+		minRole = models.WorkspaceRoleViewer
+	}
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, minRole); err != nil {
+		return err
+	}
+
+	err := srv.Storage.DeleteWorkspaceMember(ctx, workspaceID, memberID)
+	if errors.Is(err, storage.ErrConflict) {
+		return ErrLastWorkspaceOwner
+	}
+	return err
+}
+
+// CreateWorkspaceInvite создает по запросу владельца одноразовое приглашение в рабочее пространство с ролью.
+// Токен приглашения возвращается только в ответе, в хранилище сохраняется его хеш.
+func (srv *URLService) CreateWorkspaceInvite(ctx context.Context, userID string, workspaceID int64, req models.WorkspaceInviteRequest) (*models.WorkspaceInvite, error) {
+	if _, ok := workspaceRoleRanks[req.Role]; !ok {
+		return nil, ErrInvalidWorkspace
+	}
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	invite := &models.WorkspaceInvite{
+		WorkspaceID: workspaceID,
+		Role:        req.Role,
+		Token:       token,
+		TokenHash:   hashSecretToken(token),
+		CreatedBy:   userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(workspaceInviteTTL),
+	}
+	if err := srv.Storage.InsertWorkspaceInvite(ctx, invite); err != nil {
+		logger.Log.Info("Failed to save workspace invite", zap.Error(err))
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// AcceptWorkspaceInvite принимает приглашение по токену, пользователь становится участником рабочего пространства.
+func (srv *URLService) AcceptWorkspaceInvite(ctx context.Context, userID string, token string) (*models.WorkspaceMember, error) {
+	if token == "" {
+		return nil, ErrInvalidWorkspace
+	}
+
+	member, err := srv.Storage.AcceptWorkspaceInvite(ctx, hashSecretToken(token), userID, time.Now().UTC())
+	if errors.Is(err, storage.ErrConflict) {
+		return nil, ErrInviteClosed
+	}
+	return member, err
+}
+
+// CreateWorkspaceURL сохраняет сокращенный урл в рабочем пространстве, создавать урлы может редактор или владелец.
+func (srv *URLService) CreateWorkspaceURL(ctx context.Context, userID string, workspaceID int64, body []byte) (*models.ShortenURLResponse, error) {
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, models.WorkspaceRoleEditor); err != nil {
+		return nil, err
+	}
+	return srv.shortenURL(ctx, body, userID, workspaceID)
+}
+
+// GetWorkspaceURLs возвращает участнику страницу урлов рабочего пространства.
+// Параметры поиска и пагинации те же, что у GetUserURLs.
+func (srv *URLService) GetWorkspaceURLs(ctx context.Context, userID string, workspaceID int64, req models.UserURLsRequest) (*models.UserURLsResponse, error) {
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+
+	filter, err := parseUserURLsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	filter.WorkspaceID = workspaceID
+
+	page, err := srv.selectURLsPage(ctx, filter)
+	if errors.Is(err, storage.ErrNotFound) {
+		// хранилище в памяти не отличает пустую выборку от ненайденной, а доступ к пространству уже проверен.
+		return &models.UserURLsResponse{}, nil
+	}
+	return page, err
+}
+
+// SendWorkspaceURLsToDeletion создает задачу удаления урлов рабочего пространства,
+// удалять урлы может редактор или владелец. Урлы вне пространства в задаче не удаляются.
+func (srv *URLService) SendWorkspaceURLsToDeletion(ctx context.Context, userID string, workspaceID int64, urls []string) (*models.Job, error) {
+	if err := srv.checkWorkspaceRole(ctx, userID, workspaceID, models.WorkspaceRoleEditor); err != nil {
+		return nil, err
+	}
+	return srv.sendURLsToDeletion(ctx, urls, userID, workspaceID)
+}
+
+// checkWorkspaceRole - проверяет, что роль пользователя в рабочем пространстве не ниже minRole.
+// Для тех, кто не состоит в пространстве, оно не отличается от несуществующего.
+func (srv *URLService) checkWorkspaceRole(ctx context.Context, userID string, workspaceID int64, minRole string) error {
+	member, err := srv.Storage.SelectWorkspaceMember(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if workspaceRoleRanks[member.Role] < workspaceRoleRanks[minRole] {
+		return ErrWorkspaceForbidden
+	}
+	return nil
+}
@@ -1,8 +1,14 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/sqids/sqids-go"
 )
@@ -30,3 +36,71 @@ func HashOriginalURL(originalURL []byte) (string, error) {
 
 	return shortID, nil
 }
+
+// ClientIP возвращает IP клиента из заголовков X-Real-IP, X-Forwarded-For или адреса соединения.
+func ClientIP(req *http.Request) string {
+	if ip := req.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// HashIP вычисляет соленый хеш IP, чтобы не хранить адреса посетителей в открытом виде.
+func HashIP(ip string, salt string) string {
+	if ip == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(salt + ip))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReferrerHost возвращает хост из заголовка Referer в нижнем регистре.
+func ReferrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+
+	parsedURL, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Hostname())
+}
+
+// userAgentFamilies - признаки семейств браузеров в User-Agent, проверяются по порядку.
+var userAgentFamilies = []struct {
+	marker string
+	family string
+}{
+	{"YaBrowser/", "Yandex Browser"},
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+// UserAgentFamily возвращает семейство браузера по заголовку User-Agent.
+func UserAgentFamily(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown"
+	}
+
+	for _, f := range userAgentFamilies {
+		if strings.Contains(userAgent, f.marker) {
+			return f.family
+		}
+	}
+	return "Other"
+}
@@ -0,0 +1,55 @@
+// Package botdetect определяет запросы ботов, краулеров и генераторов превью ссылок.
+package botdetect
+
+import (
+	_ "embed"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//go:embed patterns.txt
+var defaultPatterns string
+
+// userAgentPattern - объединенное регулярное выражение признаков ботов в User-Agent.
+var userAgentPattern = compilePatterns(defaultPatterns)
+
+// prefetchHeaders - заголовки, которыми браузеры помечают предзагрузку и превью страниц.
+var prefetchHeaders = []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"}
+
+// IsBot определяет, отправлен ли запрос ботом: по списку признаков в User-Agent
+// и по поведению - HEAD-запросы, предзагрузка страниц, отсутствие User-Agent.
+func IsBot(req *http.Request) bool {
+	if req.Method == http.MethodHead {
+		return true
+	}
+
+	for _, header := range prefetchHeaders {
+		value := strings.ToLower(req.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+
+	userAgent := req.UserAgent()
+	if userAgent == "" {
+		return true
+	}
+
+	return userAgentPattern.MatchString(userAgent)
+}
+
+// compilePatterns - собирает признаки из списка в одно регулярное выражение без учета регистра.
+func compilePatterns(list string) *regexp.Regexp {
+	var patterns []string
+
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, "(?:"+line+")")
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+}
@@ -0,0 +1,67 @@
+package botdetect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBot(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		userAgent string
+		headers   map[string]string
+		want      bool
+	}{
+		{
+			name:      "Desktop browser",
+			method:    http.MethodGet,
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0 Safari/537.36",
+			want:      false,
+		},
+		{
+			name:      "Slack unfurler",
+			method:    http.MethodGet,
+			userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want:      true,
+		},
+		{
+			name:      "Telegram preview",
+			method:    http.MethodGet,
+			userAgent: "TelegramBot (like TwitterBot)",
+			want:      true,
+		},
+		{
+			name:      "HEAD request",
+			method:    http.MethodHead,
+			userAgent: "Mozilla/5.0",
+			want:      true,
+		},
+		{
+			name:      "Browser prefetch",
+			method:    http.MethodGet,
+			userAgent: "Mozilla/5.0 Firefox/131.0",
+			headers:   map[string]string{"Sec-Purpose": "prefetch;prerender"},
+			want:      true,
+		},
+		{
+			name:   "Empty user agent",
+			method: http.MethodGet,
+			want:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/abc", nil)
+			req.Header.Set("User-Agent", test.userAgent)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			assert.Equal(t, test.want, IsBot(req))
+		})
+	}
+}
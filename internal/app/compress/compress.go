@@ -37,6 +37,14 @@ func (c *compressWriter) WriteHeader(statusCode int) {
 	c.w.WriteHeader(statusCode)
 }
 
+// Flush отправляет клиенту накопленные сжатые данные, если оригинальный writer это поддерживает.
+func (c *compressWriter) Flush() {
+	c.zw.Flush()
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Close завершает работу и закрывает compressWriter.
 func (c *compressWriter) Close() error {
 	return c.zw.Close()
@@ -2,12 +2,24 @@ package grpcserver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/nu-kotov/URLcompressor/internal/app/api/service"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
 	"github.com/nu-kotov/URLcompressor/internal/app/proto"
+	"github.com/nu-kotov/URLcompressor/internal/app/qrcode"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"github.com/nu-kotov/URLcompressor/internal/app/urlpolicy"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// destinationRejectedReason - причина в деталях ошибки gRPC при отклонении адреса назначения политикой доменов.
+const destinationRejectedReason = "DESTINATION_REJECTED"
+
 // GRPCServer структура сервера gRPC-сервиса.
 type GRPCServer struct {
 	proto.UnimplementedURLcompressorServer
@@ -31,11 +43,35 @@ func (s *GRPCServer) PingDB(ctx context.Context, _ *proto.PingDBRequest) (*proto
 }
 
 // GetShortURL - возвращает сокращенный урл пользователя по полному урлу.
+// С workspace_id урл создается в рабочем пространстве, где у пользователя роль редактора или владельца.
 func (s *GRPCServer) GetShortURL(ctx context.Context, req *proto.GetShortURLRequest) (*proto.GetShortURLResponse, error) {
-	shortURL, err := s.service.GetShortURLSrv(ctx, []byte(req.OriginalUrl), req.UserId)
+	shortenReq := models.ShortenURLRequest{
+		URL:         req.OriginalUrl,
+		Title:       req.Title,
+		Description: req.Description,
+		Tags:        req.Tags,
+	}
+	for _, v := range req.Variants {
+		shortenReq.Variants = append(shortenReq.Variants, models.URLVariant{ID: v.Id, OriginalURL: v.OriginalUrl, Weight: int(v.Weight)})
+	}
+	if req.QueryPolicy != "" || len(req.Utm) != 0 {
+		shortenReq.RedirectOptions = &models.RedirectOptions{QueryPolicy: req.QueryPolicy, UTM: req.Utm}
+	}
+
+	body, err := json.Marshal(shortenReq)
 	if err != nil {
 		return nil, err
 	}
+
+	var shortURL *models.ShortenURLResponse
+	if req.WorkspaceId != 0 {
+		shortURL, err = s.service.CreateWorkspaceURL(ctx, req.UserId, req.WorkspaceId, body)
+	} else {
+		shortURL, err = s.service.GetShortURLSrv(ctx, body, req.UserId)
+	}
+	if err != nil {
+		return nil, workspaceStatus(destinationRejectedStatus(err))
+	}
 	return &proto.GetShortURLResponse{ShortUrl: shortURL.Result}, nil
 }
 
@@ -43,7 +79,7 @@ func (s *GRPCServer) GetShortURL(ctx context.Context, req *proto.GetShortURLRequ
 func (s *GRPCServer) GetOriginalURL(ctx context.Context, req *proto.GetOriginalURLRequest) (*proto.GetOriginalURLResponse, error) {
 	originalURL, err := s.service.SelectOriginalURLByShortURL(ctx, req.ShortUrlId)
 	if err != nil {
-		return nil, err
+		return nil, urlStatus(err)
 	}
 	return &proto.GetOriginalURLResponse{OriginalUrl: originalURL}, nil
 }
@@ -56,7 +92,7 @@ func (s *GRPCServer) GetShortURLsBatch(ctx context.Context, req *proto.GetShortU
 	}
 	shortURLsBatch, err := s.service.GetShortURLsBatch(ctx, batch, req.UserId)
 	if err != nil {
-		return nil, err
+		return nil, destinationRejectedStatus(err)
 	}
 
 	respItems := make([]*proto.GetShortURLsBatchResponseItem, len(shortURLsBatch))
@@ -69,29 +105,87 @@ func (s *GRPCServer) GetShortURLsBatch(ctx context.Context, req *proto.GetShortU
 	return &proto.GetShortURLsBatchResponse{Items: respItems}, nil
 }
 
-// GetUserURLs - возвращает урлы по id пользователя.
+// GetUserURLs - возвращает урлы по id пользователя, с workspace_id - урлы рабочего пространства пользователя.
 func (s *GRPCServer) GetUserURLs(ctx context.Context, req *proto.GetUserURLsRequest) (*proto.GetUserURLsResponse, error) {
-	userURLs, err := s.service.GetUserURLs(ctx, req.UserId)
+	urlsReq := models.UserURLsRequest{
+		Query:       req.Query,
+		Tags:        req.Tags,
+		Domain:      req.Domain,
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		State:       req.State,
+		Sort:        req.Sort,
+		Limit:       int(req.PageSize),
+		Cursor:      req.PageToken,
+	}
+
+	var page *models.UserURLsResponse
+	var err error
+	if req.WorkspaceId != 0 {
+		page, err = s.service.GetWorkspaceURLs(ctx, req.UserId, req.WorkspaceId, urlsReq)
+	} else {
+		page, err = s.service.GetUserURLs(ctx, req.UserId, urlsReq)
+	}
+	if errors.Is(err, service.ErrInvalidURLsFilter) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
-		return nil, err
+		return nil, workspaceStatus(err)
 	}
 
-	respURLs := make([]*proto.GetUserURLItem, len(userURLs))
-	for i, item := range userURLs {
-		respURLs[i] = &proto.GetUserURLItem{
-			ShortUrl:    item.ShortURL,
-			OriginalUrl: item.OriginalURL,
-		}
+	respURLs := make([]*proto.GetUserURLItem, len(page.URLs))
+	for i, item := range page.URLs {
+		respURLs[i] = userURLItem(item)
 	}
-	return &proto.GetUserURLsResponse{Urls: respURLs}, nil
+	return &proto.GetUserURLsResponse{Urls: respURLs, NextPageToken: page.NextCursor}, nil
 }
 
-// DeleteUserURLs помещает список ID урлов ["IhqFu4fdBD9w", "50ZT5FOYE6y"] в канал для удаления.
+// DeleteUserURLs помещает список ID урлов ["IhqFu4fdBD9w", "50ZT5FOYE6y"] в канал для удаления
+// и возвращает id задачи удаления. С workspace_id удаляются урлы рабочего пространства.
 func (s *GRPCServer) DeleteUserURLs(ctx context.Context, req *proto.DeleteURLsRequest) (*proto.DeleteURLsResponse, error) {
+	var job *models.Job
+	var err error
+	if req.WorkspaceId != 0 {
+		job, err = s.service.SendWorkspaceURLsToDeletion(ctx, req.UserId, req.WorkspaceId, req.ShortUrls)
+	} else {
+		job, err = s.service.SendURLsToDeletion(ctx, req.ShortUrls, req.UserId)
+	}
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
 
-	go s.service.SendURLsToDeletion(req.ShortUrls, req.UserId)
+	return &proto.DeleteURLsResponse{JobId: job.ID}, nil
+}
 
-	return &proto.DeleteURLsResponse{}, nil
+// GetJob возвращает пользователю состояние и результат его фоновой задачи.
+func (s *GRPCServer) GetJob(ctx context.Context, req *proto.GetJobRequest) (*proto.Job, error) {
+	job, err := s.service.GetJob(ctx, req.UserId, req.JobId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &proto.Job{
+		Id:        job.ID,
+		Kind:      job.Kind,
+		Status:    job.Status,
+		Processed: int32(job.Processed),
+		Succeeded: int32(job.Succeeded),
+		Failed:    int32(job.Failed),
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: job.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, result := range job.URLs {
+		msg.Urls = append(msg.Urls, &proto.JobURLResult{ShortUrl: result.ShortURL, Status: result.Status, Error: result.Error})
+	}
+	if job.FinishedAt != nil {
+		msg.FinishedAt = job.FinishedAt.Format(time.RFC3339)
+	}
+
+	return msg, nil
 }
 
 // GetStats возвращает количество пользователей и урлов в сервисе.
@@ -103,3 +197,330 @@ func (s *GRPCServer) GetStats(ctx context.Context, req *proto.StatsRequest) (*pr
 
 	return &proto.StatsResponse{Urls: int32(stats.URLs), Users: int32(stats.Users)}, nil
 }
+
+// GetURLStats возвращает владельцу статистику переходов по короткому урлу.
+func (s *GRPCServer) GetURLStats(ctx context.Context, req *proto.GetURLStatsRequest) (*proto.GetURLStatsResponse, error) {
+	stats, err := s.service.GetURLStats(ctx, req.UserId, req.ShortUrlId, models.URLStatsRequest{
+		From:        req.From,
+		To:          req.To,
+		Timezone:    req.Timezone,
+		Bucket:      req.Bucket,
+		IncludeBots: req.IncludeBots,
+	})
+	if err != nil {
+		return nil, urlStatus(err)
+	}
+
+	resp := proto.GetURLStatsResponse{
+		ShortUrl:       stats.ShortURL,
+		From:           stats.From.Format(time.RFC3339),
+		To:             stats.To.Format(time.RFC3339),
+		Timezone:       stats.Timezone,
+		Bucket:         stats.Bucket,
+		IncludeBots:    stats.IncludeBots,
+		TotalClicks:    stats.TotalClicks,
+		BotClicks:      stats.BotClicks,
+		UniqueVisitors: stats.UniqueVisitors,
+		TopReferrers:   toProtoStatsCounts(stats.TopReferrers),
+		UserAgents:     toProtoStatsCounts(stats.UserAgents),
+		Variants:       toProtoStatsCounts(stats.Variants),
+	}
+	for _, b := range stats.TimeSeries {
+		resp.TimeSeries = append(resp.TimeSeries, &proto.StatsBucket{Start: b.Start.Format(time.RFC3339), Clicks: b.Clicks})
+	}
+
+	return &resp, nil
+}
+
+// ExportClicks потоково выгружает владельцу события перехода по короткому урлу.
+func (s *GRPCServer) ExportClicks(req *proto.ExportClicksRequest, stream proto.URLcompressor_ExportClicksServer) error {
+	exportReq := models.ClicksExportRequest{From: req.From, To: req.To, Timezone: req.Timezone}
+
+	err := s.service.ExportClicks(stream.Context(), req.UserId, req.ShortUrlId, exportReq, func(page []models.ClickEvent) error {
+		for _, c := range page {
+			err := stream.Send(&proto.ClickEvent{
+				Id:           c.ID,
+				ShortUrl:     c.ShortURL,
+				ClickedAt:    c.ClickedAt.UTC().Format(time.RFC3339Nano),
+				VariantId:    c.VariantID,
+				Referrer:     c.Referrer,
+				ReferrerHost: c.ReferrerHost,
+				UserAgent:    c.UserAgent,
+				UaFamily:     c.UAFamily,
+				IpHash:       c.IPHash,
+				Country:      c.Country,
+				IsBot:        c.IsBot,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return urlStatus(err)
+}
+
+// ExportUserData потоково выгружает пользователю все его урлы, включая удаленные, с метаданными и сводкой переходов.
+func (s *GRPCServer) ExportUserData(req *proto.ExportUserDataRequest, stream proto.URLcompressor_ExportUserDataServer) error {
+	return s.service.ExportUserData(stream.Context(), req.UserId, func(link models.UserExportLink) error {
+		return stream.Send(exportedLink(link))
+	})
+}
+
+// GetQRCode возвращает QR-код короткого урла в PNG или SVG.
+func (s *GRPCServer) GetQRCode(ctx context.Context, req *proto.GetQRCodeRequest) (*proto.GetQRCodeResponse, error) {
+	opts := qrcode.Options{
+		Format:     req.Format,
+		Size:       int(req.Size),
+		Level:      req.ErrorCorrection,
+		Foreground: req.Foreground,
+		Background: req.Background,
+	}
+	if req.Margin != nil {
+		margin := int(req.GetMargin())
+		opts.Margin = &margin
+	}
+
+	img, err := s.service.GetQRCode(ctx, req.ShortUrlId, opts)
+	if err != nil {
+		return nil, urlStatus(err)
+	}
+
+	return &proto.GetQRCodeResponse{ContentType: img.ContentType, Image: img.Data}, nil
+}
+
+// CreateWorkspace создает рабочее пространство, пользователь становится его владельцем.
+func (s *GRPCServer) CreateWorkspace(ctx context.Context, req *proto.CreateWorkspaceRequest) (*proto.Workspace, error) {
+	workspace, err := s.service.CreateWorkspace(ctx, req.UserId, models.WorkspaceRequest{Name: req.Name})
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
+	return protoWorkspace(*workspace), nil
+}
+
+// ListWorkspaces возвращает рабочие пространства пользователя с его ролью в каждом.
+func (s *GRPCServer) ListWorkspaces(ctx context.Context, req *proto.ListWorkspacesRequest) (*proto.ListWorkspacesResponse, error) {
+	workspaces, err := s.service.GetUserWorkspaces(ctx, req.UserId)
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
+
+	resp := &proto.ListWorkspacesResponse{}
+	for _, w := range workspaces {
+		resp.Workspaces = append(resp.Workspaces, protoWorkspace(w))
+	}
+	return resp, nil
+}
+
+// ListWorkspaceMembers возвращает участнику список участников рабочего пространства.
+func (s *GRPCServer) ListWorkspaceMembers(ctx context.Context, req *proto.ListWorkspaceMembersRequest) (*proto.ListWorkspaceMembersResponse, error) {
+	members, err := s.service.GetWorkspaceMembers(ctx, req.UserId, req.WorkspaceId)
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
+
+	resp := &proto.ListWorkspaceMembersResponse{}
+	for _, m := range members {
+		resp.Members = append(resp.Members, protoWorkspaceMember(m))
+	}
+	return resp, nil
+}
+
+// UpdateWorkspaceMember меняет роль участника рабочего пространства по запросу владельца.
+func (s *GRPCServer) UpdateWorkspaceMember(ctx context.Context, req *proto.UpdateWorkspaceMemberRequest) (*proto.WorkspaceMember, error) {
+	member, err := s.service.UpdateWorkspaceMember(ctx, req.UserId, req.WorkspaceId, req.MemberUserId, models.WorkspaceMemberRequest{Role: req.Role})
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
+	return protoWorkspaceMember(*member), nil
+}
+
+// RemoveWorkspaceMember исключает участника из рабочего пространства, участник может исключить и себя.
+func (s *GRPCServer) RemoveWorkspaceMember(ctx context.Context, req *proto.RemoveWorkspaceMemberRequest) (*proto.RemoveWorkspaceMemberResponse, error) {
+	if err := s.service.RemoveWorkspaceMember(ctx, req.UserId, req.WorkspaceId, req.MemberUserId); err != nil {
+		return nil, workspaceStatus(err)
+	}
+	return &proto.RemoveWorkspaceMemberResponse{}, nil
+}
+
+// CreateWorkspaceInvite создает по запросу владельца приглашение в рабочее пространство с ролью.
+func (s *GRPCServer) CreateWorkspaceInvite(ctx context.Context, req *proto.CreateWorkspaceInviteRequest) (*proto.WorkspaceInvite, error) {
+	invite, err := s.service.CreateWorkspaceInvite(ctx, req.UserId, req.WorkspaceId, models.WorkspaceInviteRequest{Role: req.Role})
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
+
+	return &proto.WorkspaceInvite{
+		Id:          invite.ID,
+		WorkspaceId: invite.WorkspaceID,
+		Role:        invite.Role,
+		Token:       invite.Token,
+		CreatedAt:   invite.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:   invite.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// AcceptWorkspaceInvite принимает приглашение в рабочее пространство по токену.
+func (s *GRPCServer) AcceptWorkspaceInvite(ctx context.Context, req *proto.AcceptWorkspaceInviteRequest) (*proto.WorkspaceMember, error) {
+	member, err := s.service.AcceptWorkspaceInvite(ctx, req.UserId, req.Token)
+	if err != nil {
+		return nil, workspaceStatus(err)
+	}
+	return protoWorkspaceMember(*member), nil
+}
+
+// protoWorkspace - переводит рабочее пространство в сообщение gRPC.
+func protoWorkspace(w models.Workspace) *proto.Workspace {
+	return &proto.Workspace{
+		Id:        w.ID,
+		Name:      w.Name,
+		CreatedBy: w.CreatedBy,
+		CreatedAt: w.CreatedAt.Format(time.RFC3339),
+		Role:      w.Role,
+	}
+}
+
+// protoWorkspaceMember - переводит участника рабочего пространства в сообщение gRPC.
+func protoWorkspaceMember(m models.WorkspaceMember) *proto.WorkspaceMember {
+	return &proto.WorkspaceMember{
+		WorkspaceId: m.WorkspaceID,
+		UserId:      m.UserID,
+		Role:        m.Role,
+		JoinedAt:    m.JoinedAt.Format(time.RFC3339),
+	}
+}
+
+// workspaceStatus - превращает ошибки запросов к рабочим пространствам в статусы gRPC.
+// Остальные ошибки возвращаются как есть.
+func workspaceStatus(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidWorkspace):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, "workspace not found")
+	case errors.Is(err, service.ErrWorkspaceForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrLastWorkspaceOwner), errors.Is(err, service.ErrInviteClosed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
+// urlStatus - превращает ошибки запросов к короткому урлу пользователя в статусы gRPC.
+// Остальные ошибки, в том числе nil, возвращаются как есть.
+func urlStatus(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidStatsParams), errors.Is(err, qrcode.ErrInvalidOptions),
+		errors.Is(err, service.ErrInvalidMetadata):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, "url not found")
+	case errors.Is(err, service.ErrURLNotOwned):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrURLDeleted), errors.Is(err, service.ErrURLExpired), errors.Is(err, service.ErrURLTakenDown):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
+// toProtoStatsCounts - конвертирует счетчики статистики в сообщения gRPC.
+func toProtoStatsCounts(counts []models.StatsCount) []*proto.StatsCount {
+	result := make([]*proto.StatsCount, len(counts))
+	for i, c := range counts {
+		result[i] = &proto.StatsCount{Name: c.Name, Clicks: c.Clicks}
+	}
+	return result
+}
+
+// UpdateURLMetadata - меняет название, описание и теги урла пользователя или рабочего пространства,
+// незаданные поля не меняются.
+func (s *GRPCServer) UpdateURLMetadata(ctx context.Context, req *proto.UpdateURLMetadataRequest) (*proto.UpdateURLMetadataResponse, error) {
+	updateReq := models.UpdateURLMetadataRequest{Title: req.Title, Description: req.Description}
+	if req.Tags != nil {
+		tags := append([]string{}, req.Tags.Tags...)
+		updateReq.Tags = &tags
+	}
+
+	updated, err := s.service.UpdateURLMetadata(ctx, req.UserId, req.ShortUrlId, updateReq)
+	if err != nil {
+		return nil, urlStatus(err)
+	}
+
+	return &proto.UpdateURLMetadataResponse{Url: userURLItem(*updated)}, nil
+}
+
+// userURLItem - переводит урл пользователя в сообщение gRPC.
+func userURLItem(item models.GetUserURLsResponse) *proto.GetUserURLItem {
+	return &proto.GetUserURLItem{
+		ShortUrl:    item.ShortURL,
+		OriginalUrl: item.OriginalURL,
+		Title:       item.Title,
+		Description: item.Description,
+		Tags:        item.Tags,
+		CreatedAt:   item.CreatedAt.Format(time.RFC3339),
+		IsDeleted:   item.Deleted,
+	}
+}
+
+// exportedLink - переводит урл из выгрузки данных пользователя в сообщение gRPC.
+func exportedLink(link models.UserExportLink) *proto.ExportedLink {
+	msg := &proto.ExportedLink{
+		ShortUrl:    link.ShortURL,
+		OriginalUrl: link.OriginalURL,
+		Title:       link.Title,
+		Description: link.Description,
+		Tags:        link.Tags,
+		CreatedAt:   link.CreatedAt.Format(time.RFC3339),
+		IsDeleted:   link.Deleted,
+		Clicks: &proto.ExportedClicks{
+			TotalClicks:    link.Clicks.TotalClicks,
+			BotClicks:      link.Clicks.BotClicks,
+			UniqueVisitors: link.Clicks.UniqueVisitors,
+			Referrers:      toProtoStatsCounts(link.Clicks.Referrers),
+			UserAgents:     toProtoStatsCounts(link.Clicks.UserAgents),
+			Variants:       toProtoStatsCounts(link.Clicks.Variants),
+		},
+	}
+	for _, v := range link.Variants {
+		msg.Variants = append(msg.Variants, &proto.URLVariant{Id: v.ID, OriginalUrl: v.OriginalURL, Weight: int32(v.Weight), Served: v.Served})
+	}
+	if link.RedirectOptions != nil {
+		msg.QueryPolicy = link.RedirectOptions.QueryPolicy
+		msg.Utm = link.RedirectOptions.UTM
+	}
+	if link.ExpiresAt != nil {
+		msg.ExpiresAt = link.ExpiresAt.Format(time.RFC3339)
+	}
+	if link.Takedown != nil {
+		msg.TakedownReason = link.Takedown.Reason
+		msg.TakenDownAt = link.Takedown.At.Format(time.RFC3339)
+	}
+	for _, b := range link.Clicks.Daily {
+		msg.Clicks.Daily = append(msg.Clicks.Daily, &proto.StatsBucket{Start: b.Start.Format(time.RFC3339), Clicks: b.Clicks})
+	}
+	return msg
+}
+
+// destinationRejectedStatus - превращает отклонение адреса назначения политикой доменов в статус PermissionDenied
+// с ErrorInfo, в метаданных которого хост, причина и правило. Остальные ошибки возвращаются как есть.
+func destinationRejectedStatus(err error) error {
+	var rejection *urlpolicy.RejectionError
+	if !errors.As(err, &rejection) {
+		return err
+	}
+
+	st := status.New(codes.PermissionDenied, rejection.Error())
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: destinationRejectedReason,
+		Domain: "urlcompressor",
+		Metadata: map[string]string{
+			"host":   rejection.Host,
+			"reason": rejection.Reason,
+			"rule":   rejection.Rule,
+		},
+	})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
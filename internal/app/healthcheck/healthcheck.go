@@ -0,0 +1,271 @@
+// Package healthcheck периодически проверяет доступность адресов назначения коротких урлов.
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// batchSize - количество урлов, выбираемых из хранилища для проверки за раз.
+	batchSize = 100
+	// maxBodyRead - сколько байт тела ответа на GET вычитывается перед закрытием соединения.
+	maxBodyRead = 4096
+	// userAgent - заголовок User-Agent запросов проверки.
+	userAgent = "URLcompressor-HealthCheck/1.0"
+)
+
+// ErrPrivateAddress - ошибка при попытке проверить адрес во внутренней сети.
+var ErrPrivateAddress = errors.New("destination resolves to a private address")
+
+// Options - параметры проверки адресов назначения.
+// RecheckAfter - через сколько перепроверять урл (не меньше Interval),
+// HostInterval - минимальный интервал между запросами к одному хосту.
+// AllowPrivateNetworks разрешает запросы к loopback и частным сетям, по умолчанию они запрещены.
+type Options struct {
+	Interval             time.Duration
+	RecheckAfter         time.Duration
+	Concurrency          int
+	HostInterval         time.Duration
+	Timeout              time.Duration
+	AllowPrivateNetworks bool
+}
+
+// Notifier - уведомляет владельца урла о том, что адрес назначения перестал открываться.
+type Notifier interface {
+	NotifyBroken(ctx context.Context, data models.URLsData) error
+}
+
+// Checker - фоновая проверка адресов назначения коротких урлов.
+type Checker struct {
+	storage  storage.Storage
+	opts     Options
+	client   *http.Client
+	notifier Notifier
+
+	mu       sync.Mutex
+	hostNext map[string]time.Time
+}
+
+// NewChecker - конструктор проверки адресов назначения, notifier может быть nil.
+func NewChecker(storage storage.Storage, opts Options, notifier Notifier) *Checker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.RecheckAfter < opts.Interval {
+		opts.RecheckAfter = opts.Interval
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivateNetworks {
+		dialer.Control = denyPrivateNetworks
+	}
+
+	return &Checker{
+		storage: storage,
+		opts:    opts,
+		client: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: opts.Timeout},
+		},
+		notifier: notifier,
+		hostNext: make(map[string]time.Time),
+	}
+}
+
+// Run - проверяет урлы каждые Interval, пока не отменен ctx.
+// За один запуск проверяются все урлы, которые пора перепроверить.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			checked, err := c.CheckBatch(ctx)
+			if err != nil {
+				logger.Log.Info("Failed to check destinations", zap.Error(err))
+				break
+			}
+			if checked < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// CheckBatch - проверяет очередной батч давно не проверенных урлов и возвращает количество сохраненных результатов.
+func (c *Checker) CheckBatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	urls, err := c.storage.SelectURLsForHealthCheck(ctx, now.Add(-c.opts.RecheckAfter), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	c.pruneHosts(now)
+
+	sem := make(chan struct{}, c.opts.Concurrency)
+	var wg sync.WaitGroup
+	var checked atomic.Int64
+
+	for _, data := range urls {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(data models.URLsData) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if c.check(ctx, data) {
+				checked.Add(1)
+			}
+		}(data)
+	}
+	wg.Wait()
+
+	return int(checked.Load()), ctx.Err()
+}
+
+// check - проверяет адрес назначения урла, сохраняет результат и уведомляет владельца, если адрес сломался.
+// Возвращает false, если результат не сохранен.
+func (c *Checker) check(ctx context.Context, data models.URLsData) bool {
+	health := c.probe(ctx, data.OriginalURL)
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err := c.storage.UpdateURLHealth(ctx, data.ShortURL, health); err != nil {
+		logger.Log.Info("Failed to save destination health", zap.String("short_url", data.ShortURL), zap.Error(err))
+		return false
+	}
+
+	wasBroken := data.Health != nil && data.Health.Broken
+	if c.notifier == nil || !health.Broken || wasBroken {
+		return true
+	}
+
+	data.Health = &health
+	if err := c.notifier.NotifyBroken(ctx, data); err != nil {
+		logger.Log.Info("Failed to notify about broken destination", zap.String("short_url", data.ShortURL), zap.Error(err))
+	}
+	return true
+}
+
+// probe - запрашивает адрес методом HEAD, а если он не сработал, то GET:
+// часть серверов не поддерживает HEAD или отвечает на него иначе.
+// Сломанным считается адрес без ответа, с ответом 404, 410 или 5xx.
+func (c *Checker) probe(ctx context.Context, rawURL string) models.URLHealth {
+	health := models.URLHealth{}
+
+	status, err := c.request(ctx, http.MethodHead, rawURL)
+	if err != nil || status >= http.StatusBadRequest {
+		status, err = c.request(ctx, http.MethodGet, rawURL)
+	}
+
+	health.CheckedAt = time.Now()
+	health.Status = status
+	if err != nil {
+		health.Error = err.Error()
+	}
+	health.Broken = err != nil || status == http.StatusNotFound || status == http.StatusGone || status >= http.StatusInternalServerError
+
+	return health
+}
+
+// request - выполняет запрос с учетом ограничения частоты запросов к хосту и возвращает код ответа.
+func (c *Checker) request(ctx context.Context, method string, rawURL string) (int, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.waitHost(ctx, parsed.Hostname()); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodyRead))
+
+	return resp.StatusCode, nil
+}
+
+// waitHost - ждет, пока к хосту можно будет обратиться, не чаще одного запроса в HostInterval.
+func (c *Checker) waitHost(ctx context.Context, host string) error {
+	c.mu.Lock()
+	now := time.Now()
+	next := c.hostNext[host]
+	if next.Before(now) {
+		next = now
+	}
+	c.hostNext[host] = next.Add(c.opts.HostInterval)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(next.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// pruneHosts - забывает хосты, к которым уже можно обращаться без ожидания.
+func (c *Checker) pruneHosts(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for host, next := range c.hostNext {
+		if next.Before(now) {
+			delete(c.hostNext, host)
+		}
+	}
+}
+
+// denyPrivateNetworks - запрещает соединения с loopback, частными и служебными адресами,
+// чтобы проверка не ходила во внутреннюю сеть, в том числе после редиректов.
+func denyPrivateNetworks(network string, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/nu-kotov/URLcompressor/internal/app/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	mu       sync.Mutex
+	notified []string
+}
+
+func (n *recordingNotifier) NotifyBroken(ctx context.Context, data models.URLsData) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notified = append(n.notified, data.ShortURL)
+	return nil
+}
+
+func TestCheckBatch(t *testing.T) {
+	assert.NoError(t, logger.NewLogger("error"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	store, err := storage.NewMapStorage()
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsDataBatch(context.Background(), []models.URLsData{
+		{ShortURL: "ok", OriginalURL: server.URL + "/ok", UserID: "u"},
+		{ShortURL: "nohead", OriginalURL: server.URL + "/no-head", UserID: "u"},
+		{ShortURL: "forbidden", OriginalURL: server.URL + "/forbidden", UserID: "u"},
+		{ShortURL: "gone", OriginalURL: server.URL + "/gone", UserID: "u"},
+		{ShortURL: "deleted", OriginalURL: server.URL + "/gone", UserID: "u", DeletedFlag: true},
+	}))
+
+	notifier := &recordingNotifier{}
+	checker := NewChecker(store, Options{Concurrency: 2, Timeout: time.Second, AllowPrivateNetworks: true}, notifier)
+
+	checked, err := checker.CheckBatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, checked)
+
+	expected := map[string]models.URLHealth{
+		"ok":        {Status: http.StatusOK},
+		"nohead":    {Status: http.StatusOK},
+		"forbidden": {Status: http.StatusForbidden},
+		"gone":      {Status: http.StatusNotFound, Broken: true},
+	}
+	for shortURL, health := range expected {
+		data, err := store.SelectURLData(context.Background(), shortURL)
+		assert.NoError(t, err)
+		if assert.NotNil(t, data.Health, shortURL) {
+			assert.Equal(t, health.Status, data.Health.Status, shortURL)
+			assert.Equal(t, health.Broken, data.Health.Broken, shortURL)
+		}
+	}
+	assert.Equal(t, []string{"gone"}, notifier.notified)
+
+	// повторная проверка сломанной ссылки не отправляет повторное уведомление.
+	_, err = checker.CheckBatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gone"}, notifier.notified)
+}
+
+func TestCheckPrivateNetworkDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	checker := NewChecker(nil, Options{Timeout: time.Second}, nil)
+	health := checker.probe(context.Background(), server.URL)
+
+	assert.True(t, health.Broken)
+	assert.Equal(t, 0, health.Status)
+	assert.Contains(t, health.Error, ErrPrivateAddress.Error())
+}
@@ -0,0 +1,73 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+)
+
+// brokenLinkEvent - тело уведомления о сломанном адресе назначения.
+type brokenLinkEvent struct {
+	Event       string           `json:"event"`
+	UserID      string           `json:"user_id"`
+	ShortURL    string           `json:"short_url"`
+	OriginalURL string           `json:"original_url"`
+	Health      models.URLHealth `json:"health"`
+}
+
+// WebhookNotifier - отправляет уведомления о сломанных адресах назначения POST-запросом на вебхук,
+// доставку владельцу по user_id выполняет получатель вебхука.
+type WebhookNotifier struct {
+	webhookURL string
+	baseURL    string
+	client     *http.Client
+}
+
+// NewWebhookNotifier - конструктор уведомлений через вебхук.
+func NewWebhookNotifier(webhookURL string, baseURL string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{
+		webhookURL: webhookURL,
+		baseURL:    baseURL,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// NotifyBroken - отправляет на вебхук уведомление о сломанном адресе назначения урла.
+func (n *WebhookNotifier) NotifyBroken(ctx context.Context, data models.URLsData) error {
+	event := brokenLinkEvent{
+		Event:       "destination_broken",
+		UserID:      data.UserID,
+		ShortURL:    n.baseURL + "/" + data.ShortURL,
+		OriginalURL: data.OriginalURL,
+	}
+	if data.Health != nil {
+		event.Health = *data.Health
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Package hll реализует HyperLogLog - вероятностную оценку количества уникальных значений.
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// precision - количество бит хеша для номера регистра.
+	precision = 12
+	// registersCount - количество регистров, стандартная ошибка оценки 1.04/sqrt(m) ≈ 1.6%.
+	registersCount = 1 << precision
+	// version - версия бинарного формата скетча.
+	version = 1
+)
+
+// ErrInvalidSketch - ошибка разбора бинарного представления скетча.
+var ErrInvalidSketch = errors.New("invalid hll sketch")
+
+// Sketch - скетч HyperLogLog.
+type Sketch struct {
+	registers [registersCount]uint8
+}
+
+// New - конструктор пустого скетча.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add добавляет значение в скетч.
+func (s *Sketch) Add(value []byte) {
+	h := hash64(value)
+
+	index := h >> (64 - precision)
+	rank := uint8(bits.LeadingZeros64(h<<precision|1<<(precision-1)) + 1)
+
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// AddString добавляет строковое значение в скетч.
+func (s *Sketch) AddString(value string) {
+	s.Add([]byte(value))
+}
+
+// Merge объединяет скетч с другим, после чего он оценивает объединение множеств.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+}
+
+// Estimate возвращает оценку количества уникальных значений.
+func (s *Sketch) Estimate() uint64 {
+	m := float64(registersCount)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+
+	// для малых количеств точнее линейный подсчет по пустым регистрам.
+	if estimate <= 2.5*m && zeros != 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary возвращает бинарное представление скетча.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 2+registersCount)
+	data = append(data, version, precision)
+	data = append(data, s.registers[:]...)
+	return data, nil
+}
+
+// UnmarshalBinary восстанавливает скетч из бинарного представления.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) != 2+registersCount || data[0] != version || data[1] != precision {
+		return ErrInvalidSketch
+	}
+	copy(s.registers[:], data[2:])
+	return nil
+}
+
+// hash64 - FNV-1a с финализатором murmur3 для равномерного распределения бит.
+func hash64(value []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(value)
+	x := h.Sum64()
+
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	return x
+}
@@ -0,0 +1,51 @@
+package hll
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "Empty sketch", count: 0},
+		{name: "Small cardinality", count: 100},
+		{name: "Medium cardinality", count: 10000},
+		{name: "Large cardinality", count: 200000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sketch := New()
+			for i := 0; i < test.count; i++ {
+				sketch.AddString("visitor-" + strconv.Itoa(i))
+				sketch.AddString("visitor-" + strconv.Itoa(i))
+			}
+
+			assert.InDelta(t, float64(test.count), float64(sketch.Estimate()), float64(test.count)*0.05+1)
+		})
+	}
+}
+
+func TestMergeAndMarshal(t *testing.T) {
+	first, second := New(), New()
+	for i := 0; i < 5000; i++ {
+		first.AddString(strconv.Itoa(i))
+		second.AddString(strconv.Itoa(i + 2500))
+	}
+
+	data, err := first.MarshalBinary()
+	assert.NoError(t, err)
+
+	restored := New()
+	assert.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, first.Estimate(), restored.Estimate())
+
+	restored.Merge(second)
+	assert.InDelta(t, 7500, float64(restored.Estimate()), 7500*0.05)
+
+	assert.ErrorIs(t, restored.UnmarshalBinary(data[:10]), ErrInvalidSketch)
+}
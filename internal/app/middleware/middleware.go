@@ -37,6 +37,13 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+// Flush отправляет клиенту буферизованные данные, если оригинальный writer это поддерживает.
+func (r *loggingResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // RequestLogger - middleware для логирования HTTP-запросов и ответов.
 func RequestLogger(h http.HandlerFunc) http.HandlerFunc {
 	logFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1,8 +1,15 @@
 package models
 
+import "time"
+
 // ShortenURLRequest - структура запроса, содержащая сокращенный урл.
 type ShortenURLRequest struct {
-	URL string `json:"url"`
+	URL             string           `json:"url"`
+	Variants        []URLVariant     `json:"variants,omitempty"`
+	RedirectOptions *RedirectOptions `json:"redirect_options,omitempty"`
+	Title           string           `json:"title,omitempty"`
+	Description     string           `json:"description,omitempty"`
+	Tags            []string         `json:"tags,omitempty"`
 }
 
 // ShortenURLResponse - структура ответа, содержащая сокращенный урл.
@@ -22,26 +29,357 @@ type GetShortURLsBatchResponse struct {
 	ShortURL      string `json:"short_url"`
 }
 
+// DestinationRejectedResponse - структура ответа при отклонении адреса назначения политикой доменов.
+type DestinationRejectedResponse struct {
+	Error  string `json:"error"`
+	Host   string `json:"host"`
+	Reason string `json:"reason"`
+	Rule   string `json:"rule,omitempty"`
+}
+
 // GetUserURLsResponse - структура ответа с сокращенным и полным урлом.
 type GetUserURLsResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	Title        string     `json:"title,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	CollectionID int64      `json:"collection_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Deleted      bool       `json:"is_deleted,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt      *time.Time `json:"purge_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Health       *URLHealth `json:"health,omitempty"`
+}
+
+// Состояния урлов пользователя для поиска.
+const (
+	URLStateActive  = "active"
+	URLStateDeleted = "deleted"
+)
+
+// Поля сортировки урлов пользователя.
+const (
+	URLSortCreatedAt   = "created_at"
+	URLSortTitle       = "title"
+	URLSortOriginalURL = "original_url"
+)
+
+// UserURLsRequest - параметры поиска урлов пользователя.
+// Query - подстрока полного урла или названия, Tags - теги, которые должны быть у урла все сразу,
+// Domain - домен назначения вместе с поддоменами, State - active или deleted, по умолчанию все урлы.
+// Границы периода создания передаются в RFC3339 или в виде даты 2006-01-02 по UTC.
+// Sort - поле сортировки, с "-" в начале - по убыванию, по умолчанию "-created_at".
+// Limit - размер страницы, 0 - размер по умолчанию, Cursor - курсор следующей страницы из предыдущего ответа.
+type UserURLsRequest struct {
+	Query       string
+	Tags        []string
+	Domain      string
+	CreatedFrom string
+	CreatedTo   string
+	State       string
+	Sort        string
+	Limit       int
+	Cursor      string
+}
+
+// UserURLsCursor - позиция последнего урла страницы в порядке сортировки.
+// Sort - сортировка, для которой получен курсор, Key - значение поля сортировки title или original_url.
+type UserURLsCursor struct {
+	Sort      string    `json:"s"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	Key       string    `json:"k,omitempty"`
+	ShortURL  string    `json:"u"`
+}
+
+// UserURLsPage - страница урлов пользователя.
+// Next - позиция последнего урла страницы, nil - страница последняя.
+type UserURLsPage struct {
+	URLs []GetUserURLsResponse
+	Next *UserURLsCursor
+}
+
+// UserURLsResponse - страница урлов пользователя с курсором следующей страницы, пустым на последней странице.
+type UserURLsResponse struct {
+	URLs       []GetUserURLsResponse
+	NextCursor string
+}
+
+// UserURLsFilter - фильтр выборки урлов пользователя из хранилища, нулевые границы периода - без ограничения.
+// After - курсор, после которого начинается страница, Limit - размер страницы,
+// ненулевой CollectionID оставляет только урлы этой коллекции.
+type UserURLsFilter struct {
+	UserID       string
+	WorkspaceID  int64
+	CollectionID int64
+	Query        string
+	Tags         []string
+	Domain       string
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	State        string
+	SortBy       string
+	SortDesc     bool
+	After        *UserURLsCursor
+	Limit        int
 }
 
 // URLsData - данные по урлу.
 type URLsData struct {
-	UserID        string `json:"user_id"`
-	UUID          string `json:"uuid"`
-	ShortURL      string `json:"short_url"`
-	OriginalURL   string `json:"original_url"`
-	CorrelationID string `json:"correlation_id"`
-	DeletedFlag   bool   `json:"is_deleted"`
+	UserID          string           `json:"user_id"`
+	WorkspaceID     int64            `json:"workspace_id,omitempty"`
+	CollectionID    int64            `json:"collection_id,omitempty"`
+	UUID            string           `json:"uuid"`
+	ShortURL        string           `json:"short_url"`
+	OriginalURL     string           `json:"original_url"`
+	CorrelationID   string           `json:"correlation_id"`
+	DeletedFlag     bool             `json:"is_deleted"`
+	DeletedAt       *time.Time       `json:"deleted_at,omitempty"`
+	Variants        []URLVariant     `json:"variants,omitempty"`
+	RedirectOptions *RedirectOptions `json:"redirect_options,omitempty"`
+	Title           string           `json:"title,omitempty"`
+	Description     string           `json:"description,omitempty"`
+	Tags            []string         `json:"tags,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	Health          *URLHealth       `json:"health,omitempty"`
+	Takedown        *URLTakedown     `json:"takedown,omitempty"`
+	ExpiresAt       *time.Time       `json:"expires_at,omitempty"`
+}
+
+// URLMetadata - название, описание и теги короткого урла.
+type URLMetadata struct {
+	Title       string
+	Description string
+	Tags        []string
+}
+
+// UpdateURLMetadataRequest - структура запроса изменения названия, описания и тегов короткого урла.
+// Незаданные поля не меняются, пустые значения очищают поле.
+type UpdateURLMetadataRequest struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+}
+
+// URLTakedown - блокировка короткого урла модератором, в отличие от удаления владельцем.
+type URLTakedown struct {
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// URLHealth - результат последней проверки доступности адреса назначения короткого урла.
+// Status - код ответа, 0 - ответ не получен, причина в Error.
+type URLHealth struct {
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Broken    bool      `json:"broken"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Политики проброса query-параметров входящего запроса в урл назначения.
+const (
+	// QueryPolicyDrop - query-параметры входящего запроса отбрасываются.
+	QueryPolicyDrop = ""
+	// QueryPolicyMerge - добавляются только параметры, которых нет в урле назначения.
+	QueryPolicyMerge = "merge"
+	// QueryPolicyOverride - параметры входящего запроса заменяют одноименные параметры урла назначения.
+	QueryPolicyOverride = "override"
+)
+
+// RedirectOptions - настройки формирования урла назначения при редиректе.
+// Значения UTM-параметров могут содержать шаблоны {short_id} и {variant_id}.
+type RedirectOptions struct {
+	QueryPolicy string            `json:"query_policy,omitempty"`
+	UTM         map[string]string `json:"utm,omitempty"`
+}
+
+// URLVariant - вариант назначения короткого урла для A/B теста.
+type URLVariant struct {
+	ID          string `json:"id"`
+	OriginalURL string `json:"url"`
+	Weight      int    `json:"weight"`
+	Served      int64  `json:"served,omitempty"`
+}
+
+// RedirectTarget - выбранное назначение редиректа по короткому урлу.
+type RedirectTarget struct {
+	OriginalURL string
+	VariantID   string
 }
 
-// URLForDeleteMsg - структура сообщения для удаления урла.
+// URLForDeleteMsg - структура сообщения очереди удаления урлов.
+// ID - идентификатор сообщения в очереди, JobID - задача удаления, в которой сохраняется результат,
+// Attempts - сколько раз сообщение забиралось из очереди в обработку, Error - ошибка последней попытки.
 type URLForDeleteMsg struct {
-	UserID   string `json:"user_id"`
-	ShortURL string `json:"short_url"`
+	ID          int64  `json:"id,omitempty"`
+	UserID      string `json:"user_id"`
+	WorkspaceID int64  `json:"workspace_id,omitempty"`
+	ShortURL    string `json:"short_url"`
+	JobID       int64  `json:"job_id,omitempty"`
+	Attempts    int    `json:"attempts,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DeletionDeadLetter - сообщение очереди удаления, которое не удалось обработать за допустимое количество попыток.
+// Сохраняет идентификатор сообщения в очереди.
+type DeletionDeadLetter struct {
+	URLForDeleteMsg
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeletionQueueStats - размеры очереди удаления урлов.
+// Ready - сообщения, готовые к обработке, Delayed - занятые обработчиком или ожидающие повтора,
+// DeadLetters - сообщения, перенесенные в очередь недоставленных.
+type DeletionQueueStats struct {
+	Ready       int64 `json:"ready"`
+	Delayed     int64 `json:"delayed"`
+	DeadLetters int64 `json:"dead_letters"`
+}
+
+// RestoreURLsResponse - структура ответа восстановления урлов из корзины.
+// Restored - восстановленные короткие урлы, остальные из запроса не удалены или принадлежат другому пользователю.
+type RestoreURLsResponse struct {
+	Restored []string `json:"restored"`
+}
+
+// Статусы предложения передачи урлов другому пользователю.
+const (
+	URLTransferPending   = "pending"
+	URLTransferAccepted  = "accepted"
+	URLTransferCancelled = "cancelled"
+)
+
+// URLTransferRequest - структура запроса на создание предложения передачи урлов: короткие урлы владельца.
+type URLTransferRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// URLTransferAcceptRequest - структура запроса на принятие предложения передачи урлов по токену.
+type URLTransferAcceptRequest struct {
+	Token string `json:"token"`
+}
+
+// URLTransfer - предложение владельца передать его урлы другому пользователю.
+// Token - секрет для получателя, отдается только владельцу при создании, в хранилище лежит его хеш TokenHash.
+// ToUserID заполняется, когда получатель принимает предложение.
+type URLTransfer struct {
+	ID          int64      `json:"id"`
+	Token       string     `json:"token,omitempty"`
+	TokenHash   string     `json:"-"`
+	FromUserID  string     `json:"from_user_id"`
+	ToUserID    string     `json:"to_user_id,omitempty"`
+	ShortURLs   []string   `json:"urls"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// URLOwnershipAudit - запись журнала смены владельца урла.
+type URLOwnershipAudit struct {
+	ShortURL      string    `json:"short_url"`
+	TransferID    int64     `json:"transfer_id"`
+	FromUserID    string    `json:"from_user_id"`
+	ToUserID      string    `json:"to_user_id"`
+	TransferredAt time.Time `json:"transferred_at"`
+}
+
+// Роли участников рабочего пространства: владелец управляет участниками, редактор создает и удаляет урлы,
+// читатель только просматривает урлы пространства.
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+// WorkspaceRequest - структура запроса на создание рабочего пространства.
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// Workspace - рабочее пространство с общими урлами участников.
+// Role - роль пользователя, запросившего пространство.
+type Workspace struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role,omitempty"`
+}
+
+// WorkspaceMember - участник рабочего пространства.
+type WorkspaceMember struct {
+	WorkspaceID int64     `json:"workspace_id"`
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	JoinedAt    time.Time `json:"joined_at"`
+}
+
+// WorkspaceMemberRequest - структура запроса на смену роли участника рабочего пространства.
+type WorkspaceMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// WorkspaceInviteRequest - структура запроса на приглашение в рабочее пространство с ролью.
+type WorkspaceInviteRequest struct {
+	Role string `json:"role"`
+}
+
+// WorkspaceInviteAcceptRequest - структура запроса на принятие приглашения в рабочее пространство по токену.
+type WorkspaceInviteAcceptRequest struct {
+	Token string `json:"token"`
+}
+
+// WorkspaceInvite - одноразовое приглашение в рабочее пространство.
+// Token отдается только при создании, в хранилище лежит его хеш TokenHash.
+type WorkspaceInvite struct {
+	ID          int64      `json:"id"`
+	WorkspaceID int64      `json:"workspace_id"`
+	Role        string     `json:"role"`
+	Token       string     `json:"token,omitempty"`
+	TokenHash   string     `json:"-"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedBy  string     `json:"accepted_by,omitempty"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+}
+
+// CollectionRequest - структура запроса на создание или переименование коллекции урлов.
+type CollectionRequest struct {
+	Name string `json:"name"`
+}
+
+// Collection - именованная коллекция личных урлов пользователя.
+type Collection struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CollectionURLsRequest - структура запроса на добавление урлов в коллекцию или их исключение из коллекции.
+type CollectionURLsRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// CollectionStatsResponse - структура ответа с суммарной статистикой переходов по урлам коллекции.
+// URLs - количество переходов по каждому урлу коллекции по убыванию.
+type CollectionStatsResponse struct {
+	CollectionID int64         `json:"collection_id"`
+	Name         string        `json:"name"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	Timezone     string        `json:"timezone"`
+	Bucket       string        `json:"bucket"`
+	IncludeBots  bool          `json:"include_bots"`
+	TotalClicks  int64         `json:"total_clicks"`
+	BotClicks    int64         `json:"bot_clicks"`
+	TimeSeries   []StatsBucket `json:"time_series"`
+	URLs         []StatsCount  `json:"urls"`
 }
 
 // GetStats - структура ответа с данными о кол-ве урлов и пользователей сервиса.
@@ -49,3 +387,312 @@ type GetStatsResponse struct {
 	URLs  int `json:"urls"`
 	Users int `json:"users"`
 }
+
+// UnknownCountry - код страны, пока она не определяется по IP.
+const UnknownCountry = "ZZ"
+
+// ClickEvent - событие перехода по короткому урлу.
+type ClickEvent struct {
+	ID           int64     `json:"id"`
+	ShortURL     string    `json:"short_url"`
+	VariantID    string    `json:"variant_id,omitempty"`
+	ClickedAt    time.Time `json:"clicked_at"`
+	Referrer     string    `json:"referrer,omitempty"`
+	ReferrerHost string    `json:"referrer_host,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	UAFamily     string    `json:"ua_family,omitempty"`
+	IPHash       string    `json:"ip_hash,omitempty"`
+	Country      string    `json:"country,omitempty"`
+	IsBot        bool      `json:"is_bot,omitempty"`
+}
+
+// Размеры интервалов временного ряда статистики переходов.
+const (
+	StatsBucketHour = "hour"
+	StatsBucketDay  = "day"
+	StatsBucketWeek = "week"
+)
+
+// URLStatsRequest - параметры запроса статистики переходов по короткому урлу.
+// Границы периода передаются в RFC3339 или в виде даты 2006-01-02 в часовом поясе Timezone.
+type URLStatsRequest struct {
+	From        string
+	To          string
+	Timezone    string
+	Bucket      string
+	IncludeBots bool
+}
+
+// ClicksExportRequest - параметры выгрузки событий перехода по короткому урлу.
+// Границы периода передаются так же, как в URLStatsRequest, по умолчанию выгружаются все события.
+type ClicksExportRequest struct {
+	From     string
+	To       string
+	Timezone string
+}
+
+// ClicksPageFilter - фильтр постраничной выборки событий перехода, страница начинается после AfterID.
+type ClicksPageFilter struct {
+	ShortURL string
+	From     time.Time
+	To       time.Time
+	AfterID  int64
+	Limit    int
+}
+
+// ClickStatsFilter - фильтр выборки статистики переходов из хранилища.
+// Rollup - гранулярность агрегатов (StatsBucketHour или StatsBucketDay), по которым считается статистика
+// до момента последней агрегации, пустое значение - статистика только по сырым событиям.
+type ClickStatsFilter struct {
+	ShortURL    string
+	From        time.Time
+	To          time.Time
+	Location    *time.Location
+	Bucket      string
+	TopLimit    int
+	IncludeBots bool
+	Rollup      string
+}
+
+// ClicksRollupPolicy - параметры агрегации событий перехода в часовые и дневные агрегаты
+// и сроки хранения сырых событий и агрегатов, нулевой срок - хранить бессрочно.
+type ClicksRollupPolicy struct {
+	Now             time.Time
+	RawRetention    time.Duration
+	HourlyRetention time.Duration
+	DailyRetention  time.Duration
+}
+
+// URLStatsResponse - структура ответа со статистикой переходов по короткому урлу.
+type URLStatsResponse struct {
+	ShortURL       string        `json:"short_url"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	Timezone       string        `json:"timezone"`
+	Bucket         string        `json:"bucket"`
+	IncludeBots    bool          `json:"include_bots"`
+	TotalClicks    int64         `json:"total_clicks"`
+	BotClicks      int64         `json:"bot_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	TimeSeries     []StatsBucket `json:"time_series"`
+	TopReferrers   []StatsCount  `json:"top_referrers"`
+	UserAgents     []StatsCount  `json:"user_agents"`
+	Variants       []StatsCount  `json:"variants,omitempty"`
+}
+
+// StatsBucket - количество переходов за интервал временного ряда.
+type StatsBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// StatsCount - количество переходов в разрезе значения.
+type StatsCount struct {
+	Name   string `json:"name"`
+	Clicks int64  `json:"clicks"`
+}
+
+// Причины жалоб на короткие урлы.
+const (
+	AbuseReasonPhishing  = "phishing"
+	AbuseReasonMalware   = "malware"
+	AbuseReasonSpam      = "spam"
+	AbuseReasonIllegal   = "illegal"
+	AbuseReasonCopyright = "copyright"
+	AbuseReasonOther     = "other"
+)
+
+// Статусы жалоб на короткие урлы.
+const (
+	AbuseReportOpen      = "open"
+	AbuseReportDismissed = "dismissed"
+	AbuseReportActioned  = "actioned"
+)
+
+// Действия модератора по жалобе.
+const (
+	ModerationDismiss  = "dismiss"
+	ModerationTakedown = "takedown"
+)
+
+// AbuseReportRequest - структура запроса жалобы на короткий урл.
+type AbuseReportRequest struct {
+	Reason  string `json:"reason"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// AbuseReportResponse - структура ответа на жалобу на короткий урл.
+type AbuseReportResponse struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+// AbuseReport - жалоба на короткий урл. IP автора хранится только в виде соленого хеша.
+type AbuseReport struct {
+	ID             int64      `json:"id"`
+	ShortURL       string     `json:"short_url"`
+	Reason         string     `json:"reason"`
+	Comment        string     `json:"comment,omitempty"`
+	ReporterIPHash string     `json:"reporter_ip_hash,omitempty"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolutionNote string     `json:"resolution_note,omitempty"`
+}
+
+// AbuseReportsFilter - фильтр постраничной выборки жалоб, страница начинается после AfterID.
+// Пустые Status и ShortURL - без фильтра по ним.
+type AbuseReportsFilter struct {
+	Status   string
+	ShortURL string
+	AfterID  int64
+	Limit    int
+}
+
+// AbuseReportResolution - решение по жалобам: жалоба ReportID или, если он нулевой,
+// все открытые жалобы на ShortURL переводятся в статус Status. Решенные жалобы не меняются.
+type AbuseReportResolution struct {
+	ReportID   int64
+	ShortURL   string
+	Status     string
+	Note       string
+	ResolvedAt time.Time
+}
+
+// ModerationRequest - структура запроса действия модератора по жалобе.
+type ModerationRequest struct {
+	Action string `json:"action"`
+	Note   string `json:"note,omitempty"`
+}
+
+// TakedownRequest - структура запроса блокировки короткого урла модератором.
+type TakedownRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Типы фоновых задач пользователя.
+const (
+	JobKindImport   = "import"
+	JobKindErasure  = "erasure"
+	JobKindDeletion = "deletion"
+)
+
+// Статусы фоновых задач пользователя.
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+// Форматы файла импорта урлов.
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// ImportRecord - строка файла импорта урлов.
+// Alias - желаемый короткий урл, если пустой - короткий урл вычисляется по полному,
+// ExpiresAt - момент истечения в RFC3339 или дата 2006-01-02 по UTC.
+// В CSV теги перечисляются в одной колонке через "|".
+type ImportRecord struct {
+	URL       string   `json:"url"`
+	Alias     string   `json:"alias,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+}
+
+// Результаты обработки короткого урла задачей удаления.
+const (
+	JobURLPending  = "pending"
+	JobURLDeleted  = "deleted"
+	JobURLNotFound = "not_found"
+	JobURLFailed   = "failed"
+)
+
+// JobURLResult - результат обработки короткого урла задачей удаления.
+// Error - причина неудачи для статуса failed.
+type JobURLResult struct {
+	ShortURL string `json:"short_url"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// JobLineError - ошибка обработки строки входного файла задачи.
+type JobLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Job - фоновая задача пользователя и ее прогресс.
+// Errors - отчет об ошибках по строкам, не длиннее лимита задачи, ErrorsTruncated - отчет обрезан,
+// Error - причина, по которой задача завершилась со статусом failed,
+// Erasure - итог удаления данных пользователя для задачи erasure,
+// URLs - результаты по каждому урлу для задачи deletion.
+type Job struct {
+	ID              int64          `json:"id"`
+	UserID          string         `json:"user_id"`
+	Kind            string         `json:"kind"`
+	Status          string         `json:"status"`
+	Processed       int            `json:"processed"`
+	Succeeded       int            `json:"succeeded"`
+	Failed          int            `json:"failed"`
+	Errors          []JobLineError `json:"errors,omitempty"`
+	ErrorsTruncated bool           `json:"errors_truncated,omitempty"`
+	Error           string         `json:"error,omitempty"`
+	Erasure         *UserErasure   `json:"erasure,omitempty"`
+	URLs            []JobURLResult `json:"urls,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	FinishedAt      *time.Time     `json:"finished_at,omitempty"`
+}
+
+// UserErasure - итог безвозвратного удаления данных пользователя: количество удаленных урлов,
+// событий перехода и прошлых фоновых задач.
+type UserErasure struct {
+	Links  int64 `json:"links"`
+	Clicks int64 `json:"clicks"`
+	Jobs   int64 `json:"jobs"`
+}
+
+// Форматы выгрузки данных пользователя.
+const (
+	UserExportZIP    = "zip"
+	UserExportNDJSON = "ndjson"
+)
+
+// UserExportLink - урл пользователя в выгрузке его данных, включая удаленные, со сводкой переходов.
+type UserExportLink struct {
+	ShortURL        string           `json:"short_url"`
+	OriginalURL     string           `json:"original_url"`
+	Title           string           `json:"title,omitempty"`
+	Description     string           `json:"description,omitempty"`
+	Tags            []string         `json:"tags,omitempty"`
+	Variants        []URLVariant     `json:"variants,omitempty"`
+	RedirectOptions *RedirectOptions `json:"redirect_options,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	ExpiresAt       *time.Time       `json:"expires_at,omitempty"`
+	Deleted         bool             `json:"is_deleted"`
+	DeletedAt       *time.Time       `json:"deleted_at,omitempty"`
+	Takedown        *URLTakedown     `json:"takedown,omitempty"`
+	Clicks          UserExportClicks `json:"clicks"`
+}
+
+// UserExportClicks - сводка переходов по урлу за все время хранения, включая переходы ботов:
+// дневной ряд по UTC без дней без переходов, источники, браузеры и варианты.
+type UserExportClicks struct {
+	TotalClicks    int64         `json:"total_clicks"`
+	BotClicks      int64         `json:"bot_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	Daily          []StatsBucket `json:"daily,omitempty"`
+	Referrers      []StatsCount  `json:"referrers,omitempty"`
+	UserAgents     []StatsCount  `json:"user_agents,omitempty"`
+	Variants       []StatsCount  `json:"variants,omitempty"`
+}
+
+// UserExportManifest - описание архива выгрузки данных пользователя.
+type UserExportManifest struct {
+	UserID     string    `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	Links      int       `json:"links"`
+}
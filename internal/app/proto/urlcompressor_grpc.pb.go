@@ -19,13 +19,26 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	URLcompressor_PingDB_FullMethodName            = "/urlcompressor.URLcompressor/PingDB"
-	URLcompressor_GetShortURL_FullMethodName       = "/urlcompressor.URLcompressor/GetShortURL"
-	URLcompressor_GetOriginalURL_FullMethodName    = "/urlcompressor.URLcompressor/GetOriginalURL"
-	URLcompressor_GetShortURLsBatch_FullMethodName = "/urlcompressor.URLcompressor/GetShortURLsBatch"
-	URLcompressor_GetUserURLs_FullMethodName       = "/urlcompressor.URLcompressor/GetUserURLs"
-	URLcompressor_DeleteUserURLs_FullMethodName    = "/urlcompressor.URLcompressor/DeleteUserURLs"
-	URLcompressor_GetStats_FullMethodName          = "/urlcompressor.URLcompressor/GetStats"
+	URLcompressor_PingDB_FullMethodName                = "/urlcompressor.URLcompressor/PingDB"
+	URLcompressor_GetShortURL_FullMethodName           = "/urlcompressor.URLcompressor/GetShortURL"
+	URLcompressor_GetOriginalURL_FullMethodName        = "/urlcompressor.URLcompressor/GetOriginalURL"
+	URLcompressor_GetShortURLsBatch_FullMethodName     = "/urlcompressor.URLcompressor/GetShortURLsBatch"
+	URLcompressor_GetUserURLs_FullMethodName           = "/urlcompressor.URLcompressor/GetUserURLs"
+	URLcompressor_DeleteUserURLs_FullMethodName        = "/urlcompressor.URLcompressor/DeleteUserURLs"
+	URLcompressor_GetJob_FullMethodName                = "/urlcompressor.URLcompressor/GetJob"
+	URLcompressor_GetStats_FullMethodName              = "/urlcompressor.URLcompressor/GetStats"
+	URLcompressor_GetURLStats_FullMethodName           = "/urlcompressor.URLcompressor/GetURLStats"
+	URLcompressor_ExportClicks_FullMethodName          = "/urlcompressor.URLcompressor/ExportClicks"
+	URLcompressor_GetQRCode_FullMethodName             = "/urlcompressor.URLcompressor/GetQRCode"
+	URLcompressor_UpdateURLMetadata_FullMethodName     = "/urlcompressor.URLcompressor/UpdateURLMetadata"
+	URLcompressor_ExportUserData_FullMethodName        = "/urlcompressor.URLcompressor/ExportUserData"
+	URLcompressor_CreateWorkspace_FullMethodName       = "/urlcompressor.URLcompressor/CreateWorkspace"
+	URLcompressor_ListWorkspaces_FullMethodName        = "/urlcompressor.URLcompressor/ListWorkspaces"
+	URLcompressor_ListWorkspaceMembers_FullMethodName  = "/urlcompressor.URLcompressor/ListWorkspaceMembers"
+	URLcompressor_UpdateWorkspaceMember_FullMethodName = "/urlcompressor.URLcompressor/UpdateWorkspaceMember"
+	URLcompressor_RemoveWorkspaceMember_FullMethodName = "/urlcompressor.URLcompressor/RemoveWorkspaceMember"
+	URLcompressor_CreateWorkspaceInvite_FullMethodName = "/urlcompressor.URLcompressor/CreateWorkspaceInvite"
+	URLcompressor_AcceptWorkspaceInvite_FullMethodName = "/urlcompressor.URLcompressor/AcceptWorkspaceInvite"
 )
 
 // URLcompressorClient is the client API for URLcompressor service.
@@ -38,7 +51,20 @@ type URLcompressorClient interface {
 	GetShortURLsBatch(ctx context.Context, in *GetShortURLsBatchRequest, opts ...grpc.CallOption) (*GetShortURLsBatchResponse, error)
 	GetUserURLs(ctx context.Context, in *GetUserURLsRequest, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
 	DeleteUserURLs(ctx context.Context, in *DeleteURLsRequest, opts ...grpc.CallOption) (*DeleteURLsResponse, error)
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
 	GetStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	GetURLStats(ctx context.Context, in *GetURLStatsRequest, opts ...grpc.CallOption) (*GetURLStatsResponse, error)
+	ExportClicks(ctx context.Context, in *ExportClicksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ClickEvent], error)
+	GetQRCode(ctx context.Context, in *GetQRCodeRequest, opts ...grpc.CallOption) (*GetQRCodeResponse, error)
+	UpdateURLMetadata(ctx context.Context, in *UpdateURLMetadataRequest, opts ...grpc.CallOption) (*UpdateURLMetadataResponse, error)
+	ExportUserData(ctx context.Context, in *ExportUserDataRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportedLink], error)
+	CreateWorkspace(ctx context.Context, in *CreateWorkspaceRequest, opts ...grpc.CallOption) (*Workspace, error)
+	ListWorkspaces(ctx context.Context, in *ListWorkspacesRequest, opts ...grpc.CallOption) (*ListWorkspacesResponse, error)
+	ListWorkspaceMembers(ctx context.Context, in *ListWorkspaceMembersRequest, opts ...grpc.CallOption) (*ListWorkspaceMembersResponse, error)
+	UpdateWorkspaceMember(ctx context.Context, in *UpdateWorkspaceMemberRequest, opts ...grpc.CallOption) (*WorkspaceMember, error)
+	RemoveWorkspaceMember(ctx context.Context, in *RemoveWorkspaceMemberRequest, opts ...grpc.CallOption) (*RemoveWorkspaceMemberResponse, error)
+	CreateWorkspaceInvite(ctx context.Context, in *CreateWorkspaceInviteRequest, opts ...grpc.CallOption) (*WorkspaceInvite, error)
+	AcceptWorkspaceInvite(ctx context.Context, in *AcceptWorkspaceInviteRequest, opts ...grpc.CallOption) (*WorkspaceMember, error)
 }
 
 type uRLcompressorClient struct {
@@ -109,6 +135,16 @@ func (c *uRLcompressorClient) DeleteUserURLs(ctx context.Context, in *DeleteURLs
 	return out, nil
 }
 
+func (c *uRLcompressorClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, URLcompressor_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *uRLcompressorClient) GetStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(StatsResponse)
@@ -119,6 +155,144 @@ func (c *uRLcompressorClient) GetStats(ctx context.Context, in *StatsRequest, op
 	return out, nil
 }
 
+func (c *uRLcompressorClient) GetURLStats(ctx context.Context, in *GetURLStatsRequest, opts ...grpc.CallOption) (*GetURLStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetURLStatsResponse)
+	err := c.cc.Invoke(ctx, URLcompressor_GetURLStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) ExportClicks(ctx context.Context, in *ExportClicksRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ClickEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &URLcompressor_ServiceDesc.Streams[0], URLcompressor_ExportClicks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportClicksRequest, ClickEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLcompressor_ExportClicksClient = grpc.ServerStreamingClient[ClickEvent]
+
+func (c *uRLcompressorClient) GetQRCode(ctx context.Context, in *GetQRCodeRequest, opts ...grpc.CallOption) (*GetQRCodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetQRCodeResponse)
+	err := c.cc.Invoke(ctx, URLcompressor_GetQRCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) UpdateURLMetadata(ctx context.Context, in *UpdateURLMetadataRequest, opts ...grpc.CallOption) (*UpdateURLMetadataResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateURLMetadataResponse)
+	err := c.cc.Invoke(ctx, URLcompressor_UpdateURLMetadata_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) ExportUserData(ctx context.Context, in *ExportUserDataRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportedLink], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &URLcompressor_ServiceDesc.Streams[1], URLcompressor_ExportUserData_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportUserDataRequest, ExportedLink]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLcompressor_ExportUserDataClient = grpc.ServerStreamingClient[ExportedLink]
+
+func (c *uRLcompressorClient) CreateWorkspace(ctx context.Context, in *CreateWorkspaceRequest, opts ...grpc.CallOption) (*Workspace, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Workspace)
+	err := c.cc.Invoke(ctx, URLcompressor_CreateWorkspace_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) ListWorkspaces(ctx context.Context, in *ListWorkspacesRequest, opts ...grpc.CallOption) (*ListWorkspacesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWorkspacesResponse)
+	err := c.cc.Invoke(ctx, URLcompressor_ListWorkspaces_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) ListWorkspaceMembers(ctx context.Context, in *ListWorkspaceMembersRequest, opts ...grpc.CallOption) (*ListWorkspaceMembersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWorkspaceMembersResponse)
+	err := c.cc.Invoke(ctx, URLcompressor_ListWorkspaceMembers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) UpdateWorkspaceMember(ctx context.Context, in *UpdateWorkspaceMemberRequest, opts ...grpc.CallOption) (*WorkspaceMember, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkspaceMember)
+	err := c.cc.Invoke(ctx, URLcompressor_UpdateWorkspaceMember_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) RemoveWorkspaceMember(ctx context.Context, in *RemoveWorkspaceMemberRequest, opts ...grpc.CallOption) (*RemoveWorkspaceMemberResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveWorkspaceMemberResponse)
+	err := c.cc.Invoke(ctx, URLcompressor_RemoveWorkspaceMember_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) CreateWorkspaceInvite(ctx context.Context, in *CreateWorkspaceInviteRequest, opts ...grpc.CallOption) (*WorkspaceInvite, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkspaceInvite)
+	err := c.cc.Invoke(ctx, URLcompressor_CreateWorkspaceInvite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLcompressorClient) AcceptWorkspaceInvite(ctx context.Context, in *AcceptWorkspaceInviteRequest, opts ...grpc.CallOption) (*WorkspaceMember, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkspaceMember)
+	err := c.cc.Invoke(ctx, URLcompressor_AcceptWorkspaceInvite_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // URLcompressorServer is the server API for URLcompressor service.
 // All implementations must embed UnimplementedURLcompressorServer
 // for forward compatibility.
@@ -129,7 +303,20 @@ type URLcompressorServer interface {
 	GetShortURLsBatch(context.Context, *GetShortURLsBatchRequest) (*GetShortURLsBatchResponse, error)
 	GetUserURLs(context.Context, *GetUserURLsRequest) (*GetUserURLsResponse, error)
 	DeleteUserURLs(context.Context, *DeleteURLsRequest) (*DeleteURLsResponse, error)
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
 	GetStats(context.Context, *StatsRequest) (*StatsResponse, error)
+	GetURLStats(context.Context, *GetURLStatsRequest) (*GetURLStatsResponse, error)
+	ExportClicks(*ExportClicksRequest, grpc.ServerStreamingServer[ClickEvent]) error
+	GetQRCode(context.Context, *GetQRCodeRequest) (*GetQRCodeResponse, error)
+	UpdateURLMetadata(context.Context, *UpdateURLMetadataRequest) (*UpdateURLMetadataResponse, error)
+	ExportUserData(*ExportUserDataRequest, grpc.ServerStreamingServer[ExportedLink]) error
+	CreateWorkspace(context.Context, *CreateWorkspaceRequest) (*Workspace, error)
+	ListWorkspaces(context.Context, *ListWorkspacesRequest) (*ListWorkspacesResponse, error)
+	ListWorkspaceMembers(context.Context, *ListWorkspaceMembersRequest) (*ListWorkspaceMembersResponse, error)
+	UpdateWorkspaceMember(context.Context, *UpdateWorkspaceMemberRequest) (*WorkspaceMember, error)
+	RemoveWorkspaceMember(context.Context, *RemoveWorkspaceMemberRequest) (*RemoveWorkspaceMemberResponse, error)
+	CreateWorkspaceInvite(context.Context, *CreateWorkspaceInviteRequest) (*WorkspaceInvite, error)
+	AcceptWorkspaceInvite(context.Context, *AcceptWorkspaceInviteRequest) (*WorkspaceMember, error)
 	mustEmbedUnimplementedURLcompressorServer()
 }
 
@@ -158,9 +345,48 @@ func (UnimplementedURLcompressorServer) GetUserURLs(context.Context, *GetUserURL
 func (UnimplementedURLcompressorServer) DeleteUserURLs(context.Context, *DeleteURLsRequest) (*DeleteURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUserURLs not implemented")
 }
+func (UnimplementedURLcompressorServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
 func (UnimplementedURLcompressorServer) GetStats(context.Context, *StatsRequest) (*StatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
 }
+func (UnimplementedURLcompressorServer) GetURLStats(context.Context, *GetURLStatsRequest) (*GetURLStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetURLStats not implemented")
+}
+func (UnimplementedURLcompressorServer) ExportClicks(*ExportClicksRequest, grpc.ServerStreamingServer[ClickEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportClicks not implemented")
+}
+func (UnimplementedURLcompressorServer) GetQRCode(context.Context, *GetQRCodeRequest) (*GetQRCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQRCode not implemented")
+}
+func (UnimplementedURLcompressorServer) UpdateURLMetadata(context.Context, *UpdateURLMetadataRequest) (*UpdateURLMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateURLMetadata not implemented")
+}
+func (UnimplementedURLcompressorServer) ExportUserData(*ExportUserDataRequest, grpc.ServerStreamingServer[ExportedLink]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportUserData not implemented")
+}
+func (UnimplementedURLcompressorServer) CreateWorkspace(context.Context, *CreateWorkspaceRequest) (*Workspace, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWorkspace not implemented")
+}
+func (UnimplementedURLcompressorServer) ListWorkspaces(context.Context, *ListWorkspacesRequest) (*ListWorkspacesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWorkspaces not implemented")
+}
+func (UnimplementedURLcompressorServer) ListWorkspaceMembers(context.Context, *ListWorkspaceMembersRequest) (*ListWorkspaceMembersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWorkspaceMembers not implemented")
+}
+func (UnimplementedURLcompressorServer) UpdateWorkspaceMember(context.Context, *UpdateWorkspaceMemberRequest) (*WorkspaceMember, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateWorkspaceMember not implemented")
+}
+func (UnimplementedURLcompressorServer) RemoveWorkspaceMember(context.Context, *RemoveWorkspaceMemberRequest) (*RemoveWorkspaceMemberResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveWorkspaceMember not implemented")
+}
+func (UnimplementedURLcompressorServer) CreateWorkspaceInvite(context.Context, *CreateWorkspaceInviteRequest) (*WorkspaceInvite, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWorkspaceInvite not implemented")
+}
+func (UnimplementedURLcompressorServer) AcceptWorkspaceInvite(context.Context, *AcceptWorkspaceInviteRequest) (*WorkspaceMember, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcceptWorkspaceInvite not implemented")
+}
 func (UnimplementedURLcompressorServer) mustEmbedUnimplementedURLcompressorServer() {}
 func (UnimplementedURLcompressorServer) testEmbeddedByValue()                       {}
 
@@ -290,6 +516,24 @@ func _URLcompressor_DeleteUserURLs_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _URLcompressor_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _URLcompressor_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(StatsRequest)
 	if err := dec(in); err != nil {
@@ -308,6 +552,208 @@ func _URLcompressor_GetStats_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _URLcompressor_GetURLStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetURLStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).GetURLStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_GetURLStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).GetURLStats(ctx, req.(*GetURLStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_ExportClicks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportClicksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(URLcompressorServer).ExportClicks(m, &grpc.GenericServerStream[ExportClicksRequest, ClickEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLcompressor_ExportClicksServer = grpc.ServerStreamingServer[ClickEvent]
+
+func _URLcompressor_GetQRCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQRCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).GetQRCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_GetQRCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).GetQRCode(ctx, req.(*GetQRCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_UpdateURLMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateURLMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).UpdateURLMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_UpdateURLMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).UpdateURLMetadata(ctx, req.(*UpdateURLMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_ExportUserData_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportUserDataRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(URLcompressorServer).ExportUserData(m, &grpc.GenericServerStream[ExportUserDataRequest, ExportedLink]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLcompressor_ExportUserDataServer = grpc.ServerStreamingServer[ExportedLink]
+
+func _URLcompressor_CreateWorkspace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWorkspaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).CreateWorkspace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_CreateWorkspace_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).CreateWorkspace(ctx, req.(*CreateWorkspaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_ListWorkspaces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkspacesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).ListWorkspaces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_ListWorkspaces_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).ListWorkspaces(ctx, req.(*ListWorkspacesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_ListWorkspaceMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWorkspaceMembersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).ListWorkspaceMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_ListWorkspaceMembers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).ListWorkspaceMembers(ctx, req.(*ListWorkspaceMembersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_UpdateWorkspaceMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateWorkspaceMemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).UpdateWorkspaceMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_UpdateWorkspaceMember_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).UpdateWorkspaceMember(ctx, req.(*UpdateWorkspaceMemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_RemoveWorkspaceMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveWorkspaceMemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).RemoveWorkspaceMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_RemoveWorkspaceMember_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).RemoveWorkspaceMember(ctx, req.(*RemoveWorkspaceMemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_CreateWorkspaceInvite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWorkspaceInviteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).CreateWorkspaceInvite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_CreateWorkspaceInvite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).CreateWorkspaceInvite(ctx, req.(*CreateWorkspaceInviteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLcompressor_AcceptWorkspaceInvite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcceptWorkspaceInviteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLcompressorServer).AcceptWorkspaceInvite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLcompressor_AcceptWorkspaceInvite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLcompressorServer).AcceptWorkspaceInvite(ctx, req.(*AcceptWorkspaceInviteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // URLcompressor_ServiceDesc is the grpc.ServiceDesc for URLcompressor service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -339,11 +785,66 @@ var URLcompressor_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteUserURLs",
 			Handler:    _URLcompressor_DeleteUserURLs_Handler,
 		},
+		{
+			MethodName: "GetJob",
+			Handler:    _URLcompressor_GetJob_Handler,
+		},
 		{
 			MethodName: "GetStats",
 			Handler:    _URLcompressor_GetStats_Handler,
 		},
+		{
+			MethodName: "GetURLStats",
+			Handler:    _URLcompressor_GetURLStats_Handler,
+		},
+		{
+			MethodName: "GetQRCode",
+			Handler:    _URLcompressor_GetQRCode_Handler,
+		},
+		{
+			MethodName: "UpdateURLMetadata",
+			Handler:    _URLcompressor_UpdateURLMetadata_Handler,
+		},
+		{
+			MethodName: "CreateWorkspace",
+			Handler:    _URLcompressor_CreateWorkspace_Handler,
+		},
+		{
+			MethodName: "ListWorkspaces",
+			Handler:    _URLcompressor_ListWorkspaces_Handler,
+		},
+		{
+			MethodName: "ListWorkspaceMembers",
+			Handler:    _URLcompressor_ListWorkspaceMembers_Handler,
+		},
+		{
+			MethodName: "UpdateWorkspaceMember",
+			Handler:    _URLcompressor_UpdateWorkspaceMember_Handler,
+		},
+		{
+			MethodName: "RemoveWorkspaceMember",
+			Handler:    _URLcompressor_RemoveWorkspaceMember_Handler,
+		},
+		{
+			MethodName: "CreateWorkspaceInvite",
+			Handler:    _URLcompressor_CreateWorkspaceInvite_Handler,
+		},
+		{
+			MethodName: "AcceptWorkspaceInvite",
+			Handler:    _URLcompressor_AcceptWorkspaceInvite_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportClicks",
+			Handler:       _URLcompressor_ExportClicks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ExportUserData",
+			Handler:       _URLcompressor_ExportUserData_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "urlcompressor.proto",
 }
@@ -0,0 +1,203 @@
+// Package qrcode рисует QR-коды коротких ссылок в PNG и SVG.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// Форматы изображения QR-кода.
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Значения параметров QR-кода по умолчанию и допустимые границы.
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 32
+)
+
+// ErrInvalidOptions - ошибка валидации параметров QR-кода.
+var ErrInvalidOptions = errors.New("invalid qr code options")
+
+// levels - уровни коррекции ошибок по их обозначениям.
+var levels = map[string]qr.Level{"L": qr.L, "M": qr.M, "Q": qr.Q, "H": qr.H}
+
+// Options - параметры изображения QR-кода.
+// Size - сторона изображения в пикселях, Margin - ширина пустой рамки в модулях QR-кода (nil - по умолчанию),
+// Level - уровень коррекции ошибок (L, M, Q, H), цвета задаются в hex: RGB, RRGGBB или RRGGBBAA.
+type Options struct {
+	Format     string
+	Size       int
+	Margin     *int
+	Level      string
+	Foreground string
+	Background string
+}
+
+// Image - готовое изображение QR-кода.
+type Image struct {
+	ContentType string
+	Data        []byte
+}
+
+// Render - рисует QR-код с содержимым content, незаданные параметры берутся по умолчанию.
+func Render(content string, opts Options) (*Image, error) {
+	if opts.Format == "" {
+		opts.Format = FormatPNG
+	}
+	if opts.Size == 0 {
+		opts.Size = DefaultSize
+	}
+	margin := DefaultMargin
+	if opts.Margin != nil {
+		margin = *opts.Margin
+	}
+	if opts.Level == "" {
+		opts.Level = "M"
+	}
+	if opts.Foreground == "" {
+		opts.Foreground = "000000"
+	}
+	if opts.Background == "" {
+		opts.Background = "ffffff"
+	}
+
+	if opts.Size < MinSize || opts.Size > MaxSize {
+		return nil, fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOptions, MinSize, MaxSize)
+	}
+	if margin < 0 || margin > MaxMargin {
+		return nil, fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOptions, MaxMargin)
+	}
+
+	level, ok := levels[strings.ToUpper(opts.Level)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown error correction level %q", ErrInvalidOptions, opts.Level)
+	}
+
+	fg, err := parseColor(opts.Foreground)
+	if err != nil {
+		return nil, err
+	}
+	bg, err := parseColor(opts.Background)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qr.Encode(content, level)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := code.Size + 2*margin
+	if modules > opts.Size {
+		return nil, fmt.Errorf("%w: size is too small for %d modules", ErrInvalidOptions, modules)
+	}
+
+	switch opts.Format {
+	case FormatPNG:
+		data, err := renderPNG(code, opts.Size, margin, fg, bg)
+		if err != nil {
+			return nil, err
+		}
+		return &Image{ContentType: "image/png", Data: data}, nil
+	case FormatSVG:
+		return &Image{ContentType: "image/svg+xml", Data: renderSVG(code, opts.Size, margin, fg, bg)}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidOptions, opts.Format)
+	}
+}
+
+// renderPNG - рисует QR-код целым числом пикселей на модуль, остаток стороны уходит в рамку.
+func renderPNG(code *qr.Code, size int, margin int, fg color.RGBA, bg color.RGBA) ([]byte, error) {
+	modules := code.Size + 2*margin
+	scale := size / modules
+	offset := (size-modules*scale)/2 + margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				row := (offset+y*scale+py)*img.Stride + offset + x*scale
+				for px := 0; px < scale; px++ {
+					img.Pix[row+px] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG - рисует QR-код одним путем, соседние модули в строке объединяются в прямоугольники.
+func renderSVG(code *qr.Code, size int, margin int, fg color.RGBA, bg color.RGBA) []byte {
+	modules := code.Size + 2*margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" %s/>`, modules, modules, svgFill(bg))
+	buf.WriteString(`<path d="`)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			run := 1
+			for x+run < code.Size && code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+margin, y+margin, run, run)
+			x += run
+		}
+	}
+	fmt.Fprintf(&buf, `" %s/></svg>`, svgFill(fg))
+
+	return buf.Bytes()
+}
+
+// svgFill - атрибуты заливки SVG для цвета.
+func svgFill(c color.RGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+	}
+	return fill
+}
+
+// parseColor - разбирает цвет в hex: RGB, RRGGBB или RRGGBBAA, с решеткой или без.
+func parseColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	rgba, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("%w: invalid color %q", ErrInvalidOptions, value)
+	}
+
+	return color.RGBA{R: uint8(rgba >> 24), G: uint8(rgba >> 16), B: uint8(rgba >> 8), A: uint8(rgba)}, nil
+}
@@ -0,0 +1,61 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPNG(t *testing.T) {
+	margin := 2
+	img, err := Render("http://localhost:8080/abc", Options{Size: 300, Margin: &margin, Foreground: "#1e90ff", Background: "fff"})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, 300, decoded.Bounds().Dx())
+	assert.Equal(t, 300, decoded.Bounds().Dy())
+
+	// 21 модуль кода версии 1 и рамка по 2 модуля: 12 пикселей на модуль, остаток 0 пикселей.
+	fg := color.RGBAModel.Convert(color.RGBA{R: 0x1e, G: 0x90, B: 0xff, A: 0xff})
+	bg := color.RGBAModel.Convert(color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+	assert.Equal(t, bg, color.RGBAModel.Convert(decoded.At(0, 0)), "margin must be background")
+	assert.Equal(t, fg, color.RGBAModel.Convert(decoded.At(2*12+1, 2*12+1)), "finder pattern must be foreground")
+}
+
+func TestRenderSVG(t *testing.T) {
+	img, err := Render("http://localhost:8080/abc", Options{Format: FormatSVG, Level: "h", Foreground: "00000080"})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", img.ContentType)
+
+	svg := string(img.Data)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`))
+	assert.Contains(t, svg, `fill="#000000" fill-opacity="0.502"`)
+	assert.Contains(t, svg, `M4 4h7v1h-7z`, "finder pattern row must be merged into one rectangle")
+}
+
+func TestRenderInvalidOptions(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "Unknown format", opts: Options{Format: "gif"}},
+		{name: "Too small", opts: Options{Size: 10}},
+		{name: "Negative margin", opts: Options{Margin: &negative}},
+		{name: "Unknown level", opts: Options{Level: "X"}},
+		{name: "Invalid color", opts: Options{Foreground: "red"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Render("http://localhost:8080/abc", test.opts)
+			assert.True(t, errors.Is(err, ErrInvalidOptions), err)
+		})
+	}
+}
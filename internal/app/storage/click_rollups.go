@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+)
+
+// rollupLag - задержка агрегации, за которую успевают записаться переходы из буфера сервиса.
+const rollupLag = time.Minute
+
+// rollupKey - ключ агрегата переходов по урлу за час или день по UTC с одинаковыми измерениями.
+type rollupKey struct {
+	granularity  string
+	start        time.Time
+	shortURL     string
+	isBot        bool
+	referrerHost string
+	uaFamily     string
+	variantID    string
+}
+
+// rollupStart - возвращает начало часа или дня по UTC, в который попадает t.
+func rollupStart(t time.Time, granularity string) time.Time {
+	if granularity == models.StatsBucketDay {
+		return sketchDay(t)
+	}
+	return t.UTC().Truncate(time.Hour)
+}
+
+// rollupClicks - досчитывает часовые агрегаты по сырым событиям, дневные по часовым
+// и удаляет устаревшие события, агрегаты и скетчи. Возвращает true, если были удалены сырые события.
+// Данные удаляются только после того, как попали в агрегат следующего уровня.
+// Вызывается под блокировкой.
+func (ms *MapStorage) rollupClicks(policy models.ClicksRollupPolicy) bool {
+	hourlyFrom := ms.rolledUpTo[models.StatsBucketHour]
+	hourlyTo := rollupStart(policy.Now.Add(-rollupLag), models.StatsBucketHour)
+	if hourlyTo.After(hourlyFrom) {
+		for _, c := range ms.clicks {
+			if c.ClickedAt.Before(hourlyFrom) || !c.ClickedAt.Before(hourlyTo) {
+				continue
+			}
+			key := rollupKey{
+				granularity:  models.StatsBucketHour,
+				start:        rollupStart(c.ClickedAt, models.StatsBucketHour),
+				shortURL:     c.ShortURL,
+				isBot:        c.IsBot,
+				referrerHost: c.ReferrerHost,
+				uaFamily:     c.UAFamily,
+				variantID:    c.VariantID,
+			}
+			ms.rollups[key]++
+		}
+		ms.rolledUpTo[models.StatsBucketHour] = hourlyTo
+	}
+
+	dailyFrom := ms.rolledUpTo[models.StatsBucketDay]
+	dailyTo := rollupStart(ms.rolledUpTo[models.StatsBucketHour], models.StatsBucketDay)
+	if dailyTo.After(dailyFrom) {
+		daily := make(map[rollupKey]int64)
+		for key, clicks := range ms.rollups {
+			if key.granularity != models.StatsBucketHour || key.start.Before(dailyFrom) || !key.start.Before(dailyTo) {
+				continue
+			}
+			key.granularity = models.StatsBucketDay
+			key.start = rollupStart(key.start, models.StatsBucketDay)
+			daily[key] += clicks
+		}
+		for key, clicks := range daily {
+			ms.rollups[key] += clicks
+		}
+		ms.rolledUpTo[models.StatsBucketDay] = dailyTo
+	}
+
+	pruned := false
+	if policy.RawRetention > 0 {
+		cutoff := earliest(policy.Now.Add(-policy.RawRetention), ms.rolledUpTo[models.StatsBucketHour])
+		kept := make([]models.ClickEvent, 0, len(ms.clicks))
+		for _, c := range ms.clicks {
+			if c.ClickedAt.Before(cutoff) {
+				pruned = true
+				continue
+			}
+			kept = append(kept, c)
+		}
+		if pruned {
+			ms.clicks = kept
+		}
+	}
+
+	if policy.HourlyRetention > 0 {
+		ms.pruneRollups(models.StatsBucketHour, earliest(policy.Now.Add(-policy.HourlyRetention), ms.rolledUpTo[models.StatsBucketDay]))
+	}
+
+	if policy.DailyRetention > 0 {
+		cutoff := policy.Now.Add(-policy.DailyRetention)
+		ms.pruneRollups(models.StatsBucketDay, cutoff)
+		for key := range ms.sketches {
+			if key.day.Before(sketchDay(cutoff)) {
+				delete(ms.sketches, key)
+			}
+		}
+	}
+
+	return pruned
+}
+
+// pruneRollups - удаляет агрегаты гранулярности granularity, начавшиеся раньше cutoff.
+func (ms *MapStorage) pruneRollups(granularity string, cutoff time.Time) {
+	for key := range ms.rollups {
+		if key.granularity == granularity && key.start.Before(cutoff) {
+			delete(ms.rollups, key)
+		}
+	}
+}
+
+// addRollups - учитывает в статистике агрегаты гранулярности filter.Rollup, начавшиеся в периоде фильтра
+// до момента последней агрегации, и возвращает момент, с которого статистику надо считать по сырым событиям.
+// Вызывается под блокировкой.
+func (ms *MapStorage) addRollups(agg *clickAggregator, filter models.ClickStatsFilter) time.Time {
+	if filter.Rollup == "" {
+		return filter.From
+	}
+
+	rolledUpTo := ms.rolledUpTo[filter.Rollup]
+	to := earliest(filter.To, rolledUpTo)
+	for key, clicks := range ms.rollups {
+		if key.granularity != filter.Rollup || !agg.matches(key.shortURL) || key.start.Before(filter.From) || !key.start.Before(to) {
+			continue
+		}
+		agg.add(key.shortURL, key.start, key.isBot, key.referrerHost, key.uaFamily, key.variantID, clicks)
+	}
+
+	if rolledUpTo.After(filter.From) {
+		return rolledUpTo
+	}
+	return filter.From
+}
+
+// earliest - возвращает более ранний из моментов.
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
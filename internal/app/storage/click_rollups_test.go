@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupClicks(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	clicks := []models.ClickEvent{
+		{ShortURL: "abc", ClickedAt: now.AddDate(0, 0, -40), ReferrerHost: "t.me", UAFamily: "Chrome", VariantID: "a"},
+		{ShortURL: "abc", ClickedAt: now.AddDate(0, 0, -40).Add(10 * time.Minute), UAFamily: "Chrome", VariantID: "a"},
+		{ShortURL: "abc", ClickedAt: now.AddDate(0, 0, -3), ReferrerHost: "t.me", UAFamily: "Firefox", VariantID: "b"},
+		{ShortURL: "abc", ClickedAt: now.AddDate(0, 0, -3), UAFamily: "Other", IsBot: true},
+		{ShortURL: "abc", ClickedAt: now.Add(-10 * time.Minute), UAFamily: "Chrome", VariantID: "b"},
+		{ShortURL: "other", ClickedAt: now.AddDate(0, 0, -3), UAFamily: "Chrome"},
+	}
+	filters := map[string]models.ClickStatsFilter{
+		models.StatsBucketHour: {ShortURL: "abc", From: now.AddDate(0, 0, -20), To: now, Location: time.UTC, Bucket: models.StatsBucketHour, TopLimit: 10},
+		models.StatsBucketDay:  {ShortURL: "abc", From: now.AddDate(0, 0, -60), To: now, Location: time.UTC, Bucket: models.StatsBucketWeek, TopLimit: 10},
+	}
+
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertClicks(context.Background(), clicks))
+
+	expected := make(map[string]*models.URLStatsResponse)
+	for rollup, filter := range filters {
+		expected[rollup], err = store.SelectClickStats(context.Background(), filter)
+		assert.NoError(t, err)
+	}
+
+	policy := models.ClicksRollupPolicy{
+		Now:             now,
+		RawRetention:    7 * 24 * time.Hour,
+		HourlyRetention: 30 * 24 * time.Hour,
+	}
+	assert.NoError(t, store.RollupClicks(context.Background(), policy))
+	// повторная агрегация не должна учитывать переходы второй раз.
+	assert.NoError(t, store.RollupClicks(context.Background(), policy))
+
+	// переход в последние минуты еще не агрегирован, устаревшие сырые события удалены.
+	assert.Len(t, store.clicks, 4)
+	assert.Equal(t, now.Truncate(time.Hour), store.rolledUpTo[models.StatsBucketHour])
+	assert.Equal(t, sketchDay(now), store.rolledUpTo[models.StatsBucketDay])
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.Len(t, store.clicks, 4)
+
+	for rollup, filter := range filters {
+		filter.Rollup = rollup
+		stats, err := store.SelectClickStats(context.Background(), filter)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[rollup].TotalClicks, stats.TotalClicks, rollup)
+		assert.Equal(t, expected[rollup].BotClicks, stats.BotClicks, rollup)
+		assert.Equal(t, expected[rollup].TimeSeries, stats.TimeSeries, rollup)
+		assert.Equal(t, expected[rollup].TopReferrers, stats.TopReferrers, rollup)
+		assert.Equal(t, expected[rollup].UserAgents, stats.UserAgents, rollup)
+		assert.Equal(t, expected[rollup].Variants, stats.Variants, rollup)
+	}
+	assert.NoError(t, store.Close())
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/hll"
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+)
+
+// sketchKey - ключ дневного скетча уникальных посетителей короткого урла, боты учитываются отдельно.
+type sketchKey struct {
+	shortURL string
+	day      time.Time
+	isBot    bool
+}
+
+// dailySketch - количество переходов и скетч уникальных посетителей короткого урла за день.
+type dailySketch struct {
+	clicks int64
+	sketch *hll.Sketch
+}
+
+// sketchDay - возвращает день по UTC, за который учитывается переход.
+func sketchDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// groupClicksByDay - собирает дневные скетчи по батчу событий перехода.
+func groupClicksByDay(clicks []models.ClickEvent) map[sketchKey]*dailySketch {
+	sketches := make(map[sketchKey]*dailySketch)
+
+	for _, c := range clicks {
+		key := sketchKey{shortURL: c.ShortURL, day: sketchDay(c.ClickedAt), isBot: c.IsBot}
+
+		daily, exist := sketches[key]
+		if !exist {
+			daily = &dailySketch{sketch: hll.New()}
+			sketches[key] = daily
+		}
+
+		daily.clicks++
+		if c.IPHash != "" {
+			daily.sketch.AddString(c.IPHash)
+		}
+	}
+
+	return sketches
+}
+
+// mergeSketches - добавляет дневные скетчи batch к скетчам dst.
+func mergeSketches(dst map[sketchKey]*dailySketch, batch map[sketchKey]*dailySketch) {
+	for key, daily := range batch {
+		existing, exist := dst[key]
+		if !exist {
+			dst[key] = daily
+			continue
+		}
+
+		existing.clicks += daily.clicks
+		existing.sketch.Merge(daily.sketch)
+	}
+}
+
+// estimateVisitors - оценивает уникальных посетителей урла за дни, которые пересекаются с периодом фильтра.
+func estimateVisitors(sketches map[sketchKey]*dailySketch, filter models.ClickStatsFilter) int64 {
+	merged := hll.New()
+
+	lastDay := sketchDay(filter.To.Add(-time.Nanosecond))
+	for day := sketchDay(filter.From); !day.After(lastDay); day = day.AddDate(0, 0, 1) {
+		if daily, exist := sketches[sketchKey{shortURL: filter.ShortURL, day: day}]; exist {
+			merged.Merge(daily.sketch)
+		}
+		if !filter.IncludeBots {
+			continue
+		}
+		if daily, exist := sketches[sketchKey{shortURL: filter.ShortURL, day: day, isBot: true}]; exist {
+			merged.Merge(daily.sketch)
+		}
+	}
+
+	return int64(merged.Estimate())
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+)
+
+// directReferrer - имя источника для переходов без заголовка Referer.
+const directReferrer = "(direct)"
+
+// aggregateClicks - считает статистику переходов по событиям, хранящимся в памяти.
+// Переходы ботов учитываются только в BotClicks, если фильтр их не включает.
+// Уникальные посетители оцениваются отдельно по дневным скетчам.
+func aggregateClicks(clicks []models.ClickEvent, filter models.ClickStatsFilter) *models.URLStatsResponse {
+	agg := newClickAggregator(filter)
+	agg.addClicks(clicks, filter.From)
+	return agg.result()
+}
+
+// clickAggregator - накапливает статистику переходов по сырым событиям и агрегатам.
+// Если задан urlClicks, учитываются переходы по всем его урлам, а не по урлу фильтра.
+type clickAggregator struct {
+	filter     models.ClickStatsFilter
+	urlClicks  map[string]int64
+	stats      models.URLStatsResponse
+	series     map[time.Time]int64
+	referrers  map[string]int64
+	userAgents map[string]int64
+	variants   map[string]int64
+}
+
+func newClickAggregator(filter models.ClickStatsFilter) *clickAggregator {
+	return &clickAggregator{
+		filter:     filter,
+		series:     make(map[time.Time]int64),
+		referrers:  make(map[string]int64),
+		userAgents: make(map[string]int64),
+		variants:   make(map[string]int64),
+	}
+}
+
+// addClicks - учитывает события перехода по урлу фильтра, произошедшие с from до конца периода фильтра.
+func (a *clickAggregator) addClicks(clicks []models.ClickEvent, from time.Time) {
+	for _, c := range clicks {
+		if !a.matches(c.ShortURL) || c.ClickedAt.Before(from) || !c.ClickedAt.Before(a.filter.To) {
+			continue
+		}
+		a.add(c.ShortURL, c.ClickedAt, c.IsBot, c.ReferrerHost, c.UAFamily, c.VariantID, 1)
+	}
+}
+
+// matches - проверяет, учитываются ли переходы по урлу shortURL.
+func (a *clickAggregator) matches(shortURL string) bool {
+	if a.urlClicks == nil {
+		return shortURL == a.filter.ShortURL
+	}
+	_, exist := a.urlClicks[shortURL]
+	return exist
+}
+
+// add - учитывает clicks переходов по урлу shortURL, произошедших в момент at, с одинаковыми измерениями.
+func (a *clickAggregator) add(shortURL string, at time.Time, isBot bool, referrerHost string, uaFamily string, variantID string, clicks int64) {
+	if isBot {
+		a.stats.BotClicks += clicks
+		if !a.filter.IncludeBots {
+			return
+		}
+	}
+
+	a.stats.TotalClicks += clicks
+	if a.urlClicks != nil {
+		a.urlClicks[shortURL] += clicks
+	}
+
+	a.series[TruncateToBucket(at, a.filter.Bucket, a.filter.Location)] += clicks
+
+	if referrerHost == "" {
+		referrerHost = directReferrer
+	}
+	a.referrers[referrerHost] += clicks
+	a.userAgents[uaFamily] += clicks
+
+	if variantID != "" {
+		a.variants[variantID] += clicks
+	}
+}
+
+// result - возвращает накопленную статистику.
+func (a *clickAggregator) result() *models.URLStatsResponse {
+	stats := a.stats
+
+	for start, count := range a.series {
+		stats.TimeSeries = append(stats.TimeSeries, models.StatsBucket{Start: start, Clicks: count})
+	}
+	sort.Slice(stats.TimeSeries, func(i, j int) bool {
+		return stats.TimeSeries[i].Start.Before(stats.TimeSeries[j].Start)
+	})
+
+	stats.TopReferrers = topCounts(a.referrers, a.filter.TopLimit)
+	stats.UserAgents = topCounts(a.userAgents, a.filter.TopLimit)
+	stats.Variants = topCounts(a.variants, 0)
+
+	return &stats
+}
+
+// collectionResult - возвращает накопленную статистику по урлам urlClicks.
+func (a *clickAggregator) collectionResult() *models.CollectionStatsResponse {
+	stats := a.result()
+	return &models.CollectionStatsResponse{
+		TotalClicks: stats.TotalClicks,
+		BotClicks:   stats.BotClicks,
+		TimeSeries:  stats.TimeSeries,
+		URLs:        topCounts(a.urlClicks, 0),
+	}
+}
+
+// topCounts - сортирует значения по убыванию количества переходов и оставляет limit первых (0 - все).
+func topCounts(counts map[string]int64, limit int) []models.StatsCount {
+	var result []models.StatsCount
+	for name, count := range counts {
+		result = append(result, models.StatsCount{Name: name, Clicks: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Clicks != result[j].Clicks {
+			return result[i].Clicks > result[j].Clicks
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// TruncateToBucket - возвращает начало интервала временного ряда, в который попадает t, в часовом поясе loc.
+// Неделя начинается с понедельника, как в date_trunc PostgreSQL.
+func TruncateToBucket(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+
+	switch bucket {
+	case models.StatsBucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case models.StatsBucketWeek:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// NextBucket - возвращает начало следующего интервала временного ряда.
+func NextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case models.StatsBucketHour:
+		return start.Add(time.Hour)
+	case models.StatsBucketWeek:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateClicks(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	base := time.Date(2026, 10, 12, 22, 30, 0, 0, time.UTC)
+
+	clicks := []models.ClickEvent{
+		{ShortURL: "abc", ClickedAt: base, IPHash: "1", ReferrerHost: "t.me", UAFamily: "Chrome", VariantID: "a"},
+		{ShortURL: "abc", ClickedAt: base.Add(time.Hour), IPHash: "1", UAFamily: "Chrome", VariantID: "b"},
+		{ShortURL: "abc", ClickedAt: base.Add(2 * time.Hour), IPHash: "2", ReferrerHost: "t.me", UAFamily: "Firefox", VariantID: "b"},
+		{ShortURL: "abc", ClickedAt: base.Add(-48 * time.Hour), IPHash: "3", UAFamily: "Chrome"},
+		{ShortURL: "other", ClickedAt: base, IPHash: "4", UAFamily: "Chrome"},
+		{ShortURL: "abc", ClickedAt: base, IPHash: "5", ReferrerHost: "slack.com", UAFamily: "Other", IsBot: true},
+	}
+
+	stats := aggregateClicks(clicks, models.ClickStatsFilter{
+		ShortURL: "abc",
+		From:     base.Add(-time.Hour),
+		To:       base.Add(24 * time.Hour),
+		Location: moscow,
+		Bucket:   models.StatsBucketDay,
+		TopLimit: 10,
+	})
+
+	assert.Equal(t, int64(3), stats.TotalClicks)
+	assert.Equal(t, int64(1), stats.BotClicks)
+	assert.Equal(t, []models.StatsBucket{
+		{Start: time.Date(2026, 10, 13, 0, 0, 0, 0, moscow), Clicks: 3},
+	}, stats.TimeSeries)
+	assert.Equal(t, []models.StatsCount{{Name: "t.me", Clicks: 2}, {Name: directReferrer, Clicks: 1}}, stats.TopReferrers)
+	assert.Equal(t, []models.StatsCount{{Name: "Chrome", Clicks: 2}, {Name: "Firefox", Clicks: 1}}, stats.UserAgents)
+	assert.Equal(t, []models.StatsCount{{Name: "b", Clicks: 2}, {Name: "a", Clicks: 1}}, stats.Variants)
+}
+
+func TestTruncateToBucket(t *testing.T) {
+	ts := time.Date(2026, 10, 18, 15, 45, 10, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC), TruncateToBucket(ts, models.StatsBucketHour, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), TruncateToBucket(ts, models.StatsBucketDay, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), TruncateToBucket(ts, models.StatsBucketWeek, time.UTC))
+}
@@ -4,12 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/nu-kotov/URLcompressor/internal/app/hll"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
 	"github.com/pressly/goose/v3"
 )
@@ -107,7 +113,13 @@ func (pg *DBStorage) SelectUsersCount(ctx context.Context) (int, error) {
 // InsertURLsData - вставляет в бд информацию по урлу.
 func (pg *DBStorage) InsertURLsData(ctx context.Context, data *models.URLsData) error {
 
-	sql := `INSERT INTO urls (short_url, original_url, user_id) VALUES ($1, $2, $3);`
+	sql := `INSERT INTO urls (short_url, original_url, user_id, query_policy, utm_params, title, description, created_at, domain, expires_at, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+	queryPolicy, utmParams, err := marshalRedirectOptions(data.RedirectOptions)
+	if err != nil {
+		return err
+	}
 
 	tx, err := pg.db.Begin()
 	if err != nil {
@@ -120,6 +132,14 @@ func (pg *DBStorage) InsertURLsData(ctx context.Context, data *models.URLsData)
 		data.ShortURL,
 		data.OriginalURL,
 		data.UserID,
+		queryPolicy,
+		utmParams,
+		data.Title,
+		data.Description,
+		createdAt(data),
+		destinationDomain(data.OriginalURL),
+		data.ExpiresAt,
+		data.WorkspaceID,
 	)
 
 	if err != nil {
@@ -133,13 +153,24 @@ func (pg *DBStorage) InsertURLsData(ctx context.Context, data *models.URLsData)
 		return err
 	}
 
+	if err := insertURLVariants(ctx, tx, data); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertURLTags(ctx, tx, data.ShortURL, data.Tags); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	return tx.Commit()
 }
 
 // InsertURLsDataBatch - вставляет в бд информацию батчу урлов.
 func (pg *DBStorage) InsertURLsDataBatch(ctx context.Context, data []models.URLsData) error {
 
-	sql := `INSERT INTO urls (short_url, original_url, correlation_id, user_id) VALUES ($1, $2, $3, $4);`
+	sql := `INSERT INTO urls (short_url, original_url, correlation_id, user_id, query_policy, utm_params, title, description, created_at, domain, expires_at, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
 
 	tx, err := pg.db.Begin()
 	if err != nil {
@@ -147,13 +178,27 @@ func (pg *DBStorage) InsertURLsDataBatch(ctx context.Context, data []models.URLs
 	}
 
 	for _, d := range data {
-		_, err := tx.ExecContext(
+		queryPolicy, utmParams, err := marshalRedirectOptions(d.RedirectOptions)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.ExecContext(
 			ctx,
 			sql,
 			d.ShortURL,
 			d.OriginalURL,
 			d.CorrelationID,
 			d.UserID,
+			queryPolicy,
+			utmParams,
+			d.Title,
+			d.Description,
+			createdAt(&d),
+			destinationDomain(d.OriginalURL),
+			d.ExpiresAt,
+			d.WorkspaceID,
 		)
 		if err != nil {
 			tx.Rollback()
@@ -165,36 +210,207 @@ func (pg *DBStorage) InsertURLsDataBatch(ctx context.Context, data []models.URLs
 
 			return err
 		}
+
+		if err := insertURLVariants(ctx, tx, &d); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := insertURLTags(ctx, tx, d.ShortURL, d.Tags); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
 	return tx.Commit()
 }
 
-// DeleteURLs - вставляет в бд информацию батчу урлов.
-func (pg *DBStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) error {
-	sql := `UPDATE urls SET is_deleted = TRUE WHERE short_url = $1 AND user_id = $2;`
+// DeleteURLs - помечает удаленными в бд урлы батча и возвращает сообщения, урлы которых принадлежат пользователям
+// или рабочим пространствам отправителей. У уже удаленных урлов сохраняется момент удаления.
+func (pg *DBStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error) {
+	sql := `UPDATE urls SET is_deleted = TRUE, deleted_at = COALESCE(deleted_at, now())
+		WHERE short_url = $1 AND workspace_id = $3 AND ($3 <> 0 OR user_id = $2);`
 
 	tx, err := pg.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var deleted []models.URLForDeleteMsg
 	for _, d := range data {
-		_, err := tx.ExecContext(
+		result, err := tx.ExecContext(
 			ctx,
 			sql,
 			d.ShortURL,
 			d.UserID,
+			d.WorkspaceID,
 		)
 		if err != nil {
 			tx.Rollback()
+			return nil, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if affected != 0 {
+			deleted = append(deleted, d)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// EnqueueURLsDeletion - добавляет сообщения в очередь удаления в бд и проставляет им идентификаторы.
+func (pg *DBStorage) EnqueueURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO deletion_queue (short_url, user_id, workspace_id, job_id) VALUES ($1, $2, $3, $4) RETURNING id`
+	for i := range msgs {
+		row := tx.QueryRowContext(ctx, query, msgs[i].ShortURL, msgs[i].UserID, msgs[i].WorkspaceID, msgs[i].JobID)
+		if err := row.Scan(&msgs[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClaimURLsDeletion - забирает в обработку до limit свободных сообщений очереди удаления на время lease
+// и увеличивает их счетчик попыток. Строки, уже заблокированные другими экземплярами сервиса, пропускаются,
+// поэтому несколько экземпляров разбирают очередь, не мешая друг другу.
+func (pg *DBStorage) ClaimURLsDeletion(ctx context.Context, limit int, lease time.Duration) ([]models.URLForDeleteMsg, error) {
+	query := `UPDATE deletion_queue SET attempts = attempts + 1, locked_until = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM deletion_queue
+			WHERE locked_until IS NULL OR locked_until <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, short_url, user_id, workspace_id, job_id, attempts, error`
+
+	rows, err := pg.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var claimed []models.URLForDeleteMsg
+	for rows.Next() {
+		var msg models.URLForDeleteMsg
+		if err := rows.Scan(&msg.ID, &msg.ShortURL, &msg.UserID, &msg.WorkspaceID, &msg.JobID, &msg.Attempts, &msg.Error); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].ID < claimed[j].ID })
+	return claimed, nil
+}
+
+// AckURLsDeletion - удаляет обработанные сообщения из очереди удаления в бд.
+func (pg *DBStorage) AckURLsDeletion(ctx context.Context, ids []int64) error {
+	_, err := pg.db.ExecContext(ctx, `DELETE FROM deletion_queue WHERE id = ANY($1)`, ids)
+	return err
+}
+
+// RetryURLsDeletion - откладывает повторную обработку сообщений очереди удаления в бд до retryAt
+// и сохраняет ошибки их последней попытки и счетчики попыток.
+func (pg *DBStorage) RetryURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg, retryAt time.Time) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, msg := range msgs {
+		_, err := tx.ExecContext(ctx, `UPDATE deletion_queue SET locked_until = $2, error = $3, attempts = $4 WHERE id = $1`,
+			msg.ID, retryAt, msg.Error, msg.Attempts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeadLetterURLsDeletion - переносит сообщения из очереди удаления в бд в очередь недоставленных.
+func (pg *DBStorage) DeadLetterURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO deletion_dead_letters (id, short_url, user_id, workspace_id, job_id, attempts, error, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now()) ON CONFLICT (id) DO NOTHING`
+
+	ids := make([]int64, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+		if _, err := tx.ExecContext(ctx, query, msg.ID, msg.ShortURL, msg.UserID, msg.WorkspaceID, msg.JobID, msg.Attempts, msg.Error); err != nil {
 			return err
 		}
 	}
 
+	if _, err := tx.ExecContext(ctx, `DELETE FROM deletion_queue WHERE id = ANY($1)`, ids); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+// SelectDeletionDeadLetters - возвращает до limit сообщений очереди недоставленных из бд
+// с идентификаторами больше afterID в порядке возрастания идентификаторов.
+func (pg *DBStorage) SelectDeletionDeadLetters(ctx context.Context, afterID int64, limit int) ([]models.DeletionDeadLetter, error) {
+	query := `SELECT id, short_url, user_id, workspace_id, job_id, attempts, error, failed_at FROM deletion_dead_letters
+		WHERE id > $1 ORDER BY id LIMIT $2`
+
+	rows, err := pg.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deadLetters []models.DeletionDeadLetter
+	for rows.Next() {
+		var d models.DeletionDeadLetter
+		if err := rows.Scan(&d.ID, &d.ShortURL, &d.UserID, &d.WorkspaceID, &d.JobID, &d.Attempts, &d.Error, &d.FailedAt); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, d)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+// SelectDeletionQueueStats - возвращает размеры очереди удаления и очереди недоставленных из бд.
+func (pg *DBStorage) SelectDeletionQueueStats(ctx context.Context) (*models.DeletionQueueStats, error) {
+	query := `SELECT
+		(SELECT count(*) FROM deletion_queue WHERE locked_until IS NULL OR locked_until <= now()),
+		(SELECT count(*) FROM deletion_queue WHERE locked_until > now()),
+		(SELECT count(*) FROM deletion_dead_letters)`
+
+	var stats models.DeletionQueueStats
+	if err := pg.db.QueryRowContext(ctx, query).Scan(&stats.Ready, &stats.Delayed, &stats.DeadLetters); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
 // SelectOriginalURLByShortURL - возвращает полный урл по сокращенному из бд.
 func (pg *DBStorage) SelectOriginalURLByShortURL(ctx context.Context, shortURL string) (string, error) {
 	var originalURL string
@@ -219,35 +435,1936 @@ func (pg *DBStorage) SelectOriginalURLByShortURL(ctx context.Context, shortURL s
 	return originalURL, nil
 }
 
-// SelectURLs - возвращает информацию по урлам пользователя из бд.
-func (pg *DBStorage) SelectURLs(ctx context.Context, userID string) ([]models.GetUserURLsResponse, error) {
-	var data []models.GetUserURLsResponse
+// urlsDataColumns - колонки таблицы urls в порядке scanURLsData.
+const urlsDataColumns = `short_url, original_url, correlation_id, user_id, is_deleted, query_policy, utm_params, takedown_reason, taken_down_at,
+	title, description, ` + urlTagsColumn + `, created_at, expires_at, deleted_at, workspace_id, collection_id`
+
+// scanURLsData - читает данные по урлу без вариантов назначения из строки выборки urlsDataColumns.
+func scanURLsData(row interface{ Scan(...any) error }) (*models.URLsData, error) {
+	var data models.URLsData
+	var correlationID, userID sql.NullString
+	var queryPolicy string
+	var utmParams []byte
+	var takedownReason string
+	var takenDownAt, expiresAt, deletedAt sql.NullTime
 
-	query := `SELECT short_url, original_url from urls WHERE user_id = $1`
+	var tags string
 
-	rows, err := pg.db.Query(query, userID)
+	err := row.Scan(
+		&data.ShortURL,
+		&data.OriginalURL,
+		&correlationID,
+		&userID,
+		&data.DeletedFlag,
+		&queryPolicy,
+		&utmParams,
+		&takedownReason,
+		&takenDownAt,
+		&data.Title,
+		&data.Description,
+		&tags,
+		&data.CreatedAt,
+		&expiresAt,
+		&deletedAt,
+		&data.WorkspaceID,
+		&data.CollectionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	data.CorrelationID = correlationID.String
+	data.UserID = userID.String
+	data.Tags = splitURLTags(tags)
+	if takenDownAt.Valid {
+		data.Takedown = &models.URLTakedown{Reason: takedownReason, At: takenDownAt.Time}
+	}
+	if expiresAt.Valid {
+		data.ExpiresAt = &expiresAt.Time
+	}
+	if deletedAt.Valid {
+		data.DeletedAt = &deletedAt.Time
+	}
 
+	data.RedirectOptions, err = unmarshalRedirectOptions(queryPolicy, utmParams)
 	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// SelectURLData - возвращает данные по короткому урлу вместе с вариантами назначения из бд.
+func (pg *DBStorage) SelectURLData(ctx context.Context, shortURL string) (*models.URLsData, error) {
+	query := `SELECT ` + urlsDataColumns + ` FROM urls WHERE short_url = $1`
+
+	data, err := scanURLsData(pg.db.QueryRowContext(ctx, query, shortURL))
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	variantsQuery := `SELECT variant_id, original_url, weight, served from url_variants WHERE short_url = $1 ORDER BY variant_id`
+
+	rows, err := pg.db.QueryContext(ctx, variantsQuery, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var shortURL, originalURL string
+		var variant models.URLVariant
+
+		if err := rows.Scan(&variant.ID, &variant.OriginalURL, &variant.Weight, &variant.Served); err != nil {
+			return nil, err
+		}
+
+		data.Variants = append(data.Variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
 
-		err := rows.Scan(&shortURL, &originalURL)
+// SelectUserURLsData - возвращает из бд страницу личных урлов пользователя, включая удаленные, вместе с вариантами
+// назначения в порядке коротких урлов, страница начинается после afterShortURL. Урлы рабочих пространств не входят.
+func (pg *DBStorage) SelectUserURLsData(ctx context.Context, userID string, afterShortURL string, limit int) ([]models.URLsData, error) {
+	query := `SELECT ` + urlsDataColumns + ` FROM urls WHERE user_id = $1 AND workspace_id = 0 AND short_url > $2
+		ORDER BY short_url LIMIT $3`
+
+	rows, err := pg.db.QueryContext(ctx, query, userID, afterShortURL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var page []models.URLsData
+	positions := make(map[string]int)
+	for rows.Next() {
+		data, err := scanURLsData(rows)
 		if err != nil {
 			return nil, err
 		}
+		positions[data.ShortURL] = len(page)
+		page = append(page, *data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page) == 0 {
+		return nil, nil
+	}
+
+	shortURLs := make([]string, len(page))
+	for i, d := range page {
+		shortURLs[i] = d.ShortURL
+	}
+
+	variantsQuery := `SELECT short_url, variant_id, original_url, weight, served FROM url_variants
+		WHERE short_url = ANY($1) ORDER BY short_url, variant_id`
+
+	variantRows, err := pg.db.QueryContext(ctx, variantsQuery, shortURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer variantRows.Close()
+
+	for variantRows.Next() {
+		var shortURL string
+		var variant models.URLVariant
+
+		if err := variantRows.Scan(&shortURL, &variant.ID, &variant.OriginalURL, &variant.Weight, &variant.Served); err != nil {
+			return nil, err
+		}
+
+		i := positions[shortURL]
+		page[i].Variants = append(page[i].Variants, variant)
+	}
+
+	return page, variantRows.Err()
+}
+
+// IncrementVariantServed - увеличивает счетчик показов варианта короткого урла в бд.
+func (pg *DBStorage) IncrementVariantServed(ctx context.Context, shortURL string, variantID string) error {
+	query := `UPDATE url_variants SET served = served + 1 WHERE short_url = $1 AND variant_id = $2`
+
+	result, err := pg.db.ExecContext(ctx, query, shortURL, variantID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// InsertClicks - вставляет в бд батч событий перехода по коротким урлам.
+func (pg *DBStorage) InsertClicks(ctx context.Context, clicks []models.ClickEvent) error {
+	query := `INSERT INTO clicks (short_url, variant_id, clicked_at, referrer, referrer_host, user_agent, ua_family, ip_hash, country, is_bot)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range clicks {
+		_, err := stmt.ExecContext(
+			ctx,
+			c.ShortURL,
+			c.VariantID,
+			c.ClickedAt,
+			c.Referrer,
+			c.ReferrerHost,
+			c.UserAgent,
+			c.UAFamily,
+			c.IPHash,
+			c.Country,
+			c.IsBot,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := upsertClickSketches(ctx, tx, groupClicksByDay(clicks)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// upsertClickSketches - добавляет дневные скетчи батча к сохраненным в бд в рамках транзакции.
+// Строка скетча блокируется на время слияния, чтобы параллельные записи не теряли посетителей.
+func upsertClickSketches(ctx context.Context, tx *sql.Tx, sketches map[sketchKey]*dailySketch) error {
+	ensureQuery := `INSERT INTO click_sketches (short_url, day, is_bot) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	selectQuery := `SELECT sketch FROM click_sketches WHERE short_url = $1 AND day = $2 AND is_bot = $3 FOR UPDATE`
+	updateQuery := `UPDATE click_sketches SET clicks = clicks + $4, sketch = $5 WHERE short_url = $1 AND day = $2 AND is_bot = $3`
+
+	for key, daily := range sketches {
+		if _, err := tx.ExecContext(ctx, ensureQuery, key.shortURL, key.day, key.isBot); err != nil {
+			return err
+		}
+
+		var stored []byte
+		if err := tx.QueryRowContext(ctx, selectQuery, key.shortURL, key.day, key.isBot).Scan(&stored); err != nil {
+			return err
+		}
+
+		if len(stored) != 0 {
+			existing := hll.New()
+			if err := existing.UnmarshalBinary(stored); err != nil {
+				return err
+			}
+			daily.sketch.Merge(existing)
+		}
+
+		sketch, err := daily.sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, updateQuery, key.shortURL, key.day, key.isBot, daily.clicks, sketch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selectUniqueVisitors - оценивает уникальных посетителей урла по дневным скетчам за дни периода фильтра.
+func (pg *DBStorage) selectUniqueVisitors(ctx context.Context, filter models.ClickStatsFilter) (int64, error) {
+	query := `SELECT sketch FROM click_sketches
+		WHERE short_url = $1 AND day >= $2 AND day <= $3 AND ($4 OR NOT is_bot) AND sketch IS NOT NULL`
+
+	rows, err := pg.db.QueryContext(ctx, query, filter.ShortURL, sketchDay(filter.From), sketchDay(filter.To.Add(-time.Nanosecond)), filter.IncludeBots)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	merged := hll.New()
+	for rows.Next() {
+		var stored []byte
+		if err := rows.Scan(&stored); err != nil {
+			return 0, err
+		}
 
-		data = append(data, models.GetUserURLsResponse{
-			ShortURL:    fmt.Sprintf("%s/%s", pg.baseURL, shortURL),
-			OriginalURL: originalURL,
-		})
+		sketch := hll.New()
+		if err := sketch.UnmarshalBinary(stored); err != nil {
+			return 0, err
+		}
+		merged.Merge(sketch)
 	}
 	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return int64(merged.Estimate()), nil
+}
+
+// SelectClicksPage - возвращает страницу событий перехода по короткому урлу из бд в порядке идентификаторов.
+func (pg *DBStorage) SelectClicksPage(ctx context.Context, filter models.ClicksPageFilter) ([]models.ClickEvent, error) {
+	var page []models.ClickEvent
+
+	query := `SELECT id, short_url, variant_id, clicked_at, referrer, referrer_host, user_agent, ua_family, ip_hash, country, is_bot
+		FROM clicks WHERE short_url = $1 AND clicked_at >= $2 AND clicked_at < $3 AND id > $4
+		ORDER BY id LIMIT $5`
+
+	rows, err := pg.db.QueryContext(ctx, query, filter.ShortURL, filter.From, filter.To, filter.AfterID, filter.Limit)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return data, nil
+	for rows.Next() {
+		var c models.ClickEvent
+
+		err := rows.Scan(
+			&c.ID,
+			&c.ShortURL,
+			&c.VariantID,
+			&c.ClickedAt,
+			&c.Referrer,
+			&c.ReferrerHost,
+			&c.UserAgent,
+			&c.UAFamily,
+			&c.IPHash,
+			&c.Country,
+			&c.IsBot,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		page = append(page, c)
+	}
+
+	return page, rows.Err()
+}
+
+// clicksStatsEvents - выборка переходов для статистики: агрегаты гранулярности $4 до момента последней агрегации
+// и сырые события после него, при пустой гранулярности - только сырые события.
+// Параметры: $1 - короткий урл, $2 и $3 - границы периода, $4 - гранулярность агрегатов, $5 - учитывать ли ботов.
+const clicksStatsEvents = `WITH rolled AS (
+		SELECT COALESCE((SELECT rolled_up_to FROM click_rollup_state WHERE granularity = $4), '-infinity'::timestamptz) AS rolled_up_to
+	), events AS (
+		SELECT r.bucket_start AS ts, r.is_bot, r.referrer_host, r.ua_family, r.variant_id, r.clicks
+		FROM click_rollups r, rolled
+		WHERE r.granularity = $4 AND r.short_url = $1 AND r.bucket_start >= $2 AND r.bucket_start < LEAST($3, rolled.rolled_up_to)
+		UNION ALL
+		SELECT c.clicked_at, c.is_bot, c.referrer_host, c.ua_family, c.variant_id, 1
+		FROM clicks c, rolled
+		WHERE c.short_url = $1 AND c.clicked_at >= GREATEST($2, rolled.rolled_up_to) AND c.clicked_at < $3
+	)
+	`
+
+// clicksStatsArgs - параметры выборки clicksStatsEvents.
+func clicksStatsArgs(filter models.ClickStatsFilter) []any {
+	return []any{filter.ShortURL, filter.From, filter.To, filter.Rollup, filter.IncludeBots}
+}
+
+// SelectClickStats - считает статистику переходов по короткому урлу в бд.
+func (pg *DBStorage) SelectClickStats(ctx context.Context, filter models.ClickStatsFilter) (*models.URLStatsResponse, error) {
+	var stats models.URLStatsResponse
+
+	totalsQuery := clicksStatsEvents + `SELECT COALESCE(SUM(clicks) FILTER (WHERE $5 OR NOT is_bot), 0)::bigint,
+		COALESCE(SUM(clicks) FILTER (WHERE is_bot), 0)::bigint FROM events`
+
+	row := pg.db.QueryRowContext(ctx, totalsQuery, clicksStatsArgs(filter)...)
+	if err := row.Scan(&stats.TotalClicks, &stats.BotClicks); err != nil {
+		return nil, err
+	}
+
+	uniqueVisitors, err := pg.selectUniqueVisitors(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	stats.UniqueVisitors = uniqueVisitors
+
+	seriesQuery := clicksStatsEvents + `SELECT date_trunc($6, ts AT TIME ZONE $7) AS bucket, SUM(clicks)::bigint
+		FROM events WHERE $5 OR NOT is_bot
+		GROUP BY bucket ORDER BY bucket`
+
+	rows, err := pg.db.QueryContext(ctx, seriesQuery, append(clicksStatsArgs(filter), filter.Bucket, filter.Location.String())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		var bucket models.StatsBucket
+
+		if err := rows.Scan(&start, &bucket.Clicks); err != nil {
+			return nil, err
+		}
+
+		bucket.Start = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, filter.Location)
+		stats.TimeSeries = append(stats.TimeSeries, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats.TopReferrers, err = pg.selectClickCounts(ctx, `COALESCE(NULLIF(referrer_host, ''), '`+directReferrer+`')`, filter, filter.TopLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.UserAgents, err = pg.selectClickCounts(ctx, "ua_family", filter, filter.TopLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Variants, err = pg.selectClickCounts(ctx, "NULLIF(variant_id, '')", filter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// collectionClicksEvents - выборка переходов по урлам коллекции для статистики, как в clicksStatsEvents.
+// Параметры: $1 - коллекция, $2 и $3 - границы периода, $4 - гранулярность агрегатов, $5 - учитывать ли ботов.
+const collectionClicksEvents = `WITH rolled AS (
+		SELECT COALESCE((SELECT rolled_up_to FROM click_rollup_state WHERE granularity = $4), '-infinity'::timestamptz) AS rolled_up_to
+	), collection_urls AS (
+		SELECT short_url FROM urls WHERE collection_id = $1
+	), events AS (
+		SELECT r.short_url, r.bucket_start AS ts, r.is_bot, r.clicks
+		FROM click_rollups r, rolled
+		WHERE r.granularity = $4 AND r.short_url IN (SELECT short_url FROM collection_urls)
+			AND r.bucket_start >= $2 AND r.bucket_start < LEAST($3, rolled.rolled_up_to)
+		UNION ALL
+		SELECT c.short_url, c.clicked_at, c.is_bot, 1
+		FROM clicks c, rolled
+		WHERE c.short_url IN (SELECT short_url FROM collection_urls)
+			AND c.clicked_at >= GREATEST($2, rolled.rolled_up_to) AND c.clicked_at < $3
+	)
+	`
+
+// SelectCollectionClickStats - считает суммарную статистику переходов по урлам коллекции, включая удаленные, в бд
+// одним запросом: переходы группируются по урлу и интервалу временного ряда, урлы без переходов тоже попадают в ответ.
+func (pg *DBStorage) SelectCollectionClickStats(ctx context.Context, collectionID int64, filter models.ClickStatsFilter) (*models.CollectionStatsResponse, error) {
+	query := collectionClicksEvents + `SELECT u.short_url, date_trunc($6, e.ts AT TIME ZONE $7) AS bucket,
+		COALESCE(SUM(e.clicks) FILTER (WHERE $5 OR NOT e.is_bot), 0)::bigint,
+		COALESCE(SUM(e.clicks) FILTER (WHERE e.is_bot), 0)::bigint
+		FROM collection_urls u LEFT JOIN events e ON e.short_url = u.short_url
+		GROUP BY u.short_url, bucket`
+
+	rows, err := pg.db.QueryContext(ctx, query, collectionID, filter.From, filter.To, filter.Rollup, filter.IncludeBots,
+		filter.Bucket, filter.Location.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats models.CollectionStatsResponse
+	urlClicks := make(map[string]int64)
+	series := make(map[time.Time]int64)
+	for rows.Next() {
+		var shortURL string
+		var start sql.NullTime
+		var clicks, botClicks int64
+
+		if err := rows.Scan(&shortURL, &start, &clicks, &botClicks); err != nil {
+			return nil, err
+		}
+
+		stats.TotalClicks += clicks
+		stats.BotClicks += botClicks
+		urlClicks[shortURL] += clicks
+		if start.Valid && clicks > 0 {
+			t := start.Time
+			series[time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, filter.Location)] += clicks
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for start, clicks := range series {
+		stats.TimeSeries = append(stats.TimeSeries, models.StatsBucket{Start: start, Clicks: clicks})
+	}
+	sort.Slice(stats.TimeSeries, func(i, j int) bool { return stats.TimeSeries[i].Start.Before(stats.TimeSeries[j].Start) })
+	stats.URLs = topCounts(urlClicks, 0)
+
+	return &stats, nil
+}
+
+// selectClickCounts - считает переходы в разрезе выражения dimension, limit 0 - без ограничения.
+func (pg *DBStorage) selectClickCounts(ctx context.Context, dimension string, filter models.ClickStatsFilter, limit int) ([]models.StatsCount, error) {
+	var counts []models.StatsCount
+
+	query := clicksStatsEvents + `SELECT ` + dimension + ` AS name, SUM(clicks)::bigint AS total
+		FROM events WHERE ($5 OR NOT is_bot) AND ` + dimension + ` IS NOT NULL
+		GROUP BY name ORDER BY total DESC, name`
+	args := clicksStatsArgs(filter)
+	if limit > 0 {
+		query += ` LIMIT $6`
+		args = append(args, limit)
+	}
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var count models.StatsCount
+
+		if err := rows.Scan(&count.Name, &count.Clicks); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// RollupClicks - досчитывает часовые агрегаты по сырым событиям, дневные по часовым
+// и удаляет устаревшие события, агрегаты и скетчи в одной транзакции.
+// Строки click_rollup_state блокируются, поэтому параллельные запуски на нескольких инстансах выполняются по очереди.
+func (pg *DBStorage) RollupClicks(ctx context.Context, policy models.ClicksRollupPolicy) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hourlyQuery := `INSERT INTO click_rollups (granularity, bucket_start, short_url, is_bot, referrer_host, ua_family, variant_id, clicks)
+		SELECT 'hour', date_trunc('hour', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', short_url, is_bot, referrer_host, ua_family, variant_id, COUNT(*)
+		FROM clicks WHERE clicked_at >= $1 AND clicked_at < $2
+		GROUP BY 2, 3, 4, 5, 6, 7
+		ON CONFLICT (granularity, short_url, bucket_start, is_bot, referrer_host, ua_family, variant_id)
+		DO UPDATE SET clicks = click_rollups.clicks + EXCLUDED.clicks`
+
+	hourlyTo, err := advanceRollup(ctx, tx, models.StatsBucketHour, rollupStart(policy.Now.Add(-rollupLag), models.StatsBucketHour), hourlyQuery)
+	if err != nil {
+		return err
+	}
+
+	dailyQuery := `INSERT INTO click_rollups (granularity, bucket_start, short_url, is_bot, referrer_host, ua_family, variant_id, clicks)
+		SELECT 'day', date_trunc('day', bucket_start AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', short_url, is_bot, referrer_host, ua_family, variant_id, SUM(clicks)
+		FROM click_rollups WHERE granularity = 'hour' AND bucket_start >= $1 AND bucket_start < $2
+		GROUP BY 2, 3, 4, 5, 6, 7
+		ON CONFLICT (granularity, short_url, bucket_start, is_bot, referrer_host, ua_family, variant_id)
+		DO UPDATE SET clicks = click_rollups.clicks + EXCLUDED.clicks`
+
+	dailyTo, err := advanceRollup(ctx, tx, models.StatsBucketDay, rollupStart(hourlyTo, models.StatsBucketDay), dailyQuery)
+	if err != nil {
+		return err
+	}
+
+	if policy.RawRetention > 0 {
+		cutoff := earliest(policy.Now.Add(-policy.RawRetention), hourlyTo)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM clicks WHERE clicked_at < $1`, cutoff); err != nil {
+			return err
+		}
+	}
+
+	if policy.HourlyRetention > 0 {
+		cutoff := earliest(policy.Now.Add(-policy.HourlyRetention), dailyTo)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM click_rollups WHERE granularity = 'hour' AND bucket_start < $1`, cutoff); err != nil {
+			return err
+		}
+	}
+
+	if policy.DailyRetention > 0 {
+		cutoff := policy.Now.Add(-policy.DailyRetention)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM click_rollups WHERE granularity = 'day' AND bucket_start < $1`, cutoff); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM click_sketches WHERE day < $1`, sketchDay(cutoff)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// advanceRollup - досчитывает агрегаты гранулярности granularity запросом query с момента последней агрегации до to
+// и возвращает новый момент последней агрегации. Параметры query: $1 и $2 - границы досчитываемого периода.
+func advanceRollup(ctx context.Context, tx *sql.Tx, granularity string, to time.Time, query string) (time.Time, error) {
+	var from time.Time
+
+	row := tx.QueryRowContext(ctx, `SELECT rolled_up_to FROM click_rollup_state WHERE granularity = $1 FOR UPDATE`, granularity)
+	if err := row.Scan(&from); err != nil {
+		return time.Time{}, err
+	}
+
+	if !to.After(from) {
+		return from, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, query, from, to); err != nil {
+		return time.Time{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE click_rollup_state SET rolled_up_to = $2 WHERE granularity = $1`, granularity, to); err != nil {
+		return time.Time{}, err
+	}
+
+	return to, nil
+}
+
+// marshalRedirectOptions - раскладывает настройки редиректа по колонкам таблицы urls.
+func marshalRedirectOptions(opts *models.RedirectOptions) (string, []byte, error) {
+	if opts == nil {
+		return models.QueryPolicyDrop, nil, nil
+	}
+	if len(opts.UTM) == 0 {
+		return opts.QueryPolicy, nil, nil
+	}
+
+	utmParams, err := json.Marshal(opts.UTM)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return opts.QueryPolicy, utmParams, nil
+}
+
+// unmarshalRedirectOptions - собирает настройки редиректа из колонок таблицы urls.
+func unmarshalRedirectOptions(queryPolicy string, utmParams []byte) (*models.RedirectOptions, error) {
+	if queryPolicy == models.QueryPolicyDrop && len(utmParams) == 0 {
+		return nil, nil
+	}
+
+	opts := models.RedirectOptions{QueryPolicy: queryPolicy}
+	if len(utmParams) != 0 {
+		if err := json.Unmarshal(utmParams, &opts.UTM); err != nil {
+			return nil, err
+		}
+	}
+
+	return &opts, nil
+}
+
+// insertURLVariants - вставляет варианты назначения урла в рамках транзакции.
+func insertURLVariants(ctx context.Context, tx *sql.Tx, data *models.URLsData) error {
+	query := `INSERT INTO url_variants (short_url, variant_id, original_url, weight) VALUES ($1, $2, $3, $4);`
+
+	for _, v := range data.Variants {
+		if _, err := tx.ExecContext(ctx, query, data.ShortURL, v.ID, v.OriginalURL, v.Weight); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// userURLsSortColumns - колонки сортировки урлов пользователя в бд.
+var userURLsSortColumns = map[string]string{
+	models.URLSortCreatedAt:   "created_at",
+	models.URLSortTitle:       "title",
+	models.URLSortOriginalURL: "original_url",
+}
+
+// SelectURLs - возвращает из бд страницу урлов пользователя или рабочего пространства, подходящих под фильтр,
+// в порядке сортировки фильтра.
+// Страница выбирается по ключу сортировки и короткому урлу после курсора фильтра.
+func (pg *DBStorage) SelectURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	page := &models.UserURLsPage{}
+
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := []string{"workspace_id = " + arg(filter.WorkspaceID)}
+	if filter.WorkspaceID == 0 {
+		conditions = append(conditions, "user_id = "+arg(filter.UserID))
+	}
+	if filter.CollectionID != 0 {
+		conditions = append(conditions, "collection_id = "+arg(filter.CollectionID))
+	}
+	if filter.Query != "" {
+		pattern := arg("%" + escapeLike(strings.ToLower(filter.Query)) + "%")
+		conditions = append(conditions, "(lower(original_url) LIKE "+pattern+" OR lower(title) LIKE "+pattern+")")
+	}
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM url_tags WHERE url_tags.short_url = urls.short_url AND url_tags.tag = "+arg(tag)+")")
+	}
+	if filter.Domain != "" {
+		domain := arg(filter.Domain)
+		conditions = append(conditions, "(domain = "+domain+" OR domain LIKE '%.' || "+arg(escapeLike(filter.Domain))+")")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.CreatedTo))
+	}
+	switch filter.State {
+	case models.URLStateActive:
+		conditions = append(conditions, "is_deleted = FALSE")
+	case models.URLStateDeleted:
+		conditions = append(conditions, "is_deleted = TRUE")
+	}
+
+	sortColumn, ok := userURLsSortColumns[filter.SortBy]
+	if !ok {
+		sortColumn = userURLsSortColumns[models.URLSortCreatedAt]
+	}
+	direction, comparison := "ASC", ">"
+	if filter.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		var key any = filter.After.Key
+		if sortColumn == userURLsSortColumns[models.URLSortCreatedAt] {
+			key = filter.After.CreatedAt
+		}
+		conditions = append(conditions, "("+sortColumn+", short_url) "+comparison+" ("+arg(key)+", "+arg(filter.After.ShortURL)+")")
+	}
+
+	query := `SELECT short_url, original_url, title, description, ` + urlTagsColumn + `, collection_id, created_at, is_deleted, deleted_at, expires_at,
+		health_status, health_error, health_broken, health_checked_at
+		FROM urls WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + sortColumn + ` ` + direction + `, short_url ` + direction
+	if filter.Limit > 0 {
+		query += ` LIMIT ` + arg(filter.Limit+1)
+	}
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var last models.URLsData
+	for rows.Next() {
+		var shortURL, tags string
+		var item models.GetUserURLsResponse
+		var deletedAt, expiresAt sql.NullTime
+		var health dbURLHealth
+
+		if filter.Limit > 0 && len(page.URLs) == filter.Limit {
+			page.Next = userURLsCursor(&last, filter)
+			break
+		}
+
+		err := rows.Scan(
+			&shortURL,
+			&item.OriginalURL,
+			&item.Title,
+			&item.Description,
+			&tags,
+			&item.CollectionID,
+			&item.CreatedAt,
+			&item.Deleted,
+			&deletedAt,
+			&expiresAt,
+			&health.status,
+			&health.error,
+			&health.broken,
+			&health.checkedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		item.ShortURL = fmt.Sprintf("%s/%s", pg.baseURL, shortURL)
+		item.Tags = splitURLTags(tags)
+		item.Health = health.toModel()
+		if deletedAt.Valid {
+			item.DeletedAt = &deletedAt.Time
+		}
+		if expiresAt.Valid {
+			item.ExpiresAt = &expiresAt.Time
+		}
+
+		last = models.URLsData{ShortURL: shortURL, OriginalURL: item.OriginalURL, Title: item.Title, CreatedAt: item.CreatedAt}
+		page.URLs = append(page.URLs, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// dbURLHealth - колонки результата проверки адреса назначения в таблице urls.
+type dbURLHealth struct {
+	status    sql.NullInt64
+	error     string
+	broken    bool
+	checkedAt sql.NullTime
+}
+
+// toModel - возвращает результат проверки или nil, если урл еще не проверялся.
+func (h dbURLHealth) toModel() *models.URLHealth {
+	if !h.checkedAt.Valid {
+		return nil
+	}
+	return &models.URLHealth{Status: int(h.status.Int64), Error: h.error, Broken: h.broken, CheckedAt: h.checkedAt.Time}
+}
+
+// SelectURLsForHealthCheck - возвращает неудаленные урлы, которые не проверялись с checkedBefore,
+// начиная с давно не проверенных.
+func (pg *DBStorage) SelectURLsForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]models.URLsData, error) {
+	var data []models.URLsData
+
+	query := `SELECT short_url, original_url, user_id, health_status, health_error, health_broken, health_checked_at
+		FROM urls WHERE is_deleted = FALSE AND (health_checked_at IS NULL OR health_checked_at < $1)
+		ORDER BY health_checked_at NULLS FIRST LIMIT $2`
+
+	rows, err := pg.db.QueryContext(ctx, query, checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.URLsData
+		var userID sql.NullString
+		var health dbURLHealth
+
+		err := rows.Scan(&d.ShortURL, &d.OriginalURL, &userID, &health.status, &health.error, &health.broken, &health.checkedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.UserID = userID.String
+		d.Health = health.toModel()
+
+		data = append(data, d)
+	}
+
+	return data, rows.Err()
+}
+
+// UpdateURLHealth - сохраняет результат проверки адреса назначения урла в бд.
+func (pg *DBStorage) UpdateURLHealth(ctx context.Context, shortURL string, health models.URLHealth) error {
+	query := `UPDATE urls SET health_status = $2, health_error = $3, health_broken = $4, health_checked_at = $5 WHERE short_url = $1`
+
+	_, err := pg.db.ExecContext(ctx, query, shortURL, health.Status, health.Error, health.Broken, health.CheckedAt)
+	return err
+}
+
+// createdAt - возвращает время создания урла, а если оно не задано - текущее время.
+func createdAt(data *models.URLsData) time.Time {
+	if data.CreatedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return data.CreatedAt
+}
+
+// urlTagsColumn - выражение выборки тегов урла строкой через запятую, теги не содержат запятых.
+const urlTagsColumn = `COALESCE((SELECT string_agg(tag, ',' ORDER BY tag) FROM url_tags WHERE url_tags.short_url = urls.short_url), '')`
+
+// splitURLTags - разбирает теги, выбранные выражением urlTagsColumn.
+func splitURLTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// insertURLTags - вставляет теги урла в рамках транзакции.
+func insertURLTags(ctx context.Context, tx *sql.Tx, shortURL string, tags []string) error {
+	query := `INSERT INTO url_tags (short_url, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, query, shortURL, tag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateURLMetadata - заменяет название, описание и теги урла в бд.
+func (pg *DBStorage) UpdateURLMetadata(ctx context.Context, shortURL string, metadata models.URLMetadata) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE urls SET title = $2, description = $3 WHERE short_url = $1`,
+		shortURL, metadata.Title, metadata.Description)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_tags WHERE short_url = $1`, shortURL); err != nil {
+		return err
+	}
+	if err := insertURLTags(ctx, tx, shortURL, metadata.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateURLTakedown - блокирует урл модератором или снимает блокировку, если takedown равен nil.
+func (pg *DBStorage) UpdateURLTakedown(ctx context.Context, shortURL string, takedown *models.URLTakedown) error {
+	var reason string
+	var at sql.NullTime
+	if takedown != nil {
+		reason = takedown.Reason
+		at = sql.NullTime{Time: takedown.At, Valid: true}
+	}
+
+	query := `UPDATE urls SET takedown_reason = $2, taken_down_at = $3 WHERE short_url = $1`
+
+	result, err := pg.db.ExecContext(ctx, query, shortURL, reason, at)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// InsertAbuseReport - вставляет в бд жалобу на короткий урл и проставляет ей идентификатор.
+// Повторная открытая жалоба с того же IP на тот же урл не вставляется, в report возвращается уже открытая.
+func (pg *DBStorage) InsertAbuseReport(ctx context.Context, report *models.AbuseReport) error {
+	query := `INSERT INTO abuse_reports (short_url, reason, comment, reporter_ip_hash, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (short_url, reporter_ip_hash) WHERE status = 'open' AND reporter_ip_hash <> '' DO NOTHING
+		RETURNING id`
+
+	row := pg.db.QueryRowContext(ctx, query, report.ShortURL, report.Reason, report.Comment, report.ReporterIPHash, report.Status, report.CreatedAt)
+
+	err := row.Scan(&report.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	query = `SELECT ` + abuseReportColumns + ` FROM abuse_reports
+		WHERE short_url = $1 AND reporter_ip_hash = $2 AND status = 'open'`
+
+	open, err := scanAbuseReport(pg.db.QueryRowContext(ctx, query, report.ShortURL, report.ReporterIPHash))
+	if err != nil {
+		return err
+	}
+	*report = *open
+	return nil
+}
+
+// abuseReportColumns - колонки таблицы abuse_reports в порядке scanAbuseReport.
+const abuseReportColumns = `id, short_url, reason, comment, reporter_ip_hash, status, created_at, resolved_at, resolution_note`
+
+// scanAbuseReport - читает жалобу из строки выборки abuseReportColumns.
+func scanAbuseReport(row interface{ Scan(...any) error }) (*models.AbuseReport, error) {
+	var r models.AbuseReport
+	var resolvedAt sql.NullTime
+
+	err := row.Scan(&r.ID, &r.ShortURL, &r.Reason, &r.Comment, &r.ReporterIPHash, &r.Status, &r.CreatedAt, &resolvedAt, &r.ResolutionNote)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		r.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &r, nil
+}
+
+// SelectAbuseReports - возвращает страницу жалоб из бд в порядке идентификаторов.
+func (pg *DBStorage) SelectAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error) {
+	var page []models.AbuseReport
+
+	query := `SELECT ` + abuseReportColumns + ` FROM abuse_reports
+		WHERE id > $1 AND ($2 = '' OR status = $2) AND ($3 = '' OR short_url = $3)
+		ORDER BY id LIMIT $4`
+
+	rows, err := pg.db.QueryContext(ctx, query, filter.AfterID, filter.Status, filter.ShortURL, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanAbuseReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, *r)
+	}
+
+	return page, rows.Err()
+}
+
+// SelectAbuseReport - возвращает жалобу по идентификатору из бд.
+func (pg *DBStorage) SelectAbuseReport(ctx context.Context, id int64) (*models.AbuseReport, error) {
+	query := `SELECT ` + abuseReportColumns + ` FROM abuse_reports WHERE id = $1`
+
+	r, err := scanAbuseReport(pg.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// ResolveAbuseReports - переводит открытые жалобы в бд в статус решения.
+// Если жалоба ReportID уже не открыта, возвращает ErrConflict.
+func (pg *DBStorage) ResolveAbuseReports(ctx context.Context, resolution models.AbuseReportResolution) error {
+	query := `UPDATE abuse_reports SET status = $1, resolution_note = $2, resolved_at = $3
+		WHERE status = 'open' AND (($4::bigint <> 0 AND id = $4) OR ($4::bigint = 0 AND short_url = $5))`
+
+	result, err := pg.db.ExecContext(ctx, query, resolution.Status, resolution.Note, resolution.ResolvedAt, resolution.ReportID, resolution.ShortURL)
+	if err != nil {
+		return err
+	}
+	if resolution.ReportID == 0 {
+		return nil
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// SelectExistingShortURLs - возвращает те из коротких урлов, которые уже есть в бд.
+func (pg *DBStorage) SelectExistingShortURLs(ctx context.Context, shortURLs []string) ([]string, error) {
+	var existing []string
+
+	rows, err := pg.db.QueryContext(ctx, `SELECT short_url FROM urls WHERE short_url = ANY($1)`, shortURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortURL string
+		if err := rows.Scan(&shortURL); err != nil {
+			return nil, err
+		}
+		existing = append(existing, shortURL)
+	}
+
+	return existing, rows.Err()
+}
+
+// InsertJob - сохраняет в бд фоновую задачу и проставляет ей идентификатор.
+func (pg *DBStorage) InsertJob(ctx context.Context, job *models.Job) error {
+	query := `INSERT INTO jobs (user_id, kind, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+
+	row := pg.db.QueryRowContext(ctx, query, job.UserID, job.Kind, job.Status, job.CreatedAt, job.UpdatedAt)
+	if err := row.Scan(&job.ID); err != nil {
+		return err
+	}
+
+	return pg.UpdateJob(ctx, job)
+}
+
+// UpdateJob - заменяет состояние фоновой задачи в бд.
+func (pg *DBStorage) UpdateJob(ctx context.Context, job *models.Job) error {
+	return updateJob(ctx, pg.db, job)
+}
+
+// updateJob - заменяет состояние фоновой задачи в бд или в транзакции.
+func updateJob(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, job *models.Job) error {
+	lineErrors, err := json.Marshal(job.Errors)
+	if err != nil {
+		return err
+	}
+
+	urls, err := json.Marshal(job.URLs)
+	if err != nil {
+		return err
+	}
+
+	var erasure []byte
+	if job.Erasure != nil {
+		erasure, err = json.Marshal(job.Erasure)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE jobs SET status = $2, processed = $3, succeeded = $4, failed = $5, errors = $6,
+		errors_truncated = $7, error = $8, updated_at = $9, finished_at = $10, erasure = $11, urls = $12 WHERE id = $1`
+
+	result, err := db.ExecContext(ctx, query, job.ID, job.Status, job.Processed, job.Succeeded, job.Failed,
+		lineErrors, job.ErrorsTruncated, job.Error, job.UpdatedAt, job.FinishedAt, erasure, urls)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// jobColumns - колонки таблицы jobs в порядке, который ожидает scanJob.
+const jobColumns = `id, user_id, kind, status, processed, succeeded, failed, errors, errors_truncated, error,
+	created_at, updated_at, finished_at, erasure, urls`
+
+// scanJob - сканирует строку jobColumns в фоновую задачу.
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
+	var job models.Job
+	var lineErrors, erasure, urls []byte
+	var finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.UserID, &job.Kind, &job.Status, &job.Processed,
+		&job.Succeeded, &job.Failed, &lineErrors, &job.ErrorsTruncated, &job.Error, &job.CreatedAt, &job.UpdatedAt, &finishedAt, &erasure, &urls)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(lineErrors, &job.Errors); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(urls, &job.URLs); err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	if erasure != nil {
+		if err := json.Unmarshal(erasure, &job.Erasure); err != nil {
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// SelectJob - возвращает фоновую задачу по идентификатору из бд.
+func (pg *DBStorage) SelectJob(ctx context.Context, id int64) (*models.Job, error) {
+	return scanJob(pg.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+}
+
+// SelectStaleJobs - возвращает из бд незавершенные фоновые задачи вида kind, не обновлявшиеся с updatedBefore,
+// в порядке идентификаторов.
+func (pg *DBStorage) SelectStaleJobs(ctx context.Context, kind string, updatedBefore time.Time) ([]models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE kind = $1 AND finished_at IS NULL AND updated_at < $2 ORDER BY id`
+
+	rows, err := pg.db.QueryContext(ctx, query, kind, updatedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// ModifyJob - изменяет фоновую задачу функцией modify в транзакции, удерживая блокировку строки задачи,
+// чтобы параллельные изменения с других экземпляров сервиса не терялись. Возвращает новое состояние задачи.
+func (pg *DBStorage) ModifyJob(ctx context.Context, id int64, modify func(job *models.Job)) (*models.Job, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	job, err := scanJob(tx.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	modify(job)
+	job.ID = id
+	if err := updateJob(ctx, tx, job); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// InsertURLTransfer - сохраняет в бд предложение передачи урлов и проставляет ему идентификатор.
+func (pg *DBStorage) InsertURLTransfer(ctx context.Context, transfer *models.URLTransfer) error {
+	shortURLs, err := json.Marshal(transfer.ShortURLs)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO url_transfers (token_hash, from_user_id, short_urls, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	row := pg.db.QueryRowContext(ctx, query, transfer.TokenHash, transfer.FromUserID, shortURLs,
+		transfer.Status, transfer.CreatedAt, transfer.ExpiresAt)
+	return row.Scan(&transfer.ID)
+}
+
+// transferColumns - колонки таблицы url_transfers в порядке, который ожидает scanTransfer.
+const transferColumns = `id, token_hash, from_user_id, to_user_id, short_urls, status,
+	created_at, expires_at, accepted_at, cancelled_at`
+
+// scanTransfer - сканирует строку transferColumns в предложение передачи урлов.
+func scanTransfer(row interface{ Scan(...any) error }) (*models.URLTransfer, error) {
+	var transfer models.URLTransfer
+	var shortURLs []byte
+	var acceptedAt, cancelledAt sql.NullTime
+
+	err := row.Scan(&transfer.ID, &transfer.TokenHash, &transfer.FromUserID, &transfer.ToUserID, &shortURLs,
+		&transfer.Status, &transfer.CreatedAt, &transfer.ExpiresAt, &acceptedAt, &cancelledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(shortURLs, &transfer.ShortURLs); err != nil {
+		return nil, err
+	}
+	if acceptedAt.Valid {
+		transfer.AcceptedAt = &acceptedAt.Time
+	}
+	if cancelledAt.Valid {
+		transfer.CancelledAt = &cancelledAt.Time
+	}
+
+	return &transfer, nil
+}
+
+// SelectURLTransfer - возвращает предложение передачи урлов по идентификатору из бд.
+func (pg *DBStorage) SelectURLTransfer(ctx context.Context, id int64) (*models.URLTransfer, error) {
+	return scanTransfer(pg.db.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM url_transfers WHERE id = $1`, id))
+}
+
+// SelectURLTransferByTokenHash - возвращает предложение передачи урлов по хешу токена из бд.
+func (pg *DBStorage) SelectURLTransferByTokenHash(ctx context.Context, tokenHash string) (*models.URLTransfer, error) {
+	return scanTransfer(pg.db.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM url_transfers WHERE token_hash = $1`, tokenHash))
+}
+
+// CancelURLTransfer - отменяет ожидающее предложение передачи урлов в бд, для остальных возвращает ErrConflict.
+func (pg *DBStorage) CancelURLTransfer(ctx context.Context, id int64, cancelledAt time.Time) error {
+	query := `UPDATE url_transfers SET status = $2, cancelled_at = $3 WHERE id = $1 AND status = $4`
+
+	result, err := pg.db.ExecContext(ctx, query, id, models.URLTransferCancelled, cancelledAt, models.URLTransferPending)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	if _, err := pg.SelectURLTransfer(ctx, id); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+// AcceptURLTransfer - принимает предложение передачи в одной транзакции: урлы переходят к toUserID,
+// по каждому урлу пишется запись журнала смены владельца. Если предложение не ожидает принятия, истекло
+// или хотя бы один урл удален или больше не принадлежит владельцу, транзакция откатывается и возвращается ErrConflict.
+func (pg *DBStorage) AcceptURLTransfer(ctx context.Context, id int64, toUserID string, acceptedAt time.Time) (*models.URLTransfer, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := scanTransfer(tx.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM url_transfers WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return nil, err
+	}
+	if transfer.Status != models.URLTransferPending || !acceptedAt.Before(transfer.ExpiresAt) {
+		return nil, ErrConflict
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE urls SET user_id = $1, collection_id = 0
+		WHERE short_url = ANY($2) AND user_id = $3 AND workspace_id = 0 AND is_deleted = FALSE`, toUserID, transfer.ShortURLs, transfer.FromUserID)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected != int64(len(transfer.ShortURLs)) {
+		return nil, ErrConflict
+	}
+
+	query := `INSERT INTO url_ownership_audit (short_url, transfer_id, from_user_id, to_user_id, transferred_at)
+		SELECT short_url, $2, $3, $4, $5 FROM unnest($1::text[]) AS short_url`
+	if _, err := tx.ExecContext(ctx, query, transfer.ShortURLs, id, transfer.FromUserID, toUserID, acceptedAt); err != nil {
+		return nil, err
+	}
+
+	query = `UPDATE url_transfers SET status = $2, to_user_id = $3, accepted_at = $4 WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, id, models.URLTransferAccepted, toUserID, acceptedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	transfer.Status = models.URLTransferAccepted
+	transfer.ToUserID = toUserID
+	transfer.AcceptedAt = &acceptedAt
+	return transfer, nil
+}
+
+// SelectURLOwnershipAudit - возвращает журнал смены владельцев урла из бд в хронологическом порядке.
+func (pg *DBStorage) SelectURLOwnershipAudit(ctx context.Context, shortURL string) ([]models.URLOwnershipAudit, error) {
+	query := `SELECT short_url, transfer_id, from_user_id, to_user_id, transferred_at
+		FROM url_ownership_audit WHERE short_url = $1 ORDER BY id`
+
+	rows, err := pg.db.QueryContext(ctx, query, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var audit []models.URLOwnershipAudit
+	for rows.Next() {
+		var a models.URLOwnershipAudit
+		if err := rows.Scan(&a.ShortURL, &a.TransferID, &a.FromUserID, &a.ToUserID, &a.TransferredAt); err != nil {
+			return nil, err
+		}
+		audit = append(audit, a)
+	}
+	return audit, rows.Err()
+}
+
+// InsertWorkspace - сохраняет в бд рабочее пространство, проставляет ему идентификатор
+// и добавляет создателя владельцем.
+func (pg *DBStorage) InsertWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO workspaces (name, created_by, created_at) VALUES ($1, $2, $3) RETURNING id`
+	if err := tx.QueryRowContext(ctx, query, workspace.Name, workspace.CreatedBy, workspace.CreatedAt).Scan(&workspace.ID); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO workspace_members (workspace_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, workspace.ID, workspace.CreatedBy, models.WorkspaceRoleOwner, workspace.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	workspace.Role = models.WorkspaceRoleOwner
+	return nil
+}
+
+// SelectWorkspace - возвращает рабочее пространство по идентификатору из бд.
+func (pg *DBStorage) SelectWorkspace(ctx context.Context, id int64) (*models.Workspace, error) {
+	var workspace models.Workspace
+
+	query := `SELECT id, name, created_by, created_at FROM workspaces WHERE id = $1`
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(&workspace.ID, &workspace.Name, &workspace.CreatedBy, &workspace.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// SelectUserWorkspaces - возвращает из бд рабочие пространства, в которых состоит пользователь,
+// с его ролью в порядке идентификаторов.
+func (pg *DBStorage) SelectUserWorkspaces(ctx context.Context, userID string) ([]models.Workspace, error) {
+	query := `SELECT w.id, w.name, w.created_by, w.created_at, m.role
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1 ORDER BY w.id`
+
+	rows, err := pg.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []models.Workspace
+	for rows.Next() {
+		var w models.Workspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.CreatedBy, &w.CreatedAt, &w.Role); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+	return workspaces, rows.Err()
+}
+
+// workspaceMemberColumns - колонки таблицы workspace_members в порядке, который ожидает scanWorkspaceMember.
+const workspaceMemberColumns = `workspace_id, user_id, role, joined_at`
+
+// scanWorkspaceMember - сканирует строку workspaceMemberColumns в участника рабочего пространства.
+func scanWorkspaceMember(row interface{ Scan(...any) error }) (*models.WorkspaceMember, error) {
+	var member models.WorkspaceMember
+
+	err := row.Scan(&member.WorkspaceID, &member.UserID, &member.Role, &member.JoinedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// SelectWorkspaceMember - возвращает участника рабочего пространства из бд.
+func (pg *DBStorage) SelectWorkspaceMember(ctx context.Context, workspaceID int64, userID string) (*models.WorkspaceMember, error) {
+	query := `SELECT ` + workspaceMemberColumns + ` FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`
+	return scanWorkspaceMember(pg.db.QueryRowContext(ctx, query, workspaceID, userID))
+}
+
+// SelectWorkspaceMembers - возвращает участников рабочего пространства из бд в порядке вступления.
+func (pg *DBStorage) SelectWorkspaceMembers(ctx context.Context, workspaceID int64) ([]models.WorkspaceMember, error) {
+	query := `SELECT ` + workspaceMemberColumns + ` FROM workspace_members WHERE workspace_id = $1 ORDER BY joined_at, user_id`
+
+	rows, err := pg.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.WorkspaceMember{}
+	for rows.Next() {
+		member, err := scanWorkspaceMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+	return members, rows.Err()
+}
+
+// lockWorkspaceMember - блокирует в транзакции участников рабочего пространства, возвращает участника userID
+// и признак того, что он последний владелец пространства.
+func lockWorkspaceMember(ctx context.Context, tx *sql.Tx, workspaceID int64, userID string) (*models.WorkspaceMember, bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+workspaceMemberColumns+` FROM workspace_members WHERE workspace_id = $1 FOR UPDATE`, workspaceID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var found *models.WorkspaceMember
+	owners := 0
+	for rows.Next() {
+		member, err := scanWorkspaceMember(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		if member.Role == models.WorkspaceRoleOwner {
+			owners++
+		}
+		if member.UserID == userID {
+			found = member
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if found == nil {
+		return nil, false, ErrNotFound
+	}
+	return found, found.Role == models.WorkspaceRoleOwner && owners <= 1, nil
+}
+
+// UpdateWorkspaceMemberRole - меняет роль участника рабочего пространства в бд.
+// Если у пространства не останется владельца, возвращает ErrConflict.
+func (pg *DBStorage) UpdateWorkspaceMemberRole(ctx context.Context, workspaceID int64, userID string, role string) (*models.WorkspaceMember, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	member, lastOwner, err := lockWorkspaceMember(ctx, tx, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if lastOwner && role != models.WorkspaceRoleOwner {
+		return nil, ErrConflict
+	}
+
+	query := `UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`
+	if _, err := tx.ExecContext(ctx, query, workspaceID, userID, role); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	return member, nil
+}
+
+// DeleteWorkspaceMember - исключает участника из рабочего пространства в бд.
+// Последнего владельца пространства исключить нельзя, для него возвращается ErrConflict.
+func (pg *DBStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID int64, userID string) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, lastOwner, err := lockWorkspaceMember(ctx, tx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if lastOwner {
+		return ErrConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`, workspaceID, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertWorkspaceInvite - сохраняет в бд приглашение в рабочее пространство и проставляет ему идентификатор.
+func (pg *DBStorage) InsertWorkspaceInvite(ctx context.Context, invite *models.WorkspaceInvite) error {
+	query := `INSERT INTO workspace_invites (workspace_id, role, token_hash, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	row := pg.db.QueryRowContext(ctx, query, invite.WorkspaceID, invite.Role, invite.TokenHash,
+		invite.CreatedBy, invite.CreatedAt, invite.ExpiresAt)
+	return row.Scan(&invite.ID)
+}
+
+// AcceptWorkspaceInvite - принимает приглашение в рабочее пространство по хешу токена в одной транзакции
+// и добавляет userID участником с ролью из приглашения. Для неизвестного токена возвращает ErrNotFound,
+// для принятого или истекшего приглашения, а также если пользователь уже состоит в пространстве, - ErrConflict.
+func (pg *DBStorage) AcceptWorkspaceInvite(ctx context.Context, tokenHash string, userID string, acceptedAt time.Time) (*models.WorkspaceMember, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var inviteID int64
+	var expiresAt time.Time
+	var acceptedBefore sql.NullTime
+	member := models.WorkspaceMember{UserID: userID, JoinedAt: acceptedAt}
+
+	query := `SELECT id, workspace_id, role, expires_at, accepted_at FROM workspace_invites WHERE token_hash = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, tokenHash).Scan(&inviteID, &member.WorkspaceID, &member.Role, &expiresAt, &acceptedBefore)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if acceptedBefore.Valid || !acceptedAt.Before(expiresAt) {
+		return nil, ErrConflict
+	}
+
+	query = `INSERT INTO workspace_members (workspace_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, user_id) DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, member.WorkspaceID, userID, member.Role, acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrConflict
+	}
+
+	query = `UPDATE workspace_invites SET accepted_by = $2, accepted_at = $3 WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, inviteID, userID, acceptedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// collectionColumns - колонки таблицы collections в порядке, который ожидает scanCollection.
+const collectionColumns = `id, user_id, name, created_at, updated_at`
+
+// scanCollection - сканирует строку collectionColumns в коллекцию урлов.
+func scanCollection(row interface{ Scan(...any) error }) (*models.Collection, error) {
+	var collection models.Collection
+	err := row.Scan(&collection.ID, &collection.UserID, &collection.Name, &collection.CreatedAt, &collection.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// isUniqueViolation - проверяет, что запрос нарушил ограничение уникальности.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
+}
+
+// InsertCollection - сохраняет в бд коллекцию урлов и проставляет ей идентификатор.
+// Если у пользователя уже есть коллекция с таким названием, возвращает ErrConflict.
+func (pg *DBStorage) InsertCollection(ctx context.Context, collection *models.Collection) error {
+	query := `INSERT INTO collections (user_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	err := pg.db.QueryRowContext(ctx, query, collection.UserID, collection.Name, collection.CreatedAt, collection.UpdatedAt).Scan(&collection.ID)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// SelectCollection - возвращает коллекцию урлов по идентификатору из бд.
+func (pg *DBStorage) SelectCollection(ctx context.Context, id int64) (*models.Collection, error) {
+	return scanCollection(pg.db.QueryRowContext(ctx, `SELECT `+collectionColumns+` FROM collections WHERE id = $1`, id))
+}
+
+// SelectUserCollections - возвращает из бд коллекции пользователя в порядке названий.
+func (pg *DBStorage) SelectUserCollections(ctx context.Context, userID string) ([]models.Collection, error) {
+	rows, err := pg.db.QueryContext(ctx, `SELECT `+collectionColumns+` FROM collections WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []models.Collection
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, *collection)
+	}
+	return collections, rows.Err()
+}
+
+// UpdateCollection - заменяет название и момент изменения коллекции в бд.
+// Если у пользователя уже есть другая коллекция с таким названием, возвращает ErrConflict.
+func (pg *DBStorage) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	query := `UPDATE collections SET name = $2, updated_at = $3 WHERE id = $1 RETURNING user_id, created_at`
+
+	err := pg.db.QueryRowContext(ctx, query, collection.ID, collection.Name, collection.UpdatedAt).Scan(&collection.UserID, &collection.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// DeleteCollection - удаляет коллекцию из бд, ее урлы остаются у пользователя вне коллекций.
+func (pg *DBStorage) DeleteCollection(ctx context.Context, id int64) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE urls SET collection_id = 0 WHERE collection_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AnyCollection - значение fromCollectionID в MoveURLsToCollection, при котором урлы переносятся из любой коллекции.
+const AnyCollection int64 = -1
+
+// MoveURLsToCollection - переносит личные урлы пользователя из коллекции fromCollectionID в коллекцию collectionID в бд,
+// нулевой collectionID исключает урлы из коллекций. Чужие урлы, урлы рабочих пространств
+// и урлы других коллекций, если fromCollectionID не AnyCollection, не меняются.
+// Коллекция блокируется до конца переноса, чтобы ее не удалили, пока в нее переносятся урлы.
+// Если коллекции нет или она принадлежит другому пользователю, возвращает ErrNotFound.
+func (pg *DBStorage) MoveURLsToCollection(ctx context.Context, userID string, shortURLs []string, fromCollectionID int64, collectionID int64) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if collectionID != 0 {
+		var exist bool
+		query := `SELECT TRUE FROM collections WHERE id = $1 AND user_id = $2 FOR SHARE`
+		err := tx.QueryRowContext(ctx, query, collectionID, userID).Scan(&exist)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE urls SET collection_id = $1
+		WHERE short_url = ANY($2) AND user_id = $3 AND workspace_id = 0 AND ($4 = $5 OR collection_id = $4)`
+	if _, err := tx.ExecContext(ctx, query, collectionID, shortURLs, userID, fromCollectionID, AnyCollection); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EraseUserData - безвозвратно удаляет из бд урлы пользователя, включая удаленные, их варианты и теги,
+// события перехода, скетчи, агрегаты и журнал смены владельцев, а также задачи пользователя, кроме keepJobID,
+// предложения передачи урлов и записи журнала смены владельцев, где пользователь отправитель или получатель,
+// его участие в рабочих пространствах и его коллекции.
+// Урлы рабочих пространств остаются у пространств.
+// Жалобы на урлы остаются у модерации.
+// Если пользователь - последний владелец рабочего пространства, ничего не удаляет и возвращает ErrConflict.
+func (pg *DBStorage) EraseUserData(ctx context.Context, userID string, keepJobID int64) (*models.UserErasure, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotLastWorkspaceOwner(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	shortURLs, err := selectShortURLs(ctx, tx, `SELECT short_url FROM urls WHERE user_id = $1 AND workspace_id = 0 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	erasure := &models.UserErasure{Links: int64(len(shortURLs))}
+	if erasure.Clicks, err = eraseURLs(ctx, tx, shortURLs); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM jobs WHERE user_id = $1 AND id <> $2`, userID, keepJobID)
+	if err != nil {
+		return nil, err
+	}
+	if erasure.Jobs, err = result.RowsAffected(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM deletion_queue WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM deletion_dead_letters WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_ownership_audit WHERE from_user_id = $1 OR to_user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM url_transfers WHERE from_user_id = $1 OR to_user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM workspace_members WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM collections WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return erasure, nil
+}
+
+// checkNotLastWorkspaceOwner - блокирует в транзакции участников рабочих пространств пользователя
+// и возвращает ErrConflict, если он последний владелец какого-либо из них.
+func checkNotLastWorkspaceOwner(ctx context.Context, tx *sql.Tx, userID string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT workspace_id FROM workspace_members WHERE user_id = $1 ORDER BY workspace_id`, userID)
+	if err != nil {
+		return err
+	}
+	var workspaceIDs []int64
+	for rows.Next() {
+		var workspaceID int64
+		if err := rows.Scan(&workspaceID); err != nil {
+			rows.Close()
+			return err
+		}
+		workspaceIDs = append(workspaceIDs, workspaceID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, workspaceID := range workspaceIDs {
+		_, lastOwner, err := lockWorkspaceMember(ctx, tx, workspaceID, userID)
+		if errors.Is(err, ErrNotFound) {
+			// пользователя исключили из пространства после выборки.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if lastOwner {
+			return ErrConflict
+		}
+	}
+	return nil
+}
+
+// PurgeDeletedURLs - безвозвратно удаляет из бд урлы, удаленные раньше deletedBefore, вместе с их аналитикой
+// и возвращает количество удаленных урлов. Урлы, заблокированные другой транзакцией, удаляются при следующей очистке.
+func (pg *DBStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	shortURLs, err := selectShortURLs(ctx, tx, `SELECT short_url FROM urls WHERE is_deleted = TRUE AND deleted_at < $1 FOR UPDATE SKIP LOCKED`, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := eraseURLs(ctx, tx, shortURLs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(shortURLs)), nil
+}
+
+// selectShortURLs - выбирает короткие урлы запросом query в транзакции.
+func selectShortURLs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shortURLs []string
+	for rows.Next() {
+		var shortURL string
+		if err := rows.Scan(&shortURL); err != nil {
+			return nil, err
+		}
+		shortURLs = append(shortURLs, shortURL)
+	}
+	return shortURLs, rows.Err()
+}
+
+// eraseURLs - удаляет в транзакции урлы вместе с вариантами, тегами, событиями перехода, скетчами, агрегатами
+// и журналом смены владельцев, возвращает количество удаленных событий перехода.
+func eraseURLs(ctx context.Context, tx *sql.Tx, shortURLs []string) (int64, error) {
+	if len(shortURLs) == 0 {
+		return 0, nil
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM clicks WHERE short_url = ANY($1)`, shortURLs)
+	if err != nil {
+		return 0, err
+	}
+	clicks, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM click_sketches WHERE short_url = ANY($1)`,
+		`DELETE FROM click_rollups WHERE short_url = ANY($1)`,
+		`DELETE FROM url_ownership_audit WHERE short_url = ANY($1)`,
+		`DELETE FROM urls WHERE short_url = ANY($1)`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, shortURLs); err != nil {
+			return 0, err
+		}
+	}
+
+	return clicks, nil
+}
+
+// RestoreURLs - снимает пометку удаления с удаленных урлов пользователя в бд и возвращает восстановленные урлы.
+func (pg *DBStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	query := `UPDATE urls SET is_deleted = FALSE, deleted_at = NULL
+		WHERE user_id = $1 AND workspace_id = 0 AND short_url = ANY($2) AND is_deleted = TRUE RETURNING short_url`
+
+	rows, err := pg.db.QueryContext(ctx, query, userID, shortURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	restored := []string{}
+	for rows.Next() {
+		var shortURL string
+		if err := rows.Scan(&shortURL); err != nil {
+			return nil, err
+		}
+		restored = append(restored, shortURL)
+	}
+	return restored, rows.Err()
 }
@@ -6,15 +6,56 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/nu-kotov/URLcompressor/internal/app/hll"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
 )
 
 // FileStorage - структура хранилища в файле.
+// Состояние хранится в памяти, каждое изменение урла дописывается в файл,
+// при старте последняя запись по урлу восстанавливает его состояние.
+// События переходов хранятся в соседнем файле с суффиксом _clicks.
+// Дневные скетчи уникальных посетителей сохраняются снимком в файл с суффиксом _sketches при закрытии,
+// переходы после снимка при старте досчитываются по файлу переходов.
+// Агрегаты переходов сохраняются снимком в файл с суффиксом _rollups после каждой агрегации,
+// при удалении устаревших переходов файл переходов перезаписывается.
+// Жалобы на урлы дописываются в файл с суффиксом _reports при создании и при каждом изменении,
+// при чтении действует последняя запись жалобы.
+// Фоновые задачи так же дописываются в файл с суффиксом _jobs.
+// Очередь удаления урлов ведется журналом в файле с суффиксом _deletions: добавление, взятие в обработку,
+// откладывание повтора и подтверждение сообщения дописываются в журнал, когда очередь пустеет, журнал очищается.
+// Сообщения, исчерпавшие попытки обработки, дописываются в файл с суффиксом _dead_letters.
+// Предложения передачи урлов дописываются в файл с суффиксом _transfers при создании и при каждом изменении,
+// журнал смены владельцев урлов - в файл с суффиксом _ownership_audit.
+// Рабочие пространства, состояния их участников и приглашений дописываются журналом в файл с суффиксом _workspaces.
+// Коллекции урлов дописываются в файл с суффиксом _collections при создании и при каждом изменении,
+// коллекция урла хранится в его записи в файле урлов.
+// Счетчики показов вариантов и результаты проверок адресов назначения урлов дописываются в файл
+// с суффиксом _counters без полной записи урла,
+// при старте журнал счетчиков применяется поверх файла урлов и сжимается до последних значений.
+// При безвозвратном удалении урлов файлы урлов, переходов, задач, предложений передачи, журнала
+// смены владельцев, рабочих пространств и коллекций перезаписываются без удаленных записей.
 type FileStorage struct {
-	dataProducer *Producer
-	dataConsumer *Consumer
-	mapCash      map[string]string
+	*MapStorage
+	dataProducer        *Producer
+	dataConsumer        *Consumer
+	clicksProducer      *Producer
+	reportsProducer     *Producer
+	jobsProducer        *Producer
+	deletionsProducer   *Producer
+	deadLettersProducer *Producer
+	transfersProducer   *Producer
+	auditProducer       *Producer
+	workspacesProducer  *Producer
+	collectionsProducer *Producer
+	countersProducer    *Producer
+	clicksFilename      string
+	sketchesFilename    string
+	rollupsFilename     string
 }
 
 // NewFileStorage - конструктор хранилища в файле.
@@ -34,29 +75,1429 @@ func NewFileStorage(filename string, baseURL string) (*FileStorage, error) {
 		return nil, err
 	}
 
-	return &FileStorage{
-		dataProducer: producer,
-		dataConsumer: consumer,
-		mapCash:      cash,
-	}, nil
+	countersFilename := siblingFilename(filename, "counters")
+
+	if err := readURLCounters(countersFilename, cash); err != nil {
+		return nil, err
+	}
+
+	countersProducer, err := newProducer(countersFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	clicksFilename := siblingFilename(filename, "clicks")
+
+	clicks, err := readClicks(clicksFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	clicksProducer, err := newProducer(clicksFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	sketchesFilename := siblingFilename(filename, "sketches")
+
+	sketches, lastClickID, err := readSketchesSnapshot(sketchesFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	rollupsFilename := siblingFilename(filename, "rollups")
+
+	rollups, rolledUpTo, err := readRollupsSnapshot(rollupsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	reportsFilename := siblingFilename(filename, "reports")
+
+	reports, err := readAbuseReports(reportsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	reportsProducer, err := newProducer(reportsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	jobsFilename := siblingFilename(filename, "jobs")
+
+	jobs, jobsSeq, err := readJobs(jobsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	jobsProducer, err := newProducer(jobsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	deletionsFilename := siblingFilename(filename, "deletions")
+
+	deletions, deletionsSeq, err := readDeletions(deletionsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	deletionsProducer, err := newProducer(deletionsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLettersFilename := siblingFilename(filename, "dead_letters")
+
+	deadLetters, err := readDeadLetters(deadLettersFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLettersProducer, err := newProducer(deadLettersFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	transfersFilename := siblingFilename(filename, "transfers")
+
+	transfers, transfersSeq, err := readTransfers(transfersFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	transfersProducer, err := newProducer(transfersFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	auditFilename := siblingFilename(filename, "ownership_audit")
+
+	audit, err := readOwnershipAudit(auditFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	auditProducer, err := newProducer(auditFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionsFilename := siblingFilename(filename, "collections")
+
+	collections, collectionsSeq, err := readCollections(collectionsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	collectionsProducer, err := newProducer(collectionsFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	mapStorage := &MapStorage{
+		mapStorage:     cash,
+		clicks:         clicks,
+		sketches:       sketches,
+		rollups:        rollups,
+		rolledUpTo:     rolledUpTo,
+		reports:        reports,
+		jobs:           jobs,
+		jobsSeq:        jobsSeq,
+		deletions:      deletions,
+		deletionsSeq:   deletionsSeq,
+		deadLetters:    deadLetters,
+		transfers:      transfers,
+		transfersSeq:   transfersSeq,
+		ownershipAudit: audit,
+
+		workspaces:       make(map[int64]*models.Workspace),
+		workspaceMembers: make(map[int64]map[string]*models.WorkspaceMember),
+		workspaceInvites: make(map[int64]*models.WorkspaceInvite),
+		collections:      collections,
+		collectionsSeq:   collectionsSeq,
+	}
+	workspacesFilename := siblingFilename(filename, "workspaces")
+
+	if err := mapStorage.loadWorkspaces(workspacesFilename); err != nil {
+		return nil, err
+	}
+
+	workspacesProducer, err := newProducer(workspacesFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reports) != 0 {
+		mapStorage.reportsSeq = reports[len(reports)-1].ID
+	}
+	for i, c := range clicks {
+		if c.ID > lastClickID {
+			mergeSketches(sketches, groupClicksByDay(clicks[i:]))
+			break
+		}
+	}
+	// последние переходы могли быть удалены вместе с данными пользователя, поэтому
+	// идентификаторы продолжаются не ниже учтенных в снимке скетчей.
+	mapStorage.clicksSeq = lastClickID
+	if len(clicks) != 0 && clicks[len(clicks)-1].ID > lastClickID {
+		mapStorage.clicksSeq = clicks[len(clicks)-1].ID
+	}
+
+	fileStorage := &FileStorage{
+		MapStorage:          mapStorage,
+		dataProducer:        producer,
+		dataConsumer:        consumer,
+		clicksProducer:      clicksProducer,
+		reportsProducer:     reportsProducer,
+		jobsProducer:        jobsProducer,
+		deletionsProducer:   deletionsProducer,
+		deadLettersProducer: deadLettersProducer,
+		transfersProducer:   transfersProducer,
+		auditProducer:       auditProducer,
+		workspacesProducer:  workspacesProducer,
+		collectionsProducer: collectionsProducer,
+		countersProducer:    countersProducer,
+		clicksFilename:      clicksFilename,
+		sketchesFilename:    sketchesFilename,
+		rollupsFilename:     rollupsFilename,
+	}
+	if err := fileStorage.rewriteURLCounters(); err != nil {
+		return nil, err
+	}
+
+	return fileStorage, nil
+}
+
+// sketchesSnapshot - снимок дневных скетчей, учитывающий переходы до LastClickID включительно.
+type sketchesSnapshot struct {
+	LastClickID int64          `json:"last_click_id"`
+	Sketches    []sketchRecord `json:"sketches"`
+}
+
+// sketchRecord - дневной скетч урла в снимке.
+type sketchRecord struct {
+	ShortURL string    `json:"short_url"`
+	Day      time.Time `json:"day"`
+	IsBot    bool      `json:"is_bot,omitempty"`
+	Clicks   int64     `json:"clicks"`
+	Sketch   []byte    `json:"sketch"`
+}
+
+// readSketchesSnapshot - читает снимок дневных скетчей, отсутствие файла не является ошибкой.
+func readSketchesSnapshot(filename string) (map[sketchKey]*dailySketch, int64, error) {
+	sketches := make(map[sketchKey]*dailySketch)
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return sketches, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var snapshot sketchesSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, 0, err
+	}
+
+	for _, r := range snapshot.Sketches {
+		sketch := hll.New()
+		if err := sketch.UnmarshalBinary(r.Sketch); err != nil {
+			return nil, 0, err
+		}
+		sketches[sketchKey{shortURL: r.ShortURL, day: r.Day.UTC(), isBot: r.IsBot}] = &dailySketch{clicks: r.Clicks, sketch: sketch}
+	}
+
+	return sketches, snapshot.LastClickID, nil
+}
+
+// writeSketchesSnapshot - атомарно перезаписывает снимок дневных скетчей.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeSketchesSnapshot() error {
+	snapshot := sketchesSnapshot{LastClickID: f.clicksSeq}
+	for key, daily := range f.sketches {
+		sketch, err := daily.sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		snapshot.Sketches = append(snapshot.Sketches, sketchRecord{ShortURL: key.shortURL, Day: key.day, IsBot: key.isBot, Clicks: daily.clicks, Sketch: sketch})
+	}
+
+	return writeFileAtomic(f.sketchesFilename, snapshot)
+}
+
+// rollupsSnapshot - снимок агрегатов переходов и моментов, до которых они посчитаны.
+type rollupsSnapshot struct {
+	RolledUpTo map[string]time.Time `json:"rolled_up_to"`
+	Rollups    []rollupRecord       `json:"rollups"`
+}
+
+// rollupRecord - агрегат переходов в снимке.
+type rollupRecord struct {
+	Granularity  string    `json:"granularity"`
+	Start        time.Time `json:"start"`
+	ShortURL     string    `json:"short_url"`
+	IsBot        bool      `json:"is_bot,omitempty"`
+	ReferrerHost string    `json:"referrer_host,omitempty"`
+	UAFamily     string    `json:"ua_family,omitempty"`
+	VariantID    string    `json:"variant_id,omitempty"`
+	Clicks       int64     `json:"clicks"`
+}
+
+// readRollupsSnapshot - читает снимок агрегатов переходов, отсутствие файла не является ошибкой.
+func readRollupsSnapshot(filename string) (map[rollupKey]int64, map[string]time.Time, error) {
+	rollups := make(map[rollupKey]int64)
+	rolledUpTo := make(map[string]time.Time)
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return rollups, rolledUpTo, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshot rollupsSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, nil, err
+	}
+
+	for granularity, t := range snapshot.RolledUpTo {
+		rolledUpTo[granularity] = t.UTC()
+	}
+	for _, r := range snapshot.Rollups {
+		key := rollupKey{
+			granularity:  r.Granularity,
+			start:        r.Start.UTC(),
+			shortURL:     r.ShortURL,
+			isBot:        r.IsBot,
+			referrerHost: r.ReferrerHost,
+			uaFamily:     r.UAFamily,
+			variantID:    r.VariantID,
+		}
+		rollups[key] = r.Clicks
+	}
+
+	return rollups, rolledUpTo, nil
+}
+
+// RollupClicks - агрегирует события перехода, сохраняет снимок агрегатов
+// и перезаписывает файл переходов, если устаревшие переходы были удалены.
+// Перед перезаписью сохраняется снимок скетчей, чтобы удаленные переходы не понадобились при старте.
+func (f *FileStorage) RollupClicks(ctx context.Context, policy models.ClicksRollupPolicy) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pruned := f.rollupClicks(policy)
+
+	if err := f.writeRollupsSnapshot(); err != nil {
+		return err
+	}
+
+	if !pruned {
+		return nil
+	}
+
+	if err := f.writeSketchesSnapshot(); err != nil {
+		return err
+	}
+
+	return f.rewriteClicks()
+}
+
+// writeRollupsSnapshot - атомарно перезаписывает снимок агрегатов переходов.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeRollupsSnapshot() error {
+	snapshot := rollupsSnapshot{RolledUpTo: make(map[string]time.Time, len(f.rolledUpTo))}
+	for granularity, t := range f.rolledUpTo {
+		snapshot.RolledUpTo[granularity] = t
+	}
+	for key, clicks := range f.rollups {
+		snapshot.Rollups = append(snapshot.Rollups, rollupRecord{
+			Granularity:  key.granularity,
+			Start:        key.start,
+			ShortURL:     key.shortURL,
+			IsBot:        key.isBot,
+			ReferrerHost: key.referrerHost,
+			UAFamily:     key.uaFamily,
+			VariantID:    key.variantID,
+			Clicks:       clicks,
+		})
+	}
+
+	return writeFileAtomic(f.rollupsFilename, snapshot)
+}
+
+// rewriteClicks - атомарно перезаписывает файл переходов оставшимися в памяти событиями.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteClicks() error {
+	producer, err := rewriteLog(f.clicksFilename, f.clicksProducer, func(p *Producer) error {
+		for i := range f.clicks {
+			if err := p.writeLine(&f.clicks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.clicksProducer = producer
+
+	return nil
+}
+
+// rewriteData - атомарно перезаписывает файл урлов текущими состояниями урлов из памяти,
+// предыдущие записи урлов в файле не сохраняются.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteData() error {
+	producer, err := rewriteLog(f.dataProducer.file.Name(), f.dataProducer, func(p *Producer) error {
+		for _, d := range f.mapStorage {
+			if err := p.WriteEvent(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.dataProducer = producer
+
+	consumer, err := newConsumer(producer.file.Name())
+	if err != nil {
+		return err
+	}
+	f.dataConsumer.Close()
+	f.dataConsumer = consumer
+
+	return nil
+}
+
+// urlCounterRecord - запись журнала счетчиков урлов: текущее число показов варианта урла
+// или результат последней проверки адреса назначения, если задан Health.
+type urlCounterRecord struct {
+	ShortURL  string            `json:"short_url"`
+	VariantID string            `json:"variant_id,omitempty"`
+	Served    int64             `json:"served,omitempty"`
+	Health    *models.URLHealth `json:"health,omitempty"`
+}
+
+// readURLCounters - применяет журнал счетчиков к урлам, прочитанным из файла урлов.
+// Действует последняя запись по варианту и по проверке урла, записи по удаленным урлам и вариантам пропускаются.
+func readURLCounters(filename string, urls map[string]*models.URLsData) error {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	for {
+		var record urlCounterRecord
+		ok, err := consumer.readLine(&record)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		data, exist := urls[record.ShortURL]
+		if !exist {
+			continue
+		}
+		if record.Health != nil {
+			data.Health = record.Health
+			continue
+		}
+		for i := range data.Variants {
+			if data.Variants[i].ID == record.VariantID {
+				data.Variants[i].Served = record.Served
+			}
+		}
+	}
+}
+
+// rewriteURLCounters - атомарно перезаписывает журнал счетчиков текущими значениями счетчиков урлов из памяти.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteURLCounters() error {
+	producer, err := rewriteLog(f.countersProducer.file.Name(), f.countersProducer, func(p *Producer) error {
+		for _, d := range f.mapStorage {
+			if d.Health != nil {
+				if err := p.writeLine(urlCounterRecord{ShortURL: d.ShortURL, Health: d.Health}); err != nil {
+					return err
+				}
+			}
+			for _, v := range d.Variants {
+				if v.Served == 0 {
+					continue
+				}
+				if err := p.writeLine(urlCounterRecord{ShortURL: d.ShortURL, VariantID: v.ID, Served: v.Served}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.countersProducer = producer
+
+	return nil
+}
+
+// rewriteJobs - атомарно перезаписывает файл фоновых задач их текущими состояниями из памяти.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteJobs() error {
+	producer, err := rewriteLog(f.jobsProducer.file.Name(), f.jobsProducer, func(p *Producer) error {
+		for _, job := range f.jobs {
+			if err := p.writeLine(job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.jobsProducer = producer
+
+	return nil
+}
+
+// rewriteLog - записывает файл заново через временный файл, подменяет им исходный
+// и возвращает продюсер, дописывающий в новый файл. Старый продюсер закрывается.
+func rewriteLog(filename string, old *Producer, write func(p *Producer) error) (*Producer, error) {
+	tmpFilename := filename + ".tmp"
+	tmpProducer, err := newProducer(tmpFilename)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpProducer.file.Truncate(0); err != nil {
+		tmpProducer.file.Close()
+		return nil, err
+	}
+
+	if err := write(tmpProducer); err != nil {
+		tmpProducer.file.Close()
+		return nil, err
+	}
+
+	if err := tmpProducer.file.Sync(); err != nil {
+		tmpProducer.file.Close()
+		return nil, err
+	}
+	if err := tmpProducer.file.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return nil, err
+	}
+	if err := old.file.Close(); err != nil {
+		return nil, err
+	}
+
+	return newProducer(filename)
+}
+
+// writeFileAtomic - записывает значение в json через временный файл, чтобы при сбое не остался обрезанный файл.
+func writeFileAtomic(filename string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+// siblingFilename - возвращает имя файла рядом с основным файлом хранилища: urls.json -> urls_clicks.json.
+func siblingFilename(filename string, suffix string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_" + suffix + ext
+}
+
+// readClicks - читает сохраненные события переходов из файла.
+func readClicks(filename string) ([]models.ClickEvent, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	var clicks []models.ClickEvent
+	for {
+		var click models.ClickEvent
+		ok, err := consumer.readLine(&click)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		clicks = append(clicks, click)
+	}
+
+	return clicks, nil
+}
+
+// readAbuseReports - читает жалобы из файла, для каждой жалобы берется ее последняя запись.
+func readAbuseReports(filename string) ([]models.AbuseReport, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	var reports []models.AbuseReport
+	positions := make(map[int64]int)
+	for {
+		var report models.AbuseReport
+		ok, err := consumer.readLine(&report)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if i, exist := positions[report.ID]; exist {
+			reports[i] = report
+			continue
+		}
+		positions[report.ID] = len(reports)
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ID < reports[j].ID })
+
+	return reports, nil
+}
+
+// readJobs - читает фоновые задачи из файла, для каждой задачи берется ее последняя запись.
+// Возвращает задачи и наибольший идентификатор.
+func readJobs(filename string) (map[int64]*models.Job, int64, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer consumer.Close()
+
+	jobs := make(map[int64]*models.Job)
+	var jobsSeq int64
+	for {
+		var job models.Job
+		ok, err := consumer.readLine(&job)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			break
+		}
+		jobs[job.ID] = &job
+		if job.ID > jobsSeq {
+			jobsSeq = job.ID
+		}
+	}
+
+	return jobs, jobsSeq, nil
+}
+
+// deletionRecord - запись журнала очереди удаления, для каждого сообщения действует последняя запись.
+// Acked - сообщение обработано и удалено из очереди, RetryAt - момент, до которого отложен повтор.
+type deletionRecord struct {
+	models.URLForDeleteMsg
+	Acked   bool       `json:"acked,omitempty"`
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// readDeletions - восстанавливает очередь удаления по журналу. Занятость сообщений обработчиком не сохраняется:
+// после перезапуска неподтвержденные сообщения свободны, если их повтор не отложен.
+// Возвращает очередь и наибольший идентификатор.
+func readDeletions(filename string) ([]queuedDeletion, int64, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer consumer.Close()
+
+	queued := make(map[int64]queuedDeletion)
+	var deletionsSeq int64
+	for {
+		var record deletionRecord
+		ok, err := consumer.readLine(&record)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			break
+		}
+		if record.Acked {
+			delete(queued, record.ID)
+		} else {
+			d := queuedDeletion{msg: record.URLForDeleteMsg}
+			if record.RetryAt != nil {
+				d.lockedUntil = *record.RetryAt
+			}
+			queued[record.ID] = d
+		}
+		if record.ID > deletionsSeq {
+			deletionsSeq = record.ID
+		}
+	}
+
+	deletions := make([]queuedDeletion, 0, len(queued))
+	for _, d := range queued {
+		deletions = append(deletions, d)
+	}
+	sort.Slice(deletions, func(i, j int) bool { return deletions[i].msg.ID < deletions[j].msg.ID })
+
+	return deletions, deletionsSeq, nil
+}
+
+// readDeadLetters - читает очередь недоставленных сообщений удаления из файла,
+// для каждого сообщения берется его последняя запись.
+func readDeadLetters(filename string) ([]models.DeletionDeadLetter, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	var deadLetters []models.DeletionDeadLetter
+	index := make(map[int64]int)
+	for {
+		var deadLetter models.DeletionDeadLetter
+		ok, err := consumer.readLine(&deadLetter)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		if i, exist := index[deadLetter.ID]; exist {
+			deadLetters[i] = deadLetter
+			continue
+		}
+		index[deadLetter.ID] = len(deadLetters)
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, nil
+}
+
+// EraseUserData - безвозвратно удаляет данные пользователя из памяти и из файлов хранилища:
+// файлы урлов, переходов, задач, предложений передачи, журнал смены владельцев, журнал очереди удаления
+// и файл недоставленных сообщений перезаписываются без удаленных записей,
+// снимки скетчей и агрегатов сохраняются заново.
+// Память и файлы меняются под одной блокировкой. Если перезапись не удалась, в файлах остаются данные
+// пользователя, поэтому удаление надо повторить: оно повторно перезапишет файлы.
+func (f *FileStorage) EraseUserData(ctx context.Context, userID string, keepJobID int64) (*models.UserErasure, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	erasure, err := f.eraseUserData(userID, keepJobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.rewriteErased(); err != nil {
+		return nil, err
+	}
+	if err := f.rewriteJobs(); err != nil {
+		return nil, err
+	}
+	if err := f.rewriteDeletions(); err != nil {
+		return nil, err
+	}
+	if err := f.rewriteDeadLetters(); err != nil {
+		return nil, err
+	}
+
+	return erasure, nil
+}
+
+// PurgeDeletedURLs - безвозвратно удаляет урлы, удаленные раньше deletedBefore, из памяти и из файлов хранилища.
+func (f *FileStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	purged := f.purgeDeletedURLs(deletedBefore)
+
+	if purged == 0 {
+		return 0, nil
+	}
+	if err := f.rewriteErased(); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// rewriteErased - перезаписывает файлы урлов, счетчиков, переходов, предложений передачи, рабочих пространств
+// и коллекций и снимки скетчей и агрегатов после безвозвратного удаления данных из памяти.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteErased() error {
+	if err := f.rewriteData(); err != nil {
+		return err
+	}
+	if err := f.rewriteURLCounters(); err != nil {
+		return err
+	}
+	if err := f.rewriteClicks(); err != nil {
+		return err
+	}
+	if err := f.writeSketchesSnapshot(); err != nil {
+		return err
+	}
+	if err := f.writeRollupsSnapshot(); err != nil {
+		return err
+	}
+	if err := f.rewriteTransfers(); err != nil {
+		return err
+	}
+	if err := f.rewriteWorkspaces(); err != nil {
+		return err
+	}
+	return f.rewriteCollections()
+}
+
+// workspaceRecord - запись журнала рабочих пространств: созданное пространство, состояние участника
+// или приглашения. Removed отмечает исключение участника, TokenHash хранит хеш токена приглашения.
+type workspaceRecord struct {
+	Workspace *models.Workspace       `json:"workspace,omitempty"`
+	Member    *models.WorkspaceMember `json:"member,omitempty"`
+	Removed   bool                    `json:"removed,omitempty"`
+	Invite    *models.WorkspaceInvite `json:"invite,omitempty"`
+	TokenHash string                  `json:"token_hash,omitempty"`
+}
+
+// loadWorkspaces - восстанавливает рабочие пространства, их участников и приглашения из журнала в файле.
+func (ms *MapStorage) loadWorkspaces(filename string) error {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	for {
+		var record workspaceRecord
+		ok, err := consumer.readLine(&record)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		switch {
+		case record.Workspace != nil:
+			ms.workspaces[record.Workspace.ID] = record.Workspace
+			if _, exist := ms.workspaceMembers[record.Workspace.ID]; !exist {
+				ms.workspaceMembers[record.Workspace.ID] = make(map[string]*models.WorkspaceMember)
+			}
+			if record.Workspace.ID > ms.workspacesSeq {
+				ms.workspacesSeq = record.Workspace.ID
+			}
+		case record.Member != nil:
+			members, exist := ms.workspaceMembers[record.Member.WorkspaceID]
+			if !exist {
+				continue
+			}
+			if record.Removed {
+				delete(members, record.Member.UserID)
+			} else {
+				members[record.Member.UserID] = record.Member
+			}
+		case record.Invite != nil:
+			record.Invite.TokenHash = record.TokenHash
+			ms.workspaceInvites[record.Invite.ID] = record.Invite
+			if record.Invite.ID > ms.workspaceInvitesSeq {
+				ms.workspaceInvitesSeq = record.Invite.ID
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeWorkspaceMember - дописывает состояние участника рабочего пространства в файл.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeWorkspaceMember(member *models.WorkspaceMember, removed bool) error {
+	return f.workspacesProducer.writeLine(&workspaceRecord{Member: member, Removed: removed})
+}
+
+// writeWorkspaceInvite - дописывает состояние приглашения в рабочее пространство в файл без открытого токена.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeWorkspaceInvite(invite *models.WorkspaceInvite) error {
+	inviteCopy := *invite
+	inviteCopy.Token = ""
+	return f.workspacesProducer.writeLine(&workspaceRecord{Invite: &inviteCopy, TokenHash: invite.TokenHash})
+}
+
+// rewriteWorkspaces - атомарно перезаписывает журнал рабочих пространств их текущим состоянием из памяти.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteWorkspaces() error {
+	producer, err := rewriteLog(f.workspacesProducer.file.Name(), f.workspacesProducer, func(p *Producer) error {
+		for _, workspace := range f.workspaces {
+			if err := p.writeLine(&workspaceRecord{Workspace: workspace}); err != nil {
+				return err
+			}
+			for _, member := range f.workspaceMembers[workspace.ID] {
+				if err := p.writeLine(&workspaceRecord{Member: member}); err != nil {
+					return err
+				}
+			}
+		}
+		for _, invite := range f.workspaceInvites {
+			if err := p.writeLine(&workspaceRecord{Invite: invite, TokenHash: invite.TokenHash}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.workspacesProducer = producer
+
+	return nil
+}
+
+// InsertWorkspace - сохраняет в памяти рабочее пространство с создателем-владельцем и дописывает их в файл.
+func (f *FileStorage) InsertWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	owner := f.appendWorkspace(workspace)
+
+	stored := *workspace
+	stored.Role = ""
+	if err := f.workspacesProducer.writeLine(&workspaceRecord{Workspace: &stored}); err != nil {
+		return err
+	}
+	return f.writeWorkspaceMember(owner, false)
+}
+
+// UpdateWorkspaceMemberRole - меняет роль участника рабочего пространства и дописывает его состояние в файл.
+func (f *FileStorage) UpdateWorkspaceMemberRole(ctx context.Context, workspaceID int64, userID string, role string) (*models.WorkspaceMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	member, err := f.setWorkspaceMemberRole(workspaceID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.writeWorkspaceMember(member, false); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// DeleteWorkspaceMember - исключает участника из рабочего пространства и отмечает это в файле.
+func (f *FileStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID int64, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	member, err := f.removeWorkspaceMember(workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	return f.writeWorkspaceMember(member, true)
+}
+
+// InsertWorkspaceInvite - сохраняет в памяти и дописывает в файл приглашение в рабочее пространство.
+func (f *FileStorage) InsertWorkspaceInvite(ctx context.Context, invite *models.WorkspaceInvite) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.appendWorkspaceInvite(invite)
+	return f.writeWorkspaceInvite(invite)
+}
+
+// AcceptWorkspaceInvite - принимает приглашение в рабочее пространство и дописывает в файл
+// нового участника и состояние приглашения.
+func (f *FileStorage) AcceptWorkspaceInvite(ctx context.Context, tokenHash string, userID string, acceptedAt time.Time) (*models.WorkspaceMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	invite, member, err := f.acceptWorkspaceInvite(tokenHash, userID, acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.writeWorkspaceMember(member, false); err != nil {
+		return nil, err
+	}
+	if err := f.writeWorkspaceInvite(invite); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// collectionRecord - запись коллекции урлов в файле, для каждой коллекции действует последняя запись.
+// Deleted отмечает удаленную коллекцию.
+type collectionRecord struct {
+	models.Collection
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// readCollections - читает коллекции урлов из файла.
+// Возвращает коллекции и наибольший идентификатор.
+func readCollections(filename string) (map[int64]*models.Collection, int64, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer consumer.Close()
+
+	collections := make(map[int64]*models.Collection)
+	var collectionsSeq int64
+	for {
+		var record collectionRecord
+		ok, err := consumer.readLine(&record)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			break
+		}
+		if record.ID > collectionsSeq {
+			collectionsSeq = record.ID
+		}
+		if record.Deleted {
+			delete(collections, record.ID)
+			continue
+		}
+		collection := record.Collection
+		collections[collection.ID] = &collection
+	}
+
+	return collections, collectionsSeq, nil
+}
+
+// rewriteCollections - атомарно перезаписывает файл коллекций их текущими состояниями из памяти.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteCollections() error {
+	producer, err := rewriteLog(f.collectionsProducer.file.Name(), f.collectionsProducer, func(p *Producer) error {
+		for _, collection := range f.collections {
+			if err := p.writeLine(&collectionRecord{Collection: *collection}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.collectionsProducer = producer
+
+	return nil
+}
+
+// InsertCollection - сохраняет в памяти и дописывает в файл коллекцию урлов.
+func (f *FileStorage) InsertCollection(ctx context.Context, collection *models.Collection) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.appendCollection(collection); err != nil {
+		return err
+	}
+	return f.collectionsProducer.writeLine(&collectionRecord{Collection: *collection})
+}
+
+// UpdateCollection - переименовывает коллекцию урлов и дописывает ее новое состояние в файл.
+func (f *FileStorage) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	renamed, err := f.renameCollection(collection)
+	if err != nil {
+		return err
+	}
+	return f.collectionsProducer.writeLine(&collectionRecord{Collection: *renamed})
+}
+
+// DeleteCollection - удаляет коллекцию урлов, дописывает в файл урлов их состояния вне коллекции,
+// а затем отмечает удаление коллекции в файле коллекций.
+func (f *FileStorage) DeleteCollection(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	changed, err := f.removeCollection(id)
+	if err != nil {
+		return err
+	}
+	for i := range changed {
+		if err := f.dataProducer.WriteEvent(&changed[i]); err != nil {
+			return err
+		}
+	}
+	return f.collectionsProducer.writeLine(&collectionRecord{Collection: models.Collection{ID: id}, Deleted: true})
+}
+
+// MoveURLsToCollection - переносит личные урлы пользователя из коллекции fromCollectionID в коллекцию
+// и дописывает их новые состояния в файл.
+func (f *FileStorage) MoveURLsToCollection(ctx context.Context, userID string, shortURLs []string, fromCollectionID int64, collectionID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	changed, err := f.moveURLsToCollection(userID, shortURLs, fromCollectionID, collectionID)
+	if err != nil {
+		return err
+	}
+	for i := range changed {
+		if err := f.dataProducer.WriteEvent(&changed[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferRecord - запись предложения передачи урлов в файле вместе с хешем токена,
+// для каждого предложения действует последняя запись.
+type transferRecord struct {
+	models.URLTransfer
+	TokenHash string `json:"token_hash"`
+}
+
+// readTransfers - читает предложения передачи урлов из файла.
+// Возвращает предложения и наибольший идентификатор.
+func readTransfers(filename string) (map[int64]*models.URLTransfer, int64, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer consumer.Close()
+
+	transfers := make(map[int64]*models.URLTransfer)
+	var transfersSeq int64
+	for {
+		var record transferRecord
+		ok, err := consumer.readLine(&record)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !ok {
+			break
+		}
+		transfer := record.URLTransfer
+		transfer.TokenHash = record.TokenHash
+		transfers[transfer.ID] = &transfer
+		if transfer.ID > transfersSeq {
+			transfersSeq = transfer.ID
+		}
+	}
+
+	return transfers, transfersSeq, nil
+}
+
+// readOwnershipAudit - читает журнал смены владельцев урлов из файла.
+func readOwnershipAudit(filename string) ([]models.URLOwnershipAudit, error) {
+	consumer, err := newConsumer(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	var audit []models.URLOwnershipAudit
+	for {
+		var a models.URLOwnershipAudit
+		ok, err := consumer.readLine(&a)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		audit = append(audit, a)
+	}
+
+	return audit, nil
+}
+
+// writeTransfer - дописывает состояние предложения передачи урлов в файл.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeTransfer(transfer *models.URLTransfer) error {
+	record := transferRecord{URLTransfer: *transfer, TokenHash: transfer.TokenHash}
+	record.Token = ""
+	return f.transfersProducer.writeLine(&record)
+}
+
+// rewriteTransfers - атомарно перезаписывает файлы предложений передачи и журнала смены владельцев
+// их текущими состояниями из памяти.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteTransfers() error {
+	producer, err := rewriteLog(f.transfersProducer.file.Name(), f.transfersProducer, func(p *Producer) error {
+		for _, transfer := range f.transfers {
+			record := transferRecord{URLTransfer: *transfer, TokenHash: transfer.TokenHash}
+			if err := p.writeLine(&record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.transfersProducer = producer
+
+	producer, err = rewriteLog(f.auditProducer.file.Name(), f.auditProducer, func(p *Producer) error {
+		for i := range f.ownershipAudit {
+			if err := p.writeLine(&f.ownershipAudit[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.auditProducer = producer
+
+	return nil
+}
+
+// InsertURLTransfer - сохраняет в памяти и дописывает в файл предложение передачи урлов.
+func (f *FileStorage) InsertURLTransfer(ctx context.Context, transfer *models.URLTransfer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.appendTransfer(transfer)
+	return f.writeTransfer(transfer)
+}
+
+// CancelURLTransfer - отменяет ожидающее предложение передачи урлов и дописывает его состояние в файл.
+func (f *FileStorage) CancelURLTransfer(ctx context.Context, id int64, cancelledAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	transfer, err := f.cancelTransfer(id, cancelledAt)
+	if err != nil {
+		return err
+	}
+	return f.writeTransfer(transfer)
+}
+
+// AcceptURLTransfer - принимает предложение передачи урлов и дописывает в файлы новые состояния урлов,
+// записи журнала смены владельцев и состояние предложения.
+func (f *FileStorage) AcceptURLTransfer(ctx context.Context, id int64, toUserID string, acceptedAt time.Time) (*models.URLTransfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	transfer, changed, audit, err := f.acceptTransfer(id, toUserID, acceptedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range changed {
+		if err := f.dataProducer.WriteEvent(&changed[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range audit {
+		if err := f.auditProducer.writeLine(&audit[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.writeTransfer(transfer); err != nil {
+		return nil, err
+	}
+	return transfer, nil
 }
 
 // InsertURLsData - вставляет в файл информацию по урлу.
 func (f *FileStorage) InsertURLsData(ctx context.Context, data *models.URLsData) error {
-	f.mapCash[data.ShortURL] = data.OriginalURL
-	return f.dataProducer.WriteEvent(data)
+	return f.InsertURLsDataBatch(ctx, []models.URLsData{*data})
+}
+
+// DeleteURLs - помечает урлы пользователей удаленными, дописывает их новые состояния в файл
+// и возвращает сообщения, урлы которых принадлежат пользователям.
+func (f *FileStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	deleted, changed := f.deleteURLs(data, time.Now().UTC())
+	if err := f.writeURLsData(changed); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// EnqueueURLsDeletion - добавляет сообщения в очередь удаления и дописывает их в журнал очереди.
+func (f *FileStorage) EnqueueURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.appendDeletions(msgs)
+	return f.writeDeletions(msgs, false)
+}
+
+// ClaimURLsDeletion - забирает в обработку свободные сообщения очереди удаления
+// и дописывает в журнал их увеличенные счетчики попыток.
+func (f *FileStorage) ClaimURLsDeletion(ctx context.Context, limit int, lease time.Duration) ([]models.URLForDeleteMsg, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	claimed := f.claimDeletions(limit, time.Now().Add(lease))
+	if err := f.writeDeletions(claimed, false); err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// AckURLsDeletion - удаляет обработанные сообщения из очереди удаления и отмечает их в журнале,
+// опустевшая очередь очищает журнал.
+func (f *FileStorage) AckURLsDeletion(ctx context.Context, ids []int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ackDeletions(ids)
+	return f.writeAckedDeletions(ids)
+}
+
+// RetryURLsDeletion - откладывает повторную обработку сообщений очереди удаления до retryAt
+// и дописывает их в журнал вместе с моментом повтора, ошибкой последней попытки и счетчиком попыток.
+func (f *FileStorage) RetryURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg, retryAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, msg := range f.retryDeletions(msgs, retryAt) {
+		if err := f.deletionsProducer.writeLine(deletionRecord{URLForDeleteMsg: msg, RetryAt: &retryAt}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeadLetterURLsDeletion - переносит сообщения из очереди удаления в очередь недоставленных:
+// сначала сообщения дописываются в файл недоставленных, затем отмечаются в журнале очереди,
+// поэтому при сбое между записями сообщение не теряется.
+func (f *FileStorage) DeadLetterURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ids := make([]int64, len(msgs))
+	for i, deadLetter := range f.deadLetterDeletions(msgs, time.Now().UTC()) {
+		ids[i] = deadLetter.ID
+		if err := f.deadLettersProducer.writeLine(&deadLetter); err != nil {
+			return err
+		}
+	}
+	return f.writeAckedDeletions(ids)
+}
+
+// writeAckedDeletions - отмечает подтвержденные сообщения в журнале очереди удаления,
+// если очередь опустела, журнал очищается.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeAckedDeletions(ids []int64) error {
+	if len(f.deletions) == 0 {
+		return f.rewriteDeletions()
+	}
+
+	for _, id := range ids {
+		record := deletionRecord{URLForDeleteMsg: models.URLForDeleteMsg{ID: id}, Acked: true}
+		if err := f.deletionsProducer.writeLine(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDeletions - дописывает сообщения в журнал очереди удаления.
+// Вызывается под блокировкой.
+func (f *FileStorage) writeDeletions(msgs []models.URLForDeleteMsg, acked bool) error {
+	for _, msg := range msgs {
+		if err := f.deletionsProducer.writeLine(deletionRecord{URLForDeleteMsg: msg, Acked: acked}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteDeadLetters - атомарно перезаписывает файл недоставленных сообщений удаления их текущим списком.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteDeadLetters() error {
+	producer, err := rewriteLog(f.deadLettersProducer.file.Name(), f.deadLettersProducer, func(p *Producer) error {
+		for i := range f.deadLetters {
+			if err := p.writeLine(&f.deadLetters[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.deadLettersProducer = producer
+
+	return nil
+}
+
+// rewriteDeletions - атомарно перезаписывает журнал очереди удаления текущими сообщениями очереди.
+// Вызывается под блокировкой.
+func (f *FileStorage) rewriteDeletions() error {
+	producer, err := rewriteLog(f.deletionsProducer.file.Name(), f.deletionsProducer, func(p *Producer) error {
+		now := time.Now()
+		for _, d := range f.deletions {
+			record := deletionRecord{URLForDeleteMsg: d.msg}
+			if d.lockedUntil.After(now) {
+				record.RetryAt = &d.lockedUntil
+			}
+			if err := p.writeLine(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.deletionsProducer = producer
+
+	return nil
+}
+
+// RestoreURLs - восстанавливает удаленные урлы пользователя и дописывает их новые состояния в файл.
+func (f *FileStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	restored := f.restoreURLs(userID, shortURLs)
+	if err := f.writeURLsData(restored); err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(restored))
+	for _, d := range restored {
+		result = append(result, d.ShortURL)
+	}
+	return result, nil
 }
 
-// DeleteURLs - заглушка, для реализации общего интерфейса для всех видов хранилищ.
-func (f *FileStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) error {
+// writeURLsData - дописывает в файл новые состояния урлов.
+// Вызывается под блокировкой, которая удерживается и на время изменения урлов в памяти,
+// чтобы записи в файле шли в порядке изменений.
+func (f *FileStorage) writeURLsData(data []models.URLsData) error {
+	for i := range data {
+		if err := f.dataProducer.WriteEvent(&data[i]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // InsertURLsDataBatch - вставка батча урлов в файл.
 func (f *FileStorage) InsertURLsDataBatch(ctx context.Context, data []models.URLsData) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	for _, d := range data {
-		if _, exist := f.mapCash[d.ShortURL]; !exist {
-			f.mapCash[d.ShortURL] = d.OriginalURL
+		if _, exist := f.mapStorage[d.ShortURL]; !exist {
+			f.mapStorage[d.ShortURL] = copyURLsData(&d)
 			err := f.dataProducer.WriteEvent(&d)
 			if err != nil {
 				return err
@@ -66,9 +1507,37 @@ func (f *FileStorage) InsertURLsDataBatch(ctx context.Context, data []models.URL
 	return nil
 }
 
-// SelectURLsCount - получает количество урлов в сервисе.
-func (f *FileStorage) SelectURLsCount(ctx context.Context) (int, error) {
-	return len(f.mapCash), nil
+// IncrementVariantServed - увеличивает счетчик показов варианта и дописывает его новое значение в журнал счетчиков,
+// полная запись урла в файл урлов при этом не пишется.
+func (f *FileStorage) IncrementVariantServed(ctx context.Context, shortURL string, variantID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.incrementVariantServed(shortURL, variantID)
+	if err != nil {
+		return err
+	}
+	for _, v := range data.Variants {
+		if v.ID == variantID {
+			return f.countersProducer.writeLine(urlCounterRecord{ShortURL: shortURL, VariantID: variantID, Served: v.Served})
+		}
+	}
+	return nil
+}
+
+// InsertClicks - сохраняет в памяти и дописывает в файл батч событий перехода.
+func (f *FileStorage) InsertClicks(ctx context.Context, clicks []models.ClickEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inserted := f.appendClicks(clicks)
+	for i := range inserted {
+		if err := f.clicksProducer.writeLine(&inserted[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // SelectURLsCount - получает количество пользователей в сервисе.
@@ -89,43 +1558,112 @@ func (f *FileStorage) SelectUsersCount(ctx context.Context) (int, error) {
 	return len(users), nil
 }
 
-// SelectURLs - возвращает информацию по урлам пользователя из файла.
-func (f *FileStorage) SelectURLs(ctx context.Context, userID string) ([]models.GetUserURLsResponse, error) {
-	var data []models.GetUserURLsResponse
+// UpdateURLHealth - сохраняет результат проверки адреса назначения и дописывает его в журнал счетчиков,
+// полная запись урла в файл урлов при этом не пишется.
+func (f *FileStorage) UpdateURLHealth(ctx context.Context, shortURL string, health models.URLHealth) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	for {
-		fileStr, err := f.dataConsumer.ReadEvent()
-		if err != nil {
-			return nil, err
-		}
-		if fileStr == nil {
-			break
-		}
-		data = append(data, models.GetUserURLsResponse{ShortURL: fileStr.ShortURL, OriginalURL: fileStr.OriginalURL})
+	if _, err := f.updateURLHealth(shortURL, health); err != nil {
+		return err
 	}
+	return f.countersProducer.writeLine(urlCounterRecord{ShortURL: shortURL, Health: &health})
+}
+
+// UpdateURLMetadata - заменяет название, описание и теги урла и дописывает новое состояние урла в файл.
+func (f *FileStorage) UpdateURLMetadata(ctx context.Context, shortURL string, metadata models.URLMetadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	if len(data) == 0 {
-		return nil, ErrNotFound
+	data, err := f.updateURLMetadata(shortURL, metadata)
+	if err != nil {
+		return err
 	}
+	return f.dataProducer.WriteEvent(data)
+}
 
-	return data, nil
+// UpdateURLTakedown - блокирует урл модератором или снимает блокировку и дописывает новое состояние урла в файл.
+func (f *FileStorage) UpdateURLTakedown(ctx context.Context, shortURL string, takedown *models.URLTakedown) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.updateURLTakedown(shortURL, takedown)
+	if err != nil {
+		return err
+	}
+	return f.dataProducer.WriteEvent(data)
 }
 
-// SelectOriginalURLByShortURL - возвращает полный урл по сокращенному из файла.
-func (f *FileStorage) SelectOriginalURLByShortURL(ctx context.Context, shortURL string) (string, error) {
-	if _, exist := f.mapCash[shortURL]; !exist {
-		return "", errors.New("SHORT URL NOT EXIST")
+// InsertAbuseReport - сохраняет в памяти и дописывает в файл жалобу на короткий урл.
+// Повторная открытая жалоба с того же IP на тот же урл не сохраняется, в report возвращается уже открытая.
+func (f *FileStorage) InsertAbuseReport(ctx context.Context, report *models.AbuseReport) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.insertAbuseReport(report) {
+		return nil
 	}
-	return f.mapCash[shortURL], nil
+	return f.reportsProducer.writeLine(report)
 }
 
-// Ping - заглушка, для реализации общего интерфейса для всех видов хранилищ.
-func (f *FileStorage) Ping() error {
+// ResolveAbuseReports - переводит открытые жалобы в статус решения и дописывает измененные жалобы в файл.
+// Если жалоба ReportID уже не открыта, возвращает ErrConflict.
+func (f *FileStorage) ResolveAbuseReports(ctx context.Context, resolution models.AbuseReportResolution) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resolved, err := f.resolveAbuseReports(resolution)
+	if err != nil {
+		return err
+	}
+	for i := range resolved {
+		if err := f.reportsProducer.writeLine(&resolved[i]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// InsertJob - сохраняет в памяти и дописывает в файл фоновую задачу.
+func (f *FileStorage) InsertJob(ctx context.Context, job *models.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.appendJob(job)
+	return f.jobsProducer.writeLine(job)
+}
+
+// UpdateJob - заменяет состояние фоновой задачи в памяти и дописывает его в файл.
+func (f *FileStorage) UpdateJob(ctx context.Context, job *models.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.replaceJob(job); err != nil {
+		return err
+	}
+	return f.jobsProducer.writeLine(job)
+}
+
+// ModifyJob - атомарно изменяет фоновую задачу в памяти и дописывает ее новое состояние в файл.
+func (f *FileStorage) ModifyJob(ctx context.Context, id int64, modify func(job *models.Job)) (*models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	job, err := f.modifyJob(id, modify)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.jobsProducer.writeLine(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
 // Close - вызывает методы закрытия файла консюмера и продюсера.
 func (f *FileStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	err := f.dataConsumer.file.Close()
 	if err != nil {
 		return err
@@ -135,7 +1673,58 @@ func (f *FileStorage) Close() error {
 	if err != nil {
 		return err
 	}
-	return nil
+
+	err = f.clicksProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.reportsProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.jobsProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.deletionsProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.deadLettersProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.transfersProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.auditProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.workspacesProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.collectionsProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.countersProducer.file.Close()
+	if err != nil {
+		return err
+	}
+
+	return f.writeSketchesSnapshot()
 }
 
 // Producer - экземпляр продюсера для записи в файл.
@@ -158,7 +1747,12 @@ func newProducer(filename string) (*Producer, error) {
 
 // WriteEvent - записывает данные в файл.
 func (p *Producer) WriteEvent(event *models.URLsData) error {
-	data, err := json.Marshal(&event)
+	return p.writeLine(event)
+}
+
+// writeLine - записывает значение в файл отдельной json-строкой.
+func (p *Producer) writeLine(event any) error {
+	data, err := json.Marshal(event)
 	if err != nil {
 		return err
 	}
@@ -195,23 +1789,31 @@ func newConsumer(filename string) (*Consumer, error) {
 // ReadEvent - читает данные из файла.
 func (c *Consumer) ReadEvent() (*models.URLsData, error) {
 
-	if !c.scanner.Scan() {
-		return nil, c.scanner.Err()
-	}
-	data := c.scanner.Bytes()
-
 	event := models.URLsData{}
-	err := json.Unmarshal(data, &event)
-	if err != nil {
+	ok, err := c.readLine(&event)
+	if err != nil || !ok {
 		return nil, err
 	}
 
 	return &event, nil
 }
 
-func (c *Consumer) fillMapCash() (map[string]string, error) {
+// readLine - читает из файла очередную json-строку в event, возвращает false в конце файла.
+func (c *Consumer) readLine(event any) (bool, error) {
+	if !c.scanner.Scan() {
+		return false, c.scanner.Err()
+	}
+
+	if err := json.Unmarshal(c.scanner.Bytes(), event); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *Consumer) fillMapCash() (map[string]*models.URLsData, error) {
 
-	mapCash := make(map[string]string)
+	mapCash := make(map[string]*models.URLsData)
 	for {
 		fileStr, err := c.ReadEvent()
 		if err != nil {
@@ -220,7 +1822,7 @@ func (c *Consumer) fillMapCash() (map[string]string, error) {
 		if fileStr == nil {
 			break
 		}
-		mapCash[fileStr.ShortURL] = fileStr.OriginalURL
+		mapCash[fileStr.ShortURL] = fileStr
 
 	}
 
@@ -0,0 +1,588 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorageClicksReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	day := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	filter := models.ClickStatsFilter{
+		ShortURL: "abc",
+		From:     day.Add(-time.Hour),
+		To:       day.Add(time.Hour),
+		Location: time.UTC,
+		Bucket:   models.StatsBucketDay,
+	}
+
+	clicksBatch := func(from, to int) []models.ClickEvent {
+		var clicks []models.ClickEvent
+		for i := from; i < to; i++ {
+			clicks = append(clicks, models.ClickEvent{ShortURL: "abc", ClickedAt: day, IPHash: strconv.Itoa(i % 50)})
+		}
+		return clicks
+	}
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertClicks(context.Background(), clicksBatch(0, 100)))
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertClicks(context.Background(), clicksBatch(100, 160)))
+	assert.NoError(t, store.clicksProducer.file.Close())
+
+	// хранилище не закрыто штатно: переходы после снимка досчитываются по файлу переходов.
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	stats, err := store.SelectClickStats(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(160), stats.TotalClicks)
+	assert.InDelta(t, 50, stats.UniqueVisitors, 3)
+	assert.Equal(t, int64(160), store.clicksSeq)
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageAbuseReportsReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "abc", OriginalURL: "https://example.com"}))
+	for i := 0; i < 3; i++ {
+		report := models.AbuseReport{ShortURL: "abc", Reason: models.AbuseReasonPhishing, Status: models.AbuseReportOpen, CreatedAt: now}
+		assert.NoError(t, store.InsertAbuseReport(ctx, &report))
+		assert.Equal(t, int64(i+1), report.ID)
+	}
+	assert.NoError(t, store.ResolveAbuseReports(ctx, models.AbuseReportResolution{ReportID: 2, Status: models.AbuseReportDismissed, ResolvedAt: now}))
+	assert.ErrorIs(t, store.ResolveAbuseReports(ctx, models.AbuseReportResolution{ReportID: 2, Status: models.AbuseReportActioned, ResolvedAt: now}), ErrConflict)
+	assert.NoError(t, store.UpdateURLTakedown(ctx, "abc", &models.URLTakedown{Reason: "phishing", At: now}))
+	assert.NoError(t, store.ResolveAbuseReports(ctx, models.AbuseReportResolution{ShortURL: "abc", Status: models.AbuseReportActioned, ResolvedAt: now}))
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	reports, err := store.SelectAbuseReports(ctx, models.AbuseReportsFilter{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, reports, 3)
+	assert.Equal(t, []string{models.AbuseReportActioned, models.AbuseReportDismissed, models.AbuseReportActioned},
+		[]string{reports[0].Status, reports[1].Status, reports[2].Status})
+
+	open, err := store.SelectAbuseReports(ctx, models.AbuseReportsFilter{Status: models.AbuseReportOpen, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, open)
+
+	data, err := store.SelectURLData(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, &models.URLTakedown{Reason: "phishing", At: now}, data.Takedown)
+
+	report := models.AbuseReport{ShortURL: "abc", Reason: models.AbuseReasonSpam, ReporterIPHash: "h1", Status: models.AbuseReportOpen, CreatedAt: now}
+	assert.NoError(t, store.InsertAbuseReport(ctx, &report))
+	assert.Equal(t, int64(4), report.ID)
+
+	duplicate := models.AbuseReport{ShortURL: "abc", Reason: models.AbuseReasonOther, ReporterIPHash: "h1", Status: models.AbuseReportOpen, CreatedAt: now}
+	assert.NoError(t, store.InsertAbuseReport(ctx, &duplicate))
+	assert.Equal(t, int64(4), duplicate.ID)
+	assert.Equal(t, models.AbuseReasonSpam, duplicate.Reason)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	reports, err = store.SelectAbuseReports(ctx, models.AbuseReportsFilter{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, reports, 4)
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageJobsReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	job := models.Job{UserID: "u1", Kind: models.JobKindImport, Status: models.JobStatusPending, CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, store.InsertJob(ctx, &job))
+	assert.Equal(t, int64(1), job.ID)
+
+	job.Status = models.JobStatusDone
+	job.Processed, job.Succeeded, job.Failed = 2, 1, 1
+	job.Errors = []models.JobLineError{{Line: 2, Error: "invalid url"}}
+	job.FinishedAt = &now
+	assert.NoError(t, store.UpdateJob(ctx, &job))
+	assert.ErrorIs(t, store.UpdateJob(ctx, &models.Job{ID: 5}), ErrNotFound)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	loaded, err := store.SelectJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &job, loaded)
+
+	next := models.Job{UserID: "u1", Kind: models.JobKindImport, Status: models.JobStatusPending, CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, store.InsertJob(ctx, &next))
+	assert.Equal(t, int64(2), next.ID)
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageEraseUserData(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsDataBatch(ctx, []models.URLsData{
+		{ShortURL: "gone1", OriginalURL: "https://example.com/1", UserID: "u1"},
+		{ShortURL: "gone2", OriginalURL: "https://example.com/2", UserID: "u1", DeletedFlag: true},
+		{ShortURL: "kept", OriginalURL: "https://example.com/3", UserID: "u2"},
+	}))
+	assert.NoError(t, store.UpdateURLMetadata(ctx, "gone1", models.URLMetadata{Title: "private"}))
+	assert.NoError(t, store.InsertClicks(ctx, []models.ClickEvent{
+		{ShortURL: "kept", ClickedAt: now, IPHash: "a"},
+		{ShortURL: "gone1", ClickedAt: now, IPHash: "b"},
+		{ShortURL: "gone2", ClickedAt: now, IPHash: "c"},
+	}))
+
+	importJob := models.Job{UserID: "u1", Kind: models.JobKindImport, Status: models.JobStatusDone, CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, store.InsertJob(ctx, &importJob))
+	erasureJob := models.Job{UserID: "u1", Kind: models.JobKindErasure, Status: models.JobStatusRunning, CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, store.InsertJob(ctx, &erasureJob))
+
+	erasure, err := store.EraseUserData(ctx, "u1", erasureJob.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.UserErasure{Links: 2, Clicks: 2, Jobs: 1}, erasure)
+	assert.NoError(t, store.InsertClicks(ctx, []models.ClickEvent{{ShortURL: "kept", ClickedAt: now, IPHash: "d"}}))
+	assert.NoError(t, store.Close())
+
+	for _, name := range []string{filename, siblingFilename(filename, "clicks"), siblingFilename(filename, "jobs"), siblingFilename(filename, "sketches")} {
+		content, err := os.ReadFile(name)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(content), "gone1", "erased data left in %s", name)
+		assert.NotContains(t, string(content), "gone2", "erased data left in %s", name)
+	}
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	_, err = store.SelectURLData(ctx, "gone1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.SelectURLData(ctx, "kept")
+	assert.NoError(t, err)
+
+	_, err = store.SelectJob(ctx, importJob.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.SelectJob(ctx, erasureJob.ID)
+	assert.NoError(t, err)
+
+	stats, err := store.SelectClickStats(ctx, models.ClickStatsFilter{
+		ShortURL: "kept",
+		From:     now.Add(-time.Hour),
+		To:       now.Add(time.Hour),
+		Location: time.UTC,
+		Bucket:   models.StatsBucketDay,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.TotalClicks)
+	assert.Equal(t, int64(4), store.clicksSeq)
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageTrashReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsDataBatch(ctx, []models.URLsData{
+		{ShortURL: "old", OriginalURL: "https://example.com/1", UserID: "u1"},
+		{ShortURL: "restored", OriginalURL: "https://example.com/2", UserID: "u1"},
+		{ShortURL: "foreign", OriginalURL: "https://example.com/3", UserID: "u2"},
+	}))
+	deleted, err := store.DeleteURLs(ctx, []models.URLForDeleteMsg{
+		{ShortURL: "old", UserID: "u1"},
+		{ShortURL: "restored", UserID: "u1"},
+		{ShortURL: "foreign", UserID: "u1"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+
+	restored, err := store.RestoreURLs(ctx, "u1", []string{"restored", "foreign"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"restored"}, restored)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	for shortURL, deleted := range map[string]bool{"old": true, "restored": false, "foreign": false} {
+		data, err := store.SelectURLData(ctx, shortURL)
+		assert.NoError(t, err)
+		assert.Equal(t, deleted, data.DeletedFlag, shortURL)
+		assert.Equal(t, deleted, data.DeletedAt != nil, shortURL)
+	}
+
+	purged, err := store.PurgeDeletedURLs(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	purged, err = store.PurgeDeletedURLs(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	_, err = store.SelectURLData(ctx, "old")
+	assert.ErrorIs(t, err, ErrNotFound)
+	count, err := store.SelectURLsCount(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageDeletionQueueReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	msgs := []models.URLForDeleteMsg{
+		{ShortURL: "a", UserID: "u1", JobID: 1},
+		{ShortURL: "b", UserID: "u1", JobID: 1},
+		{ShortURL: "c", UserID: "u2", JobID: 2},
+	}
+	assert.NoError(t, store.EnqueueURLsDeletion(ctx, msgs))
+	assert.Equal(t, []int64{1, 2, 3}, []int64{msgs[0].ID, msgs[1].ID, msgs[2].ID})
+
+	claimed, err := store.ClaimURLsDeletion(ctx, 2, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, []string{claimed[0].ShortURL, claimed[1].ShortURL})
+	assert.Equal(t, 1, claimed[0].Attempts)
+
+	claimed, err = store.ClaimURLsDeletion(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1, "claimed messages were claimed again before lease expired")
+	assert.NoError(t, store.AckURLsDeletion(ctx, []int64{1}))
+	assert.NoError(t, store.deletionsProducer.file.Close())
+
+	// хранилище не закрыто штатно: неподтвержденные сообщения после перезапуска снова свободны.
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	claimed, err = store.ClaimURLsDeletion(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.URLForDeleteMsg{
+		{ID: 2, ShortURL: "b", UserID: "u1", JobID: 1, Attempts: 2},
+		{ID: 3, ShortURL: "c", UserID: "u2", JobID: 2, Attempts: 2},
+	}, claimed)
+
+	assert.NoError(t, store.AckURLsDeletion(ctx, []int64{2, 3}))
+	info, err := os.Stat(siblingFilename(filename, "deletions"))
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size(), "journal wasn't cleared after the queue became empty")
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	claimed, err = store.ClaimURLsDeletion(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed)
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageDeletionDeadLettersReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.EnqueueURLsDeletion(ctx, []models.URLForDeleteMsg{
+		{ShortURL: "a", UserID: "u1", JobID: 1},
+		{ShortURL: "b", UserID: "u1", JobID: 1},
+	}))
+
+	claimed, err := store.ClaimURLsDeletion(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 2)
+	claimed[0].Error = "timeout"
+	claimed[1].Error = "poisoned"
+	assert.NoError(t, store.RetryURLsDeletion(ctx, claimed[:1], time.Now().Add(time.Hour)))
+	assert.NoError(t, store.DeadLetterURLsDeletion(ctx, claimed[1:]))
+	assert.NoError(t, store.Close())
+
+	// отложенный повтор переживает перезапуск.
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	stats, err := store.SelectDeletionQueueStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.DeletionQueueStats{Delayed: 1, DeadLetters: 1}, stats)
+
+	claimed, err = store.ClaimURLsDeletion(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed, "delayed message was claimed before retry time")
+
+	deadLetters, err := store.SelectDeletionDeadLetters(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deadLetters, 1)
+	assert.Equal(t, models.URLForDeleteMsg{ID: 2, ShortURL: "b", UserID: "u1", JobID: 1, Attempts: 1, Error: "poisoned"}, deadLetters[0].URLForDeleteMsg)
+	assert.False(t, deadLetters[0].FailedAt.IsZero())
+
+	_, err = store.EraseUserData(ctx, "u1", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	stats, err = store.SelectDeletionQueueStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.DeletionQueueStats{}, stats, "erased user's deletions were kept")
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageURLTransferReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "a", OriginalURL: "https://example.com/a", UserID: "u1"}))
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "b", OriginalURL: "https://example.com/b", UserID: "u1"}))
+
+	now := time.Now().UTC()
+	accepted := &models.URLTransfer{Token: "secret", TokenHash: "hash-1", FromUserID: "u1", ShortURLs: []string{"a"},
+		Status: models.URLTransferPending, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	pending := &models.URLTransfer{TokenHash: "hash-2", FromUserID: "u1", ShortURLs: []string{"b"},
+		Status: models.URLTransferPending, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, store.InsertURLTransfer(ctx, accepted))
+	assert.NoError(t, store.InsertURLTransfer(ctx, pending))
+	_, err = store.AcceptURLTransfer(ctx, accepted.ID, "u2", now)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	// принятое предложение, новый владелец и журнал переживают перезапуск.
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	data, err := store.SelectURLData(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "u2", data.UserID)
+
+	transfer, err := store.SelectURLTransferByTokenHash(ctx, "hash-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.URLTransferAccepted, transfer.Status)
+	assert.Equal(t, "u2", transfer.ToUserID)
+	assert.Empty(t, transfer.Token, "token was stored in plain text")
+
+	audit, err := store.SelectURLOwnershipAudit(ctx, "a")
+	assert.NoError(t, err)
+	assert.Len(t, audit, 1)
+
+	// идентификаторы продолжаются после перезапуска.
+	next := &models.URLTransfer{TokenHash: "hash-3", FromUserID: "u2", ShortURLs: []string{"a"},
+		Status: models.URLTransferPending, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, store.InsertURLTransfer(ctx, next))
+	assert.Equal(t, int64(3), next.ID)
+
+	_, err = store.EraseUserData(ctx, "u2", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	_, err = store.SelectURLTransfer(ctx, accepted.ID)
+	assert.ErrorIs(t, err, ErrNotFound, "erased user's transfer was kept")
+	_, err = store.SelectURLTransfer(ctx, pending.ID)
+	assert.NoError(t, err)
+	audit, err = store.SelectURLOwnershipAudit(ctx, "a")
+	assert.NoError(t, err)
+	assert.Empty(t, audit, "erased url's audit was kept")
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageWorkspacesReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	workspace := &models.Workspace{Name: "Team", CreatedBy: "u1", CreatedAt: now}
+	assert.NoError(t, store.InsertWorkspace(ctx, workspace))
+	invite := &models.WorkspaceInvite{WorkspaceID: workspace.ID, Role: models.WorkspaceRoleEditor, Token: "secret",
+		TokenHash: "hash-1", CreatedBy: "u1", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.NoError(t, store.InsertWorkspaceInvite(ctx, invite))
+	_, err = store.AcceptWorkspaceInvite(ctx, "hash-1", "u2", now)
+	assert.NoError(t, err)
+	_, err = store.AcceptWorkspaceInvite(ctx, "hash-1", "u3", now)
+	assert.ErrorIs(t, err, ErrConflict, "invite accepted twice")
+	_, err = store.UpdateWorkspaceMemberRole(ctx, workspace.ID, "u1", models.WorkspaceRoleViewer)
+	assert.ErrorIs(t, err, ErrConflict, "last owner demoted")
+	_, err = store.UpdateWorkspaceMemberRole(ctx, workspace.ID, "u2", models.WorkspaceRoleViewer)
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "a", OriginalURL: "https://example.com/a",
+		UserID: "u2", WorkspaceID: workspace.ID}))
+	assert.NoError(t, store.Close())
+
+	// участники, роли и использованное приглашение переживают перезапуск.
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	members, err := store.SelectWorkspaceMembers(ctx, workspace.ID)
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+	member, err := store.SelectWorkspaceMember(ctx, workspace.ID, "u2")
+	assert.NoError(t, err)
+	assert.Equal(t, models.WorkspaceRoleViewer, member.Role)
+
+	_, err = store.AcceptWorkspaceInvite(ctx, "hash-1", "u3", now)
+	assert.ErrorIs(t, err, ErrConflict, "accepted invite reopened after reload")
+
+	next := &models.Workspace{Name: "Other", CreatedBy: "u1", CreatedAt: now}
+	assert.NoError(t, store.InsertWorkspace(ctx, next))
+	assert.Equal(t, workspace.ID+1, next.ID)
+
+	// последнего владельца пространства стереть нельзя.
+	_, err = store.EraseUserData(ctx, "u1", 0)
+	assert.ErrorIs(t, err, ErrConflict, "last owner erased")
+
+	// стирание пользователя убирает его членство, но не урлы рабочего пространства.
+	_, err = store.EraseUserData(ctx, "u2", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	_, err = store.SelectWorkspaceMember(ctx, workspace.ID, "u2")
+	assert.ErrorIs(t, err, ErrNotFound, "erased user's membership was kept")
+	_, err = store.SelectURLData(ctx, "a")
+	assert.NoError(t, err, "workspace url was erased with its creator")
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageCollectionsReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "a", OriginalURL: "https://example.com/a", UserID: "u1"}))
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "b", OriginalURL: "https://example.com/b", UserID: "u1"}))
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{ShortURL: "c", OriginalURL: "https://example.com/c", UserID: "u2"}))
+
+	now := time.Now().UTC()
+	kept := &models.Collection{UserID: "u1", Name: "Kept", CreatedAt: now, UpdatedAt: now}
+	removed := &models.Collection{UserID: "u1", Name: "Removed", CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, store.InsertCollection(ctx, kept))
+	assert.NoError(t, store.InsertCollection(ctx, removed))
+	assert.ErrorIs(t, store.InsertCollection(ctx, &models.Collection{UserID: "u1", Name: "Kept"}), ErrConflict)
+
+	assert.NoError(t, store.UpdateCollection(ctx, &models.Collection{ID: kept.ID, Name: "Renamed", UpdatedAt: now}))
+	assert.NoError(t, store.MoveURLsToCollection(ctx, "u1", []string{"a", "c"}, AnyCollection, kept.ID))
+	assert.NoError(t, store.MoveURLsToCollection(ctx, "u1", []string{"b"}, AnyCollection, removed.ID))
+	assert.ErrorIs(t, store.MoveURLsToCollection(ctx, "u2", []string{"c"}, AnyCollection, kept.ID), ErrNotFound, "foreign collection filled")
+	// урл другой коллекции не исключается.
+	assert.NoError(t, store.MoveURLsToCollection(ctx, "u1", []string{"a"}, removed.ID, 0))
+	assert.NoError(t, store.DeleteCollection(ctx, removed.ID))
+	assert.NoError(t, store.Close())
+
+	// коллекции и коллекции урлов переживают перезапуск.
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	collections, err := store.SelectUserCollections(ctx, "u1")
+	assert.NoError(t, err)
+	if assert.Len(t, collections, 1) {
+		assert.Equal(t, "Renamed", collections[0].Name)
+	}
+
+	for shortURL, collectionID := range map[string]int64{"a": kept.ID, "b": 0, "c": 0} {
+		data, err := store.SelectURLData(ctx, shortURL)
+		assert.NoError(t, err)
+		assert.Equal(t, collectionID, data.CollectionID, shortURL)
+	}
+
+	next := &models.Collection{UserID: "u1", Name: "Next", CreatedAt: now, UpdatedAt: now}
+	assert.NoError(t, store.InsertCollection(ctx, next))
+	assert.Equal(t, removed.ID+1, next.ID)
+
+	_, err = store.EraseUserData(ctx, "u1", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	collections, err = store.SelectUserCollections(ctx, "u1")
+	assert.NoError(t, err)
+	assert.Empty(t, collections, "erased user's collections were kept")
+	assert.NoError(t, store.Close())
+}
+
+func TestFileStorageURLCountersReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "urls.json")
+	ctx := context.Background()
+
+	store, err := NewFileStorage(filename, "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertURLsData(ctx, &models.URLsData{
+		ShortURL:    "abc",
+		OriginalURL: "https://example.com/a",
+		UserID:      "u1",
+		Variants: []models.URLVariant{
+			{ID: "a", OriginalURL: "https://example.com/a", Weight: 1},
+			{ID: "b", OriginalURL: "https://example.com/b", Weight: 1},
+		},
+	}))
+
+	dataInfo, err := os.Stat(filename)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, store.IncrementVariantServed(ctx, "abc", "a"))
+	}
+	assert.NoError(t, store.IncrementVariantServed(ctx, "abc", "b"))
+	assert.ErrorIs(t, store.IncrementVariantServed(ctx, "abc", "c"), ErrNotFound)
+	checkedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.UpdateURLHealth(ctx, "abc", models.URLHealth{Status: 200, CheckedAt: checkedAt}))
+	assert.NoError(t, store.UpdateURLHealth(ctx, "abc", models.URLHealth{Status: 404, Broken: true, CheckedAt: checkedAt.Add(time.Hour)}))
+
+	// показы вариантов и проверки не дописывают полные записи урла в файл урлов.
+	info, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, dataInfo.Size(), info.Size())
+
+	assert.NoError(t, store.UpdateURLTakedown(ctx, "abc", &models.URLTakedown{Reason: "spam"}))
+	assert.NoError(t, store.IncrementVariantServed(ctx, "abc", "a"))
+	assert.NoError(t, store.Close())
+
+	store, err = NewFileStorage(filename, "")
+	assert.NoError(t, err)
+
+	data, err := store.SelectURLData(ctx, "abc")
+	assert.NoError(t, err)
+	if assert.Len(t, data.Variants, 2) {
+		assert.Equal(t, int64(6), data.Variants[0].Served)
+		assert.Equal(t, int64(1), data.Variants[1].Served)
+	}
+	if assert.NotNil(t, data.Health) {
+		assert.Equal(t, 404, data.Health.Status)
+		assert.True(t, data.Health.Broken)
+	}
+	assert.NotNil(t, data.Takedown, "takedown lost by counters")
+	assert.NoError(t, store.Close())
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/nu-kotov/URLcompressor/config"
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
@@ -12,8 +13,61 @@ type Storage interface {
 	InsertURLsData(ctx context.Context, data *models.URLsData) error
 	InsertURLsDataBatch(ctx context.Context, data []models.URLsData) error
 	SelectOriginalURLByShortURL(ctx context.Context, shortURL string) (string, error)
-	SelectURLs(ctx context.Context, userID string) ([]models.GetUserURLsResponse, error)
-	DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) error
+	SelectURLData(ctx context.Context, shortURL string) (*models.URLsData, error)
+	IncrementVariantServed(ctx context.Context, shortURL string, variantID string) error
+	InsertClicks(ctx context.Context, clicks []models.ClickEvent) error
+	RollupClicks(ctx context.Context, policy models.ClicksRollupPolicy) error
+	SelectClickStats(ctx context.Context, filter models.ClickStatsFilter) (*models.URLStatsResponse, error)
+	SelectCollectionClickStats(ctx context.Context, collectionID int64, filter models.ClickStatsFilter) (*models.CollectionStatsResponse, error)
+	SelectClicksPage(ctx context.Context, filter models.ClicksPageFilter) ([]models.ClickEvent, error)
+	SelectURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error)
+	SelectUserURLsData(ctx context.Context, userID string, afterShortURL string, limit int) ([]models.URLsData, error)
+	SelectURLsForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]models.URLsData, error)
+	UpdateURLHealth(ctx context.Context, shortURL string, health models.URLHealth) error
+	UpdateURLMetadata(ctx context.Context, shortURL string, metadata models.URLMetadata) error
+	UpdateURLTakedown(ctx context.Context, shortURL string, takedown *models.URLTakedown) error
+	InsertAbuseReport(ctx context.Context, report *models.AbuseReport) error
+	SelectAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error)
+	SelectAbuseReport(ctx context.Context, id int64) (*models.AbuseReport, error)
+	ResolveAbuseReports(ctx context.Context, resolution models.AbuseReportResolution) error
+	SelectExistingShortURLs(ctx context.Context, shortURLs []string) ([]string, error)
+	InsertJob(ctx context.Context, job *models.Job) error
+	UpdateJob(ctx context.Context, job *models.Job) error
+	SelectJob(ctx context.Context, id int64) (*models.Job, error)
+	ModifyJob(ctx context.Context, id int64, modify func(job *models.Job)) (*models.Job, error)
+	SelectStaleJobs(ctx context.Context, kind string, updatedBefore time.Time) ([]models.Job, error)
+	EraseUserData(ctx context.Context, userID string, keepJobID int64) (*models.UserErasure, error)
+	InsertURLTransfer(ctx context.Context, transfer *models.URLTransfer) error
+	SelectURLTransfer(ctx context.Context, id int64) (*models.URLTransfer, error)
+	SelectURLTransferByTokenHash(ctx context.Context, tokenHash string) (*models.URLTransfer, error)
+	CancelURLTransfer(ctx context.Context, id int64, cancelledAt time.Time) error
+	AcceptURLTransfer(ctx context.Context, id int64, toUserID string, acceptedAt time.Time) (*models.URLTransfer, error)
+	SelectURLOwnershipAudit(ctx context.Context, shortURL string) ([]models.URLOwnershipAudit, error)
+	InsertWorkspace(ctx context.Context, workspace *models.Workspace) error
+	SelectWorkspace(ctx context.Context, id int64) (*models.Workspace, error)
+	SelectUserWorkspaces(ctx context.Context, userID string) ([]models.Workspace, error)
+	SelectWorkspaceMember(ctx context.Context, workspaceID int64, userID string) (*models.WorkspaceMember, error)
+	SelectWorkspaceMembers(ctx context.Context, workspaceID int64) ([]models.WorkspaceMember, error)
+	UpdateWorkspaceMemberRole(ctx context.Context, workspaceID int64, userID string, role string) (*models.WorkspaceMember, error)
+	DeleteWorkspaceMember(ctx context.Context, workspaceID int64, userID string) error
+	InsertWorkspaceInvite(ctx context.Context, invite *models.WorkspaceInvite) error
+	AcceptWorkspaceInvite(ctx context.Context, tokenHash string, userID string, acceptedAt time.Time) (*models.WorkspaceMember, error)
+	InsertCollection(ctx context.Context, collection *models.Collection) error
+	SelectCollection(ctx context.Context, id int64) (*models.Collection, error)
+	SelectUserCollections(ctx context.Context, userID string) ([]models.Collection, error)
+	UpdateCollection(ctx context.Context, collection *models.Collection) error
+	DeleteCollection(ctx context.Context, id int64) error
+	MoveURLsToCollection(ctx context.Context, userID string, shortURLs []string, fromCollectionID int64, collectionID int64) error
+	DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error)
+	EnqueueURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error
+	ClaimURLsDeletion(ctx context.Context, limit int, lease time.Duration) ([]models.URLForDeleteMsg, error)
+	AckURLsDeletion(ctx context.Context, ids []int64) error
+	RetryURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg, retryAt time.Time) error
+	DeadLetterURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error
+	SelectDeletionDeadLetters(ctx context.Context, afterID int64, limit int) ([]models.DeletionDeadLetter, error)
+	SelectDeletionQueueStats(ctx context.Context) (*models.DeletionQueueStats, error)
+	RestoreURLs(ctx context.Context, userID string, shortURLs []string) ([]string, error)
+	PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error)
 	SelectURLsCount(ctx context.Context) (int, error)
 	SelectUsersCount(ctx context.Context) (int, error)
 	Ping() error
@@ -3,24 +3,75 @@ package storage
 import (
 	"context"
 	"errors"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/nu-kotov/URLcompressor/internal/app/models"
 )
 
 // MapStorage - структура хранилища в памяти.
 type MapStorage struct {
-	mapStorage map[string]string
+	mu         sync.RWMutex
+	mapStorage map[string]*models.URLsData
+	clicks     []models.ClickEvent
+	clicksSeq  int64
+	sketches   map[sketchKey]*dailySketch
+	rollups    map[rollupKey]int64
+	rolledUpTo map[string]time.Time
+	reports    []models.AbuseReport
+	reportsSeq int64
+	jobs       map[int64]*models.Job
+	jobsSeq    int64
+	// deletions - очередь удаления урлов в порядке добавления.
+	deletions    []queuedDeletion
+	deletionsSeq int64
+	// deadLetters - сообщения очереди удаления, исчерпавшие попытки обработки.
+	deadLetters []models.DeletionDeadLetter
+	// transfers - предложения передачи урлов, ownershipAudit - журнал смены владельцев урлов.
+	transfers      map[int64]*models.URLTransfer
+	transfersSeq   int64
+	ownershipAudit []models.URLOwnershipAudit
+	// workspaces - рабочие пространства, workspaceMembers - их участники по пространству и пользователю,
+	// workspaceInvites - приглашения в пространства.
+	workspaces          map[int64]*models.Workspace
+	workspacesSeq       int64
+	workspaceMembers    map[int64]map[string]*models.WorkspaceMember
+	workspaceInvites    map[int64]*models.WorkspaceInvite
+	workspaceInvitesSeq int64
+	// collections - коллекции личных урлов пользователей.
+	collections    map[int64]*models.Collection
+	collectionsSeq int64
+}
+
+// queuedDeletion - сообщение очереди удаления и момент, до которого оно занято обработчиком.
+type queuedDeletion struct {
+	msg         models.URLForDeleteMsg
+	lockedUntil time.Time
 }
 
 // NewMapStorage - конструктор хранилища в памяти.
 func NewMapStorage() (*MapStorage, error) {
 	return &MapStorage{
-		mapStorage: make(map[string]string),
+		mapStorage: make(map[string]*models.URLsData),
+		sketches:   make(map[sketchKey]*dailySketch),
+		rollups:    make(map[rollupKey]int64),
+		rolledUpTo: make(map[string]time.Time),
+		jobs:       make(map[int64]*models.Job),
+		transfers:  make(map[int64]*models.URLTransfer),
+
+		workspaces:       make(map[int64]*models.Workspace),
+		workspaceMembers: make(map[int64]map[string]*models.WorkspaceMember),
+		workspaceInvites: make(map[int64]*models.WorkspaceInvite),
+		collections:      make(map[int64]*models.Collection),
 	}, nil
 }
 
 // SelectURLsCount - получает количество урлов в сервисе.
 func (ms *MapStorage) SelectURLsCount(ctx context.Context) (int, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	return len(ms.mapStorage), nil
 }
 
@@ -31,17 +82,23 @@ func (ms *MapStorage) SelectUsersCount(ctx context.Context) (int, error) {
 
 // InsertURLsData - вставляет в мапу информацию по урлу.
 func (ms *MapStorage) InsertURLsData(ctx context.Context, data *models.URLsData) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	if _, exist := ms.mapStorage[data.ShortURL]; !exist {
-		ms.mapStorage[data.ShortURL] = data.OriginalURL
+		ms.mapStorage[data.ShortURL] = copyURLsData(data)
 	}
 	return nil
 }
 
 // InsertURLsDataBatch - вставляет в мапу батч урлов.
 func (ms *MapStorage) InsertURLsDataBatch(ctx context.Context, data []models.URLsData) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	for _, d := range data {
 		if _, exist := ms.mapStorage[d.ShortURL]; !exist {
-			ms.mapStorage[d.ShortURL] = d.OriginalURL
+			ms.mapStorage[d.ShortURL] = copyURLsData(&d)
 		}
 	}
 	return nil
@@ -49,32 +106,1423 @@ func (ms *MapStorage) InsertURLsDataBatch(ctx context.Context, data []models.URL
 
 // SelectOriginalURLByShortURL - возвращает полный урл по сокращенному из мапы.
 func (ms *MapStorage) SelectOriginalURLByShortURL(ctx context.Context, shortURL string) (string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	if _, exist := ms.mapStorage[shortURL]; !exist {
 		return "", errors.New("SHORT URL NOT EXIST")
 	}
-	return ms.mapStorage[shortURL], nil
+	return ms.mapStorage[shortURL].OriginalURL, nil
+}
+
+// SelectURLData - возвращает данные по короткому урлу из мапы.
+func (ms *MapStorage) SelectURLData(ctx context.Context, shortURL string) (*models.URLsData, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	data, exist := ms.mapStorage[shortURL]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	return copyURLsData(data), nil
+}
+
+// IncrementVariantServed - увеличивает счетчик показов варианта короткого урла.
+func (ms *MapStorage) IncrementVariantServed(ctx context.Context, shortURL string, variantID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.incrementVariantServed(shortURL, variantID)
+	return err
+}
+
+// incrementVariantServed - увеличивает счетчик показов варианта и возвращает новое состояние урла.
+// Вызывается под блокировкой.
+func (ms *MapStorage) incrementVariantServed(shortURL string, variantID string) (*models.URLsData, error) {
+	data, exist := ms.mapStorage[shortURL]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	for i := range data.Variants {
+		if data.Variants[i].ID == variantID {
+			data.Variants[i].Served++
+			return copyURLsData(data), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// InsertClicks - сохраняет в памяти батч событий перехода по коротким урлам.
+func (ms *MapStorage) InsertClicks(ctx context.Context, clicks []models.ClickEvent) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.appendClicks(clicks)
+	return nil
+}
+
+// appendClicks - проставляет событиям идентификаторы, сохраняет их в памяти и обновляет дневные скетчи.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendClicks(clicks []models.ClickEvent) []models.ClickEvent {
+	inserted := make([]models.ClickEvent, len(clicks))
+	for i, c := range clicks {
+		ms.clicksSeq++
+		c.ID = ms.clicksSeq
+		inserted[i] = c
+	}
+	ms.clicks = append(ms.clicks, inserted...)
+	mergeSketches(ms.sketches, groupClicksByDay(inserted))
+
+	return inserted
+}
+
+// RollupClicks - агрегирует события перехода в памяти и удаляет устаревшие данные.
+func (ms *MapStorage) RollupClicks(ctx context.Context, policy models.ClicksRollupPolicy) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.rollupClicks(policy)
+	return nil
+}
+
+// SelectClickStats - считает статистику переходов по короткому урлу по событиям и агрегатам в памяти.
+func (ms *MapStorage) SelectClickStats(ctx context.Context, filter models.ClickStatsFilter) (*models.URLStatsResponse, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	agg := newClickAggregator(filter)
+	agg.addClicks(ms.clicks, ms.addRollups(agg, filter))
+
+	stats := agg.result()
+	stats.UniqueVisitors = estimateVisitors(ms.sketches, filter)
+
+	return stats, nil
+}
+
+// SelectCollectionClickStats - считает суммарную статистику переходов по урлам коллекции, включая удаленные,
+// по событиям и агрегатам в памяти за один проход.
+func (ms *MapStorage) SelectCollectionClickStats(ctx context.Context, collectionID int64, filter models.ClickStatsFilter) (*models.CollectionStatsResponse, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	agg := newClickAggregator(filter)
+	agg.urlClicks = make(map[string]int64)
+	for _, d := range ms.mapStorage {
+		if d.CollectionID == collectionID {
+			agg.urlClicks[d.ShortURL] = 0
+		}
+	}
+	agg.addClicks(ms.clicks, ms.addRollups(agg, filter))
+
+	return agg.collectionResult(), nil
 }
 
-// SelectURLs - возвращает полный урл по сокращенному из мапы.
-func (ms *MapStorage) SelectURLs(ctx context.Context, userID string) ([]models.GetUserURLsResponse, error) {
-	var data []models.GetUserURLsResponse
+// SelectClicksPage - возвращает страницу событий перехода по короткому урлу из памяти в порядке идентификаторов.
+func (ms *MapStorage) SelectClicksPage(ctx context.Context, filter models.ClicksPageFilter) ([]models.ClickEvent, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var page []models.ClickEvent
 
-	for su, ou := range ms.mapStorage {
-		data = append(data, models.GetUserURLsResponse{ShortURL: su, OriginalURL: ou})
+	start := sort.Search(len(ms.clicks), func(i int) bool { return ms.clicks[i].ID > filter.AfterID })
+	for _, c := range ms.clicks[start:] {
+		if len(page) == filter.Limit {
+			break
+		}
+		if c.ShortURL != filter.ShortURL || c.ClickedAt.Before(filter.From) || !c.ClickedAt.Before(filter.To) {
+			continue
+		}
+		page = append(page, c)
 	}
 
-	if len(data) == 0 {
+	return page, nil
+}
+
+// SelectURLs - возвращает из мапы страницу урлов пользователя, подходящих под фильтр, в порядке сортировки фильтра.
+func (ms *MapStorage) SelectURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var matched []*models.URLsData
+	found := false
+	for _, d := range ms.mapStorage {
+		if !matchUserURL(d, filter) {
+			continue
+		}
+		found = true
+		if afterUserURLsCursor(d, filter) {
+			matched = append(matched, d)
+		}
+	}
+
+	if !found {
 		return nil, ErrNotFound
 	}
 
+	sort.Slice(matched, func(i, j int) bool { return lessUserURL(matched[i], matched[j], filter) })
+
+	page := &models.UserURLsPage{}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+		page.Next = userURLsCursor(matched[len(matched)-1], filter)
+	}
+
+	page.URLs = make([]models.GetUserURLsResponse, 0, len(matched))
+	for _, d := range matched {
+		resp := models.GetUserURLsResponse{
+			ShortURL:     d.ShortURL,
+			OriginalURL:  d.OriginalURL,
+			Title:        d.Title,
+			Description:  d.Description,
+			Tags:         append([]string(nil), d.Tags...),
+			CollectionID: d.CollectionID,
+			CreatedAt:    d.CreatedAt,
+			Deleted:      d.DeletedFlag,
+		}
+		if d.DeletedAt != nil {
+			deletedAt := *d.DeletedAt
+			resp.DeletedAt = &deletedAt
+		}
+		if d.ExpiresAt != nil {
+			expiresAt := *d.ExpiresAt
+			resp.ExpiresAt = &expiresAt
+		}
+		if d.Health != nil {
+			health := *d.Health
+			resp.Health = &health
+		}
+		page.URLs = append(page.URLs, resp)
+	}
+
+	return page, nil
+}
+
+// SelectUserURLsData - возвращает из мапы страницу личных урлов пользователя, включая удаленные,
+// в порядке коротких урлов, страница начинается после afterShortURL. Урлы рабочих пространств не входят.
+func (ms *MapStorage) SelectUserURLsData(ctx context.Context, userID string, afterShortURL string, limit int) ([]models.URLsData, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var page []models.URLsData
+	for _, d := range ms.mapStorage {
+		if d.UserID == userID && d.WorkspaceID == 0 && d.ShortURL > afterShortURL {
+			page = append(page, *copyURLsData(d))
+		}
+	}
+
+	sort.Slice(page, func(i, j int) bool { return page[i].ShortURL < page[j].ShortURL })
+
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	return page, nil
+}
+
+// SelectURLsForHealthCheck - возвращает неудаленные урлы, которые не проверялись с checkedBefore,
+// начиная с давно не проверенных.
+func (ms *MapStorage) SelectURLsForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]models.URLsData, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var data []models.URLsData
+	for _, d := range ms.mapStorage {
+		if d.DeletedFlag || (d.Health != nil && !d.Health.CheckedAt.Before(checkedBefore)) {
+			continue
+		}
+		data = append(data, *copyURLsData(d))
+	}
+
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Health == nil || data[j].Health == nil {
+			return data[i].Health == nil && data[j].Health != nil
+		}
+		return data[i].Health.CheckedAt.Before(data[j].Health.CheckedAt)
+	})
+
+	if len(data) > limit {
+		data = data[:limit]
+	}
 	return data, nil
 }
 
-// DeleteURLs - заглушка, для реализации общего интерфейса для всех видов хранилищ.
-func (ms *MapStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) error {
+// UpdateURLHealth - сохраняет результат проверки адреса назначения урла.
+func (ms *MapStorage) UpdateURLHealth(ctx context.Context, shortURL string, health models.URLHealth) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.updateURLHealth(shortURL, health)
+	return err
+}
+
+// updateURLHealth - сохраняет результат проверки адреса назначения и возвращает новое состояние урла.
+// Вызывается под блокировкой.
+func (ms *MapStorage) updateURLHealth(shortURL string, health models.URLHealth) (*models.URLsData, error) {
+	data, exist := ms.mapStorage[shortURL]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	data.Health = &health
+	return copyURLsData(data), nil
+}
+
+// UpdateURLMetadata - заменяет название, описание и теги урла.
+func (ms *MapStorage) UpdateURLMetadata(ctx context.Context, shortURL string, metadata models.URLMetadata) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.updateURLMetadata(shortURL, metadata)
+	return err
+}
+
+// updateURLMetadata - заменяет метаданные урла и возвращает его новое состояние.
+// Вызывается под блокировкой.
+func (ms *MapStorage) updateURLMetadata(shortURL string, metadata models.URLMetadata) (*models.URLsData, error) {
+	data, exist := ms.mapStorage[shortURL]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	data.Title = metadata.Title
+	data.Description = metadata.Description
+	data.Tags = append([]string(nil), metadata.Tags...)
+	return copyURLsData(data), nil
+}
+
+// UpdateURLTakedown - блокирует урл модератором или снимает блокировку, если takedown равен nil.
+func (ms *MapStorage) UpdateURLTakedown(ctx context.Context, shortURL string, takedown *models.URLTakedown) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.updateURLTakedown(shortURL, takedown)
+	return err
+}
+
+// updateURLTakedown - блокирует урл или снимает блокировку и возвращает новое состояние урла.
+// Вызывается под блокировкой.
+func (ms *MapStorage) updateURLTakedown(shortURL string, takedown *models.URLTakedown) (*models.URLsData, error) {
+	data, exist := ms.mapStorage[shortURL]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	data.Takedown = nil
+	if takedown != nil {
+		t := *takedown
+		data.Takedown = &t
+	}
+	return copyURLsData(data), nil
+}
+
+// InsertAbuseReport - сохраняет в памяти жалобу на короткий урл и проставляет ей идентификатор.
+// Повторная открытая жалоба с того же IP на тот же урл не сохраняется, в report возвращается уже открытая.
+func (ms *MapStorage) InsertAbuseReport(ctx context.Context, report *models.AbuseReport) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.insertAbuseReport(report)
+	return nil
+}
+
+// insertAbuseReport - сохраняет жалобу, если с того же IP на тот же урл нет открытой жалобы,
+// иначе копирует открытую жалобу в report. Возвращает true, если жалоба сохранена.
+// Вызывается под блокировкой.
+func (ms *MapStorage) insertAbuseReport(report *models.AbuseReport) bool {
+	if report.ReporterIPHash != "" {
+		for i := range ms.reports {
+			r := &ms.reports[i]
+			if r.Status == models.AbuseReportOpen && r.ShortURL == report.ShortURL && r.ReporterIPHash == report.ReporterIPHash {
+				*report = *copyAbuseReport(r)
+				return false
+			}
+		}
+	}
+
+	ms.appendAbuseReport(report)
+	return true
+}
+
+// appendAbuseReport - проставляет жалобе идентификатор и сохраняет ее в памяти.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendAbuseReport(report *models.AbuseReport) {
+	ms.reportsSeq++
+	report.ID = ms.reportsSeq
+	ms.reports = append(ms.reports, *copyAbuseReport(report))
+}
+
+// SelectAbuseReports - возвращает страницу жалоб из памяти в порядке идентификаторов.
+func (ms *MapStorage) SelectAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var page []models.AbuseReport
+
+	start := sort.Search(len(ms.reports), func(i int) bool { return ms.reports[i].ID > filter.AfterID })
+	for i := start; i < len(ms.reports) && len(page) < filter.Limit; i++ {
+		r := &ms.reports[i]
+		if (filter.Status != "" && r.Status != filter.Status) || (filter.ShortURL != "" && r.ShortURL != filter.ShortURL) {
+			continue
+		}
+		page = append(page, *copyAbuseReport(r))
+	}
+
+	return page, nil
+}
+
+// SelectAbuseReport - возвращает жалобу по идентификатору из памяти.
+func (ms *MapStorage) SelectAbuseReport(ctx context.Context, id int64) (*models.AbuseReport, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	i := sort.Search(len(ms.reports), func(i int) bool { return ms.reports[i].ID >= id })
+	if i == len(ms.reports) || ms.reports[i].ID != id {
+		return nil, ErrNotFound
+	}
+	return copyAbuseReport(&ms.reports[i]), nil
+}
+
+// ResolveAbuseReports - переводит открытые жалобы в памяти в статус решения.
+// Если жалоба ReportID уже не открыта, возвращает ErrConflict.
+func (ms *MapStorage) ResolveAbuseReports(ctx context.Context, resolution models.AbuseReportResolution) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.resolveAbuseReports(resolution)
+	return err
+}
+
+// resolveAbuseReports - переводит открытые жалобы в статус решения и возвращает измененные жалобы.
+// Если жалоба ReportID уже не открыта, возвращает ErrConflict.
+// Вызывается под блокировкой.
+func (ms *MapStorage) resolveAbuseReports(resolution models.AbuseReportResolution) ([]models.AbuseReport, error) {
+	var resolved []models.AbuseReport
+
+	for i := range ms.reports {
+		r := &ms.reports[i]
+		if r.Status != models.AbuseReportOpen {
+			continue
+		}
+		if (resolution.ReportID != 0 && r.ID != resolution.ReportID) || (resolution.ReportID == 0 && r.ShortURL != resolution.ShortURL) {
+			continue
+		}
+		resolvedAt := resolution.ResolvedAt
+		r.Status = resolution.Status
+		r.ResolutionNote = resolution.Note
+		r.ResolvedAt = &resolvedAt
+		resolved = append(resolved, *copyAbuseReport(r))
+	}
+
+	if resolution.ReportID != 0 && len(resolved) == 0 {
+		return nil, ErrConflict
+	}
+	return resolved, nil
+}
+
+// SelectExistingShortURLs - возвращает те из коротких урлов, которые уже есть в мапе.
+func (ms *MapStorage) SelectExistingShortURLs(ctx context.Context, shortURLs []string) ([]string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var existing []string
+	for _, shortURL := range shortURLs {
+		if _, exist := ms.mapStorage[shortURL]; exist {
+			existing = append(existing, shortURL)
+		}
+	}
+	return existing, nil
+}
+
+// InsertJob - сохраняет в памяти фоновую задачу и проставляет ей идентификатор.
+func (ms *MapStorage) InsertJob(ctx context.Context, job *models.Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.appendJob(job)
+	return nil
+}
+
+// appendJob - проставляет фоновой задаче идентификатор и сохраняет ее в памяти.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendJob(job *models.Job) {
+	ms.jobsSeq++
+	job.ID = ms.jobsSeq
+	ms.jobs[job.ID] = copyJob(job)
+}
+
+// UpdateJob - заменяет состояние фоновой задачи в памяти.
+func (ms *MapStorage) UpdateJob(ctx context.Context, job *models.Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.replaceJob(job)
+}
+
+// replaceJob - заменяет состояние существующей фоновой задачи.
+// Вызывается под блокировкой.
+func (ms *MapStorage) replaceJob(job *models.Job) error {
+	if _, exist := ms.jobs[job.ID]; !exist {
+		return ErrNotFound
+	}
+	ms.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+// ModifyJob - атомарно изменяет фоновую задачу функцией modify и возвращает ее новое состояние.
+func (ms *MapStorage) ModifyJob(ctx context.Context, id int64, modify func(job *models.Job)) (*models.Job, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.modifyJob(id, modify)
+}
+
+// modifyJob - изменяет копию фоновой задачи и сохраняет ее.
+// Вызывается под блокировкой.
+func (ms *MapStorage) modifyJob(id int64, modify func(job *models.Job)) (*models.Job, error) {
+	job, exist := ms.jobs[id]
+	if !exist {
+		return nil, ErrNotFound
+	}
+
+	modified := copyJob(job)
+	modify(modified)
+	modified.ID = id
+	ms.jobs[id] = copyJob(modified)
+	return modified, nil
+}
+
+// SelectJob - возвращает фоновую задачу по идентификатору из памяти.
+func (ms *MapStorage) SelectJob(ctx context.Context, id int64) (*models.Job, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	job, exist := ms.jobs[id]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	return copyJob(job), nil
+}
+
+// SelectStaleJobs - возвращает из памяти незавершенные фоновые задачи вида kind, не обновлявшиеся с updatedBefore,
+// в порядке идентификаторов.
+func (ms *MapStorage) SelectStaleJobs(ctx context.Context, kind string, updatedBefore time.Time) ([]models.Job, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var jobs []models.Job
+	for _, job := range ms.jobs {
+		if job.Kind == kind && job.FinishedAt == nil && job.UpdatedAt.Before(updatedBefore) {
+			jobs = append(jobs, *copyJob(job))
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
+
+// EraseUserData - безвозвратно удаляет из памяти урлы пользователя, включая удаленные,
+// их события перехода, скетчи и агрегаты, а также задачи пользователя, кроме keepJobID,
+// предложения передачи урлов и записи журнала смены владельцев, где пользователь отправитель или получатель,
+// его участие в рабочих пространствах и его коллекции. Урлы рабочих пространств остаются у пространств.
+// Если пользователь - последний владелец рабочего пространства, ничего не удаляет и возвращает ErrConflict.
+func (ms *MapStorage) EraseUserData(ctx context.Context, userID string, keepJobID int64) (*models.UserErasure, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.eraseUserData(userID, keepJobID)
+}
+
+// eraseUserData - удаляет данные пользователя и возвращает количество удаленного.
+// Вызывается под блокировкой.
+func (ms *MapStorage) eraseUserData(userID string, keepJobID int64) (*models.UserErasure, error) {
+	for workspaceID, members := range ms.workspaceMembers {
+		member, exist := members[userID]
+		if exist && member.Role == models.WorkspaceRoleOwner && ms.lastWorkspaceOwner(workspaceID) {
+			return nil, ErrConflict
+		}
+	}
+
+	shortURLs := make(map[string]struct{})
+	for shortURL, d := range ms.mapStorage {
+		if d.UserID == userID && d.WorkspaceID == 0 {
+			shortURLs[shortURL] = struct{}{}
+		}
+	}
+
+	erasure := &models.UserErasure{
+		Links:  int64(len(shortURLs)),
+		Clicks: ms.eraseURLs(shortURLs),
+	}
+
+	for id, job := range ms.jobs {
+		if job.UserID == userID && id != keepJobID {
+			delete(ms.jobs, id)
+			erasure.Jobs++
+		}
+	}
+
+	deletions := ms.deletions[:0]
+	for _, d := range ms.deletions {
+		if d.msg.UserID != userID {
+			deletions = append(deletions, d)
+		}
+	}
+	ms.deletions = deletions
+
+	deadLetters := ms.deadLetters[:0]
+	for _, d := range ms.deadLetters {
+		if d.UserID != userID {
+			deadLetters = append(deadLetters, d)
+		}
+	}
+	ms.deadLetters = deadLetters
+
+	for id, transfer := range ms.transfers {
+		if transfer.FromUserID == userID || transfer.ToUserID == userID {
+			delete(ms.transfers, id)
+		}
+	}
+
+	audit := ms.ownershipAudit[:0]
+	for _, a := range ms.ownershipAudit {
+		if a.FromUserID != userID && a.ToUserID != userID {
+			audit = append(audit, a)
+		}
+	}
+	ms.ownershipAudit = audit
+
+	for _, members := range ms.workspaceMembers {
+		delete(members, userID)
+	}
+
+	for id, collection := range ms.collections {
+		if collection.UserID == userID {
+			delete(ms.collections, id)
+		}
+	}
+
+	return erasure, nil
+}
+
+// eraseURLs - удаляет урлы вместе с их событиями перехода, скетчами и агрегатами,
+// возвращает количество удаленных событий перехода.
+// Вызывается под блокировкой.
+func (ms *MapStorage) eraseURLs(shortURLs map[string]struct{}) int64 {
+	if len(shortURLs) == 0 {
+		return 0
+	}
+
+	for shortURL := range shortURLs {
+		delete(ms.mapStorage, shortURL)
+	}
+
+	var erasedClicks int64
+	clicks := ms.clicks[:0]
+	for _, c := range ms.clicks {
+		if _, erased := shortURLs[c.ShortURL]; erased {
+			erasedClicks++
+			continue
+		}
+		clicks = append(clicks, c)
+	}
+	ms.clicks = clicks
+
+	for key := range ms.sketches {
+		if _, erased := shortURLs[key.shortURL]; erased {
+			delete(ms.sketches, key)
+		}
+	}
+	for key := range ms.rollups {
+		if _, erased := shortURLs[key.shortURL]; erased {
+			delete(ms.rollups, key)
+		}
+	}
+
+	audit := ms.ownershipAudit[:0]
+	for _, a := range ms.ownershipAudit {
+		if _, erased := shortURLs[a.ShortURL]; !erased {
+			audit = append(audit, a)
+		}
+	}
+	ms.ownershipAudit = audit
+
+	return erasedClicks
+}
+
+// InsertURLTransfer - сохраняет в памяти предложение передачи урлов и проставляет ему идентификатор.
+func (ms *MapStorage) InsertURLTransfer(ctx context.Context, transfer *models.URLTransfer) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.appendTransfer(transfer)
+	return nil
+}
+
+// appendTransfer - проставляет предложению передачи идентификатор и сохраняет его в памяти без открытого токена.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendTransfer(transfer *models.URLTransfer) {
+	ms.transfersSeq++
+	transfer.ID = ms.transfersSeq
+	stored := copyTransfer(transfer)
+	stored.Token = ""
+	ms.transfers[transfer.ID] = stored
+}
+
+// SelectURLTransfer - возвращает предложение передачи урлов по идентификатору из памяти.
+func (ms *MapStorage) SelectURLTransfer(ctx context.Context, id int64) (*models.URLTransfer, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	transfer, exist := ms.transfers[id]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	return copyTransfer(transfer), nil
+}
+
+// SelectURLTransferByTokenHash - возвращает предложение передачи урлов по хешу токена из памяти.
+func (ms *MapStorage) SelectURLTransferByTokenHash(ctx context.Context, tokenHash string) (*models.URLTransfer, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for _, transfer := range ms.transfers {
+		if transfer.TokenHash == tokenHash {
+			return copyTransfer(transfer), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CancelURLTransfer - отменяет ожидающее предложение передачи урлов, для остальных возвращает ErrConflict.
+func (ms *MapStorage) CancelURLTransfer(ctx context.Context, id int64, cancelledAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.cancelTransfer(id, cancelledAt)
+	return err
+}
+
+// cancelTransfer - переводит ожидающее предложение передачи в статус cancelled и возвращает его.
+// Вызывается под блокировкой.
+func (ms *MapStorage) cancelTransfer(id int64, cancelledAt time.Time) (*models.URLTransfer, error) {
+	transfer, exist := ms.transfers[id]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	if transfer.Status != models.URLTransferPending {
+		return nil, ErrConflict
+	}
+
+	transfer.Status = models.URLTransferCancelled
+	transfer.CancelledAt = &cancelledAt
+	return copyTransfer(transfer), nil
+}
+
+// AcceptURLTransfer - принимает предложение передачи: урлы атомарно переходят к toUserID,
+// по каждому урлу пишется запись журнала смены владельца. Если предложение не ожидает принятия, истекло
+// или хотя бы один урл удален или больше не принадлежит владельцу, ничего не меняется и возвращается ErrConflict.
+func (ms *MapStorage) AcceptURLTransfer(ctx context.Context, id int64, toUserID string, acceptedAt time.Time) (*models.URLTransfer, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	transfer, _, _, err := ms.acceptTransfer(id, toUserID, acceptedAt)
+	return transfer, err
+}
+
+// acceptTransfer - передает урлы предложения toUserID, возвращает принятое предложение,
+// измененные урлы и записи журнала смены владельца.
+// Вызывается под блокировкой.
+func (ms *MapStorage) acceptTransfer(id int64, toUserID string, acceptedAt time.Time) (*models.URLTransfer, []models.URLsData, []models.URLOwnershipAudit, error) {
+	transfer, exist := ms.transfers[id]
+	if !exist {
+		return nil, nil, nil, ErrNotFound
+	}
+	if transfer.Status != models.URLTransferPending || !acceptedAt.Before(transfer.ExpiresAt) {
+		return nil, nil, nil, ErrConflict
+	}
+	for _, shortURL := range transfer.ShortURLs {
+		d, exist := ms.mapStorage[shortURL]
+		if !exist || d.UserID != transfer.FromUserID || d.WorkspaceID != 0 || d.DeletedFlag {
+			return nil, nil, nil, ErrConflict
+		}
+	}
+
+	changed := make([]models.URLsData, len(transfer.ShortURLs))
+	audit := make([]models.URLOwnershipAudit, len(transfer.ShortURLs))
+	for i, shortURL := range transfer.ShortURLs {
+		d := ms.mapStorage[shortURL]
+		d.UserID = toUserID
+		d.CollectionID = 0
+		changed[i] = *copyURLsData(d)
+		audit[i] = models.URLOwnershipAudit{
+			ShortURL:      shortURL,
+			TransferID:    id,
+			FromUserID:    transfer.FromUserID,
+			ToUserID:      toUserID,
+			TransferredAt: acceptedAt,
+		}
+	}
+	ms.ownershipAudit = append(ms.ownershipAudit, audit...)
+
+	transfer.Status = models.URLTransferAccepted
+	transfer.ToUserID = toUserID
+	transfer.AcceptedAt = &acceptedAt
+	return copyTransfer(transfer), changed, audit, nil
+}
+
+// SelectURLOwnershipAudit - возвращает журнал смены владельцев урла из памяти в хронологическом порядке.
+func (ms *MapStorage) SelectURLOwnershipAudit(ctx context.Context, shortURL string) ([]models.URLOwnershipAudit, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var audit []models.URLOwnershipAudit
+	for _, a := range ms.ownershipAudit {
+		if a.ShortURL == shortURL {
+			audit = append(audit, a)
+		}
+	}
+	return audit, nil
+}
+
+// InsertWorkspace - сохраняет в памяти рабочее пространство, проставляет ему идентификатор
+// и добавляет создателя владельцем.
+func (ms *MapStorage) InsertWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.appendWorkspace(workspace)
+	return nil
+}
+
+// appendWorkspace - проставляет рабочему пространству идентификатор, сохраняет его в памяти
+// и возвращает создателя пространства как участника с ролью владельца.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendWorkspace(workspace *models.Workspace) *models.WorkspaceMember {
+	ms.workspacesSeq++
+	workspace.ID = ms.workspacesSeq
+	workspace.Role = models.WorkspaceRoleOwner
+
+	stored := *workspace
+	stored.Role = ""
+	ms.workspaces[workspace.ID] = &stored
+
+	owner := &models.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      workspace.CreatedBy,
+		Role:        models.WorkspaceRoleOwner,
+		JoinedAt:    workspace.CreatedAt,
+	}
+	ms.workspaceMembers[workspace.ID] = map[string]*models.WorkspaceMember{owner.UserID: owner}
+
+	ownerCopy := *owner
+	return &ownerCopy
+}
+
+// SelectWorkspace - возвращает рабочее пространство по идентификатору из памяти.
+func (ms *MapStorage) SelectWorkspace(ctx context.Context, id int64) (*models.Workspace, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	workspace, exist := ms.workspaces[id]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	workspaceCopy := *workspace
+	return &workspaceCopy, nil
+}
+
+// SelectUserWorkspaces - возвращает из памяти рабочие пространства, в которых состоит пользователь,
+// с его ролью в порядке идентификаторов.
+func (ms *MapStorage) SelectUserWorkspaces(ctx context.Context, userID string) ([]models.Workspace, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var workspaces []models.Workspace
+	for id, members := range ms.workspaceMembers {
+		member, exist := members[userID]
+		if !exist {
+			continue
+		}
+		workspace := *ms.workspaces[id]
+		workspace.Role = member.Role
+		workspaces = append(workspaces, workspace)
+	}
+
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].ID < workspaces[j].ID })
+	return workspaces, nil
+}
+
+// SelectWorkspaceMember - возвращает участника рабочего пространства из памяти.
+func (ms *MapStorage) SelectWorkspaceMember(ctx context.Context, workspaceID int64, userID string) (*models.WorkspaceMember, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	member, exist := ms.workspaceMembers[workspaceID][userID]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	memberCopy := *member
+	return &memberCopy, nil
+}
+
+// SelectWorkspaceMembers - возвращает участников рабочего пространства из памяти в порядке вступления.
+func (ms *MapStorage) SelectWorkspaceMembers(ctx context.Context, workspaceID int64) ([]models.WorkspaceMember, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	members := []models.WorkspaceMember{}
+	for _, member := range ms.workspaceMembers[workspaceID] {
+		members = append(members, *member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].JoinedAt.Equal(members[j].JoinedAt) {
+			return members[i].JoinedAt.Before(members[j].JoinedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+// UpdateWorkspaceMemberRole - меняет роль участника рабочего пространства в памяти.
+// Если у пространства не останется владельца, возвращает ErrConflict.
+func (ms *MapStorage) UpdateWorkspaceMemberRole(ctx context.Context, workspaceID int64, userID string, role string) (*models.WorkspaceMember, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.setWorkspaceMemberRole(workspaceID, userID, role)
+}
+
+// setWorkspaceMemberRole - меняет роль участника рабочего пространства и возвращает его новое состояние.
+// Вызывается под блокировкой.
+func (ms *MapStorage) setWorkspaceMemberRole(workspaceID int64, userID string, role string) (*models.WorkspaceMember, error) {
+	member, exist := ms.workspaceMembers[workspaceID][userID]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	if member.Role == models.WorkspaceRoleOwner && role != models.WorkspaceRoleOwner && ms.lastWorkspaceOwner(workspaceID) {
+		return nil, ErrConflict
+	}
+
+	member.Role = role
+	memberCopy := *member
+	return &memberCopy, nil
+}
+
+// DeleteWorkspaceMember - исключает участника из рабочего пространства в памяти.
+// Последнего владельца пространства исключить нельзя, для него возвращается ErrConflict.
+func (ms *MapStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID int64, userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.removeWorkspaceMember(workspaceID, userID)
+	return err
+}
+
+// removeWorkspaceMember - исключает участника из рабочего пространства и возвращает его.
+// Вызывается под блокировкой.
+func (ms *MapStorage) removeWorkspaceMember(workspaceID int64, userID string) (*models.WorkspaceMember, error) {
+	member, exist := ms.workspaceMembers[workspaceID][userID]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	if member.Role == models.WorkspaceRoleOwner && ms.lastWorkspaceOwner(workspaceID) {
+		return nil, ErrConflict
+	}
+
+	delete(ms.workspaceMembers[workspaceID], userID)
+	return member, nil
+}
+
+// lastWorkspaceOwner - проверяет, что у рабочего пространства остался единственный владелец.
+// Вызывается под блокировкой.
+func (ms *MapStorage) lastWorkspaceOwner(workspaceID int64) bool {
+	owners := 0
+	for _, member := range ms.workspaceMembers[workspaceID] {
+		if member.Role == models.WorkspaceRoleOwner {
+			owners++
+		}
+	}
+	return owners <= 1
+}
+
+// InsertWorkspaceInvite - сохраняет в памяти приглашение в рабочее пространство и проставляет ему идентификатор.
+func (ms *MapStorage) InsertWorkspaceInvite(ctx context.Context, invite *models.WorkspaceInvite) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.appendWorkspaceInvite(invite)
+	return nil
+}
+
+// appendWorkspaceInvite - проставляет приглашению идентификатор и сохраняет его в памяти без открытого токена.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendWorkspaceInvite(invite *models.WorkspaceInvite) {
+	ms.workspaceInvitesSeq++
+	invite.ID = ms.workspaceInvitesSeq
+	stored := *invite
+	stored.Token = ""
+	ms.workspaceInvites[invite.ID] = &stored
+}
+
+// AcceptWorkspaceInvite - принимает приглашение в рабочее пространство по хешу токена и добавляет userID
+// участником с ролью из приглашения. Для неизвестного токена возвращает ErrNotFound, для принятого
+// или истекшего приглашения, а также если пользователь уже состоит в пространстве, - ErrConflict.
+func (ms *MapStorage) AcceptWorkspaceInvite(ctx context.Context, tokenHash string, userID string, acceptedAt time.Time) (*models.WorkspaceMember, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, member, err := ms.acceptWorkspaceInvite(tokenHash, userID, acceptedAt)
+	return member, err
+}
+
+// acceptWorkspaceInvite - принимает приглашение и возвращает его новое состояние и нового участника.
+// Вызывается под блокировкой.
+func (ms *MapStorage) acceptWorkspaceInvite(tokenHash string, userID string, acceptedAt time.Time) (*models.WorkspaceInvite, *models.WorkspaceMember, error) {
+	var invite *models.WorkspaceInvite
+	for _, i := range ms.workspaceInvites {
+		if i.TokenHash == tokenHash {
+			invite = i
+			break
+		}
+	}
+	if invite == nil {
+		return nil, nil, ErrNotFound
+	}
+
+	members, exist := ms.workspaceMembers[invite.WorkspaceID]
+	if !exist {
+		return nil, nil, ErrNotFound
+	}
+	if invite.AcceptedAt != nil || !acceptedAt.Before(invite.ExpiresAt) {
+		return nil, nil, ErrConflict
+	}
+	if _, exist := members[userID]; exist {
+		return nil, nil, ErrConflict
+	}
+
+	member := &models.WorkspaceMember{WorkspaceID: invite.WorkspaceID, UserID: userID, Role: invite.Role, JoinedAt: acceptedAt}
+	members[userID] = member
+
+	invite.AcceptedBy = userID
+	invite.AcceptedAt = &acceptedAt
+
+	inviteCopy, memberCopy := *invite, *member
+	return &inviteCopy, &memberCopy, nil
+}
+
+// InsertCollection - сохраняет в памяти коллекцию урлов и проставляет ей идентификатор.
+// Если у пользователя уже есть коллекция с таким названием, возвращает ErrConflict.
+func (ms *MapStorage) InsertCollection(ctx context.Context, collection *models.Collection) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.appendCollection(collection)
+}
+
+// appendCollection - проставляет коллекции идентификатор и сохраняет ее в памяти.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendCollection(collection *models.Collection) error {
+	if ms.collectionNameTaken(collection) {
+		return ErrConflict
+	}
+
+	ms.collectionsSeq++
+	collection.ID = ms.collectionsSeq
+	stored := *collection
+	ms.collections[collection.ID] = &stored
+	return nil
+}
+
+// collectionNameTaken - проверяет, есть ли у владельца коллекции другая коллекция с тем же названием.
+// Вызывается под блокировкой.
+func (ms *MapStorage) collectionNameTaken(collection *models.Collection) bool {
+	for id, c := range ms.collections {
+		if id != collection.ID && c.UserID == collection.UserID && c.Name == collection.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectCollection - возвращает коллекцию урлов по идентификатору из памяти.
+func (ms *MapStorage) SelectCollection(ctx context.Context, id int64) (*models.Collection, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	collection, exist := ms.collections[id]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	collectionCopy := *collection
+	return &collectionCopy, nil
+}
+
+// SelectUserCollections - возвращает из памяти коллекции пользователя в порядке названий.
+func (ms *MapStorage) SelectUserCollections(ctx context.Context, userID string) ([]models.Collection, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var collections []models.Collection
+	for _, collection := range ms.collections {
+		if collection.UserID == userID {
+			collections = append(collections, *collection)
+		}
+	}
+
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	return collections, nil
+}
+
+// UpdateCollection - заменяет название и момент изменения коллекции в памяти.
+// Если у пользователя уже есть другая коллекция с таким названием, возвращает ErrConflict.
+func (ms *MapStorage) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.renameCollection(collection)
+	return err
+}
+
+// renameCollection - заменяет название и момент изменения коллекции и возвращает ее новое состояние.
+// Вызывается под блокировкой.
+func (ms *MapStorage) renameCollection(collection *models.Collection) (*models.Collection, error) {
+	stored, exist := ms.collections[collection.ID]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	collection.UserID = stored.UserID
+	collection.CreatedAt = stored.CreatedAt
+	if ms.collectionNameTaken(collection) {
+		return nil, ErrConflict
+	}
+
+	stored.Name = collection.Name
+	stored.UpdatedAt = collection.UpdatedAt
+	collectionCopy := *stored
+	return &collectionCopy, nil
+}
+
+// DeleteCollection - удаляет коллекцию из памяти, ее урлы остаются у пользователя вне коллекций.
+func (ms *MapStorage) DeleteCollection(ctx context.Context, id int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.removeCollection(id)
+	return err
+}
+
+// removeCollection - удаляет коллекцию, исключает из нее урлы и возвращает их новые состояния.
+// Вызывается под блокировкой.
+func (ms *MapStorage) removeCollection(id int64) ([]models.URLsData, error) {
+	if _, exist := ms.collections[id]; !exist {
+		return nil, ErrNotFound
+	}
+	delete(ms.collections, id)
+
+	var changed []models.URLsData
+	for _, d := range ms.mapStorage {
+		if d.CollectionID == id {
+			d.CollectionID = 0
+			changed = append(changed, *copyURLsData(d))
+		}
+	}
+	return changed, nil
+}
+
+// MoveURLsToCollection - переносит личные урлы пользователя из коллекции fromCollectionID в коллекцию collectionID,
+// нулевой collectionID исключает урлы из коллекций. Чужие урлы, урлы рабочих пространств
+// и урлы других коллекций, если fromCollectionID не AnyCollection, не меняются.
+// Если коллекции нет или она принадлежит другому пользователю, возвращает ErrNotFound.
+func (ms *MapStorage) MoveURLsToCollection(ctx context.Context, userID string, shortURLs []string, fromCollectionID int64, collectionID int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, err := ms.moveURLsToCollection(userID, shortURLs, fromCollectionID, collectionID)
+	return err
+}
+
+// moveURLsToCollection - переносит урлы в коллекцию и возвращает новые состояния измененных урлов.
+// Вызывается под блокировкой.
+func (ms *MapStorage) moveURLsToCollection(userID string, shortURLs []string, fromCollectionID int64, collectionID int64) ([]models.URLsData, error) {
+	if collectionID != 0 {
+		collection, exist := ms.collections[collectionID]
+		if !exist || collection.UserID != userID {
+			return nil, ErrNotFound
+		}
+	}
+
+	var changed []models.URLsData
+	for _, shortURL := range shortURLs {
+		d, exist := ms.mapStorage[shortURL]
+		if !exist || d.UserID != userID || d.WorkspaceID != 0 || d.CollectionID == collectionID {
+			continue
+		}
+		if fromCollectionID != AnyCollection && d.CollectionID != fromCollectionID {
+			continue
+		}
+		d.CollectionID = collectionID
+		changed = append(changed, *copyURLsData(d))
+	}
+	return changed, nil
+}
+
+// PurgeDeletedURLs - безвозвратно удаляет из памяти урлы, удаленные раньше deletedBefore,
+// вместе с их аналитикой и возвращает количество удаленных урлов.
+func (ms *MapStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.purgeDeletedURLs(deletedBefore), nil
+}
+
+// purgeDeletedURLs - удаляет урлы с истекшим сроком хранения в корзине.
+// Вызывается под блокировкой.
+func (ms *MapStorage) purgeDeletedURLs(deletedBefore time.Time) int64 {
+	shortURLs := make(map[string]struct{})
+	for shortURL, d := range ms.mapStorage {
+		if d.DeletedFlag && d.DeletedAt != nil && d.DeletedAt.Before(deletedBefore) {
+			shortURLs[shortURL] = struct{}{}
+		}
+	}
+
+	ms.eraseURLs(shortURLs)
+	return int64(len(shortURLs))
+}
+
+// DeleteURLs - помечает урлы пользователей удаленными и возвращает сообщения, урлы которых принадлежат пользователям.
+// Урлы других пользователей не меняются, у уже удаленных урлов сохраняется момент удаления.
+func (ms *MapStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	deleted, _ := ms.deleteURLs(data, time.Now().UTC())
+	return deleted, nil
+}
+
+// deleteURLs - помечает урлы удаленными в момент deletedAt, возвращает сообщения по урлам пользователей
+// и измененные урлы.
+// Вызывается под блокировкой.
+func (ms *MapStorage) deleteURLs(data []models.URLForDeleteMsg, deletedAt time.Time) ([]models.URLForDeleteMsg, []models.URLsData) {
+	var deleted []models.URLForDeleteMsg
+	var changed []models.URLsData
+	for _, msg := range data {
+		d, exist := ms.mapStorage[msg.ShortURL]
+		if !exist || !deletableBy(d, msg) {
+			continue
+		}
+		deleted = append(deleted, msg)
+		if d.DeletedFlag {
+			continue
+		}
+		d.DeletedFlag = true
+		d.DeletedAt = &deletedAt
+		changed = append(changed, *copyURLsData(d))
+	}
+	return deleted, changed
+}
+
+// deletableBy - проверяет, может ли отправитель сообщения удалить урл: урл рабочего пространства удаляется
+// по сообщению этого пространства, личный урл - по сообщению его владельца.
+func deletableBy(d *models.URLsData, msg models.URLForDeleteMsg) bool {
+	return d.WorkspaceID == msg.WorkspaceID && (msg.WorkspaceID != 0 || d.UserID == msg.UserID)
+}
+
+// EnqueueURLsDeletion - добавляет сообщения в очередь удаления урлов и проставляет им идентификаторы.
+func (ms *MapStorage) EnqueueURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.appendDeletions(msgs)
 	return nil
 }
 
+// appendDeletions - проставляет сообщениям идентификаторы и добавляет их в конец очереди удаления.
+// Вызывается под блокировкой.
+func (ms *MapStorage) appendDeletions(msgs []models.URLForDeleteMsg) {
+	for i := range msgs {
+		ms.deletionsSeq++
+		msgs[i].ID = ms.deletionsSeq
+		ms.deletions = append(ms.deletions, queuedDeletion{msg: msgs[i]})
+	}
+}
+
+// ClaimURLsDeletion - забирает в обработку до limit свободных сообщений очереди удаления на время lease
+// и увеличивает их счетчик попыток. Сообщение, не подтвержденное за время lease, снова становится свободным.
+func (ms *MapStorage) ClaimURLsDeletion(ctx context.Context, limit int, lease time.Duration) ([]models.URLForDeleteMsg, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.claimDeletions(limit, time.Now().Add(lease)), nil
+}
+
+// claimDeletions - занимает до limit свободных сообщений очереди удаления до момента lockedUntil.
+// Вызывается под блокировкой.
+func (ms *MapStorage) claimDeletions(limit int, lockedUntil time.Time) []models.URLForDeleteMsg {
+	now := time.Now()
+
+	var claimed []models.URLForDeleteMsg
+	for i := range ms.deletions {
+		if len(claimed) >= limit {
+			break
+		}
+		d := &ms.deletions[i]
+		if d.lockedUntil.After(now) {
+			continue
+		}
+		d.msg.Attempts++
+		d.lockedUntil = lockedUntil
+		claimed = append(claimed, d.msg)
+	}
+	return claimed
+}
+
+// AckURLsDeletion - удаляет обработанные сообщения из очереди удаления.
+func (ms *MapStorage) AckURLsDeletion(ctx context.Context, ids []int64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.ackDeletions(ids)
+	return nil
+}
+
+// ackDeletions - удаляет сообщения с идентификаторами ids из очереди удаления.
+// Вызывается под блокировкой.
+func (ms *MapStorage) ackDeletions(ids []int64) {
+	acked := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		acked[id] = true
+	}
+
+	deletions := ms.deletions[:0]
+	for _, d := range ms.deletions {
+		if !acked[d.msg.ID] {
+			deletions = append(deletions, d)
+		}
+	}
+	ms.deletions = deletions
+}
+
+// RetryURLsDeletion - откладывает повторную обработку сообщений очереди удаления до retryAt
+// и сохраняет ошибки их последней попытки и счетчики попыток.
+func (ms *MapStorage) RetryURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg, retryAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.retryDeletions(msgs, retryAt)
+	return nil
+}
+
+// retryDeletions - занимает сообщения очереди удаления до retryAt и сохраняет ошибки их последней попытки
+// и счетчики попыток.
+// Вызывается под блокировкой.
+func (ms *MapStorage) retryDeletions(msgs []models.URLForDeleteMsg, retryAt time.Time) []models.URLForDeleteMsg {
+	byID := make(map[int64]models.URLForDeleteMsg, len(msgs))
+	for _, msg := range msgs {
+		byID[msg.ID] = msg
+	}
+
+	var retried []models.URLForDeleteMsg
+	for i := range ms.deletions {
+		d := &ms.deletions[i]
+		if msg, ok := byID[d.msg.ID]; ok {
+			d.msg.Error = msg.Error
+			d.msg.Attempts = msg.Attempts
+			d.lockedUntil = retryAt
+			retried = append(retried, d.msg)
+		}
+	}
+	return retried
+}
+
+// DeadLetterURLsDeletion - переносит сообщения из очереди удаления в очередь недоставленных.
+func (ms *MapStorage) DeadLetterURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.deadLetterDeletions(msgs, time.Now().UTC())
+	return nil
+}
+
+// deadLetterDeletions - удаляет сообщения из очереди удаления и сохраняет их в очереди недоставленных
+// с моментом failedAt. Возвращает сохраненные сообщения.
+// Вызывается под блокировкой.
+func (ms *MapStorage) deadLetterDeletions(msgs []models.URLForDeleteMsg, failedAt time.Time) []models.DeletionDeadLetter {
+	ids := make([]int64, len(msgs))
+	deadLetters := make([]models.DeletionDeadLetter, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+		deadLetters[i] = models.DeletionDeadLetter{URLForDeleteMsg: msg, FailedAt: failedAt}
+	}
+
+	ms.ackDeletions(ids)
+	ms.deadLetters = append(ms.deadLetters, deadLetters...)
+	return deadLetters
+}
+
+// SelectDeletionDeadLetters - возвращает до limit сообщений очереди недоставленных
+// с идентификаторами больше afterID в порядке возрастания идентификаторов.
+func (ms *MapStorage) SelectDeletionDeadLetters(ctx context.Context, afterID int64, limit int) ([]models.DeletionDeadLetter, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var deadLetters []models.DeletionDeadLetter
+	for _, d := range ms.deadLetters {
+		if d.ID > afterID {
+			deadLetters = append(deadLetters, d)
+		}
+	}
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].ID < deadLetters[j].ID })
+
+	if len(deadLetters) > limit {
+		deadLetters = deadLetters[:limit]
+	}
+	return deadLetters, nil
+}
+
+// SelectDeletionQueueStats - возвращает размеры очереди удаления и очереди недоставленных.
+func (ms *MapStorage) SelectDeletionQueueStats(ctx context.Context) (*models.DeletionQueueStats, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := time.Now()
+	stats := &models.DeletionQueueStats{DeadLetters: int64(len(ms.deadLetters))}
+	for _, d := range ms.deletions {
+		if d.lockedUntil.After(now) {
+			stats.Delayed++
+		} else {
+			stats.Ready++
+		}
+	}
+	return stats, nil
+}
+
+// RestoreURLs - снимает пометку удаления с удаленных урлов пользователя и возвращает восстановленные урлы.
+func (ms *MapStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	restored := ms.restoreURLs(userID, shortURLs)
+
+	result := make([]string, 0, len(restored))
+	for _, d := range restored {
+		result = append(result, d.ShortURL)
+	}
+	return result, nil
+}
+
+// restoreURLs - восстанавливает удаленные урлы пользователя и возвращает их новые состояния.
+// Вызывается под блокировкой.
+func (ms *MapStorage) restoreURLs(userID string, shortURLs []string) []models.URLsData {
+	var restored []models.URLsData
+	for _, shortURL := range shortURLs {
+		d, exist := ms.mapStorage[shortURL]
+		if !exist || d.UserID != userID || d.WorkspaceID != 0 || !d.DeletedFlag {
+			continue
+		}
+		d.DeletedFlag = false
+		d.DeletedAt = nil
+		restored = append(restored, *copyURLsData(d))
+	}
+	return restored
+}
+
 // Ping - заглушка, для реализации общего интерфейса для всех видов хранилищ.
 func (ms *MapStorage) Ping() error {
 	return nil
@@ -84,3 +1532,72 @@ func (ms *MapStorage) Ping() error {
 func (ms *MapStorage) Close() error {
 	return nil
 }
+
+// copyURLsData - копирует данные по урлу, чтобы наружу не утекали ссылки на внутреннее состояние.
+func copyURLsData(data *models.URLsData) *models.URLsData {
+	dataCopy := *data
+	dataCopy.Variants = append([]models.URLVariant(nil), data.Variants...)
+	dataCopy.Tags = append([]string(nil), data.Tags...)
+	if data.RedirectOptions != nil {
+		opts := *data.RedirectOptions
+		opts.UTM = make(map[string]string, len(data.RedirectOptions.UTM))
+		for k, v := range data.RedirectOptions.UTM {
+			opts.UTM[k] = v
+		}
+		dataCopy.RedirectOptions = &opts
+	}
+	if data.Health != nil {
+		health := *data.Health
+		dataCopy.Health = &health
+	}
+	if data.Takedown != nil {
+		takedown := *data.Takedown
+		dataCopy.Takedown = &takedown
+	}
+	if data.ExpiresAt != nil {
+		expiresAt := *data.ExpiresAt
+		dataCopy.ExpiresAt = &expiresAt
+	}
+	if data.DeletedAt != nil {
+		deletedAt := *data.DeletedAt
+		dataCopy.DeletedAt = &deletedAt
+	}
+	return &dataCopy
+}
+
+// copyAbuseReport - копирует жалобу, чтобы наружу не утекали ссылки на внутреннее состояние.
+func copyAbuseReport(report *models.AbuseReport) *models.AbuseReport {
+	reportCopy := *report
+	if report.ResolvedAt != nil {
+		resolvedAt := *report.ResolvedAt
+		reportCopy.ResolvedAt = &resolvedAt
+	}
+	return &reportCopy
+}
+
+// copyTransfer - копирует предложение передачи урлов, чтобы наружу не утекали ссылки на внутреннее состояние.
+func copyTransfer(transfer *models.URLTransfer) *models.URLTransfer {
+	transferCopy := *transfer
+	transferCopy.ShortURLs = append([]string(nil), transfer.ShortURLs...)
+	if transfer.AcceptedAt != nil {
+		acceptedAt := *transfer.AcceptedAt
+		transferCopy.AcceptedAt = &acceptedAt
+	}
+	if transfer.CancelledAt != nil {
+		cancelledAt := *transfer.CancelledAt
+		transferCopy.CancelledAt = &cancelledAt
+	}
+	return &transferCopy
+}
+
+// copyJob - копирует фоновую задачу, чтобы наружу не утекали ссылки на внутреннее состояние.
+func copyJob(job *models.Job) *models.Job {
+	jobCopy := *job
+	jobCopy.Errors = append([]models.JobLineError(nil), job.Errors...)
+	jobCopy.URLs = append([]models.JobURLResult(nil), job.URLs...)
+	if job.FinishedAt != nil {
+		finishedAt := *job.FinishedAt
+		jobCopy.FinishedAt = &finishedAt
+	}
+	return &jobCopy
+}
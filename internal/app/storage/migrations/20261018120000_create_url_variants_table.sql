@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS url_variants (
+    short_url    TEXT NOT NULL REFERENCES urls (short_url) ON DELETE CASCADE,
+    variant_id   TEXT NOT NULL,
+    original_url TEXT NOT NULL,
+    weight       INTEGER NOT NULL,
+    served       BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (short_url, variant_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS url_variants;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls
+ADD query_policy TEXT NOT NULL DEFAULT '',
+ADD utm_params JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls
+DROP COLUMN query_policy,
+DROP COLUMN utm_params;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS clicks (
+    id         BIGSERIAL PRIMARY KEY,
+    short_url  TEXT NOT NULL,
+    variant_id TEXT NOT NULL DEFAULT '',
+    clicked_at TIMESTAMPTZ NOT NULL,
+    referrer   TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_hash    TEXT NOT NULL DEFAULT '',
+    country    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS clicks_short_url_clicked_at_idx ON clicks (short_url, clicked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS clicks;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE clicks
+ADD referrer_host TEXT NOT NULL DEFAULT '',
+ADD ua_family TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE clicks
+DROP COLUMN referrer_host,
+DROP COLUMN ua_family;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS click_sketches (
+    short_url TEXT NOT NULL,
+    day       DATE NOT NULL,
+    clicks    BIGINT NOT NULL DEFAULT 0,
+    sketch    BYTEA,
+    PRIMARY KEY (short_url, day)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS click_sketches;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE clicks
+ADD is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE click_sketches
+ADD is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+DROP CONSTRAINT click_sketches_pkey,
+ADD PRIMARY KEY (short_url, day, is_bot);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM click_sketches WHERE is_bot;
+
+ALTER TABLE click_sketches
+DROP CONSTRAINT click_sketches_pkey,
+DROP COLUMN is_bot,
+ADD PRIMARY KEY (short_url, day);
+
+ALTER TABLE clicks
+DROP COLUMN is_bot;
+-- +goose StatementEnd
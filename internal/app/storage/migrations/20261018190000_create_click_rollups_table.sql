@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS click_rollups (
+    granularity   TEXT NOT NULL,
+    bucket_start  TIMESTAMPTZ NOT NULL,
+    short_url     TEXT NOT NULL,
+    is_bot        BOOLEAN NOT NULL DEFAULT FALSE,
+    referrer_host TEXT NOT NULL DEFAULT '',
+    ua_family     TEXT NOT NULL DEFAULT '',
+    variant_id    TEXT NOT NULL DEFAULT '',
+    clicks        BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (granularity, short_url, bucket_start, is_bot, referrer_host, ua_family, variant_id)
+);
+
+CREATE INDEX IF NOT EXISTS click_rollups_granularity_bucket_start_idx ON click_rollups (granularity, bucket_start);
+
+CREATE TABLE IF NOT EXISTS click_rollup_state (
+    granularity  TEXT PRIMARY KEY,
+    rolled_up_to TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO click_rollup_state (granularity, rolled_up_to)
+VALUES ('hour', 'epoch'), ('day', 'epoch')
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS clicks_clicked_at_idx ON clicks (clicked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS clicks_clicked_at_idx;
+DROP TABLE IF EXISTS click_rollup_state;
+DROP TABLE IF EXISTS click_rollups;
+-- +goose StatementEnd
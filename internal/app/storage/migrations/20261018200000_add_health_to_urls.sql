@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls
+ADD health_status INTEGER,
+ADD health_error TEXT NOT NULL DEFAULT '',
+ADD health_broken BOOLEAN NOT NULL DEFAULT FALSE,
+ADD health_checked_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS urls_health_checked_at_idx ON urls (health_checked_at NULLS FIRST) WHERE is_deleted = FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS urls_health_checked_at_idx;
+
+ALTER TABLE urls
+DROP COLUMN health_status,
+DROP COLUMN health_error,
+DROP COLUMN health_broken,
+DROP COLUMN health_checked_at;
+-- +goose StatementEnd
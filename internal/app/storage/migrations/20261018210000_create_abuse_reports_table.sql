@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS abuse_reports (
+    id               BIGSERIAL PRIMARY KEY,
+    short_url        TEXT NOT NULL,
+    reason           TEXT NOT NULL,
+    comment          TEXT NOT NULL DEFAULT '',
+    reporter_ip_hash TEXT NOT NULL DEFAULT '',
+    status           TEXT NOT NULL DEFAULT 'open',
+    created_at       TIMESTAMPTZ NOT NULL,
+    resolved_at      TIMESTAMPTZ,
+    resolution_note  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS abuse_reports_status_id_idx ON abuse_reports (status, id);
+CREATE INDEX IF NOT EXISTS abuse_reports_short_url_idx ON abuse_reports (short_url, id);
+
+ALTER TABLE urls
+ADD takedown_reason TEXT NOT NULL DEFAULT '',
+ADD taken_down_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls
+DROP COLUMN takedown_reason,
+DROP COLUMN taken_down_at;
+
+DROP TABLE IF EXISTS abuse_reports;
+-- +goose StatementEnd
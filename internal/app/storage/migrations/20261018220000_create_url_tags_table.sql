@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls
+ADD title TEXT NOT NULL DEFAULT '',
+ADD description TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS url_tags (
+    short_url TEXT NOT NULL REFERENCES urls (short_url) ON DELETE CASCADE,
+    tag       TEXT NOT NULL,
+    PRIMARY KEY (short_url, tag)
+);
+
+CREATE INDEX IF NOT EXISTS url_tags_tag_idx ON url_tags (tag);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS url_tags;
+
+ALTER TABLE urls
+DROP COLUMN title,
+DROP COLUMN description;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE urls
+ADD created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+ADD domain TEXT NOT NULL DEFAULT '';
+
+UPDATE urls SET domain = lower(COALESCE(substring(original_url FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/?#]*@)?([^:/?#]+)'), ''));
+
+CREATE INDEX IF NOT EXISTS urls_user_id_created_at_idx ON urls (user_id, created_at, short_url);
+CREATE INDEX IF NOT EXISTS urls_user_id_domain_idx ON urls (user_id, domain);
+CREATE INDEX IF NOT EXISTS urls_original_url_trgm_idx ON urls USING gin (lower(original_url) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS urls_title_trgm_idx ON urls USING gin (lower(title) gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS urls_title_trgm_idx;
+DROP INDEX IF EXISTS urls_original_url_trgm_idx;
+DROP INDEX IF EXISTS urls_user_id_domain_idx;
+DROP INDEX IF EXISTS urls_user_id_created_at_idx;
+
+ALTER TABLE urls
+DROP COLUMN created_at,
+DROP COLUMN domain;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS jobs (
+    id               BIGSERIAL PRIMARY KEY,
+    user_id          TEXT NOT NULL,
+    kind             TEXT NOT NULL,
+    status           TEXT NOT NULL,
+    processed        INTEGER NOT NULL DEFAULT 0,
+    succeeded        INTEGER NOT NULL DEFAULT 0,
+    failed           INTEGER NOT NULL DEFAULT 0,
+    errors           JSONB NOT NULL DEFAULT '[]',
+    errors_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    error            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    finished_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS jobs_user_id_idx ON jobs (user_id, id);
+
+ALTER TABLE urls
+ADD expires_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls
+DROP COLUMN expires_at;
+
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls
+ADD deleted_at TIMESTAMPTZ;
+
+UPDATE urls SET deleted_at = now() WHERE is_deleted = TRUE;
+
+CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE is_deleted = TRUE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS urls_deleted_at_idx;
+
+ALTER TABLE urls
+DROP COLUMN deleted_at;
+-- +goose StatementEnd
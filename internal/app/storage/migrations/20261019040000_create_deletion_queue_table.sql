@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS deletion_queue (
+    id           BIGSERIAL PRIMARY KEY,
+    short_url    TEXT NOT NULL,
+    user_id      TEXT NOT NULL,
+    job_id       BIGINT NOT NULL DEFAULT 0,
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS deletion_queue_user_id_idx ON deletion_queue (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS deletion_queue;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE deletion_queue
+ADD error TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS deletion_dead_letters (
+    id        BIGINT PRIMARY KEY,
+    short_url TEXT NOT NULL,
+    user_id   TEXT NOT NULL,
+    job_id    BIGINT NOT NULL DEFAULT 0,
+    attempts  INTEGER NOT NULL DEFAULT 0,
+    error     TEXT NOT NULL DEFAULT '',
+    failed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS deletion_dead_letters_user_id_idx ON deletion_dead_letters (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS deletion_dead_letters;
+
+ALTER TABLE deletion_queue
+DROP COLUMN error;
+-- +goose StatementEnd
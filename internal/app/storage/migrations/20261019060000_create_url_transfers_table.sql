@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS url_transfers (
+    id           BIGSERIAL PRIMARY KEY,
+    token_hash   TEXT NOT NULL UNIQUE,
+    from_user_id TEXT NOT NULL,
+    to_user_id   TEXT NOT NULL DEFAULT '',
+    short_urls   JSONB NOT NULL DEFAULT '[]',
+    status       TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    accepted_at  TIMESTAMPTZ,
+    cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS url_transfers_from_user_id_idx ON url_transfers (from_user_id);
+CREATE INDEX IF NOT EXISTS url_transfers_to_user_id_idx ON url_transfers (to_user_id);
+
+CREATE TABLE IF NOT EXISTS url_ownership_audit (
+    id             BIGSERIAL PRIMARY KEY,
+    short_url      TEXT NOT NULL,
+    transfer_id    BIGINT NOT NULL,
+    from_user_id   TEXT NOT NULL,
+    to_user_id     TEXT NOT NULL,
+    transferred_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS url_ownership_audit_short_url_idx ON url_ownership_audit (short_url, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS url_ownership_audit;
+
+DROP TABLE IF EXISTS url_transfers;
+-- +goose StatementEnd
@@ -0,0 +1,62 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workspaces (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id BIGINT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id      TEXT NOT NULL,
+    role         TEXT NOT NULL,
+    joined_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE IF NOT EXISTS workspace_invites (
+    id           BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    role         TEXT NOT NULL,
+    token_hash   TEXT NOT NULL UNIQUE,
+    created_by   TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    accepted_by  TEXT NOT NULL DEFAULT '',
+    accepted_at  TIMESTAMPTZ
+);
+
+ALTER TABLE urls
+ADD workspace_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS urls_workspace_id_short_url_idx ON urls (workspace_id, short_url);
+
+ALTER TABLE deletion_queue
+ADD workspace_id BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE deletion_dead_letters
+ADD workspace_id BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE deletion_dead_letters
+DROP COLUMN workspace_id;
+
+ALTER TABLE deletion_queue
+DROP COLUMN workspace_id;
+
+DROP INDEX IF EXISTS urls_workspace_id_short_url_idx;
+
+ALTER TABLE urls
+DROP COLUMN workspace_id;
+
+DROP TABLE IF EXISTS workspace_invites;
+
+DROP TABLE IF EXISTS workspace_members;
+
+DROP TABLE IF EXISTS workspaces;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS collections (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+ALTER TABLE urls
+ADD collection_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS urls_collection_id_idx ON urls (collection_id) WHERE collection_id <> 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS urls_collection_id_idx;
+
+ALTER TABLE urls
+DROP COLUMN collection_id;
+
+DROP TABLE IF EXISTS collections;
+-- +goose StatementEnd
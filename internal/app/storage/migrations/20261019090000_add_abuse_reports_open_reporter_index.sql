@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE abuse_reports SET status = 'dismissed', resolution_note = 'duplicate', resolved_at = now()
+WHERE status = 'open' AND reporter_ip_hash <> '' AND id NOT IN (
+    SELECT min(id) FROM abuse_reports
+    WHERE status = 'open' AND reporter_ip_hash <> ''
+    GROUP BY short_url, reporter_ip_hash
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS abuse_reports_open_reporter_idx ON abuse_reports (short_url, reporter_ip_hash)
+WHERE status = 'open' AND reporter_ip_hash <> '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS abuse_reports_open_reporter_idx;
+-- +goose StatementEnd
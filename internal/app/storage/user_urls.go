@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+)
+
+// destinationDomain - возвращает хост урла назначения в нижнем регистре без точки в конце.
+func destinationDomain(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+}
+
+// matchDomain - проверяет, совпадает ли домен с доменом фильтра или является его поддоменом.
+func matchDomain(domain string, filterDomain string) bool {
+	return domain == filterDomain || strings.HasSuffix(domain, "."+filterDomain)
+}
+
+// matchUserURL - проверяет, подходит ли урл под фильтр выборки урлов пользователя или рабочего пространства.
+// Личная выборка пользователя не включает урлы рабочих пространств, которые он создал.
+func matchUserURL(data *models.URLsData, filter models.UserURLsFilter) bool {
+	if data.WorkspaceID != filter.WorkspaceID || (filter.WorkspaceID == 0 && data.UserID != filter.UserID) {
+		return false
+	}
+	if filter.CollectionID != 0 && data.CollectionID != filter.CollectionID {
+		return false
+	}
+
+	switch filter.State {
+	case models.URLStateActive:
+		if data.DeletedFlag {
+			return false
+		}
+	case models.URLStateDeleted:
+		if !data.DeletedFlag {
+			return false
+		}
+	}
+
+	if !filter.CreatedFrom.IsZero() && data.CreatedAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && !data.CreatedAt.Before(filter.CreatedTo) {
+		return false
+	}
+
+	if filter.Domain != "" && !matchDomain(destinationDomain(data.OriginalURL), filter.Domain) {
+		return false
+	}
+
+	if filter.Query != "" {
+		query := strings.ToLower(filter.Query)
+		if !strings.Contains(strings.ToLower(data.OriginalURL), query) && !strings.Contains(strings.ToLower(data.Title), query) {
+			return false
+		}
+	}
+
+	for _, tag := range filter.Tags {
+		found := false
+		for _, t := range data.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lessUserURL - порядок урлов пользователя по полю сортировки фильтра, при равенстве - по короткому урлу.
+func lessUserURL(a *models.URLsData, b *models.URLsData, filter models.UserURLsFilter) bool {
+	var cmp int
+	switch filter.SortBy {
+	case models.URLSortTitle:
+		cmp = strings.Compare(a.Title, b.Title)
+	case models.URLSortOriginalURL:
+		cmp = strings.Compare(a.OriginalURL, b.OriginalURL)
+	default:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(a.ShortURL, b.ShortURL)
+	}
+
+	if filter.SortDesc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// userURLsCursor - возвращает курсор, указывающий на урл в порядке сортировки фильтра.
+func userURLsCursor(data *models.URLsData, filter models.UserURLsFilter) *models.UserURLsCursor {
+	cursor := &models.UserURLsCursor{ShortURL: data.ShortURL}
+	switch filter.SortBy {
+	case models.URLSortTitle:
+		cursor.Key = data.Title
+	case models.URLSortOriginalURL:
+		cursor.Key = data.OriginalURL
+	default:
+		cursor.CreatedAt = data.CreatedAt
+	}
+	return cursor
+}
+
+// afterUserURLsCursor - проверяет, идет ли урл после курсора в порядке сортировки фильтра.
+func afterUserURLsCursor(data *models.URLsData, filter models.UserURLsFilter) bool {
+	if filter.After == nil {
+		return true
+	}
+	cursor := &models.URLsData{
+		ShortURL:    filter.After.ShortURL,
+		Title:       filter.After.Key,
+		OriginalURL: filter.After.Key,
+		CreatedAt:   filter.After.CreatedAt,
+	}
+	return lessUserURL(cursor, data, filter)
+}
+
+// escapeLike - экранирует спецсимволы шаблона LIKE.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectURLsFilter(t *testing.T) {
+	store, err := NewMapStorage()
+	assert.NoError(t, err)
+
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.InsertURLsDataBatch(context.Background(), []models.URLsData{
+		{ShortURL: "a", UserID: "u1", OriginalURL: "https://go.dev/doc", Title: "Go docs", Tags: []string{"go", "docs"}, CreatedAt: day},
+		{ShortURL: "b", UserID: "u1", OriginalURL: "https://pkg.go.dev/net/http", Title: "net/http", Tags: []string{"go"}, CreatedAt: day.Add(time.Hour)},
+		{ShortURL: "c", UserID: "u1", OriginalURL: "https://example.com/50%_off", Title: "Sale", CreatedAt: day.AddDate(0, 0, 1), DeletedFlag: true},
+		{ShortURL: "d", UserID: "u2", OriginalURL: "https://go.dev/blog", Title: "Go blog", Tags: []string{"go"}, CreatedAt: day},
+	}))
+
+	tests := []struct {
+		name   string
+		filter models.UserURLsFilter
+		want   []string
+	}{
+		{name: "All user urls newest first", filter: models.UserURLsFilter{SortDesc: true}, want: []string{"c", "b", "a"}},
+		{name: "Substring of title", filter: models.UserURLsFilter{Query: "DOCS"}, want: []string{"a"}},
+		{name: "Substring of original url", filter: models.UserURLsFilter{Query: "50%_"}, want: []string{"c"}},
+		{name: "All tags must match", filter: models.UserURLsFilter{Tags: []string{"go", "docs"}}, want: []string{"a"}},
+		{name: "Domain with subdomains", filter: models.UserURLsFilter{Domain: "go.dev"}, want: []string{"a", "b"}},
+		{name: "Created range", filter: models.UserURLsFilter{CreatedFrom: day.Add(time.Minute), CreatedTo: day.AddDate(0, 0, 1)}, want: []string{"b"}},
+		{name: "Active only", filter: models.UserURLsFilter{State: models.URLStateActive}, want: []string{"a", "b"}},
+		{name: "Deleted only", filter: models.UserURLsFilter{State: models.URLStateDeleted}, want: []string{"c"}},
+		{name: "Sort by title", filter: models.UserURLsFilter{SortBy: models.URLSortTitle}, want: []string{"a", "c", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.filter.UserID = "u1"
+			page, err := store.SelectURLs(context.Background(), test.filter)
+			assert.NoError(t, err)
+			assert.Nil(t, page.Next)
+
+			var got []string
+			for _, u := range page.URLs {
+				got = append(got, u.ShortURL)
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err = store.SelectURLs(context.Background(), models.UserURLsFilter{UserID: "u1", Query: "missing"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	filter := models.UserURLsFilter{UserID: "u1", SortBy: models.URLSortTitle, SortDesc: true, Limit: 2}
+	page, err := store.SelectURLs(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Len(t, page.URLs, 2)
+	assert.Equal(t, &models.UserURLsCursor{Key: "Sale", ShortURL: "c"}, page.Next)
+
+	filter.After = page.Next
+	page, err = store.SelectURLs(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Len(t, page.URLs, 1)
+	assert.Equal(t, "a", page.URLs[0].ShortURL)
+	assert.Nil(t, page.Next)
+}
@@ -0,0 +1,235 @@
+// Package urlpolicy проверяет хосты адресов назначения по спискам разрешенных и запрещенных доменов.
+package urlpolicy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nu-kotov/URLcompressor/internal/app/logger"
+	"go.uber.org/zap"
+)
+
+// Причины отклонения адреса назначения.
+const (
+	// ReasonDenied - хост попал в список запрещенных.
+	ReasonDenied = "denied"
+	// ReasonNotAllowed - список разрешенных задан, а хост в него не попал.
+	ReasonNotAllowed = "not_allowed"
+)
+
+// RejectionError - ошибка отклонения адреса назначения политикой доменов.
+// Rule - правило, по которому хост запрещен, пустое для ReasonNotAllowed.
+type RejectionError struct {
+	Host   string
+	Reason string
+	Rule   string
+}
+
+// Error - текст ошибки отклонения адреса назначения.
+func (e *RejectionError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("destination host %q is %s", e.Host, strings.ReplaceAll(e.Reason, "_", " "))
+	}
+	return fmt.Sprintf("destination host %q is %s by rule %q", e.Host, e.Reason, e.Rule)
+}
+
+// rule - правило списка доменов: точный хост, хост с поддоменами или регулярное выражение.
+type rule struct {
+	source  string
+	host    string
+	suffix  string
+	pattern *regexp.Regexp
+}
+
+// match - проверяет, подходит ли хост под правило.
+func (r rule) match(host string) bool {
+	switch {
+	case r.pattern != nil:
+		return r.pattern.MatchString(host)
+	case r.suffix != "":
+		return strings.HasSuffix(host, r.suffix)
+	default:
+		return host == r.host
+	}
+}
+
+// rules - разобранные списки разрешенных и запрещенных доменов.
+type rules struct {
+	allow []rule
+	deny  []rule
+}
+
+// Policy - политика доменов адресов назначения с перечитыванием файла при его изменении.
+// Нулевой указатель на Policy разрешает любые адреса.
+type Policy struct {
+	path    string
+	rules   atomic.Pointer[rules]
+	modTime time.Time
+	size    int64
+}
+
+// Load - загружает политику доменов из файла.
+//
+// Каждая строка файла - правило вида "allow <шаблон>" или "deny <шаблон>", где шаблон -
+// точный хост (example.com), хост с любыми поддоменами без самого домена (*.example.com)
+// или регулярное выражение по хосту между слешами (/^login-.*\.xyz$/).
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+// Запрещающие правила важнее разрешающих, если разрешающие заданы, остальные хосты запрещены.
+func Load(path string) (*Policy, error) {
+	p := &Policy{path: path}
+	if _, err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check - проверяет хост адреса назначения и возвращает *RejectionError, если он запрещен.
+// Адреса без хоста проверяются только по списку разрешенных.
+func (p *Policy) Check(rawURL string) error {
+	if p == nil {
+		return nil
+	}
+
+	host := ""
+	if parsed, err := url.Parse(strings.TrimSpace(rawURL)); err == nil {
+		host = strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	}
+
+	current := p.rules.Load()
+	for _, r := range current.deny {
+		if r.match(host) {
+			return &RejectionError{Host: host, Reason: ReasonDenied, Rule: r.source}
+		}
+	}
+	if len(current.allow) == 0 {
+		return nil
+	}
+	for _, r := range current.allow {
+		if r.match(host) {
+			return nil
+		}
+	}
+	return &RejectionError{Host: host, Reason: ReasonNotAllowed}
+}
+
+// Watch - проверяет файл политики каждые interval и перечитывает его при изменении, пока не отменен ctx.
+// Если новый файл не разбирается, остается действовать предыдущая политика.
+func (p *Policy) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := p.reload()
+		if err != nil {
+			logger.Log.Info("Failed to reload domain policy", zap.String("path", p.path), zap.Error(err))
+			continue
+		}
+		if reloaded {
+			logger.Log.Info("Domain policy reloaded", zap.String("path", p.path))
+		}
+	}
+}
+
+// reload - перечитывает файл политики, если он изменился с последней загрузки.
+// Вызывается из одной горутины.
+func (p *Policy) reload() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+	if p.rules.Load() != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return false, nil
+	}
+
+	file, err := os.Open(p.path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	parsed, err := parseRules(file)
+	if err != nil {
+		return false, fmt.Errorf("parsing domain policy %s error: %w", p.path, err)
+	}
+
+	p.rules.Store(parsed)
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+
+	return true, nil
+}
+
+// parseRules - разбирает правила политики доменов.
+func parseRules(r io.Reader) (*rules, error) {
+	parsed := &rules{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action, pattern, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"allow <pattern>\" or \"deny <pattern>\"", lineNum)
+		}
+
+		r, err := parseRule(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		switch strings.ToLower(action) {
+		case "allow":
+			parsed.allow = append(parsed.allow, r)
+		case "deny":
+			parsed.deny = append(parsed.deny, r)
+		default:
+			return nil, fmt.Errorf("line %d: unknown action %q", lineNum, action)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+// parseRule - разбирает шаблон правила.
+func parseRule(pattern string) (rule, error) {
+	switch {
+	case len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return rule{}, err
+		}
+		return rule{source: pattern, pattern: re}, nil
+	case strings.HasPrefix(pattern, "*."):
+		host := strings.ToLower(strings.TrimSuffix(pattern[2:], "."))
+		if host == "" || strings.Contains(host, "*") {
+			return rule{}, fmt.Errorf("invalid wildcard pattern %q", pattern)
+		}
+		return rule{source: pattern, suffix: "." + host}, nil
+	default:
+		host := strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if strings.ContainsAny(host, "*/ ") {
+			return rule{}, fmt.Errorf("invalid host pattern %q", pattern)
+		}
+		return rule{source: pattern, host: host}, nil
+	}
+}
@@ -0,0 +1,77 @@
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# Фишинг
+deny evil.com
+deny *.phish.io
+deny /^login-[a-z]+\.xyz$/
+`), 0o644))
+
+	policy, err := Load(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		url    string
+		reason string
+	}{
+		{name: "Allowed host", url: "https://practicum.yandex.ru/learn"},
+		{name: "Exact deny", url: "https://EVIL.com./path", reason: ReasonDenied},
+		{name: "Exact deny does not match subdomain", url: "https://www.evil.com"},
+		{name: "Wildcard deny", url: "http://a.b.phish.io", reason: ReasonDenied},
+		{name: "Wildcard deny does not match apex", url: "http://phish.io"},
+		{name: "Regex deny", url: "https://login-bank.xyz:8443/", reason: ReasonDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Check(test.url)
+			if test.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var rejection *RejectionError
+			require.True(t, errors.As(err, &rejection))
+			assert.Equal(t, test.reason, rejection.Reason)
+		})
+	}
+
+	var nilPolicy *Policy
+	assert.NoError(t, nilPolicy.Check("https://evil.com"))
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(path, []byte("allow *.example.com\n"), 0o644))
+
+	policy, err := Load(path)
+	require.NoError(t, err)
+	assert.NoError(t, policy.Check("https://docs.example.com"))
+	assert.Error(t, policy.Check("https://other.org"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go policy.Watch(ctx, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("allow *.example.com\nallow other.org\ndeny docs.example.com\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		return policy.Check("https://other.org") == nil && policy.Check("https://docs.example.com") != nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("block other.org\n"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, policy.Check("https://other.org"))
+}
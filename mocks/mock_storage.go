@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	models "github.com/nu-kotov/URLcompressor/internal/app/models"
@@ -35,6 +36,79 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// AcceptURLTransfer mocks base method.
+func (m *MockStorage) AcceptURLTransfer(ctx context.Context, id int64, toUserID string, acceptedAt time.Time) (*models.URLTransfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptURLTransfer", ctx, id, toUserID, acceptedAt)
+	ret0, _ := ret[0].(*models.URLTransfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptURLTransfer indicates an expected call of AcceptURLTransfer.
+func (mr *MockStorageMockRecorder) AcceptURLTransfer(ctx, id, toUserID, acceptedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptURLTransfer", reflect.TypeOf((*MockStorage)(nil).AcceptURLTransfer), ctx, id, toUserID, acceptedAt)
+}
+
+// AcceptWorkspaceInvite mocks base method.
+func (m *MockStorage) AcceptWorkspaceInvite(ctx context.Context, tokenHash, userID string, acceptedAt time.Time) (*models.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptWorkspaceInvite", ctx, tokenHash, userID, acceptedAt)
+	ret0, _ := ret[0].(*models.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptWorkspaceInvite indicates an expected call of AcceptWorkspaceInvite.
+func (mr *MockStorageMockRecorder) AcceptWorkspaceInvite(ctx, tokenHash, userID, acceptedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptWorkspaceInvite", reflect.TypeOf((*MockStorage)(nil).AcceptWorkspaceInvite), ctx, tokenHash, userID, acceptedAt)
+}
+
+// AckURLsDeletion mocks base method.
+func (m *MockStorage) AckURLsDeletion(ctx context.Context, ids []int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AckURLsDeletion", ctx, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AckURLsDeletion indicates an expected call of AckURLsDeletion.
+func (mr *MockStorageMockRecorder) AckURLsDeletion(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AckURLsDeletion", reflect.TypeOf((*MockStorage)(nil).AckURLsDeletion), ctx, ids)
+}
+
+// CancelURLTransfer mocks base method.
+func (m *MockStorage) CancelURLTransfer(ctx context.Context, id int64, cancelledAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelURLTransfer", ctx, id, cancelledAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelURLTransfer indicates an expected call of CancelURLTransfer.
+func (mr *MockStorageMockRecorder) CancelURLTransfer(ctx, id, cancelledAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelURLTransfer", reflect.TypeOf((*MockStorage)(nil).CancelURLTransfer), ctx, id, cancelledAt)
+}
+
+// ClaimURLsDeletion mocks base method.
+func (m *MockStorage) ClaimURLsDeletion(ctx context.Context, limit int, lease time.Duration) ([]models.URLForDeleteMsg, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimURLsDeletion", ctx, limit, lease)
+	ret0, _ := ret[0].([]models.URLForDeleteMsg)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimURLsDeletion indicates an expected call of ClaimURLsDeletion.
+func (mr *MockStorageMockRecorder) ClaimURLsDeletion(ctx, limit, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimURLsDeletion", reflect.TypeOf((*MockStorage)(nil).ClaimURLsDeletion), ctx, limit, lease)
+}
+
 // Close mocks base method.
 func (m *MockStorage) Close() error {
 	m.ctrl.T.Helper()
@@ -49,20 +123,176 @@ func (mr *MockStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
 }
 
-// DeleteURLs mocks base method.
-func (m *MockStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) error {
+// DeadLetterURLsDeletion mocks base method.
+func (m *MockStorage) DeadLetterURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteURLs", ctx, data)
+	ret := m.ctrl.Call(m, "DeadLetterURLsDeletion", ctx, msgs)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// DeadLetterURLsDeletion indicates an expected call of DeadLetterURLsDeletion.
+func (mr *MockStorageMockRecorder) DeadLetterURLsDeletion(ctx, msgs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetterURLsDeletion", reflect.TypeOf((*MockStorage)(nil).DeadLetterURLsDeletion), ctx, msgs)
+}
+
+// DeleteCollection mocks base method.
+func (m *MockStorage) DeleteCollection(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCollection", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCollection indicates an expected call of DeleteCollection.
+func (mr *MockStorageMockRecorder) DeleteCollection(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCollection", reflect.TypeOf((*MockStorage)(nil).DeleteCollection), ctx, id)
+}
+
+// DeleteURLs mocks base method.
+func (m *MockStorage) DeleteURLs(ctx context.Context, data []models.URLForDeleteMsg) ([]models.URLForDeleteMsg, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteURLs", ctx, data)
+	ret0, _ := ret[0].([]models.URLForDeleteMsg)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // DeleteURLs indicates an expected call of DeleteURLs.
 func (mr *MockStorageMockRecorder) DeleteURLs(ctx, data interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteURLs", reflect.TypeOf((*MockStorage)(nil).DeleteURLs), ctx, data)
 }
 
+// DeleteWorkspaceMember mocks base method.
+func (m *MockStorage) DeleteWorkspaceMember(ctx context.Context, workspaceID int64, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWorkspaceMember", ctx, workspaceID, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWorkspaceMember indicates an expected call of DeleteWorkspaceMember.
+func (mr *MockStorageMockRecorder) DeleteWorkspaceMember(ctx, workspaceID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWorkspaceMember", reflect.TypeOf((*MockStorage)(nil).DeleteWorkspaceMember), ctx, workspaceID, userID)
+}
+
+// EnqueueURLsDeletion mocks base method.
+func (m *MockStorage) EnqueueURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueURLsDeletion", ctx, msgs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueURLsDeletion indicates an expected call of EnqueueURLsDeletion.
+func (mr *MockStorageMockRecorder) EnqueueURLsDeletion(ctx, msgs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueURLsDeletion", reflect.TypeOf((*MockStorage)(nil).EnqueueURLsDeletion), ctx, msgs)
+}
+
+// EraseUserData mocks base method.
+func (m *MockStorage) EraseUserData(ctx context.Context, userID string, keepJobID int64) (*models.UserErasure, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUserData", ctx, userID, keepJobID)
+	ret0, _ := ret[0].(*models.UserErasure)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EraseUserData indicates an expected call of EraseUserData.
+func (mr *MockStorageMockRecorder) EraseUserData(ctx, userID, keepJobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUserData", reflect.TypeOf((*MockStorage)(nil).EraseUserData), ctx, userID, keepJobID)
+}
+
+// IncrementVariantServed mocks base method.
+func (m *MockStorage) IncrementVariantServed(ctx context.Context, shortURL, variantID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementVariantServed", ctx, shortURL, variantID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncrementVariantServed indicates an expected call of IncrementVariantServed.
+func (mr *MockStorageMockRecorder) IncrementVariantServed(ctx, shortURL, variantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementVariantServed", reflect.TypeOf((*MockStorage)(nil).IncrementVariantServed), ctx, shortURL, variantID)
+}
+
+// InsertAbuseReport mocks base method.
+func (m *MockStorage) InsertAbuseReport(ctx context.Context, report *models.AbuseReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertAbuseReport", ctx, report)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertAbuseReport indicates an expected call of InsertAbuseReport.
+func (mr *MockStorageMockRecorder) InsertAbuseReport(ctx, report interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertAbuseReport", reflect.TypeOf((*MockStorage)(nil).InsertAbuseReport), ctx, report)
+}
+
+// InsertClicks mocks base method.
+func (m *MockStorage) InsertClicks(ctx context.Context, clicks []models.ClickEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertClicks", ctx, clicks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertClicks indicates an expected call of InsertClicks.
+func (mr *MockStorageMockRecorder) InsertClicks(ctx, clicks interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertClicks", reflect.TypeOf((*MockStorage)(nil).InsertClicks), ctx, clicks)
+}
+
+// InsertCollection mocks base method.
+func (m *MockStorage) InsertCollection(ctx context.Context, collection *models.Collection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertCollection", ctx, collection)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertCollection indicates an expected call of InsertCollection.
+func (mr *MockStorageMockRecorder) InsertCollection(ctx, collection interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertCollection", reflect.TypeOf((*MockStorage)(nil).InsertCollection), ctx, collection)
+}
+
+// InsertJob mocks base method.
+func (m *MockStorage) InsertJob(ctx context.Context, job *models.Job) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertJob", ctx, job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertJob indicates an expected call of InsertJob.
+func (mr *MockStorageMockRecorder) InsertJob(ctx, job interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertJob", reflect.TypeOf((*MockStorage)(nil).InsertJob), ctx, job)
+}
+
+// InsertURLTransfer mocks base method.
+func (m *MockStorage) InsertURLTransfer(ctx context.Context, transfer *models.URLTransfer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertURLTransfer", ctx, transfer)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertURLTransfer indicates an expected call of InsertURLTransfer.
+func (mr *MockStorageMockRecorder) InsertURLTransfer(ctx, transfer interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertURLTransfer", reflect.TypeOf((*MockStorage)(nil).InsertURLTransfer), ctx, transfer)
+}
+
 // InsertURLsData mocks base method.
 func (m *MockStorage) InsertURLsData(ctx context.Context, data *models.URLsData) error {
 	m.ctrl.T.Helper()
@@ -91,6 +321,63 @@ func (mr *MockStorageMockRecorder) InsertURLsDataBatch(ctx, data interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertURLsDataBatch", reflect.TypeOf((*MockStorage)(nil).InsertURLsDataBatch), ctx, data)
 }
 
+// InsertWorkspace mocks base method.
+func (m *MockStorage) InsertWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspace", ctx, workspace)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWorkspace indicates an expected call of InsertWorkspace.
+func (mr *MockStorageMockRecorder) InsertWorkspace(ctx, workspace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspace", reflect.TypeOf((*MockStorage)(nil).InsertWorkspace), ctx, workspace)
+}
+
+// InsertWorkspaceInvite mocks base method.
+func (m *MockStorage) InsertWorkspaceInvite(ctx context.Context, invite *models.WorkspaceInvite) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWorkspaceInvite", ctx, invite)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertWorkspaceInvite indicates an expected call of InsertWorkspaceInvite.
+func (mr *MockStorageMockRecorder) InsertWorkspaceInvite(ctx, invite interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWorkspaceInvite", reflect.TypeOf((*MockStorage)(nil).InsertWorkspaceInvite), ctx, invite)
+}
+
+// ModifyJob mocks base method.
+func (m *MockStorage) ModifyJob(ctx context.Context, id int64, modify func(*models.Job)) (*models.Job, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ModifyJob", ctx, id, modify)
+	ret0, _ := ret[0].(*models.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ModifyJob indicates an expected call of ModifyJob.
+func (mr *MockStorageMockRecorder) ModifyJob(ctx, id, modify interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ModifyJob", reflect.TypeOf((*MockStorage)(nil).ModifyJob), ctx, id, modify)
+}
+
+// MoveURLsToCollection mocks base method.
+func (m *MockStorage) MoveURLsToCollection(ctx context.Context, userID string, shortURLs []string, fromCollectionID, collectionID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveURLsToCollection", ctx, userID, shortURLs, fromCollectionID, collectionID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MoveURLsToCollection indicates an expected call of MoveURLsToCollection.
+func (mr *MockStorageMockRecorder) MoveURLsToCollection(ctx, userID, shortURLs, fromCollectionID, collectionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveURLsToCollection", reflect.TypeOf((*MockStorage)(nil).MoveURLsToCollection), ctx, userID, shortURLs, fromCollectionID, collectionID)
+}
+
 // Ping mocks base method.
 func (m *MockStorage) Ping() error {
 	m.ctrl.T.Helper()
@@ -105,6 +392,228 @@ func (mr *MockStorageMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStorage)(nil).Ping))
 }
 
+// PurgeDeletedURLs mocks base method.
+func (m *MockStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeletedURLs", ctx, deletedBefore)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeletedURLs indicates an expected call of PurgeDeletedURLs.
+func (mr *MockStorageMockRecorder) PurgeDeletedURLs(ctx, deletedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeletedURLs", reflect.TypeOf((*MockStorage)(nil).PurgeDeletedURLs), ctx, deletedBefore)
+}
+
+// ResolveAbuseReports mocks base method.
+func (m *MockStorage) ResolveAbuseReports(ctx context.Context, resolution models.AbuseReportResolution) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveAbuseReports", ctx, resolution)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResolveAbuseReports indicates an expected call of ResolveAbuseReports.
+func (mr *MockStorageMockRecorder) ResolveAbuseReports(ctx, resolution interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveAbuseReports", reflect.TypeOf((*MockStorage)(nil).ResolveAbuseReports), ctx, resolution)
+}
+
+// RestoreURLs mocks base method.
+func (m *MockStorage) RestoreURLs(ctx context.Context, userID string, shortURLs []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreURLs", ctx, userID, shortURLs)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreURLs indicates an expected call of RestoreURLs.
+func (mr *MockStorageMockRecorder) RestoreURLs(ctx, userID, shortURLs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreURLs", reflect.TypeOf((*MockStorage)(nil).RestoreURLs), ctx, userID, shortURLs)
+}
+
+// RetryURLsDeletion mocks base method.
+func (m *MockStorage) RetryURLsDeletion(ctx context.Context, msgs []models.URLForDeleteMsg, retryAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetryURLsDeletion", ctx, msgs, retryAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetryURLsDeletion indicates an expected call of RetryURLsDeletion.
+func (mr *MockStorageMockRecorder) RetryURLsDeletion(ctx, msgs, retryAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetryURLsDeletion", reflect.TypeOf((*MockStorage)(nil).RetryURLsDeletion), ctx, msgs, retryAt)
+}
+
+// RollupClicks mocks base method.
+func (m *MockStorage) RollupClicks(ctx context.Context, policy models.ClicksRollupPolicy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RollupClicks", ctx, policy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollupClicks indicates an expected call of RollupClicks.
+func (mr *MockStorageMockRecorder) RollupClicks(ctx, policy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollupClicks", reflect.TypeOf((*MockStorage)(nil).RollupClicks), ctx, policy)
+}
+
+// SelectAbuseReport mocks base method.
+func (m *MockStorage) SelectAbuseReport(ctx context.Context, id int64) (*models.AbuseReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAbuseReport", ctx, id)
+	ret0, _ := ret[0].(*models.AbuseReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAbuseReport indicates an expected call of SelectAbuseReport.
+func (mr *MockStorageMockRecorder) SelectAbuseReport(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAbuseReport", reflect.TypeOf((*MockStorage)(nil).SelectAbuseReport), ctx, id)
+}
+
+// SelectAbuseReports mocks base method.
+func (m *MockStorage) SelectAbuseReports(ctx context.Context, filter models.AbuseReportsFilter) ([]models.AbuseReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAbuseReports", ctx, filter)
+	ret0, _ := ret[0].([]models.AbuseReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAbuseReports indicates an expected call of SelectAbuseReports.
+func (mr *MockStorageMockRecorder) SelectAbuseReports(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAbuseReports", reflect.TypeOf((*MockStorage)(nil).SelectAbuseReports), ctx, filter)
+}
+
+// SelectClickStats mocks base method.
+func (m *MockStorage) SelectClickStats(ctx context.Context, filter models.ClickStatsFilter) (*models.URLStatsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectClickStats", ctx, filter)
+	ret0, _ := ret[0].(*models.URLStatsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectClickStats indicates an expected call of SelectClickStats.
+func (mr *MockStorageMockRecorder) SelectClickStats(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectClickStats", reflect.TypeOf((*MockStorage)(nil).SelectClickStats), ctx, filter)
+}
+
+// SelectClicksPage mocks base method.
+func (m *MockStorage) SelectClicksPage(ctx context.Context, filter models.ClicksPageFilter) ([]models.ClickEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectClicksPage", ctx, filter)
+	ret0, _ := ret[0].([]models.ClickEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectClicksPage indicates an expected call of SelectClicksPage.
+func (mr *MockStorageMockRecorder) SelectClicksPage(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectClicksPage", reflect.TypeOf((*MockStorage)(nil).SelectClicksPage), ctx, filter)
+}
+
+// SelectCollection mocks base method.
+func (m *MockStorage) SelectCollection(ctx context.Context, id int64) (*models.Collection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectCollection", ctx, id)
+	ret0, _ := ret[0].(*models.Collection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectCollection indicates an expected call of SelectCollection.
+func (mr *MockStorageMockRecorder) SelectCollection(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectCollection", reflect.TypeOf((*MockStorage)(nil).SelectCollection), ctx, id)
+}
+
+// SelectCollectionClickStats mocks base method.
+func (m *MockStorage) SelectCollectionClickStats(ctx context.Context, collectionID int64, filter models.ClickStatsFilter) (*models.CollectionStatsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectCollectionClickStats", ctx, collectionID, filter)
+	ret0, _ := ret[0].(*models.CollectionStatsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectCollectionClickStats indicates an expected call of SelectCollectionClickStats.
+func (mr *MockStorageMockRecorder) SelectCollectionClickStats(ctx, collectionID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectCollectionClickStats", reflect.TypeOf((*MockStorage)(nil).SelectCollectionClickStats), ctx, collectionID, filter)
+}
+
+// SelectDeletionDeadLetters mocks base method.
+func (m *MockStorage) SelectDeletionDeadLetters(ctx context.Context, afterID int64, limit int) ([]models.DeletionDeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectDeletionDeadLetters", ctx, afterID, limit)
+	ret0, _ := ret[0].([]models.DeletionDeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectDeletionDeadLetters indicates an expected call of SelectDeletionDeadLetters.
+func (mr *MockStorageMockRecorder) SelectDeletionDeadLetters(ctx, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectDeletionDeadLetters", reflect.TypeOf((*MockStorage)(nil).SelectDeletionDeadLetters), ctx, afterID, limit)
+}
+
+// SelectDeletionQueueStats mocks base method.
+func (m *MockStorage) SelectDeletionQueueStats(ctx context.Context) (*models.DeletionQueueStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectDeletionQueueStats", ctx)
+	ret0, _ := ret[0].(*models.DeletionQueueStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectDeletionQueueStats indicates an expected call of SelectDeletionQueueStats.
+func (mr *MockStorageMockRecorder) SelectDeletionQueueStats(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectDeletionQueueStats", reflect.TypeOf((*MockStorage)(nil).SelectDeletionQueueStats), ctx)
+}
+
+// SelectExistingShortURLs mocks base method.
+func (m *MockStorage) SelectExistingShortURLs(ctx context.Context, shortURLs []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectExistingShortURLs", ctx, shortURLs)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectExistingShortURLs indicates an expected call of SelectExistingShortURLs.
+func (mr *MockStorageMockRecorder) SelectExistingShortURLs(ctx, shortURLs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectExistingShortURLs", reflect.TypeOf((*MockStorage)(nil).SelectExistingShortURLs), ctx, shortURLs)
+}
+
+// SelectJob mocks base method.
+func (m *MockStorage) SelectJob(ctx context.Context, id int64) (*models.Job, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectJob", ctx, id)
+	ret0, _ := ret[0].(*models.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectJob indicates an expected call of SelectJob.
+func (mr *MockStorageMockRecorder) SelectJob(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectJob", reflect.TypeOf((*MockStorage)(nil).SelectJob), ctx, id)
+}
+
 // SelectOriginalURLByShortURL mocks base method.
 func (m *MockStorage) SelectOriginalURLByShortURL(ctx context.Context, shortURL string) (string, error) {
 	m.ctrl.T.Helper()
@@ -120,19 +629,94 @@ func (mr *MockStorageMockRecorder) SelectOriginalURLByShortURL(ctx, shortURL int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectOriginalURLByShortURL", reflect.TypeOf((*MockStorage)(nil).SelectOriginalURLByShortURL), ctx, shortURL)
 }
 
+// SelectStaleJobs mocks base method.
+func (m *MockStorage) SelectStaleJobs(ctx context.Context, kind string, updatedBefore time.Time) ([]models.Job, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectStaleJobs", ctx, kind, updatedBefore)
+	ret0, _ := ret[0].([]models.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectStaleJobs indicates an expected call of SelectStaleJobs.
+func (mr *MockStorageMockRecorder) SelectStaleJobs(ctx, kind, updatedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectStaleJobs", reflect.TypeOf((*MockStorage)(nil).SelectStaleJobs), ctx, kind, updatedBefore)
+}
+
+// SelectURLData mocks base method.
+func (m *MockStorage) SelectURLData(ctx context.Context, shortURL string) (*models.URLsData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectURLData", ctx, shortURL)
+	ret0, _ := ret[0].(*models.URLsData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectURLData indicates an expected call of SelectURLData.
+func (mr *MockStorageMockRecorder) SelectURLData(ctx, shortURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLData", reflect.TypeOf((*MockStorage)(nil).SelectURLData), ctx, shortURL)
+}
+
+// SelectURLOwnershipAudit mocks base method.
+func (m *MockStorage) SelectURLOwnershipAudit(ctx context.Context, shortURL string) ([]models.URLOwnershipAudit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectURLOwnershipAudit", ctx, shortURL)
+	ret0, _ := ret[0].([]models.URLOwnershipAudit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectURLOwnershipAudit indicates an expected call of SelectURLOwnershipAudit.
+func (mr *MockStorageMockRecorder) SelectURLOwnershipAudit(ctx, shortURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLOwnershipAudit", reflect.TypeOf((*MockStorage)(nil).SelectURLOwnershipAudit), ctx, shortURL)
+}
+
+// SelectURLTransfer mocks base method.
+func (m *MockStorage) SelectURLTransfer(ctx context.Context, id int64) (*models.URLTransfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectURLTransfer", ctx, id)
+	ret0, _ := ret[0].(*models.URLTransfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectURLTransfer indicates an expected call of SelectURLTransfer.
+func (mr *MockStorageMockRecorder) SelectURLTransfer(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLTransfer", reflect.TypeOf((*MockStorage)(nil).SelectURLTransfer), ctx, id)
+}
+
+// SelectURLTransferByTokenHash mocks base method.
+func (m *MockStorage) SelectURLTransferByTokenHash(ctx context.Context, tokenHash string) (*models.URLTransfer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectURLTransferByTokenHash", ctx, tokenHash)
+	ret0, _ := ret[0].(*models.URLTransfer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectURLTransferByTokenHash indicates an expected call of SelectURLTransferByTokenHash.
+func (mr *MockStorageMockRecorder) SelectURLTransferByTokenHash(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLTransferByTokenHash", reflect.TypeOf((*MockStorage)(nil).SelectURLTransferByTokenHash), ctx, tokenHash)
+}
+
 // SelectURLs mocks base method.
-func (m *MockStorage) SelectURLs(ctx context.Context, userID string) ([]models.GetUserURLsResponse, error) {
+func (m *MockStorage) SelectURLs(ctx context.Context, filter models.UserURLsFilter) (*models.UserURLsPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SelectURLs", ctx, userID)
-	ret0, _ := ret[0].([]models.GetUserURLsResponse)
+	ret := m.ctrl.Call(m, "SelectURLs", ctx, filter)
+	ret0, _ := ret[0].(*models.UserURLsPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SelectURLs indicates an expected call of SelectURLs.
-func (mr *MockStorageMockRecorder) SelectURLs(ctx, userID interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) SelectURLs(ctx, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLs", reflect.TypeOf((*MockStorage)(nil).SelectURLs), ctx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLs", reflect.TypeOf((*MockStorage)(nil).SelectURLs), ctx, filter)
 }
 
 // SelectURLsCount mocks base method.
@@ -150,6 +734,66 @@ func (mr *MockStorageMockRecorder) SelectURLsCount(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLsCount", reflect.TypeOf((*MockStorage)(nil).SelectURLsCount), ctx)
 }
 
+// SelectURLsForHealthCheck mocks base method.
+func (m *MockStorage) SelectURLsForHealthCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]models.URLsData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectURLsForHealthCheck", ctx, checkedBefore, limit)
+	ret0, _ := ret[0].([]models.URLsData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectURLsForHealthCheck indicates an expected call of SelectURLsForHealthCheck.
+func (mr *MockStorageMockRecorder) SelectURLsForHealthCheck(ctx, checkedBefore, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectURLsForHealthCheck", reflect.TypeOf((*MockStorage)(nil).SelectURLsForHealthCheck), ctx, checkedBefore, limit)
+}
+
+// SelectUserCollections mocks base method.
+func (m *MockStorage) SelectUserCollections(ctx context.Context, userID string) ([]models.Collection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserCollections", ctx, userID)
+	ret0, _ := ret[0].([]models.Collection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserCollections indicates an expected call of SelectUserCollections.
+func (mr *MockStorageMockRecorder) SelectUserCollections(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserCollections", reflect.TypeOf((*MockStorage)(nil).SelectUserCollections), ctx, userID)
+}
+
+// SelectUserURLsData mocks base method.
+func (m *MockStorage) SelectUserURLsData(ctx context.Context, userID, afterShortURL string, limit int) ([]models.URLsData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserURLsData", ctx, userID, afterShortURL, limit)
+	ret0, _ := ret[0].([]models.URLsData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserURLsData indicates an expected call of SelectUserURLsData.
+func (mr *MockStorageMockRecorder) SelectUserURLsData(ctx, userID, afterShortURL, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserURLsData", reflect.TypeOf((*MockStorage)(nil).SelectUserURLsData), ctx, userID, afterShortURL, limit)
+}
+
+// SelectUserWorkspaces mocks base method.
+func (m *MockStorage) SelectUserWorkspaces(ctx context.Context, userID string) ([]models.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectUserWorkspaces", ctx, userID)
+	ret0, _ := ret[0].([]models.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectUserWorkspaces indicates an expected call of SelectUserWorkspaces.
+func (mr *MockStorageMockRecorder) SelectUserWorkspaces(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUserWorkspaces", reflect.TypeOf((*MockStorage)(nil).SelectUserWorkspaces), ctx, userID)
+}
+
 // SelectUsersCount mocks base method.
 func (m *MockStorage) SelectUsersCount(ctx context.Context) (int, error) {
 	m.ctrl.T.Helper()
@@ -164,3 +808,133 @@ func (mr *MockStorageMockRecorder) SelectUsersCount(ctx interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectUsersCount", reflect.TypeOf((*MockStorage)(nil).SelectUsersCount), ctx)
 }
+
+// SelectWorkspace mocks base method.
+func (m *MockStorage) SelectWorkspace(ctx context.Context, id int64) (*models.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWorkspace", ctx, id)
+	ret0, _ := ret[0].(*models.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectWorkspace indicates an expected call of SelectWorkspace.
+func (mr *MockStorageMockRecorder) SelectWorkspace(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWorkspace", reflect.TypeOf((*MockStorage)(nil).SelectWorkspace), ctx, id)
+}
+
+// SelectWorkspaceMember mocks base method.
+func (m *MockStorage) SelectWorkspaceMember(ctx context.Context, workspaceID int64, userID string) (*models.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWorkspaceMember", ctx, workspaceID, userID)
+	ret0, _ := ret[0].(*models.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectWorkspaceMember indicates an expected call of SelectWorkspaceMember.
+func (mr *MockStorageMockRecorder) SelectWorkspaceMember(ctx, workspaceID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWorkspaceMember", reflect.TypeOf((*MockStorage)(nil).SelectWorkspaceMember), ctx, workspaceID, userID)
+}
+
+// SelectWorkspaceMembers mocks base method.
+func (m *MockStorage) SelectWorkspaceMembers(ctx context.Context, workspaceID int64) ([]models.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectWorkspaceMembers", ctx, workspaceID)
+	ret0, _ := ret[0].([]models.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectWorkspaceMembers indicates an expected call of SelectWorkspaceMembers.
+func (mr *MockStorageMockRecorder) SelectWorkspaceMembers(ctx, workspaceID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectWorkspaceMembers", reflect.TypeOf((*MockStorage)(nil).SelectWorkspaceMembers), ctx, workspaceID)
+}
+
+// UpdateCollection mocks base method.
+func (m *MockStorage) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCollection", ctx, collection)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateCollection indicates an expected call of UpdateCollection.
+func (mr *MockStorageMockRecorder) UpdateCollection(ctx, collection interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCollection", reflect.TypeOf((*MockStorage)(nil).UpdateCollection), ctx, collection)
+}
+
+// UpdateJob mocks base method.
+func (m *MockStorage) UpdateJob(ctx context.Context, job *models.Job) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateJob", ctx, job)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateJob indicates an expected call of UpdateJob.
+func (mr *MockStorageMockRecorder) UpdateJob(ctx, job interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateJob", reflect.TypeOf((*MockStorage)(nil).UpdateJob), ctx, job)
+}
+
+// UpdateURLHealth mocks base method.
+func (m *MockStorage) UpdateURLHealth(ctx context.Context, shortURL string, health models.URLHealth) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateURLHealth", ctx, shortURL, health)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateURLHealth indicates an expected call of UpdateURLHealth.
+func (mr *MockStorageMockRecorder) UpdateURLHealth(ctx, shortURL, health interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateURLHealth", reflect.TypeOf((*MockStorage)(nil).UpdateURLHealth), ctx, shortURL, health)
+}
+
+// UpdateURLMetadata mocks base method.
+func (m *MockStorage) UpdateURLMetadata(ctx context.Context, shortURL string, metadata models.URLMetadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateURLMetadata", ctx, shortURL, metadata)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateURLMetadata indicates an expected call of UpdateURLMetadata.
+func (mr *MockStorageMockRecorder) UpdateURLMetadata(ctx, shortURL, metadata interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateURLMetadata", reflect.TypeOf((*MockStorage)(nil).UpdateURLMetadata), ctx, shortURL, metadata)
+}
+
+// UpdateURLTakedown mocks base method.
+func (m *MockStorage) UpdateURLTakedown(ctx context.Context, shortURL string, takedown *models.URLTakedown) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateURLTakedown", ctx, shortURL, takedown)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateURLTakedown indicates an expected call of UpdateURLTakedown.
+func (mr *MockStorageMockRecorder) UpdateURLTakedown(ctx, shortURL, takedown interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateURLTakedown", reflect.TypeOf((*MockStorage)(nil).UpdateURLTakedown), ctx, shortURL, takedown)
+}
+
+// UpdateWorkspaceMemberRole mocks base method.
+func (m *MockStorage) UpdateWorkspaceMemberRole(ctx context.Context, workspaceID int64, userID, role string) (*models.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWorkspaceMemberRole", ctx, workspaceID, userID, role)
+	ret0, _ := ret[0].(*models.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateWorkspaceMemberRole indicates an expected call of UpdateWorkspaceMemberRole.
+func (mr *MockStorageMockRecorder) UpdateWorkspaceMemberRole(ctx, workspaceID, userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWorkspaceMemberRole", reflect.TypeOf((*MockStorage)(nil).UpdateWorkspaceMemberRole), ctx, workspaceID, userID, role)
+}